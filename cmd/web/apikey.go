@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// apiKeyUsage - описание использования подкоманды apikey.
+const apiKeyUsage = "usage: apikey create -name=<name> -role=<role> [-ttl=<duration>] | list | revoke -id=<id>"
+
+// runAPIKey - выполнение подкоманды apikey: создание, получение и отзыв ключей API в хранилище.
+// Позволяет создать первый ключ с ролью admin, через который остальными ключами можно управлять по API.
+//
+// Принимает: контекст, хранилище ключей API, аргументы подкоманды (create, list или revoke и их флаги) и поток вывода.
+//
+// Возвращает: ошибку.
+func runAPIKey(ctx context.Context, store models.APIKeyStore, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	fs := flag.NewFlagSet("apikey "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	switch args[0] {
+	case "create":
+		name := fs.String("name", "", "Key name, e.g. the consumer it is issued to")
+		role := fs.String("role", string(auth.RoleReader), "Key role: reader, editor or admin")
+		ttl := fs.Duration("ttl", 0, "Key lifetime (0 for a key that never expires)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" || !auth.ValidRole(auth.Role(*role)) || *ttl < 0 {
+			return errors.New("name must not be empty, role must be reader, editor or admin and ttl must not be negative")
+		}
+
+		creation := models.APIKeyCreation{Name: *name, Role: *role}
+		if *ttl > 0 {
+			expiresAt := time.Now().Add(*ttl)
+			creation.ExpiresAt = &expiresAt
+		}
+		key, err := usersegmentation.CreateAPIKey(ctx, store, creation)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created API key %d (%s), the secret is shown only once:\n%s\n", key.ID, key.Prefix, key.Secret)
+	case "list":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		keys, err := store.GetAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tROLE\tSTATUS\tEXPIRES\tLAST USED\tUSAGE")
+		now := time.Now()
+		for _, key := range keys {
+			status := "active"
+			switch {
+			case key.RevokedAt != nil:
+				status = "revoked"
+			case !key.Active(now):
+				status = "expired"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", key.ID, key.Name, key.Prefix, key.Role, status, formatTime(key.ExpiresAt), formatTime(key.LastUsedAt), key.UsageCount)
+		}
+		return w.Flush()
+	case "revoke":
+		id := fs.Int("id", 0, "ID of the key")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := store.RevokeAPIKey(ctx, *id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Revoked API key %d\n", *id)
+	default:
+		return fmt.Errorf("unknown apikey command %q: %s", args[0], apiKeyUsage)
+	}
+
+	return nil
+}
+
+// formatTime - форматирование необязательного времени для вывода.
+//
+// Принимает: время (nil - не задано).
+//
+// Возвращает: время в формате RFC 3339 или "-".
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/famusovsky/AvitoTestTask/internal/config"
+)
+
+// runConfig - выполнение подкоманды config.
+//
+// Принимает: настройки, аргументы подкоманды (print) и поток вывода.
+//
+// Возвращает: ошибку.
+func runConfig(cfg config.Config, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: config print")
+	}
+
+	switch args[0] {
+	case "print":
+		return cfg.Print(out)
+	default:
+		return fmt.Errorf("unknown config command %q: usage: config print", args[0])
+	}
+}
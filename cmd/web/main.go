@@ -1,41 +1,201 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/famusovsky/AvitoTestTask/docs"
+	"github.com/famusovsky/AvitoTestTask/internal/config"
 	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/cache"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/memory"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/metrics"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
 	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/postgres"
 	"github.com/famusovsky/AvitoTestTask/pkg/db"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
 	_ "github.com/lib/pq"
 )
 
 // XXX DO NOT FORGET ABOUT COMMENTS
-// TODO normal logging
+
+// Коды завершения программы.
+const (
+	exitOK              = 0 // exitOK - программа завершила работу без ошибок.
+	exitError           = 1 // exitError - ошибка запуска или работы программы.
+	exitShutdownTimeout = 3 // exitShutdownTimeout - обработка запросов или фоновые процессы не завершились за отведённое время.
+)
 
 // @title User Segmentation API
 // @description This is a User Segmentation API server, made for Avito Backend Trainee Assignment 2023.
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT signed with HMAC, passed as "Bearer <token>". The "roles" claim grants reader, editor or admin access.
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key created by an admin via /api-keys. The key grants the role it was created with.
 func main() {
-	addr := flag.String("addr", ":8080", "HTTP address")
-	createTables := flag.Bool("create_tables", false, "Create tables in database")
-	flag.Parse()
-
-	logger := log.New(os.Stdout, "LOG\t", log.Ldate|log.Ltime)
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitOK)
+	}
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %s\n", err)
+		os.Exit(exitError)
+	}
 
-	db, err := db.OpenViaEnvVars("postgres")
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
 	if err != nil {
-		logger.Fatal(err)
+		slog.Error(err.Error())
+		os.Exit(exitError)
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = run(ctx, cfg, args, logger)
+	switch {
+	case err == nil:
+		os.Exit(exitOK)
+	case errors.Is(err, usersegmentation.ErrShutdownTimeout):
+		logger.Error(err.Error())
+		os.Exit(exitShutdownTimeout)
+	default:
+		logger.Error(err.Error())
+		os.Exit(exitError)
 	}
-	defer db.Close()
+}
 
-	dbProcessor, err := postgres.GetModel(db, *createTables)
+// run - запуск программы.
+// Программа работает, пока не будет отменён контекст ctx (при получении SIGINT или SIGTERM), после чего пул соединений с БД закрывается.
+//
+// Принимает: контекст, настройки, аргументы командной строки после флагов (подкоманда) и логгер.
+//
+// Возвращает: ошибку.
+func run(ctx context.Context, cfg config.Config, args []string, logger *slog.Logger) error {
+	if len(args) > 0 && args[0] == "config" {
+		return runConfig(cfg, args[1:], os.Stdout)
+	}
+	if len(args) > 0 && args[0] == "token" {
+		return runToken(cfg, args[1:], os.Stdout)
+	}
+
+	jwt, err := cfg.Auth.JWT()
 	if err != nil {
-		logger.Fatal(err)
+		return err
+	}
+	if jwt == nil && !cfg.Auth.APIKeys {
+		logger.Warn("authentication is disabled: any client can modify and delete segments")
+	}
+
+	var m *metrics.Metrics
+	if cfg.Features.Metrics {
+		m = metrics.New()
+	}
+
+	var (
+		dbProcessor  models.UserSegmentationDbProcessor
+		apiKeys      models.APIKeyStore
+		healthChecks = make(map[string]usersegmentation.HealthCheck)
+	)
+	switch cfg.Storage {
+	case "postgres":
+		dsn, err := cfg.DB.ConnString()
+		if err != nil {
+			return err
+		}
+		db, err := db.Open(ctx, "postgres", dsn, cfg.DB.Options())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				logger.Error("error while closing the database", "error", err)
+			}
+		}()
+
+		if len(args) > 0 && args[0] == "migrate" {
+			return runMigrate(db, args[1:], os.Stdout)
+		}
+
+		dbProcessor, err = postgres.GetModel(db, cfg.Migrate, cfg.Features.StrictUsers)
+		if err != nil {
+			return err
+		}
+		if cfg.Auth.APIKeys || (len(args) > 0 && args[0] == "apikey") {
+			apiKeys = postgres.GetAPIKeyStore(db)
+		}
+		if len(args) > 0 && args[0] == "apikey" {
+			return runAPIKey(ctx, apiKeys, args[1:], os.Stdout)
+		}
+		if m != nil {
+			if err = m.RegisterDB(db, "postgres"); err != nil {
+				return err
+			}
+		}
+		healthChecks["postgres"] = func(ctx context.Context) error {
+			return postgres.CheckHealth(ctx, db)
+		}
+	case "memory":
+		if len(args) > 0 && args[0] == "migrate" {
+			return errors.New("migrations are only supported by postgres storage")
+		}
+		if len(args) > 0 && args[0] == "apikey" {
+			return errors.New("api keys can only be managed from the command line with postgres storage")
+		}
+		logger.Warn("using in-memory storage: data will be lost on exit")
+		dbProcessor = memory.GetModel(cfg.Features.StrictUsers)
+		if cfg.Auth.APIKeys {
+			apiKeys = memory.NewAPIKeyStore()
+			if jwt == nil {
+				logger.Warn("api keys are stored in memory and auth is disabled: no api key can be created, so all requests will be rejected")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown storage %q: must be memory or postgres", cfg.Storage)
+	}
+	if m != nil {
+		dbProcessor = m.Instrument(dbProcessor)
+	}
+	if cfg.Cache.Enabled {
+		c := cache.New(dbProcessor, cache.Options{Size: cfg.Cache.Size, TTL: time.Duration(cfg.Cache.TTL)})
+		if m != nil {
+			if err = m.RegisterCache(c); err != nil {
+				return err
+			}
+		}
+		dbProcessor = c
 	}
 
-	app := usersegmentation.CreateApp(logger, dbProcessor)
+	app := usersegmentation.CreateApp(logger, dbProcessor, usersegmentation.Options{
+		ExpiryInterval:  time.Duration(cfg.Workers.ExpiryInterval),
+		PurgeRetention:  time.Duration(cfg.Workers.PurgeRetention),
+		Timeout:         time.Duration(cfg.Timeouts.Request),
+		Timeouts:        cfg.Timeouts.Routes,
+		Metrics:         m,
+		StatsInterval:   time.Duration(cfg.Workers.StatsInterval),
+		HealthChecks:    healthChecks,
+		ReadyCacheTTL:   time.Duration(cfg.Timeouts.ReadyCacheTTL),
+		DrainDelay:      time.Duration(cfg.Timeouts.DrainDelay),
+		ShutdownTimeout: time.Duration(cfg.Timeouts.Shutdown),
+		Auth:            jwt,
+		APIKeys:         apiKeys,
+		RateLimits:      cfg.RateLimit.Limits(),
+		GRPCAddr:        cfg.GRPCAddr,
+	})
 
-	app.Run(*addr)
+	return app.Run(ctx, cfg.Addr)
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/postgres"
+)
+
+// runMigrate - выполнение подкоманды migrate.
+//
+// Принимает: указатель на базу данных, аргументы подкоманды (up, down или status) и поток вывода.
+//
+// Возвращает: ошибку.
+func runMigrate(db *sql.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status")
+	}
+
+	switch args[0] {
+	case "up":
+		version, err := postgres.MigrateUp(db)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Schema version: %d\n", version)
+	case "down":
+		version, err := postgres.MigrateDown(db)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Schema version: %d\n", version)
+	case "status":
+		statuses, err := postgres.GetMigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied at " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		fmt.Fprintf(out, "Expected schema version: %d\n", postgres.SchemaVersion())
+	default:
+		return fmt.Errorf("unknown migrate command %q: usage: migrate up|down|status", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/config"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+)
+
+// runToken - выполнение подкоманды token: выпуск токена клиента, подписанного одним из ключей auth.keys.
+//
+// Принимает: настройки, аргументы подкоманды (-subject, -roles, -ttl, -key) и поток вывода.
+//
+// Возвращает: ошибку.
+func runToken(cfg config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	fs.SetOutput(out)
+	subject := fs.String("subject", "", "Client identifier (sub claim)")
+	roles := fs.String("roles", string(auth.RoleReader), "Comma-separated roles of the client: reader, editor or admin")
+	ttl := fs.Duration("ttl", 24*time.Hour, "Token lifetime")
+	keyID := fs.String("key", "", "ID of the signing key (the first one in alphabetical order by default)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	jwt, err := cfg.Auth.NewJWT()
+	if err != nil {
+		return err
+	}
+	principal := auth.Principal{Subject: *subject}
+	for _, role := range strings.Split(*roles, ",") {
+		principal.Roles = append(principal.Roles, auth.Role(strings.TrimSpace(role)))
+	}
+
+	token, err := jwt.Issue(*keyID, principal, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, token)
+
+	return nil
+}
@@ -16,9 +16,76 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/segments": {
+        "/api-keys": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get all API keys ordered by ID, including revoked and expired ones, with their usage count and last usage time.\nSecrets of the keys are not returned.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "API keys"
+                ],
+                "summary": "Returns API keys.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.APIKey"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            },
             "post": {
-                "description": "Add segment with the specified slug to DB and get it's ID.",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Create an API key with the specified name and role. The secret of the key is returned only in this response:\nonly its hash is stored, so the secret can not be shown again. The secret is passed in the X-API-Key header.",
                 "consumes": [
                     "application/json"
                 ],
@@ -26,25 +93,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Segments"
+                    "API keys"
                 ],
-                "summary": "Adds segment to DB.",
+                "summary": "Creates API key.",
                 "parameters": [
                     {
-                        "description": "Segment slug",
-                        "name": "slug",
+                        "description": "Key name, role (reader, editor or admin) and optional expiration time",
+                        "name": "key",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Segment"
+                            "$ref": "#/definitions/models.APIKeyCreation"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/models.ID"
+                            "$ref": "#/definitions/models.CreatedAPIKey"
                         }
                     },
                     "400": {
@@ -53,35 +120,64 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.Err"
                         }
                     },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.Err"
                         }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
                     }
                 }
-            },
+            }
+        },
+        "/api-keys/{id}": {
             "delete": {
-                "description": "Delete segment with the specified slug from DB.",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
                 ],
+                "description": "Revoke the API key with the specified ID: requests with it are rejected from now on. The key stays in the list of keys.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Segments"
+                    "API keys"
                 ],
-                "summary": "Deletes segment from DB.",
+                "summary": "Revokes API key.",
                 "parameters": [
                     {
-                        "description": "Segment slug",
-                        "name": "slug",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Segment"
-                        }
+                        "type": "integer",
+                        "description": "API key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -97,18 +193,54 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.Err"
                         }
                     },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.Err"
                         }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
                     }
                 }
-            }
-        },
-        "/users": {
+            },
             "patch": {
-                "description": "Append and remove user with the specified ID to/from segments.",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Set the expiration time of the API key with the specified ID. If \"expires_at\" is null, the key never expires.",
                 "consumes": [
                     "application/json"
                 ],
@@ -116,17 +248,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "API keys"
                 ],
-                "summary": "Modifies user's relations with segments.",
+                "summary": "Sets API key expiration time.",
                 "parameters": [
                     {
-                        "description": "User modification parameters",
-                        "name": "params",
+                        "type": "integer",
+                        "description": "API key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New expiration time",
+                        "name": "expiry",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.UserModification"
+                            "$ref": "#/definitions/models.APIKeyExpiry"
                         }
                     }
                 ],
@@ -143,42 +282,98 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.Err"
                         }
                     },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.Err"
                         }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
                     }
                 }
             }
         },
-        "/users/{id}": {
+        "/healthz": {
             "get": {
-                "description": "Get a list of segments in which the user with the specified ID is located.",
+                "description": "Always returns \"ok\" while the process is able to handle requests; the state of the storage is not checked.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Health"
                 ],
-                "summary": "Returns segments in which the user is located.",
+                "summary": "Returns liveness of the service.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Health"
+                        }
+                    }
+                }
+            }
+        },
+        "/history/{period}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get a CSV report of all additions and removals of users to/from segments during the specified month.",
+                "produces": [
+                    "text/csv",
+                    "application/json"
+                ],
+                "tags": [
+                    "History"
+                ],
+                "summary": "Returns CSV report of users' segments history.",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
+                        "type": "string",
+                        "description": "Year and month in format YYYY-MM",
+                        "name": "period",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "CSV report: user_id,segment,operation,time",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Segment"
-                            }
+                            "type": "string"
                         }
                     },
                     "400": {
@@ -187,58 +382,1566 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.Err"
                         }
                     },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/models.Err"
                         }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.Err": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "description": "Text - текст ошибки.",
-                    "type": "string"
-                }
-            }
-        },
-        "models.ID": {
-            "type": "object",
-            "properties": {
-                "id": {
-                    "description": "Value - id.",
-                    "type": "integer"
-                }
-            }
         },
-        "models.Segment": {
-            "type": "object",
-            "properties": {
-                "slug": {
-                    "description": "Slug - название сегмента.",
-                    "type": "string"
+        "/readyz": {
+            "get": {
+                "description": "Check the components of the service (e.g. database availability and schema version) and report their statuses.\nThe results are cached for a short interval. When the service is shutting down, readiness fails immediately.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Returns readiness of the service.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Health"
+                        }
+                    },
+                    "503": {
+                        "description": "Some of the components are failing or the service is shutting down",
+                        "schema": {
+                            "$ref": "#/definitions/models.Health"
+                        }
+                    }
                 }
             }
         },
-        "models.UserModification": {
-            "type": "object",
-            "properties": {
-                "append": {
-                    "description": "Append - список сегментов, в которые необходимо добавить пользователя.",
-                    "type": "array",
-                    "items": {
-                        "type": "string"
-                    }
-                },
-                "id": {
+        "/segments": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get a page of segments ordered by slug, optionally only the ones with slug starting with the specified prefix.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Returns segments.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Slug prefix",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Maximum number of segments (from 1 to 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Number of segments to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Segment"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Add segment with the specified slug to DB and get it's ID.\nIf \"auto_percent\" is specified, the given percent of registered users is added to the segment, and newly registered users are evaluated against it too.\nThe choice of users is deterministic: it depends only on the user ID and the segment slug.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Adds segment to DB.",
+                "parameters": [
+                    {
+                        "description": "Segment slug and percent of users automatically added to it",
+                        "name": "segment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentCreation"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ID"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "409": {
+                        "description": "Segment already exists",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "422": {
+                        "description": "Slug is empty, too long or contains control characters",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Delete segment with the specified slug from DB. The segment is hidden, and its users are considered removed from it,\nbut it can be restored with its memberships until it is purged after the retention period.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Deletes segment from DB.",
+                "parameters": [
+                    {
+                        "description": "Segment slug",
+                        "name": "slug",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Slug"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "There is no segment with the specified slug",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            }
+        },
+        "/segments/{slug}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get ID, creation time, description, owner team and members count of the segment with the specified slug.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Returns segment.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Segment slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Segment"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Change description and/or owner team of the segment with the specified slug. Omitted fields are not changed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Modifies segment's metadata.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Segment slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New segment metadata",
+                        "name": "update",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.SegmentUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            }
+        },
+        "/segments/{slug}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Restore the deleted segment with the specified slug together with its users' memberships, except the expired ones.\nDeleted segments can be restored until they are purged after the retention period.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Restores deleted segment.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Segment slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "There is no deleted segment with the specified slug",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            }
+        },
+        "/segments/{slug}/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get a page of users in the segment with the specified slug, ordered by user ID, with the time they were added.\nThe response is streamed, so \"limit=0\" can be used to export the whole segment.\nThe default request timeout does not apply to the stream; it is limited only by the timeout set for this route.\nTo get the next page, pass \"next_cursor\" from the response as \"cursor\"; it is absent on the last page.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Segments"
+                ],
+                "summary": "Returns users in the segment.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Segment slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the user after which to start",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Maximum number of users (0 for all)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.MembersPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get a page of registered users ordered by ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Returns registered users.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Maximum number of users (from 1 to 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Number of users to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.User"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Register user with the specified ID and add him to the segments with automatic rollout he falls into.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Registers user.",
+                "parameters": [
+                    {
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ID"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Append and remove user with the specified ID to/from segments.\nEach appended segment is either a slug or an object with the slug and \"expires_at\" (RFC 3339) or \"ttl\" (e.g. \"72h\").\nAll changes are applied atomically. If some of the segments do not exist, nothing is changed,\nunless \"partial\" is true: then the changes are applied to the existing segments and the rest are reported as \"unknown\".\nThe response reports the status of each segment: \"added\", \"already_present\", \"removed\", \"not_member\" or \"unknown\".",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Modifies user's relations with segments.",
+                "parameters": [
+                    {
+                        "description": "User modification parameters",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserModification"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ModificationReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "Some of the segments do not exist or user is not registered (only in strict mode)",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/bulk": {
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Apply a list of user modifications (as in PATCH /users), or add/remove a list of users to/from a single segment.\nModifications are applied in batches; a modification that can not be applied (unknown segment, or unregistered user in strict mode) is skipped and reported.\nOn a database error the batches applied before it are kept.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Modifies relations with segments of many users.",
+                "parameters": [
+                    {
+                        "description": "List of user modifications, or segment with list of user IDs",
+                        "name": "params",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.BulkModification"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.BulkReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Get a list of segments in which the user with the specified ID is located.\nWith with_expiry=true, membership expiry time is added to the segments whose membership expires.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Returns segments in which the user is located.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Add membership expiry time",
+                        "name": "with_expiry",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Relation"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "APIKeyAuth": []
+                    }
+                ],
+                "description": "Delete user with the specified ID and all his relations with segments.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Deletes user.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "401": {
+                        "description": "Bearer token or API key is missing or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "403": {
+                        "description": "Role of the client is insufficient",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "429": {
+                        "description": "Rate limit of the client is exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {
+                            "$ref": "#/definitions/models.Err"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "models.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "CreatedAt - время создания ключа.",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "ExpiresAt - время истечения ключа (nil - ключ бессрочный).",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID - id ключа.",
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "description": "LastUsedAt - время последнего использования ключа (nil - ключ не использовался).",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Name - название ключа (например, потребитель, которому он выдан).",
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Prefix - начало секрета ключа, по которому ключ можно узнать.",
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "description": "RevokedAt - время отзыва ключа (nil - ключ не отозван).",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "Role - роль, с которой выполняются запросы с ключом (reader, editor или admin).",
+                    "type": "string"
+                },
+                "usage_count": {
+                    "description": "UsageCount - количество запросов с ключом.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.APIKeyCreation": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt - время истечения ключа (не задано - ключ бессрочный).",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Name - название ключа.",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "Role - роль ключа: reader, editor или admin.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.APIKeyExpiry": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt - время истечения ключа (null - ключ бессрочный).",
+                    "type": "string"
+                }
+            }
+        },
+        "models.BulkFailure": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code - код ошибки (см. ErrorCode).",
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Text - текст ошибки.",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID - id пользователя.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.BulkModification": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "description": "IDs - список id пользователей.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "operation": {
+                    "description": "Operation - операция над сегментом (OperationAdd, по умолчанию, или OperationRemove).",
+                    "type": "string"
+                },
+                "segment": {
+                    "description": "Segment - сегмент, в который необходимо добавить (или из которого необходимо убрать) пользователей.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.SegmentAddition"
+                        }
+                    ]
+                },
+                "users": {
+                    "description": "Users - список изменений пользователей.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.UserModification"
+                    }
+                }
+            }
+        },
+        "models.BulkReport": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "description": "Applied - количество применённых изменений пользователей.",
+                    "type": "integer"
+                },
+                "failed": {
+                    "description": "Failed - список изменений пользователей, которые не были применены.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.BulkFailure"
+                    }
+                }
+            }
+        },
+        "models.ComponentHealth": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Error - текст ошибки проверки компонента.",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status - статус компонента (HealthOK или HealthFailing).",
+                    "type": "string"
+                }
+            }
+        },
+        "models.CreatedAPIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "CreatedAt - время создания ключа.",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "ExpiresAt - время истечения ключа (nil - ключ бессрочный).",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID - id ключа.",
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "description": "LastUsedAt - время последнего использования ключа (nil - ключ не использовался).",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Name - название ключа (например, потребитель, которому он выдан).",
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Prefix - начало секрета ключа, по которому ключ можно узнать.",
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "description": "RevokedAt - время отзыва ключа (nil - ключ не отозван).",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "Role - роль, с которой выполняются запросы с ключом (reader, editor или admin).",
+                    "type": "string"
+                },
+                "secret": {
+                    "description": "Secret - секрет ключа, передаваемый в заголовке X-API-Key; возвращается только при создании.",
+                    "type": "string"
+                },
+                "usage_count": {
+                    "description": "UsageCount - количество запросов с ключом.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Err": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code - машиночитаемый код ошибки (см. константы Code*).",
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Text - текст ошибки.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Health": {
+            "type": "object",
+            "properties": {
+                "components": {
+                    "description": "Components - состояния компонентов сервиса по их названиям.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.ComponentHealth"
+                    }
+                },
+                "status": {
+                    "description": "Status - статус сервиса (HealthOK, HealthFailing или HealthShuttingDown).",
+                    "type": "string"
+                }
+            }
+        },
+        "models.ID": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "Value - id.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Member": {
+            "type": "object",
+            "properties": {
+                "added_at": {
+                    "description": "AddedAt - время добавления пользователя в сегмент.",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "ExpiresAt - время истечения членства (nil, если членство бессрочное).",
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "UserID - id пользователя.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.MembersPage": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "description": "NextCursor - курсор следующей страницы (nil, если страница последняя).",
+                    "type": "integer"
+                },
+                "users": {
+                    "description": "Users - пользователи, состоящие в сегменте.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Member"
+                    }
+                }
+            }
+        },
+        "models.ModificationReport": {
+            "type": "object",
+            "properties": {
+                "append": {
+                    "description": "Append - результаты добавления в сегменты.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.SlugStatus"
+                    }
+                },
+                "remove": {
+                    "description": "Remove - результаты удаления из сегментов.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.SlugStatus"
+                    }
+                }
+            }
+        },
+        "models.Relation": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt - время истечения членства (nil, если членство бессрочное).",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Slug - название сегмента.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Segment": {
+            "type": "object",
+            "properties": {
+                "auto_percent": {
+                    "description": "AutoPercent - процент пользователей, автоматически добавляемых в сегмент.",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "description": "CreatedAt - время создания сегмента.",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Description - описание сегмента.",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID - id сегмента.",
+                    "type": "integer"
+                },
+                "members": {
+                    "description": "Members - количество пользователей в сегменте.",
+                    "type": "integer"
+                },
+                "owner_team": {
+                    "description": "OwnerTeam - команда, владеющая сегментом.",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Slug - название сегмента.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.SegmentAddition": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt - время истечения членства (nil, если членство бессрочное).",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Slug - название сегмента.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.SegmentCreation": {
+            "type": "object",
+            "properties": {
+                "auto_percent": {
+                    "description": "AutoPercent - процент пользователей, автоматически добавляемых в сегмент (от 0 до 100).",
+                    "type": "integer"
+                },
+                "slug": {
+                    "description": "Value - название сегмента.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.SegmentUpdate": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "description": "Description - новое описание сегмента.",
+                    "type": "string"
+                },
+                "owner_team": {
+                    "description": "OwnerTeam - новая команда, владеющая сегментом.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.Slug": {
+            "type": "object",
+            "properties": {
+                "slug": {
+                    "description": "Value - название сегмента.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.SlugStatus": {
+            "type": "object",
+            "properties": {
+                "slug": {
+                    "description": "Slug - название сегмента.",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status - статус (одна из констант Status*).",
+                    "type": "string"
+                }
+            }
+        },
+        "models.User": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "CreatedAt - время регистрации пользователя.",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID - id пользователя.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.UserModification": {
+            "type": "object",
+            "properties": {
+                "append": {
+                    "description": "Append - список сегментов, в которые необходимо добавить пользователя.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.SegmentAddition"
+                    }
+                },
+                "id": {
                     "description": "Value - id.",
                     "type": "integer"
                 },
+                "partial": {
+                    "description": "Partial - флаг частичного применения (если true, то несуществующие сегменты пропускаются).",
+                    "type": "boolean"
+                },
                 "remove": {
                     "description": "Remove - список сегментов, из которых необходимо убрать пользователя.",
                     "type": "array",
@@ -248,6 +1951,20 @@ const docTemplate = `{
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "APIKeyAuth": {
+            "description": "API key created by an admin via /api-keys. The key grants the role it was created with.",
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "description": "JWT signed with HMAC, passed as \"Bearer \u003ctoken\u003e\". The \"roles\" claim grants reader, editor or admin access.",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
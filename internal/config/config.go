@@ -0,0 +1,622 @@
+// config - пакет, описывающий настройки запуска сервиса.
+//
+// Настройки загружаются из YAML файла, переменных окружения и флагов командной строки:
+// каждый следующий источник переопределяет значения, заданные предыдущими.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/ratelimit"
+	sqldb "github.com/famusovsky/AvitoTestTask/pkg/db"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config - структура, описывающая настройки запуска сервиса.
+type Config struct {
+	Addr     string   `yaml:"addr"`      // Addr - адрес HTTP сервера.
+	GRPCAddr string   `yaml:"grpc_addr"` // GRPCAddr - адрес gRPC сервера (пустая строка - gRPC сервер отключён).
+	Storage  string   `yaml:"storage"`   // Storage - хранилище данных сегментирования: postgres или memory.
+	Migrate  bool     `yaml:"migrate"`   // Migrate - флаг применения неприменённых миграций при запуске.
+	DB       DB       `yaml:"db"`        // DB - настройки подключения к БД.
+	Timeouts Timeouts `yaml:"timeouts"`  // Timeouts - настройки времени обработки запросов и завершения работы.
+	Workers  Workers  `yaml:"workers"`   // Workers - настройки фоновых процессов.
+	Log      Log      `yaml:"log"`       // Log - настройки лога.
+	Features Features `yaml:"features"`  // Features - включение и отключение возможностей сервиса.
+	Auth     Auth     `yaml:"auth"`      // Auth - настройки аутентификации клиентов.
+	// RateLimit - настройки ограничения частоты запросов клиентов.
+	RateLimit RateLimit `yaml:"rate_limit"`
+	Cache     Cache     `yaml:"cache"` // Cache - настройки кеша сегментов пользователей.
+}
+
+// DB - структура, описывающая настройки подключения к БД.
+type DB struct {
+	DSN             string   `yaml:"dsn"`                // DSN - строка подключения; если задана, то Host, Port, User, Password, Name и SSLMode не используются.
+	Host            string   `yaml:"host"`               // Host - хост БД.
+	Port            string   `yaml:"port"`               // Port - порт БД.
+	User            string   `yaml:"user"`               // User - пользователь БД.
+	Password        string   `yaml:"password"`           // Password - пароль пользователя БД.
+	PasswordFile    string   `yaml:"password_file"`      // PasswordFile - путь к файлу с паролем пользователя БД (например, секрету Docker), заменяет Password.
+	Name            string   `yaml:"name"`               // Name - название БД.
+	SSLMode         string   `yaml:"sslmode"`            // SSLMode - режим SSL подключения.
+	MaxOpenConns    int      `yaml:"max_open_conns"`     // MaxOpenConns - максимальное количество открытых соединений (0 - без ограничения).
+	MaxIdleConns    int      `yaml:"max_idle_conns"`     // MaxIdleConns - максимальное количество простаивающих соединений (0 - значение database/sql по умолчанию).
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime"`  // ConnMaxLifetime - максимальное время жизни соединения (0 - без ограничения).
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time"` // ConnMaxIdleTime - максимальное время простоя соединения (0 - без ограничения).
+	ConnectTimeout  Duration `yaml:"connect_timeout"`    // ConnectTimeout - время, в течение которого повторяются попытки подключения при запуске (0 - одна попытка).
+	ConnectBackoff  Duration `yaml:"connect_backoff"`    // ConnectBackoff - пауза перед второй попыткой подключения, удваиваемая после каждой неудачной попытки.
+}
+
+// Timeouts - структура, описывающая настройки времени обработки запросов и завершения работы.
+type Timeouts struct {
+	Request       Duration      `yaml:"request"`         // Request - время обработки запроса, по истечении которого возвращается код 504 (0 - без ограничения).
+	Routes        RouteTimeouts `yaml:"routes"`          // Routes - время обработки запросов к отдельным маршрутам по ключу "METHOD /path".
+	ReadyCacheTTL Duration      `yaml:"ready_cache_ttl"` // ReadyCacheTTL - время кеширования результата проверки готовности.
+	DrainDelay    Duration      `yaml:"drain_delay"`     // DrainDelay - время между началом завершения работы и прекращением приёма запросов.
+	Shutdown      Duration      `yaml:"shutdown"`        // Shutdown - время ожидания завершения запросов и фоновых процессов (0 - без ограничения).
+}
+
+// Workers - структура, описывающая настройки фоновых процессов.
+type Workers struct {
+	ExpiryInterval Duration `yaml:"expiry_interval"` // ExpiryInterval - период удаления истёкших членств пользователей в сегментах (0 - не удалять).
+	PurgeRetention Duration `yaml:"purge_retention"` // PurgeRetention - время хранения удалённых сегментов (0 - не удалять).
+	StatsInterval  Duration `yaml:"stats_interval"`  // StatsInterval - период обновления метрик общего количества данных в хранилище (0 - не обновлять).
+}
+
+// Log - структура, описывающая настройки лога.
+type Log struct {
+	Format string `yaml:"format"` // Format - формат лога: text или json.
+	Level  string `yaml:"level"`  // Level - минимальный уровень записей лога: debug, info, warn или error.
+}
+
+// Features - структура, описывающая включение и отключение возможностей сервиса.
+type Features struct {
+	StrictUsers bool `yaml:"strict_users"` // StrictUsers - запрет неявной регистрации пользователей при изменении их сегментов.
+	Metrics     bool `yaml:"metrics"`      // Metrics - сбор метрик и их выдача по адресу /metrics.
+}
+
+// Auth - структура, описывающая настройки аутентификации клиентов по JWT и ключам API.
+type Auth struct {
+	Enabled  bool     `yaml:"enabled"`  // Enabled - флаг проверки токенов и ролей клиентов.
+	Keys     Secrets  `yaml:"keys"`     // Keys - ключи подписи токенов по их ID (поле kid заголовка токена).
+	Issuer   string   `yaml:"issuer"`   // Issuer - требуемое значение поля iss токена (пустое - не проверяется).
+	Audience string   `yaml:"audience"` // Audience - требуемое значение поля aud токена (пустое - не проверяется).
+	Leeway   Duration `yaml:"leeway"`   // Leeway - допустимое расхождение часов при проверке срока действия токена.
+	APIKeys  bool     `yaml:"api_keys"` // APIKeys - флаг аутентификации клиентов по ключам API из хранилища и управления ими через /api-keys.
+}
+
+// Cache - структура, описывающая настройки кеша сегментов пользователей (GET /users/:id) в памяти процесса.
+type Cache struct {
+	Enabled bool     `yaml:"enabled"` // Enabled - флаг кеширования сегментов пользователей.
+	Size    int      `yaml:"size"`    // Size - максимальное количество пользователей в кеше.
+	TTL     Duration `yaml:"ttl"`     // TTL - время хранения сегментов пользователя в кеше.
+}
+
+// RateLimit - структура, описывающая настройки ограничения частоты запросов клиентов по классам маршрутов.
+type RateLimit struct {
+	Enabled bool           `yaml:"enabled"` // Enabled - флаг ограничения частоты запросов.
+	Read    RateLimitClass `yaml:"read"`    // Read - ограничение запросов получения данных.
+	Write   RateLimitClass `yaml:"write"`   // Write - ограничение запросов изменения пользователей и их сегментов.
+	Admin   RateLimitClass `yaml:"admin"`   // Admin - ограничение запросов, требующих роли admin (изменение сегментов, управление ключами API).
+	Auth    RateLimitClass `yaml:"auth"`    // Auth - ограничение неудачных попыток аутентификации с одного IP адреса.
+}
+
+// RateLimitClass - структура, описывающая ограничение частоты запросов одного клиента к маршрутам класса.
+type RateLimitClass struct {
+	Rate  float64 `yaml:"rate"`  // Rate - средняя допустимая частота запросов в секунду.
+	Burst int     `yaml:"burst"` // Burst - максимальное количество запросов подряд.
+}
+
+// Default - получение настроек по умолчанию.
+//
+// Возвращает: настройки.
+func Default() Config {
+	return Config{
+		Addr:    ":8080",
+		Storage: "postgres",
+		DB: DB{
+			Host:           "localhost",
+			Port:           "5432",
+			SSLMode:        "disable",
+			MaxIdleConns:   2,
+			ConnectTimeout: Duration(30 * time.Second),
+			ConnectBackoff: Duration(500 * time.Millisecond),
+		},
+		Timeouts: Timeouts{
+			Request:       Duration(30 * time.Second),
+			Routes:        RouteTimeouts{},
+			ReadyCacheTTL: Duration(2 * time.Second),
+			DrainDelay:    Duration(5 * time.Second),
+			Shutdown:      Duration(30 * time.Second),
+		},
+		Workers: Workers{
+			ExpiryInterval: Duration(time.Minute),
+			PurgeRetention: Duration(30 * 24 * time.Hour),
+			StatsInterval:  Duration(time.Minute),
+		},
+		Log: Log{
+			Format: "text",
+			Level:  "info",
+		},
+		Auth: Auth{
+			Keys: Secrets{},
+		},
+		RateLimit: RateLimit{
+			Read:  RateLimitClass{Rate: 100, Burst: 200},
+			Write: RateLimitClass{Rate: 20, Burst: 40},
+			Admin: RateLimitClass{Rate: 2, Burst: 10},
+			Auth:  RateLimitClass{Rate: 1, Burst: 20},
+		},
+		Cache: Cache{
+			Size: 10000,
+			TTL:  Duration(30 * time.Second),
+		},
+	}
+}
+
+// configFlag - название флага пути к файлу настроек.
+const configFlag = "config"
+
+// Load - загрузка настроек.
+// Значения по умолчанию переопределяются значениями из файла настроек (путь задаётся флагом -config или переменной окружения APP_CONFIG),
+// затем значениями из переменных окружения и затем значениями флагов.
+//
+// Принимает: название программы, аргументы командной строки, функцию получения переменной окружения (например, os.LookupEnv) и поток вывода справки и ошибок разбора флагов.
+//
+// Возвращает: настройки, аргументы командной строки после флагов и ошибку (flag.ErrHelp, если была запрошена справка).
+func Load(name string, args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, []string, error) {
+	// Флаги разбираются дважды: сначала для получения пути к файлу настроек, затем поверх настроек из файла и переменных окружения.
+	path, _ := lookupEnv(EnvName(configFlag))
+	pre := Default()
+	fs := pre.FlagSet(name)
+	fs.StringVar(&path, configFlag, path, "Path to YAML configuration file")
+	fs.SetOutput(output)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return Config{}, nil, err
+		}
+		if cfg.Timeouts.Routes == nil {
+			cfg.Timeouts.Routes = RouteTimeouts{}
+		}
+		if cfg.Auth.Keys == nil {
+			cfg.Auth.Keys = Secrets{}
+		}
+	}
+	if err := cfg.loadEnv(lookupEnv); err != nil {
+		return Config{}, nil, err
+	}
+
+	fs = cfg.FlagSet(name)
+	fs.String(configFlag, path, "")
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// FlagSet - создание набора флагов, значения которых записываются в настройки.
+// Значениями флагов по умолчанию считаются текущие значения настроек.
+//
+// Принимает: название набора флагов.
+//
+// Возвращает: набор флагов.
+func (cfg *Config) FlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "HTTP address")
+	fs.StringVar(&cfg.GRPCAddr, "grpc_addr", cfg.GRPCAddr, "gRPC address (empty to disable the gRPC server)")
+	fs.StringVar(&cfg.Storage, "storage", cfg.Storage, "Storage of segmentation data: postgres or memory")
+	fs.BoolVar(&cfg.Migrate, "migrate", cfg.Migrate, "Apply pending schema migrations on startup")
+
+	fs.StringVar(&cfg.DB.DSN, "db_dsn", cfg.DB.DSN, "Database connection string, overrides other db_* connection settings")
+	fs.StringVar(&cfg.DB.Host, "db_host", cfg.DB.Host, "Database host")
+	fs.StringVar(&cfg.DB.Port, "db_port", cfg.DB.Port, "Database port")
+	fs.StringVar(&cfg.DB.User, "db_user", cfg.DB.User, "Database user")
+	fs.StringVar(&cfg.DB.Password, "db_password", cfg.DB.Password, "Database password (prefer the environment variable or the password file)")
+	fs.StringVar(&cfg.DB.PasswordFile, "db_password_file", cfg.DB.PasswordFile, "Path to file containing database password")
+	fs.StringVar(&cfg.DB.Name, "db_name", cfg.DB.Name, "Database name")
+	fs.StringVar(&cfg.DB.SSLMode, "db_sslmode", cfg.DB.SSLMode, "Database SSL mode: disable, allow, prefer, require, verify-ca or verify-full")
+	fs.IntVar(&cfg.DB.MaxOpenConns, "db_max_open_conns", cfg.DB.MaxOpenConns, "Maximum number of open database connections (0 for unlimited)")
+	fs.IntVar(&cfg.DB.MaxIdleConns, "db_max_idle_conns", cfg.DB.MaxIdleConns, "Maximum number of idle database connections (0 for database/sql default)")
+	fs.DurationVar((*time.Duration)(&cfg.DB.ConnMaxLifetime), "db_conn_max_lifetime", time.Duration(cfg.DB.ConnMaxLifetime), "Maximum lifetime of a database connection (0 for unlimited)")
+	fs.DurationVar((*time.Duration)(&cfg.DB.ConnMaxIdleTime), "db_conn_max_idle_time", time.Duration(cfg.DB.ConnMaxIdleTime), "Maximum idle time of a database connection (0 for unlimited)")
+	fs.DurationVar((*time.Duration)(&cfg.DB.ConnectTimeout), "db_connect_timeout", time.Duration(cfg.DB.ConnectTimeout), "Time during which connection to the database is retried on startup (0 for a single attempt)")
+	fs.DurationVar((*time.Duration)(&cfg.DB.ConnectBackoff), "db_connect_backoff", time.Duration(cfg.DB.ConnectBackoff), "Delay before the second connection attempt, doubled after each failed attempt")
+
+	fs.DurationVar((*time.Duration)(&cfg.Timeouts.Request), "timeout", time.Duration(cfg.Timeouts.Request), "Request processing timeout, after which 504 is returned (0 to disable)")
+	fs.Var(cfg.Timeouts.Routes, "timeouts", `Comma-separated request processing timeouts of individual routes, e.g. "PATCH /users/bulk=2m,GET /segments/:slug/users=10m"`)
+	fs.DurationVar((*time.Duration)(&cfg.Timeouts.ReadyCacheTTL), "ready_cache_ttl", time.Duration(cfg.Timeouts.ReadyCacheTTL), "Interval during which the result of readiness check is reused")
+	fs.DurationVar((*time.Duration)(&cfg.Timeouts.DrainDelay), "drain_delay", time.Duration(cfg.Timeouts.DrainDelay), "Delay between failing readiness on shutdown and stopping accepting requests")
+	fs.DurationVar((*time.Duration)(&cfg.Timeouts.Shutdown), "shutdown_timeout", time.Duration(cfg.Timeouts.Shutdown), "Time to wait for in-flight requests and background workers on shutdown (0 to wait forever)")
+
+	fs.DurationVar((*time.Duration)(&cfg.Workers.ExpiryInterval), "expiry_interval", time.Duration(cfg.Workers.ExpiryInterval), "Interval of removing expired users' relations with segments (0 to disable)")
+	fs.DurationVar((*time.Duration)(&cfg.Workers.PurgeRetention), "purge_retention", time.Duration(cfg.Workers.PurgeRetention), "Retention period of deleted segments before they are purged (0 to disable purging)")
+	fs.DurationVar((*time.Duration)(&cfg.Workers.StatsInterval), "stats_interval", time.Duration(cfg.Workers.StatsInterval), "Interval of refreshing metrics of total segments, users and memberships (0 to disable)")
+
+	fs.StringVar(&cfg.Log.Format, "log_format", cfg.Log.Format, "Log format: text or json")
+	fs.StringVar(&cfg.Log.Level, "log_level", cfg.Log.Level, "Minimum log level: debug, info, warn or error")
+
+	fs.BoolVar(&cfg.Features.StrictUsers, "strict_users", cfg.Features.StrictUsers, "Reject modification of unregistered users instead of registering them implicitly")
+	fs.BoolVar(&cfg.Features.Metrics, "metrics", cfg.Features.Metrics, "Collect metrics and serve them on /metrics")
+
+	fs.BoolVar(&cfg.Auth.Enabled, "auth", cfg.Auth.Enabled, "Require JWT bearer tokens and check roles of clients")
+	fs.Var(cfg.Auth.Keys, "auth_keys", `Comma-separated token signing keys by their IDs, e.g. "2024-01=<secret>,2024-06=<secret>"`)
+	fs.StringVar(&cfg.Auth.Issuer, "auth_issuer", cfg.Auth.Issuer, "Required issuer (iss) of tokens")
+	fs.StringVar(&cfg.Auth.Audience, "auth_audience", cfg.Auth.Audience, "Required audience (aud) of tokens")
+	fs.DurationVar((*time.Duration)(&cfg.Auth.Leeway), "auth_leeway", time.Duration(cfg.Auth.Leeway), "Allowed clock skew when checking token expiry")
+	fs.BoolVar(&cfg.Auth.APIKeys, "auth_api_keys", cfg.Auth.APIKeys, "Authenticate clients by API keys stored in the database and manage them on /api-keys")
+
+	fs.BoolVar(&cfg.RateLimit.Enabled, "rate_limit", cfg.RateLimit.Enabled, "Limit the rate of requests of each client")
+	for _, class := range []struct {
+		name     string
+		settings *RateLimitClass
+		usage    string
+	}{
+		{"read", &cfg.RateLimit.Read, "reading requests"},
+		{"write", &cfg.RateLimit.Write, "requests modifying users"},
+		{"admin", &cfg.RateLimit.Admin, "requests requiring the admin role"},
+		{"auth", &cfg.RateLimit.Auth, "failed authentication attempts (per IP address)"},
+	} {
+		fs.Float64Var(&class.settings.Rate, "rate_limit_"+class.name+"_rate", class.settings.Rate, "Allowed requests per second of a client for "+class.usage)
+		fs.IntVar(&class.settings.Burst, "rate_limit_"+class.name+"_burst", class.settings.Burst, "Allowed burst of requests of a client for "+class.usage)
+	}
+
+	fs.BoolVar(&cfg.Cache.Enabled, "cache", cfg.Cache.Enabled, "Cache users' segments in memory")
+	fs.IntVar(&cfg.Cache.Size, "cache_size", cfg.Cache.Size, "Maximum number of users in the cache")
+	fs.DurationVar((*time.Duration)(&cfg.Cache.TTL), "cache_ttl", time.Duration(cfg.Cache.TTL), "Time users' segments are kept in the cache")
+
+	fs.VisitAll(func(f *flag.Flag) {
+		f.Usage += fmt.Sprintf(" [$%s]", EnvName(f.Name))
+	})
+
+	return fs
+}
+
+// EnvName - получение названия переменной окружения, соответствующей флагу.
+// Флаги настроек БД (db_*) соответствуют переменным DB_*, остальные - переменным APP_*.
+//
+// Принимает: название флага.
+//
+// Возвращает: название переменной окружения.
+func EnvName(flagName string) string {
+	name := strings.ToUpper(flagName)
+	if strings.HasPrefix(name, "DB_") {
+		return name
+	}
+
+	return "APP_" + name
+}
+
+// loadFile - загрузка настроек из YAML файла.
+//
+// Принимает: путь к файлу.
+//
+// Возвращает: ошибку.
+func (cfg *Config) loadFile(path string) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("unsupported config file format %q: must be .yaml or .yml", ext)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error while opening config file: %s", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error while parsing config file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// databaseURLEnv - переменная окружения строки подключения к БД, используемая, если не задана DB_DSN.
+const databaseURLEnv = "DATABASE_URL"
+
+// loadEnv - загрузка настроек из переменных окружения.
+//
+// Принимает: функцию получения переменной окружения.
+//
+// Возвращает: ошибку.
+func (cfg *Config) loadEnv(lookupEnv func(string) (string, bool)) error {
+	// DATABASE_URL - общепринятая переменная строки подключения, переопределяемая DB_DSN.
+	if dsn, ok := lookupEnv(databaseURLEnv); ok {
+		cfg.DB.DSN = dsn
+	}
+
+	errs := make([]error, 0)
+	cfg.FlagSet("env").VisitAll(func(f *flag.Flag) {
+		value, ok := lookupEnv(EnvName(f.Name))
+		if !ok {
+			return
+		}
+		if err := f.Value.Set(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q of environment variable %s: %s", value, EnvName(f.Name), err))
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// Validate - проверка настроек.
+//
+// Возвращает: ошибку, описывающую все неверные значения.
+func (cfg Config) Validate() error {
+	errs := make([]error, 0)
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Addr != "", "addr must not be empty")
+	check(cfg.GRPCAddr == "" || !sameAddr(cfg.GRPCAddr, cfg.Addr), "grpc_addr %q must differ from addr %q", cfg.GRPCAddr, cfg.Addr)
+	check(cfg.Storage == "postgres" || cfg.Storage == "memory", "unknown storage %q: must be memory or postgres", cfg.Storage)
+
+	if cfg.Storage == "postgres" && cfg.DB.DSN == "" {
+		check(cfg.DB.Host != "", "db.host must not be empty")
+		_, err := strconv.ParseUint(cfg.DB.Port, 10, 16)
+		check(err == nil, "db.port %q must be a port number", cfg.DB.Port)
+		check(cfg.DB.User != "", "db.user must not be empty")
+		check(cfg.DB.Password == "" || cfg.DB.PasswordFile == "", "only one of db.password and db.password_file must be set")
+		check(cfg.DB.Name != "", "db.name must not be empty")
+		check(sslModes[cfg.DB.SSLMode], "unknown db.sslmode %q: must be disable, allow, prefer, require, verify-ca or verify-full", cfg.DB.SSLMode)
+	}
+	check(cfg.DB.MaxOpenConns >= 0, "db.max_open_conns must not be negative")
+	check(cfg.DB.MaxIdleConns >= 0, "db.max_idle_conns must not be negative")
+	check(cfg.DB.MaxOpenConns == 0 || cfg.DB.MaxIdleConns <= cfg.DB.MaxOpenConns, "db.max_idle_conns must not exceed db.max_open_conns")
+
+	durations := []struct {
+		key   string
+		value Duration
+	}{
+		{"db.conn_max_lifetime", cfg.DB.ConnMaxLifetime},
+		{"db.conn_max_idle_time", cfg.DB.ConnMaxIdleTime},
+		{"db.connect_timeout", cfg.DB.ConnectTimeout},
+		{"db.connect_backoff", cfg.DB.ConnectBackoff},
+		{"timeouts.request", cfg.Timeouts.Request},
+		{"timeouts.ready_cache_ttl", cfg.Timeouts.ReadyCacheTTL},
+		{"timeouts.drain_delay", cfg.Timeouts.DrainDelay},
+		{"timeouts.shutdown", cfg.Timeouts.Shutdown},
+		{"workers.expiry_interval", cfg.Workers.ExpiryInterval},
+		{"workers.purge_retention", cfg.Workers.PurgeRetention},
+		{"workers.stats_interval", cfg.Workers.StatsInterval},
+		{"auth.leeway", cfg.Auth.Leeway},
+	}
+	for _, d := range durations {
+		check(d.value >= 0, "%s must not be negative", d.key)
+	}
+
+	if _, err := logging.New(io.Discard, cfg.Log.Format, cfg.Log.Level); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.Auth.Enabled {
+		check(len(cfg.Auth.Keys) > 0, "auth.keys must not be empty when auth is enabled")
+	}
+	for _, id := range cfg.Auth.Keys.ids() {
+		check(len(cfg.Auth.Keys[id]) >= auth.MinKeyLength, "auth key %q must be at least %d bytes long", id, auth.MinKeyLength)
+	}
+
+	if cfg.Cache.Enabled {
+		check(cfg.Cache.Size >= 1, "cache.size must be at least 1")
+		check(cfg.Cache.TTL > 0, "cache.ttl must be positive")
+	}
+
+	if cfg.RateLimit.Enabled {
+		for _, class := range cfg.RateLimit.classes() {
+			check(class.settings.Rate > 0, "rate_limit.%s.rate must be positive", class.class)
+			check(class.settings.Burst >= 1, "rate_limit.%s.burst must be at least 1", class.class)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sameAddr - проверка, что два адреса прослушивания совпадают.
+// Адреса совпадают, если у них одинаковые порты и одинаковые хосты или хост хотя бы одного из них
+// не задан или означает все интерфейсы (например, ":8080" и "0.0.0.0:8080").
+//
+// Принимает: адреса в виде host:port.
+//
+// Возвращает: флаг совпадения.
+func sameAddr(a string, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	if portA != portB {
+		return false
+	}
+
+	return hostA == hostB || anyHost(hostA) || anyHost(hostB)
+}
+
+// anyHost - проверка, что хост адреса прослушивания означает все интерфейсы.
+//
+// Принимает: хост.
+//
+// Возвращает: флаг.
+func anyHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsUnspecified()
+}
+
+// sslModes - допустимые режимы SSL подключения к БД.
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// ConnString - получение строки подключения к БД.
+//
+// Возвращает: DSN, если он задан, иначе URL, составленный из остальных настроек подключения, и ошибку чтения файла с паролем.
+func (settings DB) ConnString() (string, error) {
+	if settings.DSN != "" {
+		return settings.DSN, nil
+	}
+
+	password := settings.Password
+	if settings.PasswordFile != "" {
+		var err error
+		if password, err = sqldb.ReadPasswordFile(settings.PasswordFile); err != nil {
+			return "", err
+		}
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.User(settings.User),
+		Host:     net.JoinHostPort(settings.Host, settings.Port),
+		Path:     "/" + settings.Name,
+		RawQuery: url.Values{"sslmode": {settings.SSLMode}}.Encode(),
+	}
+	if password != "" {
+		u.User = url.UserPassword(settings.User, password)
+	}
+
+	return u.String(), nil
+}
+
+// Options - получение настроек открытия БД и пула соединений.
+//
+// Возвращает: настройки.
+func (settings DB) Options() sqldb.Options {
+	return sqldb.Options{
+		MaxOpenConns:    settings.MaxOpenConns,
+		MaxIdleConns:    settings.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(settings.ConnMaxLifetime),
+		ConnMaxIdleTime: time.Duration(settings.ConnMaxIdleTime),
+		ConnectTimeout:  time.Duration(settings.ConnectTimeout),
+		InitialBackoff:  time.Duration(settings.ConnectBackoff),
+	}
+}
+
+// JWT - создание проверки токенов клиентов.
+//
+// Возвращает: проверку токенов (nil, если аутентификация отключена) и ошибку.
+func (settings Auth) JWT() (*auth.JWT, error) {
+	if !settings.Enabled {
+		return nil, nil
+	}
+
+	return settings.NewJWT()
+}
+
+// NewJWT - создание выпуска и проверки токенов независимо от флага Enabled.
+//
+// Возвращает: выпуск и проверку токенов и ошибку.
+func (settings Auth) NewJWT() (*auth.JWT, error) {
+	keys := make(map[string][]byte, len(settings.Keys))
+	for id, key := range settings.Keys {
+		keys[id] = []byte(key)
+	}
+
+	return auth.NewJWT(keys, auth.Options{
+		Issuer:   settings.Issuer,
+		Audience: settings.Audience,
+		Leeway:   time.Duration(settings.Leeway),
+	})
+}
+
+// rateLimitClass - структура, описывающая настройки ограничения частоты запросов вместе с классом маршрутов.
+type rateLimitClass struct {
+	class    ratelimit.Class // class - класс маршрутов.
+	settings RateLimitClass  // settings - настройки ограничения.
+}
+
+// classes - получение настроек ограничения частоты запросов по классам маршрутов.
+//
+// Возвращает: настройки ограничения в порядке read, write, admin, auth.
+func (settings RateLimit) classes() []rateLimitClass {
+	return []rateLimitClass{
+		{ratelimit.ClassRead, settings.Read},
+		{ratelimit.ClassWrite, settings.Write},
+		{ratelimit.ClassAdmin, settings.Admin},
+		{ratelimit.ClassAuth, settings.Auth},
+	}
+}
+
+// Limits - получение ограничений частоты запросов для приложения.
+//
+// Возвращает: ограничения по классам маршрутов (nil, если ограничение отключено).
+func (settings RateLimit) Limits() map[ratelimit.Class]ratelimit.Limit {
+	if !settings.Enabled {
+		return nil
+	}
+
+	limits := make(map[ratelimit.Class]ratelimit.Limit)
+	for _, class := range settings.classes() {
+		limits[class.class] = ratelimit.Limit{Rate: class.settings.Rate, Burst: class.settings.Burst}
+	}
+
+	return limits
+}
+
+// redacted - замена секретов при выводе настроек.
+const redacted = "xxxxx"
+
+// Redacted - получение копии настроек, в которой секреты скрыты.
+//
+// Возвращает: настройки.
+func (cfg Config) Redacted() Config {
+	if cfg.DB.Password != "" {
+		cfg.DB.Password = redacted
+	}
+	cfg.DB.DSN = sqldb.RedactDSN(cfg.DB.DSN)
+	keys := make(Secrets, len(cfg.Auth.Keys))
+	for id := range cfg.Auth.Keys {
+		keys[id] = redacted
+	}
+	cfg.Auth.Keys = keys
+
+	return cfg
+}
+
+// Print - вывод настроек в формате YAML со скрытыми секретами.
+//
+// Принимает: поток вывода.
+//
+// Возвращает: ошибку.
+func (cfg Config) Print(out io.Writer) error {
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.Redacted()); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
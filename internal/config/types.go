@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration - промежуток времени, записываемый в YAML в формате time.ParseDuration (например, "1m30s").
+type Duration time.Duration
+
+// MarshalYAML - получение представления промежутка времени в YAML.
+//
+// Возвращает: строку в формате time.Duration.String и ошибку.
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+// UnmarshalYAML - разбор промежутка времени из YAML.
+//
+// Принимает: узел YAML.
+//
+// Возвращает: ошибку.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// RouteTimeouts - время обработки запросов к отдельным маршрутам по ключу "METHOD /path".
+// Во флаге и переменной окружения задаётся списком пар "METHOD /path=время" через запятую,
+// например "PATCH /users/bulk=2m,GET /segments/:slug/users=1m", в YAML - словарём.
+type RouteTimeouts map[string]time.Duration
+
+// String - получение строкового представления значения флага.
+//
+// Возвращает: список пар "METHOD /path=время" через запятую.
+func (timeouts RouteTimeouts) String() string {
+	pairs := make([]string, 0, len(timeouts))
+	for route, timeout := range timeouts {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", route, timeout))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+// Set - разбор значения флага.
+//
+// Принимает: список пар "METHOD /path=время" через запятую.
+//
+// Возвращает: ошибку.
+func (timeouts RouteTimeouts) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		route, duration, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("route timeout %q must be in format \"METHOD /path=duration\"", pair)
+		}
+		if err := timeouts.set(route, duration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarshalYAML - получение представления времени обработки запросов в YAML.
+//
+// Возвращает: словарь "METHOD /path" - время и ошибку.
+func (timeouts RouteTimeouts) MarshalYAML() (any, error) {
+	result := make(map[string]string, len(timeouts))
+	for route, timeout := range timeouts {
+		result[route] = timeout.String()
+	}
+
+	return result, nil
+}
+
+// UnmarshalYAML - разбор времени обработки запросов из YAML.
+// Значения добавляются к уже заданным.
+//
+// Принимает: узел YAML.
+//
+// Возвращает: ошибку.
+func (timeouts *RouteTimeouts) UnmarshalYAML(node *yaml.Node) error {
+	var values map[string]string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	if *timeouts == nil {
+		*timeouts = make(RouteTimeouts, len(values))
+	}
+	for route, duration := range values {
+		if err := timeouts.set(route, duration); err != nil {
+			return fmt.Errorf("line %d: %s", node.Line, err)
+		}
+	}
+
+	return nil
+}
+
+// set - установка времени обработки запросов к маршруту.
+//
+// Принимает: маршрут в формате "METHOD /path" и время в формате time.ParseDuration.
+//
+// Возвращает: ошибку.
+func (timeouts RouteTimeouts) set(route string, duration string) error {
+	fields := strings.Fields(route)
+	if len(fields) != 2 {
+		return fmt.Errorf("route %q must be in format \"METHOD /path\"", route)
+	}
+	timeout, err := time.ParseDuration(strings.TrimSpace(duration))
+	if err != nil {
+		return fmt.Errorf("timeout of route %q: %s", route, err)
+	}
+	if timeout < 0 {
+		return fmt.Errorf("timeout of route %q must not be negative", route)
+	}
+
+	timeouts[strings.ToUpper(fields[0])+" "+fields[1]] = timeout
+	return nil
+}
+
+// Secrets - секреты по их ID.
+// Во флаге и переменной окружения задаются списком пар "id=секрет" через запятую, в YAML - словарём.
+type Secrets map[string]string
+
+// String - получение строкового представления значения флага.
+//
+// Возвращает: список пар "id=xxxxx" через запятую (сами секреты не выводятся).
+func (secrets Secrets) String() string {
+	pairs := make([]string, 0, len(secrets))
+	for _, id := range secrets.ids() {
+		pairs = append(pairs, id+"="+redacted)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// Set - разбор значения флага.
+//
+// Принимает: список пар "id=секрет" через запятую.
+//
+// Возвращает: ошибку.
+func (secrets Secrets) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || id == "" || secret == "" {
+			return errors.New(`secrets must be in format "id=secret"`)
+		}
+		secrets[id] = secret
+	}
+
+	return nil
+}
+
+// ids - получение отсортированного списка ID секретов.
+//
+// Возвращает: ID секретов.
+func (secrets Secrets) ids() []string {
+	ids := make([]string, 0, len(secrets))
+	for id := range secrets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
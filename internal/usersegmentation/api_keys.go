@@ -0,0 +1,199 @@
+package usersegmentation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateAPIKey - создание ключа API со случайным секретом.
+// В хранилище сохраняется только хеш секрета, поэтому секрет можно получить только из результата этой функции.
+//
+// Принимает: контекст, хранилище ключей API и параметры ключа (название и роль должны быть проверены заранее).
+//
+// Возвращает: созданный ключ вместе с секретом и ошибку.
+func CreateAPIKey(ctx context.Context, store models.APIKeyStore, creation models.APIKeyCreation) (models.CreatedAPIKey, error) {
+	secret, prefix, hash, err := auth.NewAPIKeySecret()
+	if err != nil {
+		return models.CreatedAPIKey{}, fmt.Errorf("error while generating api key secret: %s", err)
+	}
+	key, err := store.AddAPIKey(ctx, models.NewAPIKey{
+		Hash:      hash,
+		Prefix:    prefix,
+		Name:      creation.Name,
+		Role:      creation.Role,
+		ExpiresAt: creation.ExpiresAt,
+	})
+	if err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+
+	return models.CreatedAPIKey{APIKey: key, Secret: secret}, nil
+}
+
+// PostAPIKey - создаёт ключ API.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Creates API key.
+// @Description  Create an API key with the specified name and role. The secret of the key is returned only in this response:
+// @Description  only its hash is stored, so the secret can not be shown again. The secret is passed in the X-API-Key header.
+// @Tags         API keys
+// @Accept       json
+// @Produce      json
+// @Param        key body models.APIKeyCreation true "Key name, role (reader, editor or admin) and optional expiration time"
+// @Success      201 {object} models.CreatedAPIKey
+// @Failure      400 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /api-keys [post]
+func (app *App) PostAPIKey(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	if ok, err := checkType(c); !ok {
+		return err
+	}
+	creation, ok, err := getAPIKeyCreation(c)
+	if !ok {
+		return err
+	}
+
+	key, err := CreateAPIKey(ctx, app.options.APIKeys, creation)
+	if err != nil {
+		return sendError(c, err)
+	}
+	logging.FromContext(ctx).Info("api key created", "api_key_id", key.ID, "name", key.Name, "role", key.Role)
+
+	return c.Status(http.StatusCreated).JSON(key)
+}
+
+// GetAPIKeys - возвращает ключи API.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Returns API keys.
+// @Description  Get all API keys ordered by ID, including revoked and expired ones, with their usage count and last usage time.
+// @Description  Secrets of the keys are not returned.
+// @Tags         API keys
+// @Produce      json
+// @Success      200 {object} []models.APIKey
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /api-keys [get]
+func (app *App) GetAPIKeys(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	keys, err := app.options.APIKeys.GetAPIKeys(ctx)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON(keys)
+}
+
+// RevokeAPIKey - отзывает ключ API.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Revokes API key.
+// @Description  Revoke the API key with the specified ID: requests with it are rejected from now on. The key stays in the list of keys.
+// @Tags         API keys
+// @Produce      json
+// @Param        id path int true "API key ID"
+// @Success      200 {string} string "OK"
+// @Failure      400 {object} models.Err
+// @Failure      404 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /api-keys/{id} [delete]
+func (app *App) RevokeAPIKey(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	id, ok, err := getPathID(c)
+	if !ok {
+		return err
+	}
+
+	if err = app.options.APIKeys.RevokeAPIKey(ctx, id); err != nil {
+		return sendError(c, err)
+	}
+	logging.FromContext(ctx).Info("api key revoked", "api_key_id", id)
+
+	return c.JSON("OK")
+}
+
+// PatchAPIKey - изменяет время истечения ключа API.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Sets API key expiration time.
+// @Description  Set the expiration time of the API key with the specified ID. If "expires_at" is null, the key never expires.
+// @Tags         API keys
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "API key ID"
+// @Param        expiry body models.APIKeyExpiry true "New expiration time"
+// @Success      200 {string} string "OK"
+// @Failure      400 {object} models.Err
+// @Failure      404 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /api-keys/{id} [patch]
+func (app *App) PatchAPIKey(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	if ok, err := checkType(c); !ok {
+		return err
+	}
+	id, ok, err := getPathID(c)
+	if !ok {
+		return err
+	}
+	expiry, ok, err := getAPIKeyExpiry(c)
+	if !ok {
+		return err
+	}
+
+	if err = app.options.APIKeys.SetAPIKeyExpiry(ctx, id, expiry.ExpiresAt); err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON("OK")
+}
@@ -2,34 +2,102 @@
 package usersegmentation
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/metrics"
 	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/ratelimit"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/swagger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // App - структура, описывающая приложение.
 type App struct {
-	webApp      *fiber.App                         // webApp - веб-приложение на основе фреймворка Fiber.
-	dbProcessor models.UserSegmentationDbProcessor // dbProcessor - обработчик БД.
-	logger      *log.Logger                        // errorLog - логгер ошибок.
+	webApp      *fiber.App                             // webApp - веб-приложение на основе фреймворка Fiber.
+	dbProcessor models.UserSegmentationDbProcessor     // dbProcessor - обработчик БД.
+	logger      *slog.Logger                           // logger - логгер.
+	options     Options                                // options - настройки приложения.
+	routes      map[string]bool                        // routes - зарегистрированные маршруты по ключу "METHOD /path".
+	limiters    map[ratelimit.Class]*ratelimit.Limiter // limiters - ограничители частоты запросов по классам маршрутов.
+	grpcServer  *grpc.Server                           // grpcServer - gRPC сервер (nil, если он отключён).
+	grpcHealth  *health.Server                         // grpcHealth - сервис проверки состояния gRPC сервера.
+
+	shuttingDown atomic.Bool   // shuttingDown - флаг начала завершения работы приложения.
+	readyMu      sync.Mutex    // readyMu - мьютекс последней проверки готовности.
+	ready        models.Health // ready - результат последней проверки готовности.
+	readyAt      time.Time     // readyAt - время последней проверки готовности.
+
+	apiKeyUsageMu sync.Mutex                 // apiKeyUsageMu - мьютекс учёта использований ключей API.
+	apiKeyUsage   map[int]models.APIKeyUsage // apiKeyUsage - использования ключей API, ещё не сохранённые в хранилище.
+
+	requestsCtx    context.Context    // requestsCtx - родительский контекст обрабатываемых запросов.
+	cancelRequests context.CancelFunc // cancelRequests - отмена контекстов обрабатываемых запросов при завершении работы.
+}
+
+// Options - структура, описывающая настройки приложения.
+type Options struct {
+	ExpiryInterval time.Duration // ExpiryInterval - период удаления истёкших членств пользователей в сегментах (0 - фоновое удаление отключено).
+	PurgeRetention time.Duration // PurgeRetention - время хранения удалённых сегментов до их окончательного удаления (0 - окончательное удаление отключено).
+	Timeout        time.Duration // Timeout - время обработки запроса, по истечении которого возвращается код 504 (0 - без ограничения).
+	// Timeouts - время обработки запросов к отдельным маршрутам по ключу "METHOD /path" (например, "PATCH /users/bulk"), заменяет Timeout.
+	// Передача потока GET /segments/:slug/users ограничивается только этой настройкой, Timeout к ней не применяется.
+	Timeouts map[string]time.Duration
+	// Metrics - метрики, в которых учитываются запросы и по адресу /metrics (nil - метрики отключены).
+	// Вызовы обработчика БД учитываются, только если он создан через Metrics.Instrument.
+	Metrics *metrics.Metrics
+	// StatsInterval - период обновления метрик общего количества данных в хранилище (0 - не обновлять).
+	StatsInterval time.Duration
+	// HealthChecks - проверки готовности компонентов сервиса по их названиям, выполняемые по адресу /readyz.
+	HealthChecks map[string]HealthCheck
+	// ReadyCacheTTL - время, в течение которого результат проверки готовности не обновляется (0 - проверять при каждом запросе).
+	ReadyCacheTTL time.Duration
+	// DrainDelay - время между началом завершения работы (когда /readyz начинает возвращать 503) и прекращением приёма запросов.
+	DrainDelay time.Duration
+	// ShutdownTimeout - время ожидания завершения обрабатываемых запросов и фоновых процессов после прекращения приёма запросов (0 - без ограничения).
+	ShutdownTimeout time.Duration
+	// Auth - проверка токенов клиентов (nil - аутентификация отключена).
+	// Запросы к /segments (кроме получения), /segments/:slug/restore и DELETE /users/:id требуют роли admin, GET /users/:id - роли reader,
+	// остальные запросы к API - роли editor; /healthz, /readyz, /metrics и /swagger доступны без аутентификации.
+	Auth *auth.JWT
+	// APIKeys - хранилище ключей API (nil - аутентификация по ключам API отключена).
+	// Если задано, то клиенты могут аутентифицироваться по заголовку X-API-Key, а ключами можно управлять через /api-keys с ролью admin;
+	// при этом аутентификация требуется, даже если Auth равен nil.
+	APIKeys models.APIKeyStore
+	// RateLimits - ограничения частоты запросов одного клиента по классам маршрутов (nil - частота не ограничивается, классы без ограничения также не ограничиваются).
+	// К классу read относятся запросы получения данных, к классу admin - запросы, требующие роли admin, к классу write - остальные запросы к API.
+	RateLimits map[ratelimit.Class]ratelimit.Limit
+	// GRPCAddr - адрес gRPC сервера (пустая строка - gRPC сервер отключён).
+	// gRPC сервер предоставляет часть API (см. api/usersegmentation/v1/usersegmentation.proto) с теми же ролями и ограничениями частоты запросов,
+	// что и соответствующие маршруты; время обработки вызовов ограничивается Timeout, а в метриках вызовы не учитываются.
+	GRPCAddr string
 }
 
 // CreateApp - создание приложения.
 //
-// Принимает: логгер, обработчик БД.
+// Принимает: логгер, обработчик БД, настройки приложения.
 //
 // Возвращает: приложение.
-func CreateApp(logger *log.Logger, dbProcessor models.UserSegmentationDbProcessor) *App {
+func CreateApp(logger *slog.Logger, dbProcessor models.UserSegmentationDbProcessor, options Options) *App {
 	application := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			logger.Printf("Error: %v", err)
-			return c.Status(http.StatusInternalServerError).JSON(models.Err{Text: err.Error()})
+			logging.FromContext(c.UserContext()).Error("unhandled error", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(models.Err{Text: err.Error(), Code: models.CodeInternal})
 		},
 	})
 
@@ -37,34 +105,207 @@ func CreateApp(logger *log.Logger, dbProcessor models.UserSegmentationDbProcesso
 		webApp:      application,
 		dbProcessor: dbProcessor,
 		logger:      logger,
+		options:     options,
+		apiKeyUsage: make(map[int]models.APIKeyUsage),
+		limiters:    make(map[ratelimit.Class]*ratelimit.Limiter),
+	}
+	for class, limit := range options.RateLimits {
+		result.limiters[class] = ratelimit.New(limit)
+	}
+	result.requestsCtx, result.cancelRequests = context.WithCancel(context.Background())
+	result.webApp.Hooks().OnListen(func(data fiber.ListenData) error {
+		logger.Info("listening", "host", data.Host, "port", data.Port)
+		return nil
+	})
+
+	result.webApp.Use(result.observeRequests)
+
+	reader, editor, admin := result.authorize(auth.RoleReader), result.authorize(auth.RoleEditor), result.authorize(auth.RoleAdmin)
+	reads, writes, admins := result.limitRate(ratelimit.ClassRead), result.limitRate(ratelimit.ClassWrite), result.limitRate(ratelimit.ClassAdmin)
+
+	result.webApp.Post("/segments", admin, admins, result.PostSegment)
+	result.webApp.Delete("/segments", admin, admins, result.DeleteSegment)
+	result.webApp.Get("/segments", editor, reads, result.GetSegments)
+	result.webApp.Get("/segments/:slug", editor, reads, result.GetSegment)
+	result.webApp.Patch("/segments/:slug", admin, admins, result.PatchSegment)
+	result.webApp.Get("/segments/:slug/users", editor, reads, result.GetSegmentMembers)
+	result.webApp.Post("/segments/:slug/restore", admin, admins, result.RestoreSegment)
+	result.webApp.Post("/users", editor, writes, result.PostUser)
+	result.webApp.Get("/users", editor, reads, result.GetUsers)
+	result.webApp.Patch("/users", editor, writes, result.ModifyUser)
+	result.webApp.Patch("/users/bulk", editor, writes, result.ModifyUsers)
+	result.webApp.Get("/users/:id", reader, reads, result.GetUserRelations)
+	result.webApp.Delete("/users/:id", admin, admins, result.DeleteUser)
+	result.webApp.Get("/history/:period", editor, reads, result.GetHistoryReport)
+	if options.APIKeys != nil {
+		result.webApp.Post("/api-keys", admin, admins, result.PostAPIKey)
+		result.webApp.Get("/api-keys", admin, admins, result.GetAPIKeys)
+		result.webApp.Delete("/api-keys/:id", admin, admins, result.RevokeAPIKey)
+		result.webApp.Patch("/api-keys/:id", admin, admins, result.PatchAPIKey)
+	}
+	result.webApp.Get("/healthz", result.Healthz)
+	result.webApp.Get("/readyz", result.Readyz)
+	result.webApp.Get("/swagger/*", swagger.New()) // default
+	if options.Metrics != nil {
+		result.webApp.Get("/metrics", adaptor.HTTPHandler(options.Metrics.Handler()))
+	}
+
+	if options.GRPCAddr != "" {
+		result.grpcServer, result.grpcHealth = result.newGRPCServer()
 	}
 
-	result.webApp.Post("/segments", result.PostSegment)
-	result.webApp.Delete("/segments", result.DeleteSegment)
-	result.webApp.Patch("/users", result.ModifyUser)
-	result.webApp.Get("/users/:id", result.GetUserRelations)
+	result.routes = make(map[string]bool)
+	for _, route := range result.webApp.GetRoutes(true) {
+		result.routes[routeKey(route.Method, route.Path)] = true
+	}
+	for key := range options.Timeouts {
+		if !result.routes[key] {
+			logger.Warn("timeout is set for unknown route", "route", key)
+		}
+	}
 
 	return result
 }
 
+// ErrShutdownTimeout - ошибка, возвращаемая Run, если обработка запросов или фоновые процессы не завершились за Options.ShutdownTimeout.
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
 // Run - запуск приложения.
 //
-// Принимает: адрес.
-func (app *App) Run(addr string) {
-	app.webApp.Get("/swagger/*", swagger.New()) // default
+// Приложение обрабатывает запросы, пока не будет отменён контекст ctx. После отмены /readyz начинает возвращать 503,
+// через Options.DrainDelay приложение прекращает приём новых запросов и ожидает завершения обрабатываемых запросов и фоновых процессов
+// не дольше Options.ShutdownTimeout; по истечении этого времени контексты обрабатываемых запросов отменяются.
+// Если задан Options.GRPCAddr, то так же обрабатываются и вызовы gRPC сервера; после отмены ctx его сервис проверки состояния возвращает NOT_SERVING.
+//
+// Принимает: контекст, при отмене которого приложение завершает работу, адрес HTTP сервера.
+//
+// Возвращает: ошибку (nil, если приложение завершило работу после отмены ctx без ошибок; ErrShutdownTimeout, если завершение не уложилось во время).
+func (app *App) Run(ctx context.Context, addr string) error {
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
 
-	idleConnsClosed := make(chan struct{})
+	var workers sync.WaitGroup
+	app.startWorker(&workers, app.options.ExpiryInterval > 0, func() { app.runExpiryWorker(workersCtx, app.options.ExpiryInterval) })
+	app.startWorker(&workers, app.options.PurgeRetention > 0, func() { app.runPurgeWorker(workersCtx, purgeInterval, app.options.PurgeRetention) })
+	app.startWorker(&workers, app.options.Metrics != nil && app.options.StatsInterval > 0, func() { app.runStatsWorker(workersCtx, app.options.StatsInterval) })
+	app.startWorker(&workers, app.options.APIKeys != nil, func() { app.runAPIKeyUsageWorker(workersCtx, apiKeyUsageInterval) })
+
+	var grpcListener net.Listener
+	if app.grpcServer != nil {
+		var err error
+		if grpcListener, err = net.Listen("tcp", app.options.GRPCAddr); err != nil {
+			stopWorkers()
+			workers.Wait()
+			return fmt.Errorf("error while listening on %s: %s", app.options.GRPCAddr, err)
+		}
+	}
+
+	listenErr := make(chan error, 2)
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		<-sigint
+		if err := app.webApp.Listen(addr); err != nil {
+			listenErr <- fmt.Errorf("error while listening on %s: %s", addr, err)
+		}
+	}()
+	if grpcListener != nil {
+		app.logger.Info("listening for grpc", "addr", grpcListener.Addr().String())
+		app.grpcHealth.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		go func() {
+			if err := app.grpcServer.Serve(grpcListener); err != nil {
+				listenErr <- fmt.Errorf("error while serving grpc on %s: %s", app.options.GRPCAddr, err)
+			}
+		}()
+	}
 
-		if err := app.webApp.Shutdown(); err != nil {
-			app.logger.Printf("Error while shutting down the server: %v", err)
+	select {
+	case err := <-listenErr:
+		if app.grpcServer != nil {
+			app.grpcServer.Stop()
 		}
+		app.webApp.Shutdown()
+		stopWorkers()
+		workers.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	app.shuttingDown.Store(true)
+	if app.grpcHealth != nil {
+		app.grpcHealth.Shutdown()
+	}
+	app.logger.Info("shutting down", "drain_delay", app.options.DrainDelay, "timeout", app.options.ShutdownTimeout)
+	time.Sleep(app.options.DrainDelay)
 
-		close(idleConnsClosed)
+	var (
+		shutdownCtx context.Context
+		cancel      context.CancelFunc
+	)
+	if app.options.ShutdownTimeout > 0 {
+		shutdownCtx, cancel = context.WithTimeout(context.Background(), app.options.ShutdownTimeout)
+	} else {
+		shutdownCtx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
 	}()
 
-	app.logger.Fatalln(app.webApp.Listen(addr))
+	grpcDone := make(chan struct{})
+	if app.grpcServer != nil {
+		go func() {
+			app.grpcServer.GracefulStop()
+			close(grpcDone)
+		}()
+	}
+
+	errs := make([]error, 0)
+	if err := app.webApp.ShutdownWithContext(shutdownCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: requests are still being handled", ErrShutdownTimeout)
+		}
+		errs = append(errs, err)
+	}
+	if app.grpcServer != nil {
+		select {
+		case <-grpcDone:
+		case <-shutdownCtx.Done():
+			// Вызовы, не завершившиеся за отведённое время, прерываются.
+			app.grpcServer.Stop()
+			errs = append(errs, fmt.Errorf("%w: grpc calls are still being handled", ErrShutdownTimeout))
+		}
+	}
+	if app.options.APIKeys != nil {
+		if err := app.flushAPIKeyUsage(shutdownCtx); err != nil {
+			app.logger.Error("error while recording api keys usage", "error", err)
+		}
+	}
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		errs = append(errs, fmt.Errorf("%w: background workers are still running", ErrShutdownTimeout))
+	}
+
+	// Запросы, не завершившиеся за отведённое время, прерываются.
+	app.cancelRequests()
+	app.logger.Info("shut down")
+
+	return errors.Join(errs...)
+}
+
+// startWorker - запуск фонового процесса.
+//
+// Принимает: группу ожидания фоновых процессов, флаг запуска (если false, то процесс не запускается) и функцию процесса.
+func (app *App) startWorker(workers *sync.WaitGroup, enabled bool, run func()) {
+	if !enabled {
+		return
+	}
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		run()
+	}()
 }
@@ -2,63 +2,248 @@ package usersegmentation
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/memory"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/metrics"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/ratelimit"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
 
 	"github.com/gofiber/fiber"
 )
 
 // processorMock - mock для обработчика БД.
 type processorMock struct {
-	resOnAddSegment       int
-	errOnAddSegment       error
-	errOnDeleteSegment    error
-	errOnModifyUser       error
-	resOnGetUserRelations []string
-	errOnGetUserRelations error
+	resOnAddSegment                int
+	errOnAddSegment                error
+	gotOnAddSegment                int
+	errOnDeleteSegment             error
+	errOnRestoreSegment            error
+	gotOnRestoreSegment            string
+	resOnPurgeDeleted              int
+	errOnPurgeDeleted              error
+	callsOnPurgeDeleted            chan time.Time
+	resOnGetSegments               []models.Segment
+	errOnGetSegments               error
+	gotOnGetSegments               []any
+	resOnGetSegment                models.Segment
+	errOnGetSegment                error
+	gotOnGetSegment                string
+	waitOnGetSegment               bool
+	delayOnGetSegment              time.Duration
+	callsOnGetSegment              chan struct{}
+	errOnUpdateSegment             error
+	resOnGetMembers                []models.Member
+	errOnGetMembers                error
+	gotOnGetMembers                []any
+	waitOnGetMembers               bool
+	delayOnGetMembers              time.Duration
+	gotOnUpdateSegment             models.SegmentUpdate
+	resOnModifyUser                models.ModificationReport
+	errOnModifyUser                error
+	gotOnModifyUser                []models.SegmentAddition
+	gotPartialOnModify             bool
+	resOnModifyUsers               models.BulkReport
+	errOnModifyUsers               error
+	gotOnModifyUsers               []models.UserModification
+	resOnGetUserRelations          []models.Relation
+	errOnGetUserRelations          error
+	gotPrincipalOnGetUserRelations auth.Principal
+	resOnDeleteExpired             int
+	errOnDeleteExpired             error
+	callsOnDeleteExpired           chan struct{}
+	errOnAddUser                   error
+	resOnGetUsers                  []models.User
+	errOnGetUsers                  error
+	gotOnGetUsers                  [2]int
+	errOnDeleteUser                error
+	resOnGetHistory                []models.HistoryRecord
+	errOnGetHistory                error
+	resOnGetStats                  models.Stats
+	errOnGetStats                  error
+	callsOnGetStats                chan struct{}
 }
 
-func (p processorMock) AddSegment(slug string) (int, error) {
+func (p *processorMock) AddSegment(ctx context.Context, slug string, autoPercent int) (int, error) {
+	p.gotOnAddSegment = autoPercent
 	return p.resOnAddSegment, p.errOnAddSegment
 }
-func (p processorMock) DeleteSegment(slug string) error {
+func (p processorMock) DeleteSegment(ctx context.Context, slug string) error {
 	return p.errOnDeleteSegment
 }
-func (p processorMock) ModifyUser(id int, append []string, remove []string) error {
-	return p.errOnModifyUser
+func (p *processorMock) RestoreSegment(ctx context.Context, slug string) error {
+	p.gotOnRestoreSegment = slug
+	return p.errOnRestoreSegment
+}
+func (p processorMock) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	if p.callsOnPurgeDeleted != nil {
+		p.callsOnPurgeDeleted <- before
+	}
+	return p.resOnPurgeDeleted, p.errOnPurgeDeleted
+}
+func (p *processorMock) GetSegments(ctx context.Context, prefix string, limit int, offset int) ([]models.Segment, error) {
+	p.gotOnGetSegments = []any{prefix, limit, offset}
+	return p.resOnGetSegments, p.errOnGetSegments
+}
+func (p *processorMock) GetSegment(ctx context.Context, slug string) (models.Segment, error) {
+	p.gotOnGetSegment = slug
+	if p.callsOnGetSegment != nil {
+		p.callsOnGetSegment <- struct{}{}
+	}
+	time.Sleep(p.delayOnGetSegment)
+	if p.waitOnGetSegment {
+		<-ctx.Done()
+		return models.Segment{}, fmt.Errorf("error while getting segment: %s", ctx.Err())
+	}
+	return p.resOnGetSegment, p.errOnGetSegment
+}
+func (p *processorMock) UpdateSegment(ctx context.Context, slug string, update models.SegmentUpdate) error {
+	p.gotOnUpdateSegment = update
+	return p.errOnUpdateSegment
 }
-func (p processorMock) GetUserRelations(id int) ([]string, error) {
+func (p *processorMock) GetSegmentMembers(ctx context.Context, slug string, after int, limit int, fn func(models.Member) error) error {
+	p.gotOnGetMembers = []any{slug, after, limit}
+	if p.waitOnGetMembers {
+		<-ctx.Done()
+		return fmt.Errorf("error while getting segment members: %s", ctx.Err())
+	}
+	for _, member := range p.resOnGetMembers {
+		if err := fn(member); err != nil {
+			return err
+		}
+		time.Sleep(p.delayOnGetMembers)
+		if ctx.Err() != nil {
+			return fmt.Errorf("error while getting segment members: %s", ctx.Err())
+		}
+	}
+	return p.errOnGetMembers
+}
+func (p *processorMock) ModifyUser(ctx context.Context, id int, append []models.SegmentAddition, remove []string, partial bool) (models.ModificationReport, error) {
+	p.gotOnModifyUser = append
+	p.gotPartialOnModify = partial
+	return p.resOnModifyUser, p.errOnModifyUser
+}
+func (p *processorMock) ModifyUsers(ctx context.Context, mods []models.UserModification) (models.BulkReport, error) {
+	p.gotOnModifyUsers = mods
+	return p.resOnModifyUsers, p.errOnModifyUsers
+}
+func (p *processorMock) GetUserRelations(ctx context.Context, id int) ([]models.Relation, error) {
+	p.gotPrincipalOnGetUserRelations, _ = auth.FromContext(ctx)
 	return p.resOnGetUserRelations, p.errOnGetUserRelations
 }
+func (p processorMock) DeleteExpired(ctx context.Context) (int, error) {
+	if p.callsOnDeleteExpired != nil {
+		p.callsOnDeleteExpired <- struct{}{}
+	}
+	return p.resOnDeleteExpired, p.errOnDeleteExpired
+}
+func (p processorMock) AddUser(ctx context.Context, id int) error {
+	return p.errOnAddUser
+}
+func (p *processorMock) GetUsers(ctx context.Context, limit int, offset int) ([]models.User, error) {
+	p.gotOnGetUsers = [2]int{limit, offset}
+	return p.resOnGetUsers, p.errOnGetUsers
+}
+func (p processorMock) DeleteUser(ctx context.Context, id int) error {
+	logging.FromContext(ctx).Debug("deleting user", "id", id)
+	return p.errOnDeleteUser
+}
+func (p processorMock) GetHistory(ctx context.Context, from time.Time, to time.Time) ([]models.HistoryRecord, error) {
+	return p.resOnGetHistory, p.errOnGetHistory
+}
+func (p processorMock) GetStats(ctx context.Context) (models.Stats, error) {
+	if p.callsOnGetStats != nil {
+		p.callsOnGetStats <- struct{}{}
+	}
+	return p.resOnGetStats, p.errOnGetStats
+}
 func (p *processorMock) CleanUp() {
 	p.resOnAddSegment = 0
 	p.errOnAddSegment = nil
+	p.gotOnAddSegment = 0
 	p.errOnDeleteSegment = nil
+	p.errOnRestoreSegment = nil
+	p.gotOnRestoreSegment = ""
+	p.resOnPurgeDeleted = 0
+	p.errOnPurgeDeleted = nil
+	p.callsOnPurgeDeleted = nil
+	p.resOnGetSegments = []models.Segment{}
+	p.errOnGetSegments = nil
+	p.gotOnGetSegments = nil
+	p.resOnGetSegment = models.Segment{}
+	p.errOnGetSegment = nil
+	p.gotOnGetSegment = ""
+	p.waitOnGetSegment = false
+	p.delayOnGetSegment = 0
+	p.callsOnGetSegment = nil
+	p.errOnUpdateSegment = nil
+	p.resOnGetMembers = nil
+	p.errOnGetMembers = nil
+	p.gotOnGetMembers = nil
+	p.waitOnGetMembers = false
+	p.delayOnGetMembers = 0
+	p.gotOnUpdateSegment = models.SegmentUpdate{}
+	p.resOnModifyUser = models.ModificationReport{}
 	p.errOnModifyUser = nil
-	p.resOnGetUserRelations = []string{}
+	p.gotOnModifyUser = nil
+	p.gotPartialOnModify = false
+	p.resOnModifyUsers = models.BulkReport{}
+	p.errOnModifyUsers = nil
+	p.gotOnModifyUsers = nil
+	p.resOnGetUserRelations = []models.Relation{}
 	p.errOnGetUserRelations = nil
+	p.gotPrincipalOnGetUserRelations = auth.Principal{}
+	p.errOnAddUser = nil
+	p.resOnGetUsers = []models.User{}
+	p.errOnGetUsers = nil
+	p.gotOnGetUsers = [2]int{}
+	p.errOnDeleteUser = nil
+	p.resOnGetHistory = []models.HistoryRecord{}
+	p.errOnGetHistory = nil
+	p.resOnDeleteExpired = 0
+	p.errOnDeleteExpired = nil
+	p.callsOnDeleteExpired = nil
+	p.resOnGetStats = models.Stats{}
+	p.errOnGetStats = nil
+	p.callsOnGetStats = nil
 }
 
 var (
-	contentTypeErr = []byte(`{"error":"request's Content-Type must be application/json"}`)
+	contentTypeErr = []byte(`{"error":"request's Content-Type must be application/json","code":"bad_request"}`)
+	wrongLimitErr  = []byte(`{"error":"query parameter \"limit\" must be an integer from 1 to 1000","code":"bad_request"}`)
+	wrongOffsetErr = []byte(`{"error":"query parameter \"offset\" must be a non-negative integer","code":"bad_request"}`)
 )
 
 // Test_Segments - тестирование обработки запросов по адресу /segments.
 func Test_Segments(t *testing.T) {
 	processor := &processorMock{}
-	app := CreateApp(log.Default(), processor)
+	app := CreateApp(logging.Discard, processor, Options{})
 
 	for i := 0; i < 10; i++ {
 		var (
-			reqBody         = `{"slug":"test"}`
-			testErr         = fmt.Errorf("test error %d", rand.Int())
-			wrongReqErrText = []byte(`{"error":"request's body must implement the template {\"slug\":\"some text\"}"}`)
+			reqBody             = `{"slug":"test"}`
+			testErr             = fmt.Errorf("test error %d", rand.Int())
+			wrongReqErrText     = []byte(`{"error":"request's body must implement the template {\"slug\":\"some text\"}","code":"bad_request"}`)
+			wrongPostReqErrText = []byte(`{"error":"request's body must implement the template {\"slug\":\"some text\",\"auto_percent\":0}","code":"bad_request"}`)
 		)
 
 		t.Run("normal case", func(t *testing.T) {
@@ -82,13 +267,31 @@ func Test_Segments(t *testing.T) {
 			processor.errOnAddSegment = testErr
 
 			resp, err := app.webApp.Test(req)
-			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
 
 			req.Method = fiber.MethodDelete
 			processor.errOnDeleteSegment = testErr
 
 			resp, err = app.webApp.Test(req)
-			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("segment already exists", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(reqBody, fiber.MethodPost, "/segments", fiber.MIMEApplicationJSON)
+			processor.errOnAddSegment = fmt.Errorf("segment %q: %w", "test", models.ErrSegmentExists)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"error":"segment \"test\": segment already exists","code":"segment_exists"}`), http.StatusConflict, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("invalid slug", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"slug":""}`, fiber.MethodPost, "/segments", fiber.MIMEApplicationJSON)
+			processor.errOnAddSegment = fmt.Errorf("slug must not be empty: %w", models.ErrInvalidSlug)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"error":"slug must not be empty: invalid slug","code":"invalid_slug"}`), http.StatusUnprocessableEntity, fiber.MIMEApplicationJSON, t)
 		})
 
 		t.Run("bad request - wrong content type", func(t *testing.T) {
@@ -109,7 +312,7 @@ func Test_Segments(t *testing.T) {
 			req := createRequest(`{"smth":"is wrong"}`, fiber.MethodPost, "/segments", fiber.MIMEApplicationJSON)
 
 			resp, err := app.webApp.Test(req)
-			checkResponse(resp, err, wrongReqErrText, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+			checkResponse(resp, err, wrongPostReqErrText, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
 
 			req.Method = fiber.MethodDelete
 
@@ -122,44 +325,371 @@ func Test_Segments(t *testing.T) {
 			req := createRequest(``, fiber.MethodPost, "/segments", fiber.MIMEApplicationJSON)
 
 			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, wrongPostReqErrText, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
 
-			checkResponse(resp, err, wrongReqErrText, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+			req = createRequest(``, fiber.MethodDelete, "/segments", fiber.MIMEApplicationJSON)
 
 			resp, err = app.webApp.Test(req)
 			checkResponse(resp, err, wrongReqErrText, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
 		})
+
+		t.Run("auto percent", func(t *testing.T) {
+			defer processor.CleanUp()
+			percent := rand.Intn(101)
+			req := createRequest(fmt.Sprintf(`{"slug":"test","auto_percent":%d}`, percent), fiber.MethodPost, "/segments", fiber.MIMEApplicationJSON)
+			processor.resOnAddSegment = 1
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"id":1}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if processor.gotOnAddSegment != percent {
+				t.Errorf("got auto percent: %d\nexpected: %d\n", processor.gotOnAddSegment, percent)
+			}
+
+			for _, percent := range []int{-1 - rand.Intn(100), 101 + rand.Intn(100)} {
+				req := createRequest(fmt.Sprintf(`{"slug":"test","auto_percent":%d}`, percent), fiber.MethodPost, "/segments", fiber.MIMEApplicationJSON)
+
+				resp, err := app.webApp.Test(req)
+				checkResponse(resp, err, []byte(`{"error":"\"auto_percent\" must be between 0 and 100","code":"bad_request"}`), http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+			}
+		})
+	}
+}
+
+// Test_RestoreSegment - тестирование обработки запросов на восстановление удалённых сегментов.
+func Test_RestoreSegment(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{})
+
+	for i := 0; i < 10; i++ {
+		var (
+			testSlug = fmt.Sprintf("TEST %d", rand.Int())
+			testPath = "/segments/" + url.PathEscape(testSlug) + "/restore"
+			testErr  = fmt.Errorf("test error %d", rand.Int())
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodPost, testPath, fiber.MIMEApplicationJSON)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+			if processor.gotOnRestoreSegment != testSlug {
+				t.Errorf("got slug: %s\nexpected: %s\n", processor.gotOnRestoreSegment, testSlug)
+			}
+		})
+
+		t.Run("deleted segment not found", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodPost, testPath, fiber.MIMEApplicationJSON)
+			processor.errOnRestoreSegment = fmt.Errorf("deleted segment %q: %w", testSlug, models.ErrSegmentNotFound)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"deleted segment \"%s\": segment not found","code":"segment_not_found"}`, testSlug)), http.StatusNotFound, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("error while handling db", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodPost, testPath, fiber.MIMEApplicationJSON)
+			processor.errOnRestoreSegment = testErr
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+		})
+	}
+}
+
+// Test_SegmentsMetadata - тестирование обработки запросов к метаданным сегментов.
+func Test_SegmentsMetadata(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{})
+
+	for i := 0; i < 10; i++ {
+		var (
+			testErr     = fmt.Errorf("test error %d", rand.Int())
+			testTime    = time.Date(2023, time.August, 1+rand.Intn(28), 0, 0, 0, 0, time.UTC)
+			testSegment = models.Segment{ID: rand.Intn(1000), Slug: "TEST 1", CreatedAt: testTime, Description: "test", OwnerTeam: "team", AutoPercent: 10, Members: rand.Intn(1000)}
+			segmentBody = fmt.Sprintf(`{"id":%d,"slug":"TEST 1","created_at":"%s","description":"test","owner_team":"team","auto_percent":10,"members":%d}`,
+				testSegment.ID, testTime.Format(time.RFC3339), testSegment.Members)
+			notFoundErr = fmt.Errorf("segment %q: %w", testSegment.Slug, models.ErrSegmentNotFound)
+			updateErr   = []byte(`{"error":"request's body must implement the template {\"description\":\"some text\",\"owner_team\":\"some text\"}","code":"bad_request"}`)
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodGet, "/segments?prefix=TEST&limit=10&offset=20", fiber.MIMEApplicationJSON)
+			processor.resOnGetSegments = []models.Segment{testSegment}
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte("["+segmentBody+"]"), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if !reflect.DeepEqual(processor.gotOnGetSegments, []any{"TEST", 10, 20}) {
+				t.Errorf("got prefix, limit and offset: %v\nexpected: %v\n", processor.gotOnGetSegments, []any{"TEST", 10, 20})
+			}
+
+			req = createRequest(``, fiber.MethodGet, "/segments/TEST%201", fiber.MIMEApplicationJSON)
+			processor.resOnGetSegment = testSegment
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(segmentBody), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if processor.gotOnGetSegment != testSegment.Slug {
+				t.Errorf("got slug: %s\nexpected: %s\n", processor.gotOnGetSegment, testSegment.Slug)
+			}
+
+			req = createRequest(`{"owner_team":"new team"}`, fiber.MethodPatch, "/segments/TEST%201", fiber.MIMEApplicationJSON)
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if got := processor.gotOnUpdateSegment; got.Description != nil || got.OwnerTeam == nil || *got.OwnerTeam != "new team" {
+				t.Errorf("got update: %v\n", got)
+			}
+		})
+
+		t.Run("segment not found", func(t *testing.T) {
+			defer processor.CleanUp()
+			expectedBody := []byte(fmt.Sprintf(`{"error":"%s","code":"segment_not_found"}`, strings.ReplaceAll(notFoundErr.Error(), `"`, `\"`)))
+			req := createRequest(``, fiber.MethodGet, "/segments/TEST%201", fiber.MIMEApplicationJSON)
+			processor.errOnGetSegment = notFoundErr
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, expectedBody, http.StatusNotFound, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(`{"description":"test"}`, fiber.MethodPatch, "/segments/TEST%201", fiber.MIMEApplicationJSON)
+			processor.errOnUpdateSegment = notFoundErr
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, expectedBody, http.StatusNotFound, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("error while handling db", func(t *testing.T) {
+			defer processor.CleanUp()
+			expectedBody := []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr))
+			req := createRequest(``, fiber.MethodGet, "/segments", fiber.MIMEApplicationJSON)
+			processor.errOnGetSegments = testErr
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, expectedBody, http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodGet, "/segments/test", fiber.MIMEApplicationJSON)
+			processor.errOnGetSegment = testErr
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, expectedBody, http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(`{"description":"test"}`, fiber.MethodPatch, "/segments/test", fiber.MIMEApplicationJSON)
+			processor.errOnUpdateSegment = testErr
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, expectedBody, http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("bad request", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"smth":"is wrong"}`, fiber.MethodPatch, "/segments/test", fiber.MIMEApplicationJSON)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, updateErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(`{"description":"test"}`, fiber.MethodPatch, "/segments/test", "xml")
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, contentTypeErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodGet, "/segments?limit=0", fiber.MIMEApplicationJSON)
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, wrongLimitErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+		})
+	}
+}
+
+// Test_SegmentMembers - тестирование обработки запросов по адресу /segments/{slug}/users.
+func Test_SegmentMembers(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{})
+
+	for i := 0; i < 10; i++ {
+		var (
+			testErr     = fmt.Errorf("test error %d", rand.Int())
+			testTime    = time.Date(2023, time.August, 1+rand.Intn(28), 0, 0, 0, 0, time.UTC)
+			testMembers = make([]models.Member, 1+rand.Intn(10))
+			membersBody = make([]string, len(testMembers))
+		)
+		for j := range testMembers {
+			testMembers[j] = models.Member{UserID: j * 10, AddedAt: testTime}
+			membersBody[j] = fmt.Sprintf(`{"user_id":%d,"added_at":"%s"}`, j*10, testTime.Format(time.RFC3339))
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodGet, fmt.Sprintf("/segments/test/users?cursor=5&limit=%d", len(testMembers)), fiber.MIMEApplicationJSON)
+			processor.resOnGetMembers = testMembers
+
+			resp, err := app.webApp.Test(req)
+			expectedBody := fmt.Sprintf(`{"users":[%s],"next_cursor":%d}`, strings.Join(membersBody, ","), testMembers[len(testMembers)-1].UserID)
+			checkResponse(resp, err, []byte(expectedBody), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if !reflect.DeepEqual(processor.gotOnGetMembers, []any{"test", 5, len(testMembers)}) {
+				t.Errorf("got slug, cursor and limit: %v\nexpected: %v\n", processor.gotOnGetMembers, []any{"test", 5, len(testMembers)})
+			}
+
+			req = createRequest(``, fiber.MethodGet, "/segments/test/users?limit=0", fiber.MIMEApplicationJSON)
+
+			resp, err = app.webApp.Test(req)
+			expectedBody = fmt.Sprintf(`{"users":[%s]}`, strings.Join(membersBody, ","))
+			checkResponse(resp, err, []byte(expectedBody), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if !reflect.DeepEqual(processor.gotOnGetMembers, []any{"test", math.MinInt, 0}) {
+				t.Errorf("got slug, cursor and limit: %v\nexpected: %v\n", processor.gotOnGetMembers, []any{"test", math.MinInt, 0})
+			}
+
+			req = createRequest(``, fiber.MethodGet, "/segments/test/users", fiber.MIMEApplicationJSON)
+			processor.resOnGetMembers = nil
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"users":[]}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("segment not found", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodGet, "/segments/test/users", fiber.MIMEApplicationJSON)
+			processor.errOnGetMembers = fmt.Errorf("segment %q: %w", "test", models.ErrSegmentNotFound)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"error":"segment \"test\": segment not found","code":"segment_not_found"}`), http.StatusNotFound, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("error while handling db", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodGet, "/segments/test/users", fiber.MIMEApplicationJSON)
+			processor.errOnGetMembers = testErr
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("bad request", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodGet, "/segments/test/users?cursor=wrong", fiber.MIMEApplicationJSON)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"error":"query parameter \"cursor\" must be an integer","code":"bad_request"}`), http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodGet, "/segments/test/users?limit=-1", fiber.MIMEApplicationJSON)
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"error":"query parameter \"limit\" must be a non-negative integer","code":"bad_request"}`), http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+		})
 	}
 }
 
 // Test_Users - тестирование обработки запросов по адресу /users.
 func Test_Users(t *testing.T) {
 	processor := &processorMock{}
-	app := CreateApp(log.Default(), processor)
+	app := CreateApp(logging.Discard, processor, Options{})
 
 	for i := 0; i < 10; i++ {
 		var (
 			testErr                = fmt.Errorf("test error %d", rand.Int())
 			userModReqBody         = `{"id":10,"append":["test1","test2"],"remove":["test3","test4"]}`
 			userModRespBody        = []byte(`[{"slug":"test1"},{"slug":"test2"}]`)
-			userModWrongReqErrText = []byte(`{"error":"request's body must implement the template {\"id\":0,\"append\":[\"test1\",\"test2\"],\"remove\":[\"test3\",\"test4\"]}"}`)
-			getUserWrongReqErrText = []byte(`{"error":"path parameter \"id\" must be an integer"}`)
+			userModReportBody      = []byte(`{"append":[{"slug":"test1","status":"added"},{"slug":"test2","status":"already_present"}],"remove":[{"slug":"test3","status":"removed"},{"slug":"test4","status":"not_member"}]}`)
+			userModWrongReqErrText = []byte(`{"error":"request's body must implement the template {\"id\":0,\"append\":[\"test1\",\"test2\"],\"remove\":[\"test3\",\"test4\"],\"partial\":false}","code":"bad_request"}`)
+			getUserWrongReqErrText = []byte(`{"error":"path parameter \"id\" must be an integer","code":"bad_request"}`)
 		)
 
 		t.Run("normal case", func(t *testing.T) {
 			defer processor.CleanUp()
 			req := createRequest(userModReqBody,
 				fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON)
+			processor.resOnModifyUser = models.ModificationReport{
+				Append: []models.SlugStatus{{Slug: "test1", Status: models.StatusAdded}, {Slug: "test2", Status: models.StatusAlreadyPresent}},
+				Remove: []models.SlugStatus{{Slug: "test3", Status: models.StatusRemoved}, {Slug: "test4", Status: models.StatusNotMember}},
+			}
 
 			resp, err := app.webApp.Test(req)
-			checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			checkResponse(resp, err, userModReportBody, http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if processor.gotPartialOnModify {
+				t.Error("got partial modification, expected atomic")
+			}
 
 			req = createRequest(``, fiber.MethodGet, "/users/0", fiber.MIMEApplicationJSON)
-			processor.resOnGetUserRelations = []string{"test1", "test2"}
+			processor.resOnGetUserRelations = []models.Relation{{Slug: "test1"}, {Slug: "test2"}}
 
 			resp, err = app.webApp.Test(req)
 			checkResponse(resp, err, userModRespBody, http.StatusOK, fiber.MIMEApplicationJSON, t)
 		})
 
+		t.Run("normal case - segments with expiry", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"id":10,"append":["test1",{"slug":"test2","ttl":"24h"},{"slug":"test3","expires_at":"2030-01-02T03:04:05Z"}]}`,
+				fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"append":null,"remove":null}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+			got := processor.gotOnModifyUser
+			if len(got) != 3 || got[0].Slug != "test1" || got[0].ExpiresAt != nil ||
+				got[1].Slug != "test2" || got[1].ExpiresAt == nil || time.Until(*got[1].ExpiresAt) > 24*time.Hour || time.Until(*got[1].ExpiresAt) < 23*time.Hour ||
+				got[2].Slug != "test3" || got[2].ExpiresAt == nil || !got[2].ExpiresAt.Equal(time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC)) {
+				t.Errorf("got appended segments: %v", got)
+			}
+
+			expiresAt := time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC)
+			req = createRequest(``, fiber.MethodGet, "/users/10", fiber.MIMEApplicationJSON)
+			processor.resOnGetUserRelations = []models.Relation{{Slug: "test1"}, {Slug: "test3", ExpiresAt: &expiresAt}}
+
+			// По умолчанию ответ сохраняет прежний формат, время истечения выводится только с with_expiry=true.
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`[{"slug":"test1"},{"slug":"test3"}]`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodGet, "/users/10?with_expiry=true", fiber.MIMEApplicationJSON)
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`[{"slug":"test1"},{"slug":"test3","expires_at":"2030-01-02T03:04:05Z"}]`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodGet, "/users/10?with_expiry=yes", fiber.MIMEApplicationJSON)
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"error":"query parameter \"with_expiry\" must be a boolean","code":"bad_request"}`), http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("partial modification", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"id":10,"append":["test1","unknown"],"partial":true}`,
+				fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON)
+			processor.resOnModifyUser = models.ModificationReport{
+				Append: []models.SlugStatus{{Slug: "test1", Status: models.StatusAdded}, {Slug: "unknown", Status: models.StatusUnknown}},
+				Remove: []models.SlugStatus{},
+			}
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"append":[{"slug":"test1","status":"added"},{"slug":"unknown","status":"unknown"}],"remove":[]}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if !processor.gotPartialOnModify {
+				t.Error("got atomic modification, expected partial")
+			}
+		})
+
+		t.Run("unknown segments", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"id":10,"append":["test1","unknown"]}`,
+				fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON)
+			processor.errOnModifyUser = fmt.Errorf("segments %q: %w", []string{"unknown"}, models.ErrSegmentNotFound)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"error":"segments [\"unknown\"]: segment not found","code":"segment_not_found"}`), http.StatusNotFound, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("bad request - wrong expiry", func(t *testing.T) {
+			defer processor.CleanUp()
+			for _, addition := range []string{
+				`{"slug":"test1","ttl":"-1h"}`,
+				`{"slug":"test1","ttl":"forever"}`,
+				`{"slug":"test1","ttl":"1h","expires_at":"2030-01-02T03:04:05Z"}`,
+				`{"slug":"test1","smth":"is wrong"}`,
+			} {
+				req := createRequest(`{"id":10,"append":[`+addition+`]}`, fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON)
+
+				resp, err := app.webApp.Test(req)
+				checkResponse(resp, err, userModWrongReqErrText, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+			}
+		})
+
 		t.Run("error while handling db", func(t *testing.T) {
 			defer processor.CleanUp()
 			req := createRequest(userModReqBody,
@@ -167,13 +697,13 @@ func Test_Users(t *testing.T) {
 			processor.errOnModifyUser = testErr
 
 			resp, err := app.webApp.Test(req)
-			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
 
 			req = createRequest(``, fiber.MethodGet, "/users/0", fiber.MIMEApplicationJSON)
 			processor.errOnGetUserRelations = testErr
 
 			resp, err = app.webApp.Test(req)
-			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
 		})
 
 		t.Run("bad request - wrong content type", func(t *testing.T) {
@@ -185,7 +715,7 @@ func Test_Users(t *testing.T) {
 			checkResponse(resp, err, contentTypeErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
 
 			req = createRequest(``, fiber.MethodGet, "/users/0", "xml")
-			processor.resOnGetUserRelations = []string{"test1", "test2"}
+			processor.resOnGetUserRelations = []models.Relation{{Slug: "test1"}, {Slug: "test2"}}
 
 			resp, err = app.webApp.Test(req)
 			checkResponse(resp, err, userModRespBody, http.StatusOK, fiber.MIMEApplicationJSON, t)
@@ -211,8 +741,8 @@ func Test_Users(t *testing.T) {
 			resp, err := app.webApp.Test(req)
 			checkResponse(resp, err, userModWrongReqErrText, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
 
-			expectedErr := []byte(fmt.Sprintf(`{"error":"%s"}`, fiber.ErrMethodNotAllowed.Message))
-			req = createRequest(``, fiber.MethodGet, "/users", fiber.MIMEApplicationJSON)
+			expectedErr := []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, fiber.ErrMethodNotAllowed.Message))
+			req = createRequest(``, fiber.MethodPut, "/users", fiber.MIMEApplicationJSON)
 
 			resp, err = app.webApp.Test(req)
 			checkResponse(resp, err, expectedErr, http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
@@ -220,6 +750,851 @@ func Test_Users(t *testing.T) {
 	}
 }
 
+// Test_BulkModification - тестирование обработки запросов на массовое изменение сегментов пользователей.
+func Test_BulkModification(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{})
+
+	for i := 0; i < 10; i++ {
+		var (
+			testErr     = fmt.Errorf("test error %d", rand.Int())
+			testIDs     = make([]int, 1+rand.Intn(100))
+			testReport  = models.BulkReport{Applied: rand.Intn(100), Failed: []models.BulkFailure{{ID: 1, Text: "user 1: user not found", Code: models.CodeUserNotFound}}}
+			reportBody  = []byte(fmt.Sprintf(`{"applied":%d,"failed":[{"id":1,"error":"user 1: user not found","code":"user_not_found"}]}`, testReport.Applied))
+			wrongReqErr = []byte(`{"error":"request's body must implement the template {\"users\":[{\"id\":0,\"append\":[\"test1\"],\"remove\":[\"test2\"]}]} or {\"segment\":\"test1\",\"ids\":[0],\"operation\":\"add\"}","code":"bad_request"}`)
+		)
+		for j := range testIDs {
+			testIDs[j] = int(rand.Int31())
+		}
+		idsJSON := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(testIDs)), ","), "[]")
+
+		t.Run("normal case - list of modifications", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"users":[{"id":1,"append":["test1"]},{"id":2,"remove":["test2"],"partial":true}]}`,
+				fiber.MethodPatch, "/users/bulk", fiber.MIMEApplicationJSON)
+			processor.resOnModifyUsers = testReport
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, reportBody, http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+			expected := []models.UserModification{
+				{ID: models.ID{Value: 1}, Append: []models.SegmentAddition{{Slug: "test1"}}},
+				{ID: models.ID{Value: 2}, Remove: []string{"test2"}, Partial: true},
+			}
+			if !reflect.DeepEqual(processor.gotOnModifyUsers, expected) {
+				t.Errorf("got modifications: %v\nexpected: %v", processor.gotOnModifyUsers, expected)
+			}
+		})
+
+		t.Run("normal case - segment and list of ids", func(t *testing.T) {
+			defer processor.CleanUp()
+			for _, operation := range []string{"", `,"operation":"add"`, `,"operation":"remove"`} {
+				req := createRequest(`{"segment":"test","ids":[`+idsJSON+`]`+operation+`}`,
+					fiber.MethodPatch, "/users/bulk", fiber.MIMEApplicationJSON)
+				processor.resOnModifyUsers = testReport
+
+				resp, err := app.webApp.Test(req)
+				checkResponse(resp, err, reportBody, http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+				got := processor.gotOnModifyUsers
+				if len(got) != len(testIDs) {
+					t.Fatalf("got %d modifications, expected %d", len(got), len(testIDs))
+				}
+				for j, mod := range got {
+					expected := models.UserModification{ID: models.ID{Value: testIDs[j]}, Append: []models.SegmentAddition{{Slug: "test"}}}
+					if operation == `,"operation":"remove"` {
+						expected = models.UserModification{ID: models.ID{Value: testIDs[j]}, Remove: []string{"test"}}
+					}
+					if !reflect.DeepEqual(mod, expected) {
+						t.Errorf("got modification: %v\nexpected: %v", mod, expected)
+					}
+				}
+			}
+		})
+
+		t.Run("normal case - segment with expiry", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"segment":{"slug":"test","expires_at":"2030-01-02T03:04:05Z"},"ids":[`+idsJSON+`]}`,
+				fiber.MethodPatch, "/users/bulk", fiber.MIMEApplicationJSON)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"applied":0,"failed":null}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+			for _, mod := range processor.gotOnModifyUsers {
+				if len(mod.Append) != 1 || mod.Append[0].ExpiresAt == nil || !mod.Append[0].ExpiresAt.Equal(time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC)) {
+					t.Errorf("got modification: %v", mod)
+				}
+			}
+		})
+
+		t.Run("error while handling db", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"segment":"test","ids":[`+idsJSON+`]}`, fiber.MethodPatch, "/users/bulk", fiber.MIMEApplicationJSON)
+			processor.errOnModifyUsers = testErr
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("bad request - wrong body", func(t *testing.T) {
+			defer processor.CleanUp()
+			for _, body := range []string{
+				``,
+				`{}`,
+				`{"users":[]}`,
+				`{"segment":"test"}`,
+				`{"ids":[1,2]}`,
+				`{"users":[{"id":1}],"segment":"test","ids":[1]}`,
+				`{"users":[{"id":1}],"operation":"remove"}`,
+				`{"segment":"test","ids":[1],"operation":"move"}`,
+				`{"segment":{"slug":"test","ttl":"1h"},"ids":[1],"operation":"remove"}`,
+				`{"segment":"test","ids":[1],"smth":"is wrong"}`,
+			} {
+				req := createRequest(body, fiber.MethodPatch, "/users/bulk", fiber.MIMEApplicationJSON)
+
+				resp, err := app.webApp.Test(req)
+				checkResponse(resp, err, wrongReqErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+			}
+			if processor.gotOnModifyUsers != nil {
+				t.Errorf("got modifications: %v, expected none", processor.gotOnModifyUsers)
+			}
+		})
+
+		t.Run("bad request - too many modifications", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"segment":"test","ids":[`+strings.Repeat("1,", maxBulkSize)+`1]}`, fiber.MethodPatch, "/users/bulk", fiber.MIMEApplicationJSON)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"request must contain at most %d modifications","code":"bad_request"}`, maxBulkSize)), http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("bad request - wrong content type", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"segment":"test","ids":[1]}`, fiber.MethodPatch, "/users/bulk", "xml")
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, contentTypeErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+		})
+	}
+}
+
+// Test_UsersRegistry - тестирование обработки запросов к реестру пользователей.
+func Test_UsersRegistry(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{})
+
+	for i := 0; i < 10; i++ {
+		var (
+			testErr      = fmt.Errorf("test error %d", rand.Int())
+			testID       = rand.Intn(1000)
+			testTime     = time.Date(2023, time.August, 1+rand.Intn(28), 0, 0, 0, 0, time.UTC)
+			wrongIDErr   = []byte(`{"error":"path parameter \"id\" must be an integer","code":"bad_request"}`)
+			wrongBodyErr = []byte(`{"error":"request's body must implement the template {\"id\":0}","code":"bad_request"}`)
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(fmt.Sprintf(`{"id":%d}`, testID), fiber.MethodPost, "/users", fiber.MIMEApplicationJSON)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodGet, "/users?limit=2&offset=5", fiber.MIMEApplicationJSON)
+			processor.resOnGetUsers = []models.User{{ID: testID, CreatedAt: testTime}, {ID: testID + 1, CreatedAt: testTime}}
+
+			resp, err = app.webApp.Test(req)
+			expectedBody := fmt.Sprintf(`[{"id":%d,"created_at":"%s"},{"id":%d,"created_at":"%s"}]`,
+				testID, testTime.Format(time.RFC3339), testID+1, testTime.Format(time.RFC3339))
+			checkResponse(resp, err, []byte(expectedBody), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if processor.gotOnGetUsers != [2]int{2, 5} {
+				t.Errorf("got limit and offset: %v\nexpected: %v\n", processor.gotOnGetUsers, [2]int{2, 5})
+			}
+
+			req = createRequest(``, fiber.MethodGet, "/users", fiber.MIMEApplicationJSON)
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(expectedBody), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			if processor.gotOnGetUsers != [2]int{defaultLimit, 0} {
+				t.Errorf("got limit and offset: %v\nexpected: %v\n", processor.gotOnGetUsers, [2]int{defaultLimit, 0})
+			}
+
+			req = createRequest(``, fiber.MethodDelete, fmt.Sprintf("/users/%d", testID), fiber.MIMEApplicationJSON)
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("user already exists or not found", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(fmt.Sprintf(`{"id":%d}`, testID), fiber.MethodPost, "/users", fiber.MIMEApplicationJSON)
+			processor.errOnAddUser = fmt.Errorf("user %d: %w", testID, models.ErrUserExists)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"user %d: user already exists","code":"user_exists"}`, testID)), http.StatusConflict, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodDelete, fmt.Sprintf("/users/%d", testID), fiber.MIMEApplicationJSON)
+			processor.errOnDeleteUser = fmt.Errorf("user %d: %w", testID, models.ErrUserNotFound)
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"user %d: user not found","code":"user_not_found"}`, testID)), http.StatusNotFound, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(fmt.Sprintf(`{"id":%d,"append":["test1"]}`, testID), fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON)
+			processor.errOnModifyUser = fmt.Errorf("user %d: %w", testID, models.ErrUserNotFound)
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"user %d: user not found","code":"user_not_found"}`, testID)), http.StatusNotFound, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("error while handling db", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(fmt.Sprintf(`{"id":%d}`, testID), fiber.MethodPost, "/users", fiber.MIMEApplicationJSON)
+			processor.errOnAddUser = testErr
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodGet, "/users", fiber.MIMEApplicationJSON)
+			processor.errOnGetUsers = testErr
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodDelete, fmt.Sprintf("/users/%d", testID), fiber.MIMEApplicationJSON)
+			processor.errOnDeleteUser = testErr
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("bad request", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(`{"id":"wrong"}`, fiber.MethodPost, "/users", fiber.MIMEApplicationJSON)
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, wrongBodyErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(fmt.Sprintf(`{"id":%d}`, testID), fiber.MethodPost, "/users", "xml")
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, contentTypeErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+
+			req = createRequest(``, fiber.MethodDelete, "/users/wrong", fiber.MIMEApplicationJSON)
+
+			resp, err = app.webApp.Test(req)
+			checkResponse(resp, err, wrongIDErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+
+			for _, query := range []string{"limit=0", "limit=1001", "limit=wrong"} {
+				req = createRequest(``, fiber.MethodGet, "/users?"+query, fiber.MIMEApplicationJSON)
+
+				resp, err = app.webApp.Test(req)
+				checkResponse(resp, err, wrongLimitErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+			}
+			for _, query := range []string{"offset=-1", "offset=wrong"} {
+				req = createRequest(``, fiber.MethodGet, "/users?"+query, fiber.MIMEApplicationJSON)
+
+				resp, err = app.webApp.Test(req)
+				checkResponse(resp, err, wrongOffsetErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+			}
+		})
+	}
+}
+
+// Test_UserIDRange - тестирование отклонения id пользователей, не помещающихся в столбцы типа integer.
+func Test_UserIDRange(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{})
+	rangeErr := func(field string) []byte {
+		return []byte(fmt.Sprintf(`{"error":"%s must be between -2147483648 and 2147483647","code":"bad_request"}`, strings.ReplaceAll(field, `"`, `\"`)))
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		field  string
+	}{
+		{"register", fiber.MethodPost, "/users", `{"id":3000000000}`, `"id"`},
+		{"get", fiber.MethodGet, "/users/3000000000", ``, `path parameter "id"`},
+		{"delete", fiber.MethodDelete, "/users/-3000000000", ``, `path parameter "id"`},
+		{"modify", fiber.MethodPatch, "/users", `{"id":3000000000,"append":["test"]}`, `"id"`},
+		{"bulk by users", fiber.MethodPatch, "/users/bulk", `{"users":[{"id":1,"append":["test"]},{"id":3000000000,"append":["test"]}]}`, `"id" of every user`},
+		{"bulk by segment", fiber.MethodPatch, "/users/bulk", `{"segment":"test","ids":[1,-3000000000]}`, `"ids"`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer processor.CleanUp()
+			resp, err := app.webApp.Test(createRequest(c.body, c.method, c.path, fiber.MIMEApplicationJSON))
+			checkResponse(resp, err, rangeErr(c.field), http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+		})
+	}
+
+	t.Run("maximum id", func(t *testing.T) {
+		defer processor.CleanUp()
+		resp, err := app.webApp.Test(createRequest(``, fiber.MethodGet, "/users/2147483647", fiber.MIMEApplicationJSON))
+		checkResponse(resp, err, []byte(`[]`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+	})
+}
+
+// Test_History - тестирование обработки запросов по адресу /history.
+func Test_History(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{})
+
+	for i := 0; i < 10; i++ {
+		var (
+			testErr    = fmt.Errorf("test error %d", rand.Int())
+			testUserID = rand.Intn(1000)
+			testTime   = time.Date(2023, time.August, 1+rand.Intn(28), rand.Intn(24), rand.Intn(60), 0, 0, time.UTC)
+			periodErr  = []byte(`{"error":"path parameter \"period\" must be in format YYYY-MM","code":"bad_request"}`)
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodGet, "/history/2023-08", fiber.MIMEApplicationJSON)
+			processor.resOnGetHistory = []models.HistoryRecord{
+				{UserID: testUserID, Slug: "test1", Operation: models.OperationAdd, Time: testTime},
+				{UserID: testUserID, Slug: "test1", Operation: models.OperationRemove, Time: testTime.Add(time.Hour)},
+			}
+			expectedBody := fmt.Sprintf("user_id,segment,operation,time\n%d,test1,add,%s\n%d,test1,remove,%s\n",
+				testUserID, testTime.Format(time.RFC3339), testUserID, testTime.Add(time.Hour).Format(time.RFC3339))
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(expectedBody), http.StatusOK, "text/csv", t)
+		})
+
+		t.Run("error while handling db", func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(``, fiber.MethodGet, "/history/2023-08", fiber.MIMEApplicationJSON)
+			processor.errOnGetHistory = testErr
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(fmt.Sprintf(`{"error":"%s","code":"internal_error"}`, testErr)), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+		})
+
+		t.Run("bad request - wrong period", func(t *testing.T) {
+			defer processor.CleanUp()
+			for _, period := range []string{"2023", "2023-13", "08-2023", "wrong"} {
+				req := createRequest(``, fiber.MethodGet, "/history/"+period, fiber.MIMEApplicationJSON)
+
+				resp, err := app.webApp.Test(req)
+				checkResponse(resp, err, periodErr, http.StatusBadRequest, fiber.MIMEApplicationJSON, t)
+			}
+		})
+	}
+}
+
+// Test_Timeouts - тестирование ограничения времени обработки запросов.
+func Test_Timeouts(t *testing.T) {
+	processor := &processorMock{}
+	timeoutErr := []byte(`{"error":"error while getting segment: context deadline exceeded: request timed out","code":"timeout"}`)
+
+	t.Run("default timeout", func(t *testing.T) {
+		defer processor.CleanUp()
+		app := CreateApp(logging.Discard, processor, Options{Timeout: 10 * time.Millisecond})
+		req := createRequest(``, fiber.MethodGet, "/segments/test", fiber.MIMEApplicationJSON)
+		processor.waitOnGetSegment = true
+
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, timeoutErr, http.StatusGatewayTimeout, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("route timeout", func(t *testing.T) {
+		defer processor.CleanUp()
+		app := CreateApp(logging.Discard, processor, Options{
+			Timeout:  time.Hour,
+			Timeouts: map[string]time.Duration{"GET /segments/:slug": 10 * time.Millisecond},
+		})
+		req := createRequest(``, fiber.MethodGet, "/segments/test", fiber.MIMEApplicationJSON)
+		processor.waitOnGetSegment = true
+
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, timeoutErr, http.StatusGatewayTimeout, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("other route", func(t *testing.T) {
+		defer processor.CleanUp()
+		app := CreateApp(logging.Discard, processor, Options{
+			Timeouts: map[string]time.Duration{"GET /segments/:slug": time.Nanosecond},
+		})
+		req := createRequest(``, fiber.MethodGet, "/segments", fiber.MIMEApplicationJSON)
+		processor.resOnGetSegments = []models.Segment{}
+
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, []byte(`[]`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("stream without default timeout", func(t *testing.T) {
+		defer processor.CleanUp()
+		app := CreateApp(logging.Discard, processor, Options{Timeout: 10 * time.Millisecond})
+		req := createRequest(``, fiber.MethodGet, "/segments/test/users?limit=0", fiber.MIMEApplicationJSON)
+		processor.resOnGetMembers = []models.Member{{UserID: 1}, {UserID: 2}, {UserID: 3}}
+		processor.delayOnGetMembers = 10 * time.Millisecond
+
+		resp, err := app.webApp.Test(req)
+		expectedBody := `{"users":[{"user_id":1,"added_at":"0001-01-01T00:00:00Z"},{"user_id":2,"added_at":"0001-01-01T00:00:00Z"},{"user_id":3,"added_at":"0001-01-01T00:00:00Z"}]}`
+		checkResponse(resp, err, []byte(expectedBody), http.StatusOK, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("stream route timeout", func(t *testing.T) {
+		defer processor.CleanUp()
+		app := CreateApp(logging.Discard, processor, Options{
+			Timeout:  time.Hour,
+			Timeouts: map[string]time.Duration{"GET /segments/:slug/users": 10 * time.Millisecond},
+		})
+		req := createRequest(``, fiber.MethodGet, "/segments/test/users", fiber.MIMEApplicationJSON)
+		processor.waitOnGetMembers = true
+
+		resp, err := app.webApp.Test(req)
+		expectedBody := `{"error":"error while getting segment members: context deadline exceeded: request timed out","code":"timeout"}`
+		checkResponse(resp, err, []byte(expectedBody), http.StatusGatewayTimeout, fiber.MIMEApplicationJSON, t)
+	})
+}
+
+// Test_StreamMembers - тестирование прекращения передачи потока пользователей сегмента.
+func Test_StreamMembers(t *testing.T) {
+	// infinite - получение бесконечного списка пользователей, пока fn не вернёт ошибку или не будет отменён контекст.
+	infinite := func(ctx context.Context, stopped chan<- error) func(fn func(models.Member) error) error {
+		return func(fn func(models.Member) error) error {
+			var err error
+			for id := 0; err == nil; id++ {
+				if err = fn(models.Member{UserID: id}); err == nil {
+					err = ctx.Err()
+				}
+			}
+			stopped <- err
+			return err
+		}
+	}
+
+	t.Run("body closed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan error, 1)
+		body, err := streamMembers(ctx, cancel, infinite(ctx, stopped), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = body.Read(make([]byte, 16)); err != nil {
+			t.Fatal(err)
+		}
+		body.Close()
+
+		select {
+		case err = <-stopped:
+			if !errors.Is(err, io.ErrClosedPipe) {
+				t.Errorf("got err = %v, expected %v", err, io.ErrClosedPipe)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("stream is not stopped after its body is closed")
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Error("context is not cancelled after the stream is stopped")
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan error, 1)
+		body, err := streamMembers(ctx, cancel, infinite(ctx, stopped), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+		if _, err = body.Read(make([]byte, 16)); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		if _, err = io.ReadAll(body); !errors.Is(err, context.Canceled) {
+			t.Errorf("got err = %v, expected %v", err, context.Canceled)
+		}
+		if err = <-stopped; !errors.Is(err, context.Canceled) {
+			t.Errorf("got err = %v, expected %v", err, context.Canceled)
+		}
+	})
+}
+
+// Test_RequestLogging - тестирование журнала доступа и ID запросов.
+func Test_RequestLogging(t *testing.T) {
+	processor := &processorMock{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	app := CreateApp(logger, processor, Options{})
+
+	records := func() []map[string]any {
+		defer buf.Reset()
+		result := make([]map[string]any, 0)
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			record := make(map[string]any)
+			if err := dec.Decode(&record); err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, record)
+		}
+		return result
+	}
+
+	t.Run("request ID from header", func(t *testing.T) {
+		defer processor.CleanUp()
+		req := createRequest(``, fiber.MethodDelete, "/users/15", fiber.MIMEApplicationJSON)
+		req.Header.Set("X-Request-ID", "test-request")
+
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		if got := resp.Header.Get("X-Request-ID"); got != "test-request" {
+			t.Errorf("got request ID %q, expected %q", got, "test-request")
+		}
+
+		got := records()
+		if len(got) != 2 {
+			t.Fatalf("got %d log records, expected 2: %v", len(got), got)
+		}
+		if got[0]["msg"] != "deleting user" || got[0]["request_id"] != "test-request" {
+			t.Errorf("got storage log record: %v", got[0])
+		}
+		access := got[1]
+		if access["msg"] != "request" || access["request_id"] != "test-request" || access["method"] != "DELETE" ||
+			access["path"] != "/users/15" || access["status"] != float64(200) || access["user_id"] != float64(15) || access["level"] != "INFO" {
+			t.Errorf("got access log record: %v", access)
+		}
+		if _, ok := access["latency"]; !ok {
+			t.Errorf("got access log record without latency: %v", access)
+		}
+	})
+
+	t.Run("generated request ID", func(t *testing.T) {
+		defer processor.CleanUp()
+		for _, header := range []string{"", strings.Repeat("a", maxRequestIDLength+1), "bad\tid"} {
+			req := createRequest(``, fiber.MethodGet, "/segments", fiber.MIMEApplicationJSON)
+			if header != "" {
+				req.Header.Set("X-Request-ID", header)
+			}
+			processor.errOnGetSegments = errors.New("test error")
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"error":"test error","code":"internal_error"}`), http.StatusInternalServerError, fiber.MIMEApplicationJSON, t)
+			id := resp.Header.Get("X-Request-ID")
+			if len(id) != 32 || id == header {
+				t.Errorf("got generated request ID %q", id)
+			}
+
+			got := records()
+			if len(got) != 2 {
+				t.Fatalf("got %d log records, expected 2: %v", len(got), got)
+			}
+			for _, record := range got {
+				if record["request_id"] != id || record["level"] != "ERROR" {
+					t.Errorf("got log record: %v", record)
+				}
+			}
+			if _, ok := got[1]["user_id"]; ok {
+				t.Errorf("got access log record with user id: %v", got[1])
+			}
+		}
+	})
+}
+
+// Test_Metrics - тестирование учёта запросов в метриках.
+func Test_Metrics(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{Metrics: metrics.New()})
+	defer processor.CleanUp()
+
+	for _, path := range []string{"/users/1", "/users/2", "/unknown"} {
+		if _, err := app.webApp.Test(createRequest(``, fiber.MethodGet, path, fiber.MIMEApplicationJSON)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := app.webApp.Test(createRequest(``, fiber.MethodGet, "/metrics", fiber.MIMEApplicationJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, expected := range []string{
+		`usersegmentation_http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`usersegmentation_http_requests_total{method="GET",route="unknown",status="500"} 1`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("metrics do not contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+// Test_StatsWorker - тестирование фонового обновления метрик общего количества данных в хранилище.
+func Test_StatsWorker(t *testing.T) {
+	processor := &processorMock{callsOnGetStats: make(chan struct{})}
+	processor.resOnGetStats = models.Stats{Segments: 5, Users: 42}
+	app := CreateApp(logging.Discard, processor, Options{Metrics: metrics.New()})
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.runStatsWorker(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-processor.callsOnGetStats:
+		case <-time.After(time.Second):
+			t.Fatal("stats were not refreshed")
+		}
+	}
+
+	stop()
+	for {
+		select {
+		case <-processor.callsOnGetStats:
+			continue
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("worker was not stopped")
+		}
+		break
+	}
+
+	resp, err := app.webApp.Test(createRequest(``, fiber.MethodGet, "/metrics", fiber.MIMEApplicationJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, expected := range []string{"usersegmentation_segments 5", "usersegmentation_users 42"} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("metrics do not contain %q", expected)
+		}
+	}
+}
+
+// Test_Health - тестирование проверок состояния сервиса.
+func Test_Health(t *testing.T) {
+	var (
+		calls   int
+		testErr error
+	)
+	check := func(ctx context.Context) error {
+		calls++
+		return testErr
+	}
+
+	t.Run("liveness", func(t *testing.T) {
+		app := CreateApp(logging.Discard, &processorMock{}, Options{})
+		app.shuttingDown.Store(true)
+		req := createRequest(``, fiber.MethodGet, "/healthz", fiber.MIMEApplicationJSON)
+
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, []byte(`{"status":"ok"}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		calls, testErr = 0, nil
+		app := CreateApp(logging.Discard, &processorMock{}, Options{HealthChecks: map[string]HealthCheck{"storage": check}})
+
+		for i := 0; i < 3; i++ {
+			req := createRequest(``, fiber.MethodGet, "/readyz", fiber.MIMEApplicationJSON)
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"status":"ok","components":{"storage":{"status":"ok"}}}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		}
+		if calls != 3 {
+			t.Errorf("got %d checks, expected 3", calls)
+		}
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		calls, testErr = 0, fmt.Errorf("test error %d", rand.Int())
+		app := CreateApp(logging.Discard, &processorMock{}, Options{HealthChecks: map[string]HealthCheck{
+			"storage": check,
+			"other":   func(ctx context.Context) error { return nil },
+		}})
+		req := createRequest(``, fiber.MethodGet, "/readyz", fiber.MIMEApplicationJSON)
+		expectedBody := fmt.Sprintf(`{"status":"failing","components":{"other":{"status":"ok"},"storage":{"status":"failing","error":"%s"}}}`, testErr)
+
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, []byte(expectedBody), http.StatusServiceUnavailable, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		calls, testErr = 0, nil
+		app := CreateApp(logging.Discard, &processorMock{}, Options{
+			HealthChecks:  map[string]HealthCheck{"storage": check},
+			ReadyCacheTTL: time.Hour,
+		})
+
+		for i := 0; i < 3; i++ {
+			req := createRequest(``, fiber.MethodGet, "/readyz", fiber.MIMEApplicationJSON)
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, []byte(`{"status":"ok","components":{"storage":{"status":"ok"}}}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+			testErr = errors.New("test error")
+		}
+		if calls != 1 {
+			t.Errorf("got %d checks, expected 1", calls)
+		}
+	})
+
+	t.Run("cancelled request", func(t *testing.T) {
+		app := CreateApp(logging.Discard, &processorMock{}, Options{
+			HealthChecks: map[string]HealthCheck{"storage": func(ctx context.Context) error {
+				if _, ok := ctx.Deadline(); !ok {
+					return errors.New("check has no deadline")
+				}
+				return ctx.Err()
+			}},
+			ReadyCacheTTL: time.Hour,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if health := app.readiness(ctx); health.Status != models.HealthOK {
+			t.Errorf("got %+v after the request was cancelled", health)
+		}
+		req := createRequest(``, fiber.MethodGet, "/readyz", fiber.MIMEApplicationJSON)
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, []byte(`{"status":"ok","components":{"storage":{"status":"ok"}}}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("shutting down", func(t *testing.T) {
+		calls, testErr = 0, nil
+		app := CreateApp(logging.Discard, &processorMock{}, Options{HealthChecks: map[string]HealthCheck{"storage": check}})
+		app.shuttingDown.Store(true)
+		req := createRequest(``, fiber.MethodGet, "/readyz", fiber.MIMEApplicationJSON)
+
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, []byte(`{"status":"shutting_down"}`), http.StatusServiceUnavailable, fiber.MIMEApplicationJSON, t)
+		if calls != 0 {
+			t.Errorf("got %d checks, expected 0", calls)
+		}
+	})
+}
+
+// Test_Run - тестирование запуска и завершения работы приложения.
+func Test_Run(t *testing.T) {
+	t.Run("listen error", func(t *testing.T) {
+		app := CreateApp(logging.Discard, &processorMock{}, Options{ExpiryInterval: time.Millisecond})
+
+		if err := app.Run(context.Background(), "wrong address"); err == nil {
+			t.Error("expected listen error")
+		}
+	})
+
+	t.Run("graceful shutdown", func(t *testing.T) {
+		processor := &processorMock{callsOnGetSegment: make(chan struct{}), delayOnGetSegment: 200 * time.Millisecond}
+		app := CreateApp(logging.Discard, processor, Options{DrainDelay: 100 * time.Millisecond, ShutdownTimeout: time.Second})
+		addr, runErr, stop := runApp(t, app)
+
+		resp := make(chan *http.Response, 1)
+		go func() {
+			r, err := http.Get("http://" + addr + "/segments/test")
+			if err != nil {
+				t.Error(err)
+			}
+			resp <- r
+		}()
+		<-processor.callsOnGetSegment
+		stop()
+
+		time.Sleep(50 * time.Millisecond)
+		r, err := http.Get("http://" + addr + "/readyz")
+		checkResponse(r, err, []byte(`{"status":"shutting_down"}`), http.StatusServiceUnavailable, fiber.MIMEApplicationJSON, t)
+
+		if err := <-runErr; err != nil {
+			t.Errorf("unexpected: %s", err)
+		}
+		r = <-resp
+		checkResponse(r, nil, []byte(`{"id":0,"slug":"","created_at":"0001-01-01T00:00:00Z","description":"","owner_team":"","auto_percent":0,"members":0}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		if _, err := http.Get("http://" + addr + "/healthz"); err == nil {
+			t.Error("expected server to stop accepting requests")
+		}
+	})
+
+	t.Run("shutdown timeout", func(t *testing.T) {
+		processor := &processorMock{callsOnGetSegment: make(chan struct{}), waitOnGetSegment: true}
+		app := CreateApp(logging.Discard, processor, Options{ShutdownTimeout: 100 * time.Millisecond})
+		addr, runErr, stop := runApp(t, app)
+
+		resp := make(chan *http.Response, 1)
+		go func() {
+			r, _ := http.Get("http://" + addr + "/segments/test")
+			resp <- r
+		}()
+		<-processor.callsOnGetSegment
+		stop()
+
+		if err := <-runErr; !errors.Is(err, ErrShutdownTimeout) {
+			t.Errorf("got err = %v, expected %v", err, ErrShutdownTimeout)
+		}
+		select {
+		case <-resp:
+		case <-time.After(time.Second):
+			t.Error("request was not cancelled")
+		}
+	})
+}
+
+// runApp - запуск приложения на свободном порту.
+//
+// Принимает: тест, приложение.
+//
+// Возвращает: адрес приложения, канал ошибки Run и функцию завершения работы приложения.
+func runApp(t *testing.T, app *App) (string, <-chan error, context.CancelFunc) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, stop := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run(ctx, addr)
+	}()
+
+	for i := 0; i < 100; i++ {
+		if _, err = http.Get("http://" + addr + "/healthz"); err == nil {
+			return addr, runErr, stop
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("app is not listening: %s", err)
+
+	return "", nil, nil
+}
+
+// Test_ExpiryWorker - тестирование фонового удаления истёкших членств пользователей в сегментах.
+func Test_ExpiryWorker(t *testing.T) {
+	processor := &processorMock{callsOnDeleteExpired: make(chan struct{})}
+	app := CreateApp(logging.Discard, processor, Options{})
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.runExpiryWorker(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-processor.callsOnDeleteExpired:
+		case <-time.After(time.Second):
+			t.Fatal("expired relations were not deleted")
+		}
+	}
+
+	stop()
+	for {
+		select {
+		case <-processor.callsOnDeleteExpired:
+		case <-done:
+			return
+		case <-time.After(time.Second):
+			t.Fatal("worker was not stopped")
+		}
+	}
+}
+
 func checkResponse(got *http.Response, gotErr error, expectedBody []byte, expectedStatusCode int, expectedContentType string, t *testing.T) {
 	if gotErr != nil {
 		t.Errorf("unexpected: %s\n", gotErr)
@@ -250,3 +1625,407 @@ func createRequest(body string, method string, path string, contentType string)
 
 	return req
 }
+
+// Test_PurgeWorker - тестирование фонового окончательного удаления сегментов.
+func Test_PurgeWorker(t *testing.T) {
+	processor := &processorMock{callsOnPurgeDeleted: make(chan time.Time)}
+	app := CreateApp(logging.Discard, processor, Options{})
+	retention := time.Duration(1+rand.Intn(1000)) * time.Hour
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.runPurgeWorker(ctx, time.Millisecond, retention)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case before := <-processor.callsOnPurgeDeleted:
+			if d := time.Since(before) - retention; d < 0 || d > time.Second {
+				t.Errorf("got purge time %v, expected %v ago", before, retention)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("deleted segments were not purged")
+		}
+	}
+
+	stop()
+	for {
+		select {
+		case <-processor.callsOnPurgeDeleted:
+		case <-done:
+			return
+		case <-time.After(time.Second):
+			t.Fatal("worker was not stopped")
+		}
+	}
+}
+
+// Test_Auth - тестирование аутентификации клиентов и проверки их ролей.
+func Test_Auth(t *testing.T) {
+	processor := &processorMock{}
+	jwt, err := auth.NewJWT(map[string][]byte{"main": []byte("0123456789abcdef0123456789abcdef")}, auth.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := CreateApp(logging.Discard, processor, Options{Auth: jwt})
+
+	token := func(subject string, roles ...auth.Role) string {
+		token, err := jwt.Issue("", auth.Principal{Subject: subject, Roles: roles}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+	unauthorized := []byte(`{"error":"bearer token is required: unauthorized","code":"unauthorized"}`)
+	forbiddenAdmin := []byte(`{"error":"role admin is required: forbidden","code":"forbidden"}`)
+	forbiddenEditor := []byte(`{"error":"role editor is required: forbidden","code":"forbidden"}`)
+
+	cases := []struct {
+		name          string
+		authorization string
+		method        string
+		path          string
+		body          string
+		expected      []byte
+		status        int
+	}{
+		{"no token", "", fiber.MethodGet, "/users/1", ``, unauthorized, http.StatusUnauthorized},
+		{"wrong scheme", "Basic dXNlcjpwYXNz", fiber.MethodGet, "/users/1", ``, unauthorized, http.StatusUnauthorized},
+		{"reader gets user", token("reader", auth.RoleReader), fiber.MethodGet, "/users/1", ``, []byte(`[]`), http.StatusOK},
+		{"reader modifies user", token("reader", auth.RoleReader), fiber.MethodPatch, "/users", `{"id":1,"append":[],"remove":[]}`, forbiddenEditor, http.StatusForbidden},
+		{"reader lists segments", token("reader", auth.RoleReader), fiber.MethodGet, "/segments", ``, forbiddenEditor, http.StatusForbidden},
+		{"editor modifies user", token("editor", auth.RoleEditor), fiber.MethodPatch, "/users", `{"id":1,"append":[],"remove":[]}`, []byte(`{"append":null,"remove":null}`), http.StatusOK},
+		{"editor gets user", token("editor", auth.RoleEditor), fiber.MethodGet, "/users/1", ``, []byte(`[]`), http.StatusOK},
+		{"editor creates segment", token("editor", auth.RoleEditor), fiber.MethodPost, "/segments", `{"slug":"test"}`, forbiddenAdmin, http.StatusForbidden},
+		{"editor deletes segment", token("editor", auth.RoleEditor), fiber.MethodDelete, "/segments", `{"slug":"test"}`, forbiddenAdmin, http.StatusForbidden},
+		{"admin creates segment", token("admin", auth.RoleAdmin), fiber.MethodPost, "/segments", `{"slug":"test"}`, []byte(`{"id":0}`), http.StatusOK},
+		{"admin deletes segment", token("admin", auth.RoleAdmin), fiber.MethodDelete, "/segments", `{"slug":"test"}`, []byte(`"OK"`), http.StatusOK},
+		{"no roles", token("guest"), fiber.MethodGet, "/users/1", ``, []byte(`{"error":"role reader is required: forbidden","code":"forbidden"}`), http.StatusForbidden},
+		{"health without token", "", fiber.MethodGet, "/healthz", ``, []byte(`{"status":"ok"}`), http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer processor.CleanUp()
+			req := createRequest(c.body, c.method, c.path, fiber.MIMEApplicationJSON)
+			if c.authorization != "" {
+				req.Header.Set("Authorization", c.authorization)
+			}
+
+			resp, err := app.webApp.Test(req)
+			checkResponse(resp, err, c.expected, c.status, fiber.MIMEApplicationJSON, t)
+			if c.status == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("got WWW-Authenticate = %q", resp.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		other, err := auth.NewJWT(map[string][]byte{"main": []byte("fedcba9876543210fedcba9876543210")}, auth.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged, err := other.Issue("", auth.Principal{Subject: "admin", Roles: []auth.Role{auth.RoleAdmin}}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expired, err := jwt.Issue("", auth.Principal{Subject: "admin", Roles: []auth.Role{auth.RoleAdmin}}, -time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, token := range []string{"malformed", forged, expired} {
+			req := createRequest(``, fiber.MethodGet, "/users/1", fiber.MIMEApplicationJSON)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			resp, err := app.webApp.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusUnauthorized || !bytes.Contains(body, []byte(`"code":"unauthorized"`)) {
+				t.Errorf("got status %d and body %s for token %q", resp.StatusCode, body, token)
+			}
+			if got := resp.Header.Get("WWW-Authenticate"); got != `Bearer error="invalid_token"` {
+				t.Errorf("got WWW-Authenticate = %q", got)
+			}
+		}
+	})
+
+	t.Run("principal in handler", func(t *testing.T) {
+		defer processor.CleanUp()
+		req := createRequest(``, fiber.MethodGet, "/users/1", fiber.MIMEApplicationJSON)
+		req.Header.Set("Authorization", token("crm", auth.RoleEditor))
+
+		resp, err := app.webApp.Test(req)
+		checkResponse(resp, err, []byte(`[]`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		if got := processor.gotPrincipalOnGetUserRelations; got.Subject != "crm" || len(got.Roles) != 1 || got.Roles[0] != auth.RoleEditor {
+			t.Errorf("got principal %+v", got)
+		}
+	})
+}
+
+func Test_APIKeys(t *testing.T) {
+	processor := &processorMock{}
+	store := memory.NewAPIKeyStore()
+	app := CreateApp(logging.Discard, processor, Options{APIKeys: store})
+
+	admin, err := CreateAPIKey(context.Background(), store, models.APIKeyCreation{Name: "admin", Role: string(auth.RoleAdmin)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(admin.Secret, admin.Prefix) {
+		t.Fatalf("got secret %q with prefix %q", admin.Secret, admin.Prefix)
+	}
+
+	request := func(secret string, body string, method string, path string) (*http.Response, error) {
+		req := createRequest(body, method, path, fiber.MIMEApplicationJSON)
+		if secret != "" {
+			req.Header.Set(auth.APIKeyHeader, secret)
+		}
+		return app.webApp.Test(req)
+	}
+
+	var editor models.CreatedAPIKey
+	t.Run("create key", func(t *testing.T) {
+		resp, err := request(admin.Secret, `{"name":"crm","role":"editor"}`, fiber.MethodPost, "/api-keys")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("got status %d", resp.StatusCode)
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&editor); err != nil {
+			t.Fatal(err)
+		}
+		if editor.ID != 2 || editor.Name != "crm" || editor.Role != "editor" || editor.Secret == "" || editor.Secret == admin.Secret {
+			t.Errorf("got created key %+v", editor)
+		}
+	})
+
+	invalid := []byte(`{"error":"invalid api key: unauthorized","code":"unauthorized"}`)
+	cases := []struct {
+		name     string
+		secret   string
+		method   string
+		path     string
+		body     string
+		expected []byte
+		status   int
+	}{
+		{"no key", "", fiber.MethodGet, "/users/1", ``, []byte(`{"error":"api key is required: unauthorized","code":"unauthorized"}`), http.StatusUnauthorized},
+		{"unknown key", "usk_unknown", fiber.MethodGet, "/users/1", ``, invalid, http.StatusUnauthorized},
+		{"editor gets user", editor.Secret, fiber.MethodGet, "/users/1", ``, []byte(`[]`), http.StatusOK},
+		{"editor creates key", editor.Secret, fiber.MethodPost, "/api-keys", `{"name":"other","role":"admin"}`, []byte(`{"error":"role admin is required: forbidden","code":"forbidden"}`), http.StatusForbidden},
+		{"unknown role", admin.Secret, fiber.MethodPost, "/api-keys", `{"name":"other","role":"root"}`, []byte(`{"error":"\"role\" must be reader, editor or admin","code":"bad_request"}`), http.StatusBadRequest},
+		{"expired creation", admin.Secret, fiber.MethodPost, "/api-keys", `{"name":"other","role":"reader","expires_at":"2000-01-01T00:00:00Z"}`, []byte(`{"error":"\"expires_at\" must be in the future","code":"bad_request"}`), http.StatusBadRequest},
+		{"revoke unknown key", admin.Secret, fiber.MethodDelete, "/api-keys/100", ``, []byte(`{"error":"api key 100: api key not found","code":"api_key_not_found"}`), http.StatusNotFound},
+		{"invalid id", admin.Secret, fiber.MethodPatch, "/api-keys/crm", `{"expires_at":null}`, []byte(`{"error":"path parameter \"id\" must be an integer","code":"bad_request"}`), http.StatusBadRequest},
+		{"id out of range", admin.Secret, fiber.MethodDelete, "/api-keys/3000000000", ``, []byte(`{"error":"path parameter \"id\" must be between -2147483648 and 2147483647","code":"bad_request"}`), http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer processor.CleanUp()
+			resp, err := request(c.secret, c.body, c.method, c.path)
+			checkResponse(resp, err, c.expected, c.status, fiber.MIMEApplicationJSON, t)
+		})
+	}
+
+	t.Run("principal in handler", func(t *testing.T) {
+		defer processor.CleanUp()
+		resp, err := request(editor.Secret, ``, fiber.MethodGet, "/users/1")
+		checkResponse(resp, err, []byte(`[]`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		if got := processor.gotPrincipalOnGetUserRelations; got.Subject != "api_key:2" || len(got.Roles) != 1 || got.Roles[0] != auth.RoleEditor {
+			t.Errorf("got principal %+v", got)
+		}
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		if err := app.flushAPIKeyUsage(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := request(admin.Secret, ``, fiber.MethodGet, "/api-keys")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]models.APIKey, 0)
+		if err = json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 2 {
+			t.Fatalf("got keys %+v", keys)
+		}
+		// Запрос создания ключа редактором отклонён по роли, но ключ при этом использован.
+		if keys[1].UsageCount != 3 || keys[1].LastUsedAt == nil {
+			t.Errorf("got editor key %+v, expected 3 usages", keys[1])
+		}
+		if bytes.Contains([]byte(fmt.Sprint(keys)), []byte(editor.Secret)) {
+			t.Error("secret is returned in the list of keys")
+		}
+	})
+
+	t.Run("expiry and revocation", func(t *testing.T) {
+		resp, err := request(admin.Secret, `{"expires_at":"2000-01-01T00:00:00Z"}`, fiber.MethodPatch, "/api-keys/2")
+		checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		resp, err = request(editor.Secret, ``, fiber.MethodGet, "/users/1")
+		expired := []byte(fmt.Sprintf(`{"error":"api key %s is revoked or expired: unauthorized","code":"unauthorized"}`, editor.Prefix))
+		checkResponse(resp, err, expired, http.StatusUnauthorized, fiber.MIMEApplicationJSON, t)
+
+		resp, err = request(admin.Secret, `{"expires_at":null}`, fiber.MethodPatch, "/api-keys/2")
+		checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		resp, err = request(editor.Secret, ``, fiber.MethodGet, "/users/1")
+		checkResponse(resp, err, []byte(`[]`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+
+		resp, err = request(admin.Secret, ``, fiber.MethodDelete, "/api-keys/2")
+		checkResponse(resp, err, []byte(`"OK"`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		resp, err = request(editor.Secret, ``, fiber.MethodGet, "/users/1")
+		checkResponse(resp, err, expired, http.StatusUnauthorized, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("with bearer tokens", func(t *testing.T) {
+		jwt, err := auth.NewJWT(map[string][]byte{"main": []byte("0123456789abcdef0123456789abcdef")}, auth.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := CreateApp(logging.Discard, processor, Options{Auth: jwt, APIKeys: store})
+
+		resp, err := app.webApp.Test(createRequest(``, fiber.MethodGet, "/users/1", fiber.MIMEApplicationJSON))
+		checkResponse(resp, err, []byte(`{"error":"bearer token or api key is required: unauthorized","code":"unauthorized"}`), http.StatusUnauthorized, fiber.MIMEApplicationJSON, t)
+
+		req := createRequest(``, fiber.MethodGet, "/api-keys", fiber.MIMEApplicationJSON)
+		req.Header.Set(auth.APIKeyHeader, admin.Secret)
+		resp, err = app.webApp.Test(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("got status %d and err = %v", resp.StatusCode, err)
+		}
+	})
+}
+
+func Test_RateLimit(t *testing.T) {
+	processor := &processorMock{}
+	limits := map[ratelimit.Class]ratelimit.Limit{
+		ratelimit.ClassRead:  {Rate: 0.001, Burst: 2},
+		ratelimit.ClassWrite: {Rate: 0.001, Burst: 1},
+	}
+	limited := func(class ratelimit.Class) []byte {
+		return []byte(fmt.Sprintf(`{"error":"too many %s requests: rate limit exceeded","code":"rate_limited"}`, class))
+	}
+
+	t.Run("by ip", func(t *testing.T) {
+		app := CreateApp(logging.Discard, processor, Options{RateLimits: limits})
+
+		for i, expected := range []struct {
+			remaining string
+			status    int
+		}{{"1", http.StatusOK}, {"0", http.StatusOK}, {"0", http.StatusTooManyRequests}} {
+			resp, err := app.webApp.Test(createRequest(``, fiber.MethodGet, "/users/1", fiber.MIMEApplicationJSON))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != expected.status || resp.Header.Get("RateLimit-Limit") != "2" || resp.Header.Get("RateLimit-Remaining") != expected.remaining {
+				t.Errorf("request %d: got status %d and headers %v", i, resp.StatusCode, resp.Header)
+			}
+			if reset, err := strconv.Atoi(resp.Header.Get("RateLimit-Reset")); err != nil || reset < 1 {
+				t.Errorf("request %d: got RateLimit-Reset %q", i, resp.Header.Get("RateLimit-Reset"))
+			}
+		}
+
+		resp, err := app.webApp.Test(createRequest(``, fiber.MethodGet, "/segments", fiber.MIMEApplicationJSON))
+		checkResponse(resp, err, limited(ratelimit.ClassRead), http.StatusTooManyRequests, fiber.MIMEApplicationJSON, t)
+		if retry, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retry < 1 {
+			t.Errorf("got Retry-After %q", resp.Header.Get("Retry-After"))
+		}
+
+		// Ограничения классов не зависят друг от друга, а класс admin не ограничен.
+		resp, err = app.webApp.Test(createRequest(`{"id":1,"append":[],"remove":[]}`, fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON))
+		checkResponse(resp, err, []byte(`{"append":null,"remove":null}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		resp, err = app.webApp.Test(createRequest(`{"id":1,"append":[],"remove":[]}`, fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON))
+		checkResponse(resp, err, limited(ratelimit.ClassWrite), http.StatusTooManyRequests, fiber.MIMEApplicationJSON, t)
+		resp, err = app.webApp.Test(createRequest(`{"slug":"test"}`, fiber.MethodPost, "/segments", fiber.MIMEApplicationJSON))
+		checkResponse(resp, err, []byte(`{"id":0}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		if resp.Header.Get("RateLimit-Limit") != "" {
+			t.Errorf("got RateLimit-Limit %q for unlimited class", resp.Header.Get("RateLimit-Limit"))
+		}
+		processor.CleanUp()
+
+		resp, err = app.webApp.Test(createRequest(``, fiber.MethodGet, "/healthz", fiber.MIMEApplicationJSON))
+		checkResponse(resp, err, []byte(`{"status":"ok"}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("by subject", func(t *testing.T) {
+		jwt, err := auth.NewJWT(map[string][]byte{"main": []byte("0123456789abcdef0123456789abcdef")}, auth.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := CreateApp(logging.Discard, processor, Options{Auth: jwt, RateLimits: limits})
+
+		modify := func(subject string) (*http.Response, error) {
+			token, err := jwt.Issue("", auth.Principal{Subject: subject, Roles: []auth.Role{auth.RoleEditor}}, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := createRequest(`{"id":1,"append":[],"remove":[]}`, fiber.MethodPatch, "/users", fiber.MIMEApplicationJSON)
+			req.Header.Set("Authorization", "Bearer "+token)
+			return app.webApp.Test(req)
+		}
+
+		resp, err := modify("batch")
+		checkResponse(resp, err, []byte(`{"append":null,"remove":null}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		resp, err = modify("batch")
+		checkResponse(resp, err, limited(ratelimit.ClassWrite), http.StatusTooManyRequests, fiber.MIMEApplicationJSON, t)
+		resp, err = modify("crm")
+		checkResponse(resp, err, []byte(`{"append":null,"remove":null}`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+	})
+
+	t.Run("auth failures", func(t *testing.T) {
+		store := &countingAPIKeyStore{APIKeyStore: memory.NewAPIKeyStore()}
+		key, err := CreateAPIKey(context.Background(), store, models.APIKeyCreation{Name: "crm", Role: string(auth.RoleReader)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := CreateApp(logging.Discard, processor, Options{APIKeys: store, RateLimits: map[ratelimit.Class]ratelimit.Limit{
+			ratelimit.ClassAuth: {Rate: 0.001, Burst: 3},
+		}})
+		request := func(secret string) (*http.Response, error) {
+			req := createRequest(``, fiber.MethodGet, "/users/1", fiber.MIMEApplicationJSON)
+			req.Header.Set(auth.APIKeyHeader, secret)
+			return app.webApp.Test(req)
+		}
+
+		// Успешная аутентификация не расходует попытки.
+		for i := 0; i < 5; i++ {
+			resp, err := request(key.Secret)
+			checkResponse(resp, err, []byte(`[]`), http.StatusOK, fiber.MIMEApplicationJSON, t)
+		}
+		for i := 0; i < 3; i++ {
+			resp, err := request("usk_invalid")
+			checkResponse(resp, err, []byte(`{"error":"invalid api key: unauthorized","code":"unauthorized"}`), http.StatusUnauthorized, fiber.MIMEApplicationJSON, t)
+		}
+
+		lookups := store.lookups.Load()
+		for _, secret := range []string{"usk_invalid", key.Secret} {
+			resp, err := request(secret)
+			checkResponse(resp, err, []byte(`{"error":"too many failed authentication attempts: rate limit exceeded","code":"rate_limited"}`),
+				http.StatusTooManyRequests, fiber.MIMEApplicationJSON, t)
+			if retry, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retry < 1 {
+				t.Errorf("got Retry-After %q", resp.Header.Get("Retry-After"))
+			}
+		}
+		if got := store.lookups.Load(); got != lookups {
+			t.Errorf("got %d api key lookups after the attempts were exhausted", got-lookups)
+		}
+	})
+}
+
+// countingAPIKeyStore - хранилище ключей API, подсчитывающее поиски ключей по хешу.
+type countingAPIKeyStore struct {
+	models.APIKeyStore
+	lookups atomic.Int64 // lookups - количество вызовов GetAPIKeyByHash.
+}
+
+func (s *countingAPIKeyStore) GetAPIKeyByHash(ctx context.Context, hash []byte) (models.APIKey, error) {
+	s.lookups.Add(1)
+	return s.APIKeyStore.GetAPIKeyByHash(ctx, hash)
+}
@@ -0,0 +1,166 @@
+package usersegmentation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// authorize - создание промежуточного обработчика, пропускающего только запросы клиентов с ролью не ниже требуемой.
+// Клиент аутентифицируется по ключу API из заголовка X-API-Key, если он передан и ключи API включены (Options.APIKeys не равен nil),
+// иначе - по токену из заголовка "Authorization: Bearer <token>", и сохраняется в контексте запроса (см. auth.FromContext).
+// Если аутентификация отключена (Options.Auth и Options.APIKeys равны nil), то пропускаются все запросы.
+// Частота неудачных попыток аутентификации с одного IP адреса ограничивается (см. limitAuthFailures).
+//
+// Принимает: требуемую роль.
+//
+// Возвращает: промежуточный обработчик, возвращающий 401, если ключ или токен не передан или недействителен, 403, если роли клиента недостаточно,
+// и 429 с заголовком Retry-After, если неудачные попытки аутентификации с IP адреса клиента исчерпаны.
+func (app *App) authorize(role auth.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if app.options.Auth == nil && app.options.APIKeys == nil {
+			return c.Next()
+		}
+
+		principal, retryAfter, err := app.limitAuthFailures(c.IP(), func() (auth.Principal, error) {
+			return app.authenticate(c)
+		})
+		if err != nil {
+			if retryAfter > 0 {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(seconds(retryAfter), 1)))
+			}
+			return sendError(c, err)
+		}
+		c.SetUserContext(auth.WithPrincipal(c.UserContext(), principal))
+
+		if !principal.Allows(role) {
+			return sendError(c, fmt.Errorf("role %s is required: %w", role, models.ErrForbidden))
+		}
+
+		return c.Next()
+	}
+}
+
+// authenticate - аутентификация клиента HTTP запроса по ключу API или токену.
+// Если токен не передан или недействителен, то к ответу добавляется заголовок WWW-Authenticate.
+//
+// Принимает: контекст.
+//
+// Возвращает: клиента и ошибку (models.ErrUnauthorized, если ключ или токен не передан или недействителен).
+func (app *App) authenticate(c *fiber.Ctx) (auth.Principal, error) {
+	principal, challenge, err := app.authenticateCredentials(c.UserContext(), c.Get(auth.APIKeyHeader), c.Get(fiber.HeaderAuthorization))
+	if challenge != "" {
+		c.Set(fiber.HeaderWWWAuthenticate, challenge)
+	}
+
+	return principal, err
+}
+
+// authenticateCredentials - аутентификация клиента по ключу API или токену независимо от протокола запроса.
+// Ключ API используется, если он передан и ключи API включены (Options.APIKeys не равен nil), иначе - токен.
+//
+// Принимает: контекст, секрет ключа API и значение заголовка Authorization ("Bearer <token>").
+//
+// Возвращает: клиента, значение заголовка WWW-Authenticate (пустая строка, если он не нужен)
+// и ошибку (models.ErrUnauthorized, если ключ или токен не передан или недействителен).
+func (app *App) authenticateCredentials(ctx context.Context, apiKey string, authorization string) (auth.Principal, string, error) {
+	if apiKey != "" && app.options.APIKeys != nil {
+		principal, err := app.authenticateAPIKey(ctx, apiKey)
+		return principal, "", err
+	}
+
+	if app.options.Auth == nil {
+		return auth.Principal{}, "", fmt.Errorf("api key is required: %w", models.ErrUnauthorized)
+	}
+	scheme, token, _ := strings.Cut(authorization, " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		if app.options.APIKeys != nil {
+			return auth.Principal{}, "Bearer", fmt.Errorf("bearer token or api key is required: %w", models.ErrUnauthorized)
+		}
+		return auth.Principal{}, "Bearer", fmt.Errorf("bearer token is required: %w", models.ErrUnauthorized)
+	}
+	principal, err := app.options.Auth.Verify(token)
+	if err != nil {
+		return auth.Principal{}, `Bearer error="invalid_token"`, fmt.Errorf("invalid token: %s: %w", err, models.ErrUnauthorized)
+	}
+
+	return principal, "", nil
+}
+
+// authenticateAPIKey - аутентификация клиента по секрету ключа API.
+// Использование действительного ключа учитывается и сохраняется в хранилище фоновым процессом (см. runAPIKeyUsageWorker).
+//
+// Принимает: контекст и секрет ключа.
+//
+// Возвращает: клиента с идентификатором "api_key:<id>" и ролью ключа и ошибку (models.ErrUnauthorized, если ключ не существует, отозван или истёк).
+func (app *App) authenticateAPIKey(ctx context.Context, secret string) (auth.Principal, error) {
+	key, err := app.options.APIKeys.GetAPIKeyByHash(ctx, auth.HashAPIKey(secret))
+	if errors.Is(err, models.ErrAPIKeyNotFound) {
+		return auth.Principal{}, fmt.Errorf("invalid api key: %w", models.ErrUnauthorized)
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	now := time.Now()
+	if !key.Active(now) {
+		return auth.Principal{}, fmt.Errorf("api key %s is revoked or expired: %w", key.Prefix, models.ErrUnauthorized)
+	}
+	app.recordAPIKeyUsage(key.ID, now)
+
+	return auth.Principal{Subject: "api_key:" + strconv.Itoa(key.ID), Roles: []auth.Role{auth.Role(key.Role)}}, nil
+}
+
+// recordAPIKeyUsage - учёт использования ключа API до сохранения в хранилище.
+//
+// Принимает: id ключа и время использования.
+func (app *App) recordAPIKeyUsage(id int, at time.Time) {
+	app.apiKeyUsageMu.Lock()
+	defer app.apiKeyUsageMu.Unlock()
+
+	usage := app.apiKeyUsage[id]
+	usage.Count++
+	if at.After(usage.LastUsed) {
+		usage.LastUsed = at
+	}
+	app.apiKeyUsage[id] = usage
+}
+
+// flushAPIKeyUsage - сохранение учтённых использований ключей API в хранилище.
+// Если сохранить не удалось, использования возвращаются в учёт и сохраняются при следующем вызове.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+func (app *App) flushAPIKeyUsage(ctx context.Context) error {
+	app.apiKeyUsageMu.Lock()
+	usage := app.apiKeyUsage
+	app.apiKeyUsage = make(map[int]models.APIKeyUsage)
+	app.apiKeyUsageMu.Unlock()
+
+	if len(usage) == 0 {
+		return nil
+	}
+	if err := app.options.APIKeys.RecordAPIKeyUsage(ctx, usage); err != nil {
+		app.apiKeyUsageMu.Lock()
+		for id, u := range usage {
+			pending := app.apiKeyUsage[id]
+			pending.Count += u.Count
+			if u.LastUsed.After(pending.LastUsed) {
+				pending.LastUsed = u.LastUsed
+			}
+			app.apiKeyUsage[id] = pending
+		}
+		app.apiKeyUsageMu.Unlock()
+		return err
+	}
+
+	return nil
+}
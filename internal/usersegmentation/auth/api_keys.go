@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// APIKeyHeader - заголовок, в котором передаётся секрет ключа API.
+const APIKeyHeader = "X-API-Key"
+
+// Параметры секретов ключей API.
+const (
+	apiKeyScheme       = "usk_" // apiKeyScheme - начало всех секретов ключей API, упрощающее их поиск в коде и логах.
+	apiKeyBytes        = 32     // apiKeyBytes - количество случайных байт секрета.
+	apiKeyPrefixLength = 12     // apiKeyPrefixLength - длина начала секрета, хранящегося для узнавания ключа.
+)
+
+// NewAPIKeySecret - генерация секрета ключа API.
+//
+// Возвращает: секрет, его начало для узнавания ключа, хеш секрета для хранения и ошибку.
+func NewAPIKeySecret() (string, string, []byte, error) {
+	b := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", nil, err
+	}
+	secret := apiKeyScheme + base64.RawURLEncoding.EncodeToString(b)
+
+	return secret, secret[:apiKeyPrefixLength], HashAPIKey(secret), nil
+}
+
+// HashAPIKey - получение хеша секрета ключа API.
+// Секрет содержит 256 случайных бит, поэтому для хранения достаточно SHA-256 без соли.
+//
+// Принимает: секрет.
+//
+// Возвращает: хеш секрета.
+func HashAPIKey(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
+
+// ValidRole - проверка роли.
+//
+// Принимает: роль.
+//
+// Возвращает: true, если роль - reader, editor или admin.
+func ValidRole(role Role) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Test_NewAPIKeySecret - тестирование генерации секретов ключей API.
+func Test_NewAPIKeySecret(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		secret, prefix, hash, err := NewAPIKeySecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(secret, apiKeyScheme) || !strings.HasPrefix(secret, prefix) || len(prefix) != apiKeyPrefixLength {
+			t.Errorf("got secret %q with prefix %q", secret, prefix)
+		}
+		if !bytes.Equal(hash, HashAPIKey(secret)) || bytes.Equal(hash, HashAPIKey(secret+"x")) {
+			t.Errorf("got hash %x that does not match secret %q", hash, secret)
+		}
+		if seen[secret] {
+			t.Errorf("got secret %q twice", secret)
+		}
+		seen[secret] = true
+	}
+}
+
+// Test_ValidRole - тестирование проверки ролей.
+func Test_ValidRole(t *testing.T) {
+	for role, expected := range map[Role]bool{RoleReader: true, RoleEditor: true, RoleAdmin: true, "": false, "root": false, "Admin": false} {
+		if got := ValidRole(role); got != expected {
+			t.Errorf("got ValidRole(%q) = %t, expected %t", role, got, expected)
+		}
+	}
+}
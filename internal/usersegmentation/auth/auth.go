@@ -0,0 +1,223 @@
+// auth - пакет, реализующий аутентификацию клиентов по JWT и проверку их ролей.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Role - роль клиента.
+type Role string
+
+// Роли клиентов. Каждая следующая роль включает права предыдущих.
+const (
+	RoleReader Role = "reader" // RoleReader - получение сегментов пользователя.
+	RoleEditor Role = "editor" // RoleEditor - изменение сегментов пользователей и просмотр сегментов.
+	RoleAdmin  Role = "admin"  // RoleAdmin - создание, изменение и удаление сегментов, удаление пользователей.
+)
+
+// roleLevels - уровни ролей: роль с большим уровнем включает права ролей с меньшим.
+var roleLevels = map[Role]int{
+	RoleReader: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Principal - структура, описывающая аутентифицированного клиента.
+type Principal struct {
+	Subject string // Subject - идентификатор клиента (поле sub токена).
+	Roles   []Role // Roles - роли клиента.
+}
+
+// Allows - проверка наличия у клиента роли не ниже требуемой.
+//
+// Принимает: требуемую роль.
+//
+// Возвращает: true, если у клиента есть требуемая роль или роль, включающая её права.
+func (p Principal) Allows(required Role) bool {
+	for _, role := range p.Roles {
+		if level, ok := roleLevels[role]; ok && level >= roleLevels[required] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// principalKey - ключ клиента в контексте.
+type principalKey struct{}
+
+// WithPrincipal - сохранение аутентифицированного клиента в контексте.
+//
+// Принимает: контекст и клиента.
+//
+// Возвращает: контекст с клиентом.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext - получение аутентифицированного клиента из контекста.
+//
+// Принимает: контекст.
+//
+// Возвращает: клиента и флаг его наличия в контексте (false, если аутентификация отключена).
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// MinKeyLength - минимальная длина ключа подписи токенов в байтах.
+const MinKeyLength = 32
+
+// signingMethods - допустимые алгоритмы подписи токенов.
+var signingMethods = []string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodHS384.Alg(), jwt.SigningMethodHS512.Alg()}
+
+// Options - настройки проверки токенов.
+type Options struct {
+	Issuer   string        // Issuer - требуемое значение поля iss токена (пустое - не проверяется).
+	Audience string        // Audience - требуемое значение поля aud токена (пустое - не проверяется).
+	Leeway   time.Duration // Leeway - допустимое расхождение часов при проверке полей exp, nbf и iat.
+}
+
+// JWT - структура, описывающая выпуск и проверку токенов, подписанных HMAC.
+type JWT struct {
+	keys    map[string][]byte // keys - ключи подписи по их ID (поле kid заголовка токена).
+	options Options           // options - настройки проверки токенов.
+	parser  *jwt.Parser       // parser - разборщик токенов.
+}
+
+// claims - поля токена.
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []Role `json:"roles"` // Roles - роли клиента.
+}
+
+// NewJWT - создание выпуска и проверки токенов.
+//
+// Принимает: ключи подписи по их ID и настройки проверки токенов.
+//
+// Возвращает: выпуск и проверку токенов и ошибку (если ключей нет или какой-либо из них короче MinKeyLength).
+func NewJWT(keys map[string][]byte, options Options) (*JWT, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one signing key is required")
+	}
+	for id, key := range keys {
+		if len(key) < MinKeyLength {
+			return nil, fmt.Errorf("signing key %q must be at least %d bytes long", id, MinKeyLength)
+		}
+	}
+
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(options.Leeway),
+	}
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+	if options.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(options.Audience))
+	}
+
+	return &JWT{keys: keys, options: options, parser: jwt.NewParser(parserOptions...)}, nil
+}
+
+// Verify - проверка токена.
+// Токен должен быть подписан одним из ключей (если в заголовке указан kid - ключом с этим ID), содержать поля sub и exp и не быть просроченным.
+//
+// Принимает: токен.
+//
+// Возвращает: клиента, которому выдан токен, и ошибку.
+func (j *JWT) Verify(token string) (Principal, error) {
+	c := &claims{}
+	if _, err := j.parser.ParseWithClaims(token, c, j.key); err != nil {
+		return Principal{}, err
+	}
+	if c.Subject == "" {
+		return Principal{}, errors.New("token has no subject")
+	}
+
+	return Principal{Subject: c.Subject, Roles: c.Roles}, nil
+}
+
+// key - получение ключа проверки подписи токена.
+//
+// Принимает: токен.
+//
+// Возвращает: ключ с ID из заголовка kid или, если kid не указан, все ключи, и ошибку.
+func (j *JWT) key(token *jwt.Token) (any, error) {
+	if id, ok := token.Header["kid"].(string); ok {
+		key, ok := j.keys[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", id)
+		}
+		return key, nil
+	}
+
+	set := jwt.VerificationKeySet{}
+	for _, id := range j.keyIDs() {
+		set.Keys = append(set.Keys, j.keys[id])
+	}
+
+	return set, nil
+}
+
+// keyIDs - получение отсортированного списка ID ключей.
+//
+// Возвращает: ID ключей.
+func (j *JWT) keyIDs() []string {
+	ids := make([]string, 0, len(j.keys))
+	for id := range j.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Issue - выпуск токена, подписанного HS256.
+//
+// Принимает: ID ключа подписи (пустой - первый по алфавиту ключ), клиента и время действия токена.
+//
+// Возвращает: токен и ошибку.
+func (j *JWT) Issue(keyID string, p Principal, ttl time.Duration) (string, error) {
+	if keyID == "" {
+		keyID = j.keyIDs()[0]
+	}
+	key, ok := j.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown signing key %q", keyID)
+	}
+	if p.Subject == "" {
+		return "", errors.New("subject must not be empty")
+	}
+	for _, role := range p.Roles {
+		if !ValidRole(role) {
+			return "", fmt.Errorf("unknown role %q: must be reader, editor or admin", role)
+		}
+	}
+
+	now := time.Now()
+	c := claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   p.Subject,
+			Issuer:    j.options.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Roles: p.Roles,
+	}
+	if j.options.Audience != "" {
+		c.Audience = jwt.ClaimStrings{j.options.Audience}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+	token.Header["kid"] = keyID
+
+	return token.SignedString(key)
+}
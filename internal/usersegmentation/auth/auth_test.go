@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys - ключи подписи токенов для тестов.
+var testKeys = map[string][]byte{
+	"old": []byte("0123456789abcdef0123456789abcdef"),
+	"new": []byte("fedcba9876543210fedcba9876543210"),
+}
+
+// Test_NewJWT - тестирование проверки ключей подписи.
+func Test_NewJWT(t *testing.T) {
+	if _, err := NewJWT(nil, Options{}); err == nil {
+		t.Error("got no error for empty keys")
+	}
+	if _, err := NewJWT(map[string][]byte{"short": []byte("secret")}, Options{}); err == nil {
+		t.Error("got no error for short key")
+	}
+	if _, err := NewJWT(testKeys, Options{}); err != nil {
+		t.Errorf("got err = %v", err)
+	}
+}
+
+// Test_Verify - тестирование выпуска и проверки токенов.
+func Test_Verify(t *testing.T) {
+	j, err := NewJWT(testKeys, Options{Issuer: "segmentation", Audience: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal := Principal{Subject: "crm", Roles: []Role{RoleEditor}}
+
+	for _, keyID := range []string{"", "old", "new"} {
+		token, err := j.Issue(keyID, principal, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := j.Verify(token)
+		if err != nil || got.Subject != principal.Subject || len(got.Roles) != 1 || got.Roles[0] != RoleEditor {
+			t.Errorf("got principal %+v and err = %v for key %q", got, err, keyID)
+		}
+	}
+
+	// sign - подпись токена с произвольными полями.
+	sign := func(method jwt.SigningMethod, key any, kid string, c jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "crm", "iss": "segmentation", "aud": "api", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"admin"}}
+	}
+
+	if _, err := j.Verify(sign(jwt.SigningMethodHS512, testKeys["new"], "", valid())); err != nil {
+		t.Errorf("got err = %v for token without kid", err)
+	}
+
+	cases := map[string]string{
+		"unknown kid":    sign(jwt.SigningMethodHS256, testKeys["old"], "unknown", valid()),
+		"wrong key":      sign(jwt.SigningMethodHS256, testKeys["new"], "old", valid()),
+		"foreign key":    sign(jwt.SigningMethodHS256, []byte("00000000000000000000000000000000"), "", valid()),
+		"none algorithm": sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", valid()),
+	}
+	for name, modify := range map[string]func(jwt.MapClaims){
+		"expired":       func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no expiry":     func(c jwt.MapClaims) { delete(c, "exp") },
+		"no subject":    func(c jwt.MapClaims) { delete(c, "sub") },
+		"wrong issuer":  func(c jwt.MapClaims) { c["iss"] = "other" },
+		"wrong aud":     func(c jwt.MapClaims) { c["aud"] = "other" },
+		"not yet valid": func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+	} {
+		c := valid()
+		modify(c)
+		cases[name] = sign(jwt.SigningMethodHS256, testKeys["old"], "old", c)
+	}
+	for name, token := range cases {
+		if got, err := j.Verify(token); err == nil {
+			t.Errorf("%s: got principal %+v and no error", name, got)
+		}
+	}
+
+	if _, err := j.Issue("unknown", principal, time.Hour); err == nil {
+		t.Error("got no error for unknown key")
+	}
+	if _, err := j.Issue("", Principal{Subject: "crm", Roles: []Role{"owner"}}, time.Hour); err == nil || !strings.Contains(err.Error(), "unknown role") {
+		t.Errorf("got err = %v for unknown role", err)
+	}
+}
+
+// Test_Allows - тестирование проверки ролей.
+func Test_Allows(t *testing.T) {
+	cases := []struct {
+		roles    []Role
+		required Role
+		expected bool
+	}{
+		{nil, RoleReader, false},
+		{[]Role{"guest"}, RoleReader, false},
+		{[]Role{RoleReader}, RoleReader, true},
+		{[]Role{RoleReader}, RoleEditor, false},
+		{[]Role{RoleEditor}, RoleReader, true},
+		{[]Role{RoleEditor}, RoleAdmin, false},
+		{[]Role{RoleReader, RoleAdmin}, RoleAdmin, true},
+		{[]Role{RoleAdmin}, RoleEditor, true},
+	}
+	for _, c := range cases {
+		if got := (Principal{Roles: c.roles}).Allows(c.required); got != c.expected {
+			t.Errorf("roles %v, required %s: got %v, expected %v", c.roles, c.required, got, c.expected)
+		}
+	}
+}
+
+// Test_Context - тестирование сохранения клиента в контексте.
+func Test_Context(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("got principal from empty context")
+	}
+	ctx := WithPrincipal(context.Background(), Principal{Subject: "crm"})
+	if got, ok := FromContext(ctx); !ok || got.Subject != "crm" {
+		t.Errorf("got principal %+v, ok = %v", got, ok)
+	}
+}
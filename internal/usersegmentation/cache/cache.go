@@ -0,0 +1,207 @@
+// cache - пакет, реализующий кеширование сегментов пользователей в памяти процесса.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// Options - структура, описывающая настройки кеша.
+type Options struct {
+	Size int           // Size - максимальное количество пользователей в кеше; при превышении вытесняются давно не запрошенные.
+	TTL  time.Duration // TTL - время хранения сегментов пользователя в кеше.
+}
+
+// Stats - структура, описывающая статистику кеша.
+type Stats struct {
+	Hits          uint64 // Hits - количество запросов, получивших сегменты пользователя из кеша.
+	Misses        uint64 // Misses - количество запросов, получивших сегменты пользователя из обработчика БД.
+	Evictions     uint64 // Evictions - количество пользователей, вытесненных из кеша из-за превышения размера.
+	Invalidations uint64 // Invalidations - количество пользователей, удалённых из кеша при изменении данных.
+	Size          int    // Size - текущее количество пользователей в кеше.
+}
+
+// entry - структура, описывающая сегменты пользователя в кеше.
+type entry struct {
+	id        int               // id - id пользователя.
+	relations []models.Relation // relations - сегменты пользователя.
+	expires   time.Time         // expires - время, после которого сегменты пользователя нужно получить заново.
+}
+
+// Processor - обработчик БД, кеширующий результаты GetUserRelations другого обработчика БД (LRU с ограничением времени хранения).
+//
+// Остальные методы вызывают одноимённые методы next; изменяющие методы удаляют из кеша затронутых пользователей:
+// ModifyUser, ModifyUsers, AddUser и DeleteUser - изменённых пользователей, DeleteSegment - пользователей, состоявших в сегменте,
+// AddSegment с автоматическим добавлением - пользователей, попадающих в процент, RestoreSegment - всех пользователей.
+// Кеш не знает об изменениях, сделанных в обход него (например, другими экземплярами сервиса): они становятся видны не позже чем через TTL.
+//
+// Все методы безопасны для одновременного вызова из нескольких горутин.
+type Processor struct {
+	next    models.UserSegmentationDbProcessor // next - обработчик БД, результаты которого кешируются.
+	options Options                            // options - настройки кеша.
+	now     func() time.Time                   // now - функция получения текущего времени.
+
+	mu         sync.Mutex            // mu - мьютекс, защищающий кеш и статистику.
+	entries    map[int]*list.Element // entries - элементы списка recent по id пользователя.
+	recent     *list.List            // recent - сегменты пользователей от недавно запрошенных к давно запрошенным.
+	generation uint64                // generation - номер изменения данных, увеличиваемый при каждом удалении из кеша.
+	stats      Stats                 // stats - статистика кеша.
+}
+
+// New - создание обработчика БД, кеширующего сегменты пользователей.
+//
+// Принимает обработчик БД и настройки кеша (Size и TTL должны быть положительными).
+//
+// Возвращает обработчик БД.
+func New(next models.UserSegmentationDbProcessor, options Options) *Processor {
+	return &Processor{
+		next:    next,
+		options: options,
+		now:     time.Now,
+		entries: make(map[int]*list.Element),
+		recent:  list.New(),
+	}
+}
+
+// Stats - получение статистики кеша.
+//
+// Возвращает статистику.
+func (p *Processor) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Size = p.recent.Len()
+	return stats
+}
+
+// GetUserRelations - возвращает сегменты пользователя из кеша, а если их там нет или время их хранения истекло - из обработчика БД.
+// Полученные из обработчика БД сегменты сохраняются в кеше, только если за время запроса кеш не изменялся,
+// и хранятся не дольше TTL и не дольше истечения ближайшего членства пользователя.
+//
+// Принимает: контекст и id пользователя.
+//
+// Возвращает: список отношений пользователя с сегментами и ошибку.
+func (p *Processor) GetUserRelations(ctx context.Context, id int) ([]models.Relation, error) {
+	p.mu.Lock()
+	if relations, ok := p.get(id); ok {
+		p.stats.Hits++
+		p.mu.Unlock()
+		return relations, nil
+	}
+	p.stats.Misses++
+	generation := p.generation
+	p.mu.Unlock()
+
+	relations, err := p.next.GetUserRelations(ctx, id)
+	if err != nil {
+		return relations, err
+	}
+
+	p.mu.Lock()
+	if generation == p.generation {
+		p.put(id, relations)
+	}
+	p.mu.Unlock()
+
+	return clone(relations), nil
+}
+
+// get - получение сегментов пользователя из кеша. Вызывается при захваченном мьютексе.
+//
+// Принимает id пользователя.
+//
+// Возвращает копию сегментов пользователя и флаг их наличия в кеше.
+func (p *Processor) get(id int) ([]models.Relation, bool) {
+	element, ok := p.entries[id]
+	if !ok {
+		return nil, false
+	}
+	e := element.Value.(*entry)
+	if !p.now().Before(e.expires) {
+		p.remove(element)
+		return nil, false
+	}
+	p.recent.MoveToFront(element)
+
+	return clone(e.relations), true
+}
+
+// put - сохранение сегментов пользователя в кеше с вытеснением давно запрошенных пользователей. Вызывается при захваченном мьютексе.
+//
+// Принимает id пользователя и его сегменты.
+func (p *Processor) put(id int, relations []models.Relation) {
+	expires := p.now().Add(p.options.TTL)
+	for _, relation := range relations {
+		if relation.ExpiresAt != nil && relation.ExpiresAt.Before(expires) {
+			expires = *relation.ExpiresAt
+		}
+	}
+
+	if element, ok := p.entries[id]; ok {
+		p.remove(element)
+	}
+	p.entries[id] = p.recent.PushFront(&entry{id: id, relations: clone(relations), expires: expires})
+	for p.recent.Len() > p.options.Size {
+		p.remove(p.recent.Back())
+		p.stats.Evictions++
+	}
+}
+
+// remove - удаление элемента из кеша. Вызывается при захваченном мьютексе.
+//
+// Принимает элемент списка recent.
+func (p *Processor) remove(element *list.Element) {
+	delete(p.entries, element.Value.(*entry).id)
+	p.recent.Remove(element)
+}
+
+// invalidate - удаление из кеша пользователей, для которых match возвращает true.
+//
+// Принимает функцию выбора пользователей по сегментам в кеше.
+func (p *Processor) invalidate(match func(e *entry) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.generation++
+	for element := p.recent.Front(); element != nil; {
+		next := element.Next()
+		if match(element.Value.(*entry)) {
+			p.remove(element)
+			p.stats.Invalidations++
+		}
+		element = next
+	}
+}
+
+// invalidateUsers - удаление пользователей из кеша.
+//
+// Принимает id пользователей.
+func (p *Processor) invalidateUsers(ids ...int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.generation++
+	for _, id := range ids {
+		if element, ok := p.entries[id]; ok {
+			p.remove(element)
+			p.stats.Invalidations++
+		}
+	}
+}
+
+// clone - копирование сегментов пользователя, чтобы изменения копии вызывающим кодом не затрагивали кеш.
+//
+// Принимает сегменты пользователя.
+//
+// Возвращает копию (nil, если сегментов nil).
+func clone(relations []models.Relation) []models.Relation {
+	if relations == nil {
+		return nil
+	}
+	return append(make([]models.Relation, 0, len(relations)), relations...)
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/memory"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/storagetest"
+)
+
+// ctx - контекст вызовов обработчика БД в тестах.
+var ctx = context.Background()
+
+// countingProcessor - обработчик БД, считающий вызовы GetUserRelations.
+type countingProcessor struct {
+	models.UserSegmentationDbProcessor
+	calls atomic.Int64 // calls - количество вызовов GetUserRelations.
+}
+
+func (p *countingProcessor) GetUserRelations(ctx context.Context, id int) ([]models.Relation, error) {
+	p.calls.Add(1)
+	return p.UserSegmentationDbProcessor.GetUserRelations(ctx, id)
+}
+
+// newTestCache - создание кеша над хранилищем в памяти для тестов.
+func newTestCache(t *testing.T, options Options) (*Processor, *countingProcessor) {
+	t.Helper()
+	next := &countingProcessor{UserSegmentationDbProcessor: memory.GetModel(false)}
+	for _, slug := range []string{"a", "b"} {
+		if _, err := next.AddSegment(ctx, slug, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(next, options), next
+}
+
+// slugs - получение названий сегментов пользователя через кеш.
+func slugs(t *testing.T, p *Processor, id int) []string {
+	t.Helper()
+	relations, err := p.GetUserRelations(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		result = append(result, relation.Slug)
+	}
+	return result
+}
+
+func Test_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, strictUsers bool) models.UserSegmentationDbProcessor {
+		return New(memory.GetModel(strictUsers), Options{Size: 100, TTL: time.Hour})
+	})
+}
+
+// Test_Hits - тестирование получения сегментов пользователя из кеша и статистики.
+func Test_Hits(t *testing.T) {
+	p, next := newTestCache(t, Options{Size: 10, TTL: time.Hour})
+	if _, err := p.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: "a"}}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := slugs(t, p, 1); !reflect.DeepEqual(got, []string{"a"}) {
+			t.Errorf("got segments %v, expected [a]", got)
+		}
+	}
+	if calls := next.calls.Load(); calls != 1 {
+		t.Errorf("got %d storage calls, expected 1", calls)
+	}
+
+	relations, _ := p.GetUserRelations(ctx, 1)
+	relations[0].Slug = "changed"
+	if got := slugs(t, p, 1); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("got segments %v after changing the returned slice, expected [a]", got)
+	}
+
+	if stats := p.Stats(); stats.Hits != 4 || stats.Misses != 1 || stats.Size != 1 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+// Test_Expiry - тестирование времени хранения сегментов пользователя в кеше.
+func Test_Expiry(t *testing.T) {
+	p, next := newTestCache(t, Options{Size: 10, TTL: time.Minute})
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	expiresAt := now.Add(10 * time.Second)
+	if _, err := p.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: "a", ExpiresAt: &expiresAt}}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	slugs(t, p, 1)
+	slugs(t, p, 2)
+
+	now = now.Add(10 * time.Second)
+	slugs(t, p, 1)
+	slugs(t, p, 2)
+	if calls := next.calls.Load(); calls != 3 {
+		t.Errorf("got %d storage calls, expected the user with expired membership to be requested again", calls)
+	}
+
+	now = now.Add(time.Minute)
+	slugs(t, p, 2)
+	if calls := next.calls.Load(); calls != 4 {
+		t.Errorf("got %d storage calls, expected the user to be requested again after ttl", calls)
+	}
+}
+
+// Test_Eviction - тестирование вытеснения давно запрошенных пользователей.
+func Test_Eviction(t *testing.T) {
+	p, next := newTestCache(t, Options{Size: 2, TTL: time.Hour})
+
+	slugs(t, p, 1)
+	slugs(t, p, 2)
+	slugs(t, p, 1)
+	slugs(t, p, 3)
+	if stats := p.Stats(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	calls := next.calls.Load()
+	slugs(t, p, 1)
+	if next.calls.Load() != calls {
+		t.Error("recently requested user was evicted")
+	}
+	slugs(t, p, 2)
+	if next.calls.Load() != calls+1 {
+		t.Error("least recently requested user was not evicted")
+	}
+}
+
+// Test_Invalidation - тестирование удаления пользователей из кеша при изменениях.
+func Test_Invalidation(t *testing.T) {
+	p, _ := newTestCache(t, Options{Size: 100, TTL: time.Hour})
+	if _, err := p.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: "a"}, {Slug: "b"}}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ModifyUser(ctx, 2, []models.SegmentAddition{{Slug: "b"}}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	check := func(id int, expected ...string) {
+		t.Helper()
+		if expected == nil {
+			expected = []string{}
+		}
+		if got := slugs(t, p, id); !reflect.DeepEqual(got, expected) {
+			t.Errorf("got segments %v of user %d, expected %v", got, id, expected)
+		}
+	}
+	check(1, "a", "b")
+	check(2, "b")
+	check(3)
+
+	if _, err := p.ModifyUser(ctx, 1, nil, []string{"a"}, false); err != nil {
+		t.Fatal(err)
+	}
+	check(1, "b")
+
+	if _, err := p.ModifyUsers(ctx, []models.UserModification{{ID: models.ID{Value: 3}, Append: []models.SegmentAddition{{Slug: "a"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	check(3, "a")
+
+	invalidations := p.Stats().Invalidations
+	if err := p.DeleteSegment(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Stats().Invalidations - invalidations; got != 2 {
+		t.Errorf("got %d invalidated users after deleting segment, expected 2 members of it", got)
+	}
+	check(1)
+	check(2)
+	check(3, "a")
+
+	if err := p.RestoreSegment(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	check(1, "b")
+	check(2, "b")
+
+	if err := p.DeleteUser(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	check(2)
+
+	rolledOut := -1
+	for id := 100; id < 200 && rolledOut < 0; id++ {
+		if models.InRollout(id, "auto", 50) {
+			rolledOut = id
+		}
+	}
+	if err := p.AddUser(ctx, rolledOut); err != nil {
+		t.Fatal(err)
+	}
+	check(rolledOut)
+	if _, err := p.AddSegment(ctx, "auto", 50); err != nil {
+		t.Fatal(err)
+	}
+	check(rolledOut, "auto")
+}
+
+// Test_ConcurrentInvalidation - тестирование того, что сегменты, полученные до изменения, не сохраняются в кеше после него.
+func Test_ConcurrentInvalidation(t *testing.T) {
+	p, _ := newTestCache(t, Options{Size: 100, TTL: time.Hour})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p.GetUserRelations(ctx, 1)
+		}()
+		go func(i int) {
+			defer wg.Done()
+			slug := []string{"a", "b"}[i%2]
+			if i%4 < 2 {
+				p.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: slug}}, nil, false)
+			} else {
+				p.ModifyUser(ctx, 1, nil, []string{slug}, false)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cached := slugs(t, p, 1)
+	relations, err := p.next.GetUserRelations(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != len(relations) {
+		t.Errorf("got cached segments %v, storage has %+v", cached, relations)
+	}
+}
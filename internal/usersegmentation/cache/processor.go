@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+func (p *Processor) AddSegment(ctx context.Context, slug string, autoPercent int) (int, error) {
+	if autoPercent > 0 {
+		defer p.invalidate(func(e *entry) bool {
+			return models.InRollout(e.id, slug, autoPercent)
+		})
+	}
+	return p.next.AddSegment(ctx, slug, autoPercent)
+}
+
+func (p *Processor) DeleteSegment(ctx context.Context, slug string) error {
+	defer p.invalidate(func(e *entry) bool {
+		for _, relation := range e.relations {
+			if relation.Slug == slug {
+				return true
+			}
+		}
+		return false
+	})
+	return p.next.DeleteSegment(ctx, slug)
+}
+
+func (p *Processor) RestoreSegment(ctx context.Context, slug string) error {
+	defer p.invalidate(func(e *entry) bool { return true })
+	return p.next.RestoreSegment(ctx, slug)
+}
+
+func (p *Processor) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	return p.next.PurgeDeleted(ctx, before)
+}
+
+func (p *Processor) GetSegments(ctx context.Context, prefix string, limit int, offset int) ([]models.Segment, error) {
+	return p.next.GetSegments(ctx, prefix, limit, offset)
+}
+
+func (p *Processor) GetSegment(ctx context.Context, slug string) (models.Segment, error) {
+	return p.next.GetSegment(ctx, slug)
+}
+
+func (p *Processor) UpdateSegment(ctx context.Context, slug string, update models.SegmentUpdate) error {
+	return p.next.UpdateSegment(ctx, slug, update)
+}
+
+func (p *Processor) GetSegmentMembers(ctx context.Context, slug string, after int, limit int, fn func(models.Member) error) error {
+	return p.next.GetSegmentMembers(ctx, slug, after, limit, fn)
+}
+
+func (p *Processor) ModifyUser(ctx context.Context, id int, append []models.SegmentAddition, remove []string, partial bool) (models.ModificationReport, error) {
+	defer p.invalidateUsers(id)
+	return p.next.ModifyUser(ctx, id, append, remove, partial)
+}
+
+func (p *Processor) ModifyUsers(ctx context.Context, mods []models.UserModification) (models.BulkReport, error) {
+	ids := make([]int, len(mods))
+	for i, mod := range mods {
+		ids[i] = mod.Value
+	}
+	defer p.invalidateUsers(ids...)
+	return p.next.ModifyUsers(ctx, mods)
+}
+
+func (p *Processor) DeleteExpired(ctx context.Context) (int, error) {
+	return p.next.DeleteExpired(ctx)
+}
+
+func (p *Processor) AddUser(ctx context.Context, id int) error {
+	defer p.invalidateUsers(id)
+	return p.next.AddUser(ctx, id)
+}
+
+func (p *Processor) GetUsers(ctx context.Context, limit int, offset int) ([]models.User, error) {
+	return p.next.GetUsers(ctx, limit, offset)
+}
+
+func (p *Processor) DeleteUser(ctx context.Context, id int) error {
+	defer p.invalidateUsers(id)
+	return p.next.DeleteUser(ctx, id)
+}
+
+func (p *Processor) GetHistory(ctx context.Context, from time.Time, to time.Time) ([]models.HistoryRecord, error) {
+	return p.next.GetHistory(ctx, from, to)
+}
+
+func (p *Processor) GetStats(ctx context.Context) (models.Stats, error) {
+	return p.next.GetStats(ctx)
+}
@@ -0,0 +1,495 @@
+package usersegmentation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/ratelimit"
+	pb "github.com/famusovsky/AvitoTestTask/pkg/api/usersegmentation/v1"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcErrorDomain - домен ошибок в подробностях ошибок gRPC (google.rpc.ErrorInfo).
+const grpcErrorDomain = "usersegmentation"
+
+// Ключи метаданных gRPC вызовов, соответствующие заголовкам HTTP запросов.
+var (
+	authorizationMetadata = strings.ToLower(fiber.HeaderAuthorization) // authorizationMetadata - токен клиента ("Bearer <token>").
+	apiKeyMetadata        = strings.ToLower(auth.APIKeyHeader)         // apiKeyMetadata - ключ API клиента.
+	requestIDMetadata     = strings.ToLower(requestIDHeader)           // requestIDMetadata - ID вызова.
+	retryAfterMetadata    = strings.ToLower(fiber.HeaderRetryAfter)    // retryAfterMetadata - количество секунд до возможности повторить вызов.
+	rateLimitMetadata     = strings.ToLower(rateLimitLimitHeader)      // rateLimitMetadata - максимальное количество вызовов подряд.
+	remainingMetadata     = strings.ToLower(rateLimitRemainingHeader)  // remainingMetadata - количество вызовов, которые можно выполнить сразу.
+	resetMetadata         = strings.ToLower(rateLimitResetHeader)      // resetMetadata - количество секунд до восстановления всех вызовов.
+)
+
+// grpcMethod - структура, описывающая требования к вызову метода gRPC сервиса.
+type grpcMethod struct {
+	role  auth.Role       // role - роль, требуемая для вызова метода.
+	class ratelimit.Class // class - класс, ограничение частоты которого применяется к вызову.
+}
+
+// grpcMethods - требования к вызовам методов gRPC сервиса по полному названию метода, совпадающие с требованиями соответствующих маршрутов HTTP API.
+// Вызовы остальных методов (проверки состояния и получения описания сервиса) не требуют аутентификации и не ограничиваются.
+var grpcMethods = map[string]grpcMethod{
+	pb.UserSegmentation_AddSegment_FullMethodName:         {role: auth.RoleAdmin, class: ratelimit.ClassAdmin},
+	pb.UserSegmentation_DeleteSegment_FullMethodName:      {role: auth.RoleAdmin, class: ratelimit.ClassAdmin},
+	pb.UserSegmentation_ModifyUser_FullMethodName:         {role: auth.RoleEditor, class: ratelimit.ClassWrite},
+	pb.UserSegmentation_GetUserRelations_FullMethodName:   {role: auth.RoleReader, class: ratelimit.ClassRead},
+	pb.UserSegmentation_ListSegmentMembers_FullMethodName: {role: auth.RoleEditor, class: ratelimit.ClassRead},
+}
+
+// slugStatuses - статусы сегментов в отчёте об изменении сегментов пользователя по константам models.Status*.
+var slugStatuses = map[string]pb.SlugStatus_Status{
+	models.StatusAdded:          pb.SlugStatus_STATUS_ADDED,
+	models.StatusAlreadyPresent: pb.SlugStatus_STATUS_ALREADY_PRESENT,
+	models.StatusRemoved:        pb.SlugStatus_STATUS_REMOVED,
+	models.StatusNotMember:      pb.SlugStatus_STATUS_NOT_MEMBER,
+	models.StatusUnknown:        pb.SlugStatus_STATUS_UNKNOWN,
+}
+
+// grpcService - структура, реализующая gRPC сервис сегментации пользователей поверх обработчика БД приложения.
+type grpcService struct {
+	pb.UnimplementedUserSegmentationServer
+
+	app *App // app - приложение.
+}
+
+// newGRPCServer - создание gRPC сервера приложения.
+// Кроме сервиса сегментации пользователей, сервер предоставляет стандартные сервисы проверки состояния (grpc.health.v1) и получения описания сервисов (reflection).
+//
+// Возвращает: gRPC сервер и сервис проверки состояния.
+func (app *App) newGRPCServer() (*grpc.Server, *health.Server) {
+	server := grpc.NewServer(grpc.UnaryInterceptor(app.interceptUnary), grpc.StreamInterceptor(app.interceptStream))
+	pb.RegisterUserSegmentationServer(server, &grpcService{app: app})
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+
+	return server, healthServer
+}
+
+// AddSegment - добавляет сегмент в БД.
+//
+// Принимает: контекст и запрос.
+//
+// Возвращает: id добавленного сегмента и ошибку.
+func (s *grpcService) AddSegment(ctx context.Context, req *pb.AddSegmentRequest) (*pb.AddSegmentResponse, error) {
+	if req.GetAutoPercent() < 0 || req.GetAutoPercent() > 100 {
+		return nil, invalidArgument(`"auto_percent" must be between 0 and 100`)
+	}
+
+	id, err := s.app.dbProcessor.AddSegment(ctx, req.GetSlug(), int(req.GetAutoPercent()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.AddSegmentResponse{Id: int64(id)}, nil
+}
+
+// DeleteSegment - удаляет сегмент из БД.
+//
+// Принимает: контекст и запрос.
+//
+// Возвращает: пустой ответ и ошибку.
+func (s *grpcService) DeleteSegment(ctx context.Context, req *pb.DeleteSegmentRequest) (*pb.DeleteSegmentResponse, error) {
+	if err := s.app.dbProcessor.DeleteSegment(ctx, req.GetSlug()); err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteSegmentResponse{}, nil
+}
+
+// ModifyUser - изменяет сегменты пользователя.
+//
+// Принимает: контекст и запрос.
+//
+// Возвращает: отчёт о результатах изменения для каждого сегмента и ошибку.
+func (s *grpcService) ModifyUser(ctx context.Context, req *pb.ModifyUserRequest) (*pb.ModifyUserResponse, error) {
+	additions := make([]models.SegmentAddition, len(req.GetAppend()))
+	for i, addition := range req.GetAppend() {
+		additions[i].Slug = addition.GetSlug()
+		switch expiry := addition.GetExpiry().(type) {
+		case *pb.SegmentAddition_ExpiresAt:
+			if err := expiry.ExpiresAt.CheckValid(); err != nil {
+				return nil, invalidArgument(fmt.Sprintf(`"expires_at" of segment %q is invalid: %s`, addition.GetSlug(), err))
+			}
+			expiresAt := expiry.ExpiresAt.AsTime()
+			additions[i].ExpiresAt = &expiresAt
+		case *pb.SegmentAddition_Ttl:
+			if err := expiry.Ttl.CheckValid(); err != nil || expiry.Ttl.AsDuration() <= 0 {
+				return nil, invalidArgument(fmt.Sprintf(`"ttl" of segment %q must be positive`, addition.GetSlug()))
+			}
+			expiresAt := time.Now().Add(expiry.Ttl.AsDuration())
+			additions[i].ExpiresAt = &expiresAt
+		}
+	}
+
+	id, err := userID(req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.app.dbProcessor.ModifyUser(ctx, id, additions, req.GetRemove(), req.GetPartial())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ModifyUserResponse{Append: slugStatusesToProto(report.Append), Remove: slugStatusesToProto(report.Remove)}, nil
+}
+
+// GetUserRelations - возвращает сегменты, в которых состоит пользователь.
+//
+// Принимает: контекст и запрос.
+//
+// Возвращает: список отношений пользователя с сегментами и ошибку.
+func (s *grpcService) GetUserRelations(ctx context.Context, req *pb.GetUserRelationsRequest) (*pb.GetUserRelationsResponse, error) {
+	id, err := userID(req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	relations, err := s.app.dbProcessor.GetUserRelations(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.GetUserRelationsResponse{Relations: make([]*pb.Relation, len(relations))}
+	for i, relation := range relations {
+		resp.Relations[i] = &pb.Relation{Slug: relation.Slug, ExpiresAt: timestampToProto(relation.ExpiresAt)}
+	}
+
+	return resp, nil
+}
+
+// ListSegmentMembers - передаёт пользователей, состоящих в сегменте, по мере получения из обработчика БД.
+//
+// Принимает: запрос и поток ответа.
+//
+// Возвращает: ошибку.
+func (s *grpcService) ListSegmentMembers(req *pb.ListSegmentMembersRequest, stream pb.UserSegmentation_ListSegmentMembersServer) error {
+	if req.GetLimit() < 0 {
+		return invalidArgument(`"limit" must be non-negative`)
+	}
+	after := math.MinInt
+	if req.After != nil {
+		after = int(req.GetAfter())
+	}
+
+	return s.app.dbProcessor.GetSegmentMembers(stream.Context(), req.GetSlug(), after, int(req.GetLimit()), func(member models.Member) error {
+		return stream.Send(&pb.Member{
+			UserId:    int64(member.UserID),
+			AddedAt:   timestamppb.New(member.AddedAt),
+			ExpiresAt: timestampToProto(member.ExpiresAt),
+		})
+	})
+}
+
+// userID - проверка id пользователя из запроса: id пользователей хранятся в БД в столбцах типа integer.
+//
+// Принимает: id пользователя из запроса.
+//
+// Возвращает: id и ошибку gRPC с кодом состояния InvalidArgument, если id не помещается в integer.
+func userID(id int64) (int, error) {
+	if id < math.MinInt32 || id > math.MaxInt32 {
+		return 0, invalidArgument(fmt.Sprintf(`"user_id" must be between %d and %d`, math.MinInt32, math.MaxInt32))
+	}
+
+	return int(id), nil
+}
+
+// slugStatusesToProto - преобразование результатов изменения сегментов пользователя в сообщения gRPC.
+//
+// Принимает: результаты изменения.
+//
+// Возвращает: результаты изменения в сообщениях gRPC.
+func slugStatusesToProto(statuses []models.SlugStatus) []*pb.SlugStatus {
+	result := make([]*pb.SlugStatus, len(statuses))
+	for i, st := range statuses {
+		result[i] = &pb.SlugStatus{Slug: st.Slug, Status: slugStatuses[st.Status]}
+	}
+
+	return result
+}
+
+// timestampToProto - преобразование необязательного времени в сообщение gRPC.
+//
+// Принимает: время (nil, если оно не задано).
+//
+// Возвращает: время в сообщении gRPC (nil, если оно не задано).
+func timestampToProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return timestamppb.New(*t)
+}
+
+// interceptUnary - перехватчик одиночных вызовов gRPC сервера (см. handleCall).
+func (app *App) interceptUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var resp any
+	err := app.handleCall(ctx, info.FullMethod, grpc.SetHeader, func(ctx context.Context) error {
+		var err error
+		resp, err = handler(ctx, req)
+		return err
+	})
+
+	return resp, err
+}
+
+// interceptStream - перехватчик потоковых вызовов gRPC сервера (см. handleCall).
+func (app *App) interceptStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	setHeader := func(_ context.Context, md metadata.MD) error {
+		return stream.SetHeader(md)
+	}
+
+	return app.handleCall(stream.Context(), info.FullMethod, setHeader, func(ctx context.Context) error {
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	})
+}
+
+// serverStream - поток gRPC вызова с заменённым контекстом.
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx context.Context // ctx - контекст обработки вызова.
+}
+
+// Context - получение контекста обработки вызова.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// handleCall - обработка вызова gRPC сервера с теми же проверками, что и у запроса к соответствующему маршруту HTTP API.
+//
+// Вызову назначается ID (из метаданных x-request-id или сгенерированный), возвращаемый в тех же метаданных ответа.
+// Клиент вызова метода из grpcMethods аутентифицируется по метаданным x-api-key или authorization (см. authorize),
+// и частота его вызовов ограничивается (см. limitRate). Время обработки вызова ограничивается Options.Timeout.
+// Ошибка обработки преобразуется в ошибку gRPC (см. grpcError), а вызов записывается в журнал доступа.
+//
+// Принимает: контекст вызова, полное название метода, функцию отправки метаданных ответа и функцию обработки вызова.
+//
+// Возвращает: ошибку gRPC.
+func (app *App) handleCall(ctx context.Context, method string, setHeader func(context.Context, metadata.MD) error, call func(context.Context) error) error {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	id := metadataValue(md, requestIDMetadata)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	setHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+
+	logger := app.logger.With("request_id", id)
+	ctx = logging.WithLogger(ctx, logger)
+	var cancel context.CancelFunc
+	if app.options.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, app.options.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	ctx, err := app.checkCall(ctx, method, md, setHeader)
+	if err == nil {
+		err = call(ctx)
+	}
+	err = grpcError(ctx, err)
+
+	code, latency := status.Code(err), time.Since(start)
+	attrs := []any{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("latency", latency),
+	}
+	if principal, ok := auth.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("subject", principal.Subject))
+	}
+
+	level := slog.LevelInfo
+	if code == codes.Internal || code == codes.Unknown {
+		level = slog.LevelError
+	}
+	logger.Log(ctx, level, "grpc call", attrs...)
+
+	return err
+}
+
+// checkCall - аутентификация клиента и ограничение частоты вызовов метода из grpcMethods.
+// Проверки выполняются так же, как промежуточными обработчиками authorize и limitRate маршрутов HTTP API;
+// состояние ограничения частоты возвращается в метаданных ответа ratelimit-*, а при превышении - ещё и в retry-after
+// (как и при исчерпании неудачных попыток аутентификации, см. limitAuthFailures).
+//
+// Принимает: контекст вызова, полное название метода, метаданные вызова и функцию отправки метаданных ответа.
+//
+// Возвращает: контекст вызова с клиентом (см. auth.FromContext) и ошибку.
+func (app *App) checkCall(ctx context.Context, method string, md metadata.MD, setHeader func(context.Context, metadata.MD) error) (context.Context, error) {
+	requirements, ok := grpcMethods[method]
+	if !ok {
+		return ctx, nil
+	}
+
+	if app.options.Auth != nil || app.options.APIKeys != nil {
+		principal, retryAfter, err := app.limitAuthFailures(peerIP(ctx), func() (auth.Principal, error) {
+			principal, _, err := app.authenticateCredentials(ctx, metadataValue(md, apiKeyMetadata), metadataValue(md, authorizationMetadata))
+			return principal, err
+		})
+		if err != nil {
+			if retryAfter > 0 {
+				setHeader(ctx, metadata.Pairs(retryAfterMetadata, strconv.Itoa(max(seconds(retryAfter), 1))))
+			}
+			return ctx, err
+		}
+		ctx = auth.WithPrincipal(ctx, principal)
+
+		if !principal.Allows(requirements.role) {
+			return ctx, fmt.Errorf("role %s is required: %w", requirements.role, models.ErrForbidden)
+		}
+	}
+
+	limiter, ok := app.limiters[requirements.class]
+	if !ok {
+		return ctx, nil
+	}
+	key := "ip:" + peerIP(ctx)
+	if principal, ok := auth.FromContext(ctx); ok {
+		key = "subject:" + principal.Subject
+	}
+
+	result := limiter.Allow(key, time.Now())
+	header := metadata.Pairs(
+		rateLimitMetadata, strconv.Itoa(result.Limit),
+		remainingMetadata, strconv.Itoa(result.Remaining),
+		resetMetadata, strconv.Itoa(seconds(result.Reset)),
+	)
+	if !result.Allowed {
+		header.Set(retryAfterMetadata, strconv.Itoa(max(seconds(result.RetryAfter), 1)))
+	}
+	setHeader(ctx, header)
+	if !result.Allowed {
+		return ctx, fmt.Errorf("too many %s requests: %w", requirements.class, models.ErrRateLimited)
+	}
+
+	return ctx, nil
+}
+
+// grpcError - преобразование ошибки обработки вызова в ошибку gRPC.
+// Ошибки из пакета models преобразуются в ошибки с кодом состояния gRPC, соответствующим коду состояния HTTP API (см. sendError),
+// и кодом ошибки (см. models.ErrorCode) в подробностях; остальные ошибки - в ошибки с кодом состояния Internal.
+// Если время обработки вызова истекло, возвращается ошибка с кодом состояния DeadlineExceeded. Ошибки gRPC возвращаются без изменений.
+//
+// Принимает: контекст вызова, ошибку.
+//
+// Возвращает: ошибку gRPC (nil, если ошибки нет).
+func grpcError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s: %w", err, models.ErrTimeout)
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	code := models.ErrorCode(err)
+	if code == models.CodeInternal {
+		logging.FromContext(ctx).Error("error while handling grpc call", "error", err)
+	}
+
+	grpcCode := codes.Internal
+	switch code {
+	case models.CodeSegmentNotFound, models.CodeUserNotFound, models.CodeAPIKeyNotFound:
+		grpcCode = codes.NotFound
+	case models.CodeSegmentExists, models.CodeUserExists:
+		grpcCode = codes.AlreadyExists
+	case models.CodeInvalidSlug:
+		grpcCode = codes.InvalidArgument
+	case models.CodeTimeout:
+		grpcCode = codes.DeadlineExceeded
+	case models.CodeUnauthorized:
+		grpcCode = codes.Unauthenticated
+	case models.CodeForbidden:
+		grpcCode = codes.PermissionDenied
+	case models.CodeRateLimited:
+		grpcCode = codes.ResourceExhausted
+	}
+
+	return statusError(grpcCode, code, err.Error())
+}
+
+// invalidArgument - создание ошибки gRPC о некорректном запросе (код состояния InvalidArgument, код ошибки models.CodeBadRequest).
+//
+// Принимает: текст ошибки.
+//
+// Возвращает: ошибку gRPC.
+func invalidArgument(text string) error {
+	return statusError(codes.InvalidArgument, models.CodeBadRequest, text)
+}
+
+// statusError - создание ошибки gRPC с кодом ошибки в подробностях (google.rpc.ErrorInfo с доменом grpcErrorDomain).
+//
+// Принимает: код состояния gRPC, код ошибки (см. константы models.Code*) и текст ошибки.
+//
+// Возвращает: ошибку gRPC.
+func statusError(grpcCode codes.Code, code string, text string) error {
+	st := status.New(grpcCode, text)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: code, Domain: grpcErrorDomain}); err == nil {
+		st = detailed
+	}
+
+	return st.Err()
+}
+
+// metadataValue - получение первого значения метаданных вызова по ключу.
+//
+// Принимает: метаданные и ключ.
+//
+// Возвращает: значение (пустая строка, если его нет).
+func metadataValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// peerIP - получение IP адреса клиента вызова.
+//
+// Принимает: контекст вызова.
+//
+// Возвращает: IP адрес клиента (или адрес целиком, если он не содержит порт).
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,408 @@
+package usersegmentation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/memory"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/ratelimit"
+	pb "github.com/famusovsky/AvitoTestTask/pkg/api/usersegmentation/v1"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// dialGRPC - запуск gRPC сервера приложения в памяти и подключение к нему.
+//
+// Принимает: тест, приложение (созданное с Options.GRPCAddr).
+//
+// Возвращает: клиентское соединение, закрываемое вместе с сервером по окончании теста.
+func dialGRPC(t *testing.T, app *App) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	go app.grpcServer.Serve(lis)
+	t.Cleanup(app.grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// checkStatus - проверка кода состояния gRPC и кода ошибки в подробностях ошибки.
+//
+// Принимает: ошибку, ожидаемые код состояния и код ошибки (пустая строка, если ошибки не ожидается), тест.
+func checkStatus(err error, expectedCode codes.Code, expectedReason string, t *testing.T) {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != expectedCode {
+		t.Errorf("got code %s (%s), expected %s", st.Code(), st.Message(), expectedCode)
+		return
+	}
+
+	reason := ""
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == grpcErrorDomain {
+			reason = info.GetReason()
+		}
+	}
+	if reason != expectedReason {
+		t.Errorf("got error code %q, expected %q", reason, expectedReason)
+	}
+}
+
+// Test_GRPC - тестирование методов gRPC сервиса поверх хранилища в памяти.
+func Test_GRPC(t *testing.T) {
+	app := CreateApp(logging.Discard, memory.GetModel(false), Options{GRPCAddr: "bufconn"})
+	client := pb.NewUserSegmentationClient(dialGRPC(t, app))
+	ctx := context.Background()
+
+	t.Run("segments", func(t *testing.T) {
+		for _, slug := range []string{"first", "second"} {
+			if _, err := client.AddSegment(ctx, &pb.AddSegmentRequest{Slug: slug}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err := client.AddSegment(ctx, &pb.AddSegmentRequest{Slug: "first"})
+		checkStatus(err, codes.AlreadyExists, models.CodeSegmentExists, t)
+		_, err = client.AddSegment(ctx, &pb.AddSegmentRequest{Slug: ""})
+		checkStatus(err, codes.InvalidArgument, models.CodeInvalidSlug, t)
+		_, err = client.AddSegment(ctx, &pb.AddSegmentRequest{Slug: "third", AutoPercent: 101})
+		checkStatus(err, codes.InvalidArgument, models.CodeBadRequest, t)
+	})
+
+	t.Run("users", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond).UTC()
+		resp, err := client.ModifyUser(ctx, &pb.ModifyUserRequest{
+			UserId: 1,
+			Append: []*pb.SegmentAddition{
+				{Slug: "first", Expiry: &pb.SegmentAddition_ExpiresAt{ExpiresAt: timestamppb.New(expiresAt)}},
+				{Slug: "second", Expiry: &pb.SegmentAddition_Ttl{Ttl: durationpb.New(time.Hour)}},
+				{Slug: "unknown"},
+			},
+			Remove:  []string{"second"},
+			Partial: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprint(resp.GetAppend(), resp.GetRemove())
+		expected := fmt.Sprint([]*pb.SlugStatus{
+			{Slug: "first", Status: pb.SlugStatus_STATUS_ADDED},
+			{Slug: "second", Status: pb.SlugStatus_STATUS_ADDED},
+			{Slug: "unknown", Status: pb.SlugStatus_STATUS_UNKNOWN},
+		}, []*pb.SlugStatus{{Slug: "second", Status: pb.SlugStatus_STATUS_REMOVED}})
+		if got != expected {
+			t.Errorf("got report %s, expected %s", got, expected)
+		}
+
+		relations, err := client.GetUserRelations(ctx, &pb.GetUserRelationsRequest{UserId: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(relations.GetRelations()) != 1 || relations.GetRelations()[0].GetSlug() != "first" || !relations.GetRelations()[0].GetExpiresAt().AsTime().Equal(expiresAt) {
+			t.Errorf("got relations %v", relations.GetRelations())
+		}
+
+		_, err = client.ModifyUser(ctx, &pb.ModifyUserRequest{UserId: 1, Append: []*pb.SegmentAddition{{Slug: "unknown"}}})
+		checkStatus(err, codes.NotFound, models.CodeSegmentNotFound, t)
+		_, err = client.ModifyUser(ctx, &pb.ModifyUserRequest{UserId: 1, Append: []*pb.SegmentAddition{{Slug: "first", Expiry: &pb.SegmentAddition_Ttl{Ttl: durationpb.New(-time.Hour)}}}})
+		checkStatus(err, codes.InvalidArgument, models.CodeBadRequest, t)
+
+		// id пользователей хранятся в БД в столбцах типа integer.
+		for _, id := range []int64{math.MaxInt32 + 1, math.MinInt32 - 1} {
+			_, err = client.ModifyUser(ctx, &pb.ModifyUserRequest{UserId: id, Append: []*pb.SegmentAddition{{Slug: "first"}}})
+			checkStatus(err, codes.InvalidArgument, models.CodeBadRequest, t)
+			_, err = client.GetUserRelations(ctx, &pb.GetUserRelationsRequest{UserId: id})
+			checkStatus(err, codes.InvalidArgument, models.CodeBadRequest, t)
+		}
+		if _, err = client.GetUserRelations(ctx, &pb.GetUserRelationsRequest{UserId: math.MaxInt32}); err != nil {
+			t.Errorf("unexpected error for the maximum id: %v", err)
+		}
+	})
+
+	t.Run("members", func(t *testing.T) {
+		for _, id := range []int64{3, 2} {
+			if _, err := client.ModifyUser(ctx, &pb.ModifyUserRequest{UserId: id, Append: []*pb.SegmentAddition{{Slug: "first"}}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		list := func(req *pb.ListSegmentMembersRequest) ([]int64, error) {
+			stream, err := client.ListSegmentMembers(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			ids := make([]int64, 0)
+			for {
+				member, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					return ids, nil
+				}
+				if err != nil {
+					return ids, err
+				}
+				ids = append(ids, member.GetUserId())
+			}
+		}
+
+		after := int64(1)
+		for _, c := range []struct {
+			req      *pb.ListSegmentMembersRequest
+			expected string
+		}{
+			{&pb.ListSegmentMembersRequest{Slug: "first"}, "[1 2 3]"},
+			{&pb.ListSegmentMembersRequest{Slug: "first", After: &after, Limit: 1}, "[2]"},
+			{&pb.ListSegmentMembersRequest{Slug: "second"}, "[]"},
+		} {
+			ids, err := list(c.req)
+			if err != nil || fmt.Sprint(ids) != c.expected {
+				t.Errorf("got %v and err = %v for %v, expected %s", ids, err, c.req, c.expected)
+			}
+		}
+
+		_, err := list(&pb.ListSegmentMembersRequest{Slug: "unknown"})
+		checkStatus(err, codes.NotFound, models.CodeSegmentNotFound, t)
+		_, err = list(&pb.ListSegmentMembersRequest{Slug: "first", Limit: -1})
+		checkStatus(err, codes.InvalidArgument, models.CodeBadRequest, t)
+	})
+
+	t.Run("delete segment", func(t *testing.T) {
+		if _, err := client.DeleteSegment(ctx, &pb.DeleteSegmentRequest{Slug: "first"}); err != nil {
+			t.Fatal(err)
+		}
+		relations, err := client.GetUserRelations(ctx, &pb.GetUserRelationsRequest{UserId: 1})
+		if err != nil || len(relations.GetRelations()) != 0 {
+			t.Errorf("got relations %v and err = %v", relations.GetRelations(), err)
+		}
+
+		_, err = client.DeleteSegment(ctx, &pb.DeleteSegmentRequest{Slug: "first"})
+		checkStatus(err, codes.NotFound, models.CodeSegmentNotFound, t)
+	})
+
+	t.Run("request id", func(t *testing.T) {
+		var header metadata.MD
+		callCtx := metadata.AppendToOutgoingContext(ctx, "x-request-id", "abc")
+		if _, err := client.GetUserRelations(callCtx, &pb.GetUserRelationsRequest{UserId: 1}, grpc.Header(&header)); err != nil {
+			t.Fatal(err)
+		}
+		if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "abc" {
+			t.Errorf("got request id %v", got)
+		}
+	})
+}
+
+// Test_GRPCAuth - тестирование аутентификации и проверки ролей клиентов gRPC сервиса.
+func Test_GRPCAuth(t *testing.T) {
+	processor := &processorMock{}
+	jwt, err := auth.NewJWT(map[string][]byte{"main": []byte("0123456789abcdef0123456789abcdef")}, auth.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memory.NewAPIKeyStore()
+	created, err := CreateAPIKey(context.Background(), store, models.APIKeyCreation{Name: "crm", Role: string(auth.RoleReader)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := CreateApp(logging.Discard, processor, Options{Auth: jwt, APIKeys: store, GRPCAddr: "bufconn"})
+	conn := dialGRPC(t, app)
+	client := pb.NewUserSegmentationClient(conn)
+
+	withToken := func(subject string, roles ...auth.Role) context.Context {
+		token, err := jwt.Issue("", auth.Principal{Subject: subject, Roles: roles}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	_, err = client.GetUserRelations(context.Background(), &pb.GetUserRelationsRequest{UserId: 1})
+	checkStatus(err, codes.Unauthenticated, models.CodeUnauthorized, t)
+	_, err = client.GetUserRelations(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer malformed"), &pb.GetUserRelationsRequest{UserId: 1})
+	checkStatus(err, codes.Unauthenticated, models.CodeUnauthorized, t)
+	_, err = client.ModifyUser(withToken("reader", auth.RoleReader), &pb.ModifyUserRequest{UserId: 1})
+	checkStatus(err, codes.PermissionDenied, models.CodeForbidden, t)
+	_, err = client.AddSegment(withToken("editor", auth.RoleEditor), &pb.AddSegmentRequest{Slug: "test"})
+	checkStatus(err, codes.PermissionDenied, models.CodeForbidden, t)
+
+	if _, err = client.AddSegment(withToken("admin", auth.RoleAdmin), &pb.AddSegmentRequest{Slug: "test"}); err != nil {
+		t.Errorf("unexpected: %s", err)
+	}
+	if _, err = client.GetUserRelations(withToken("crm", auth.RoleReader), &pb.GetUserRelationsRequest{UserId: 1}); err != nil {
+		t.Errorf("unexpected: %s", err)
+	}
+	if got := processor.gotPrincipalOnGetUserRelations; got.Subject != "crm" {
+		t.Errorf("got principal %+v", got)
+	}
+
+	apiKeyCtx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", created.Secret)
+	if _, err = client.GetUserRelations(apiKeyCtx, &pb.GetUserRelationsRequest{UserId: 1}); err != nil {
+		t.Errorf("unexpected: %s", err)
+	}
+	if got := processor.gotPrincipalOnGetUserRelations; got.Subject != fmt.Sprintf("api_key:%d", created.ID) {
+		t.Errorf("got principal %+v", got)
+	}
+	_, err = client.ModifyUser(apiKeyCtx, &pb.ModifyUserRequest{UserId: 1})
+	checkStatus(err, codes.PermissionDenied, models.CodeForbidden, t)
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Errorf("health check without token: %s", err)
+	} else if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("got health status %s", resp.GetStatus())
+	}
+}
+
+// Test_GRPCRateLimit - тестирование ограничения частоты вызовов gRPC сервиса.
+func Test_GRPCRateLimit(t *testing.T) {
+	processor := &processorMock{}
+	app := CreateApp(logging.Discard, processor, Options{
+		RateLimits: map[ratelimit.Class]ratelimit.Limit{ratelimit.ClassRead: {Rate: 0.001, Burst: 1}},
+		GRPCAddr:   "bufconn",
+	})
+	client := pb.NewUserSegmentationClient(dialGRPC(t, app))
+
+	var header metadata.MD
+	if _, err := client.GetUserRelations(context.Background(), &pb.GetUserRelationsRequest{UserId: 1}, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("ratelimit-remaining"); len(got) != 1 || got[0] != "0" {
+		t.Errorf("got ratelimit-remaining %v", got)
+	}
+
+	_, err := client.GetUserRelations(context.Background(), &pb.GetUserRelationsRequest{UserId: 1}, grpc.Header(&header))
+	checkStatus(err, codes.ResourceExhausted, models.CodeRateLimited, t)
+	if got := header.Get("retry-after"); len(got) != 1 || got[0] == "0" {
+		t.Errorf("got retry-after %v", got)
+	}
+
+	// Класс write не ограничен.
+	if _, err := client.ModifyUser(context.Background(), &pb.ModifyUserRequest{UserId: 1}); err != nil {
+		t.Errorf("unexpected: %s", err)
+	}
+}
+
+// Test_GRPCAuthFailures - тестирование ограничения частоты неудачных попыток аутентификации вызовов.
+func Test_GRPCAuthFailures(t *testing.T) {
+	processor := &processorMock{}
+	store := &countingAPIKeyStore{APIKeyStore: memory.NewAPIKeyStore()}
+	app := CreateApp(logging.Discard, processor, Options{
+		APIKeys:    store,
+		RateLimits: map[ratelimit.Class]ratelimit.Limit{ratelimit.ClassAuth: {Rate: 0.001, Burst: 2}},
+		GRPCAddr:   "bufconn",
+	})
+	client := pb.NewUserSegmentationClient(dialGRPC(t, app))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "usk_invalid")
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetUserRelations(ctx, &pb.GetUserRelationsRequest{UserId: 1})
+		checkStatus(err, codes.Unauthenticated, models.CodeUnauthorized, t)
+	}
+
+	var header metadata.MD
+	_, err := client.GetUserRelations(ctx, &pb.GetUserRelationsRequest{UserId: 1}, grpc.Header(&header))
+	checkStatus(err, codes.ResourceExhausted, models.CodeRateLimited, t)
+	if got := header.Get("retry-after"); len(got) != 1 || got[0] == "0" {
+		t.Errorf("got retry-after %v", got)
+	}
+	if got := store.lookups.Load(); got != 2 {
+		t.Errorf("got %d api key lookups, expected 2", got)
+	}
+}
+
+// Test_grpcError - тестирование преобразования ошибок обработчика БД в ошибки gRPC.
+func Test_grpcError(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		err    error
+		code   codes.Code
+		reason string
+	}{
+		{"no error", context.Background(), nil, codes.OK, ""},
+		{"user not found", context.Background(), fmt.Errorf("user 1: %w", models.ErrUserNotFound), codes.NotFound, models.CodeUserNotFound},
+		{"user exists", context.Background(), models.ErrUserExists, codes.AlreadyExists, models.CodeUserExists},
+		{"unauthorized", context.Background(), models.ErrUnauthorized, codes.Unauthenticated, models.CodeUnauthorized},
+		{"rate limited", context.Background(), models.ErrRateLimited, codes.ResourceExhausted, models.CodeRateLimited},
+		{"internal", logging.WithLogger(context.Background(), logging.Discard), errors.New("connection refused"), codes.Internal, models.CodeInternal},
+		{"timeout", expired, errors.New("canceling statement"), codes.DeadlineExceeded, models.CodeTimeout},
+		{"canceled", context.Background(), context.Canceled, codes.Canceled, ""},
+		{"grpc error", context.Background(), status.Error(codes.Unavailable, "unavailable"), codes.Unavailable, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			checkStatus(grpcError(c.ctx, c.err), c.code, c.reason, t)
+		})
+	}
+}
+
+// Test_RunGRPC - тестирование запуска и плавного завершения работы gRPC сервера вместе с приложением.
+func Test_RunGRPC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcAddr := ln.Addr().String()
+	ln.Close()
+
+	processor := &processorMock{resOnGetMembers: []models.Member{{UserID: 1}}}
+	app := CreateApp(logging.Discard, processor, Options{DrainDelay: 100 * time.Millisecond, ShutdownTimeout: time.Second, GRPCAddr: grpcAddr})
+	_, runErr, stop := runApp(t, app)
+
+	conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	health := healthpb.NewHealthClient(conn)
+
+	resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("got health %v and err = %v", resp, err)
+	}
+	if _, err := pb.NewUserSegmentationClient(conn).GetUserRelations(context.Background(), &pb.GetUserRelationsRequest{UserId: 1}); err != nil {
+		t.Errorf("unexpected: %s", err)
+	}
+
+	stop()
+	time.Sleep(50 * time.Millisecond)
+	resp, err = health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got health %v and err = %v during drain", resp, err)
+	}
+
+	if err := <-runErr; err != nil {
+		t.Errorf("unexpected: %s", err)
+	}
+	if _, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("got err = %v, expected grpc server to stop", err)
+	}
+}
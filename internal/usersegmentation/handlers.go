@@ -1,8 +1,10 @@
 package usersegmentation
 
 import (
-	"net/http"
+	"encoding/csv"
+	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
 	"github.com/gofiber/fiber/v2"
@@ -16,26 +18,39 @@ import (
 
 // @Summary      Adds segment to DB.
 // @Description  Add segment with the specified slug to DB and get it's ID.
+// @Description  If "auto_percent" is specified, the given percent of registered users is added to the segment, and newly registered users are evaluated against it too.
+// @Description  The choice of users is deterministic: it depends only on the user ID and the segment slug.
 // @Tags         Segments
 // @Accept       json
 // @Produce      json
-// @Param        slug body models.Segment true "Segment slug"
+// @Param        segment body models.SegmentCreation true "Segment slug and percent of users automatically added to it"
 // @Success      200 {object} models.ID
 // @Failure      400 {object} models.Err
+// @Failure      409 {object} models.Err "Segment already exists"
+// @Failure      422 {object} models.Err "Slug is empty, too long or contains control characters"
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
 // @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
 // @Router       /segments [post]
 func (app *App) PostSegment(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
 	if ok, err := checkType(c); !ok {
 		return err
 	}
-	slug, ok, err := getSlug(c)
+	segment, ok, err := getSegmentCreation(c)
 	if !ok {
 		return err
 	}
 
-	id, err := app.dbProcessor.AddSegment(slug)
+	id, err := app.dbProcessor.AddSegment(ctx, segment.Value, segment.AutoPercent)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(models.Err{Text: err.Error()})
+		return sendError(c, err)
 	}
 
 	return c.JSON(models.ID{Value: id})
@@ -48,16 +63,27 @@ func (app *App) PostSegment(c *fiber.Ctx) error {
 // Возвращает: ошибку.
 
 // @Summary      Deletes segment from DB.
-// @Description  Delete segment with the specified slug from DB.
+// @Description  Delete segment with the specified slug from DB. The segment is hidden, and its users are considered removed from it,
+// @Description  but it can be restored with its memberships until it is purged after the retention period.
 // @Tags         Segments
 // @Accept       json
 // @Produce      json
-// @Param        slug body models.Segment true "Segment slug"
+// @Param        slug body models.Slug true "Segment slug"
 // @Success      200 {string} string "OK"
 // @Failure      400 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      404 {object} models.Err "There is no segment with the specified slug"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
 // @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
 // @Router       /segments [delete]
 func (app *App) DeleteSegment(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
 	if ok, err := checkType(c); !ok {
 		return err
 	}
@@ -66,9 +92,228 @@ func (app *App) DeleteSegment(c *fiber.Ctx) error {
 		return err
 	}
 
-	err = app.dbProcessor.DeleteSegment(slug)
+	err = app.dbProcessor.DeleteSegment(ctx, slug)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON("OK")
+}
+
+// RestoreSegment - восстанавливает удалённый сегмент.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Restores deleted segment.
+// @Description  Restore the deleted segment with the specified slug together with its users' memberships, except the expired ones.
+// @Description  Deleted segments can be restored until they are purged after the retention period.
+// @Tags         Segments
+// @Produce      json
+// @Param        slug path string true "Segment slug"
+// @Success      200 {string} string "OK"
+// @Failure      400 {object} models.Err
+// @Failure      404 {object} models.Err "There is no deleted segment with the specified slug"
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /segments/{slug}/restore [post]
+func (app *App) RestoreSegment(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	slug, ok, err := getSlugParam(c)
+	if !ok {
+		return err
+	}
+
+	err = app.dbProcessor.RestoreSegment(ctx, slug)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON("OK")
+}
+
+// GetSegments - возвращает сегменты.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Returns segments.
+// @Description  Get a page of segments ordered by slug, optionally only the ones with slug starting with the specified prefix.
+// @Tags         Segments
+// @Produce      json
+// @Param        prefix query string false "Slug prefix"
+// @Param        limit query int false "Maximum number of segments (from 1 to 1000)" default(100)
+// @Param        offset query int false "Number of segments to skip" default(0)
+// @Success      200 {object} []models.Segment
+// @Failure      400 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /segments [get]
+func (app *App) GetSegments(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	limit, offset, ok, err := getPagination(c)
+	if !ok {
+		return err
+	}
+
+	segments, err := app.dbProcessor.GetSegments(ctx, c.Query("prefix"), limit, offset)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON(segments)
+}
+
+// GetSegment - возвращает сегмент.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Returns segment.
+// @Description  Get ID, creation time, description, owner team and members count of the segment with the specified slug.
+// @Tags         Segments
+// @Produce      json
+// @Param        slug path string true "Segment slug"
+// @Success      200 {object} models.Segment
+// @Failure      400 {object} models.Err
+// @Failure      404 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /segments/{slug} [get]
+func (app *App) GetSegment(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	slug, ok, err := getSlugParam(c)
+	if !ok {
+		return err
+	}
+
+	segment, err := app.dbProcessor.GetSegment(ctx, slug)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON(segment)
+}
+
+// GetSegmentMembers - возвращает пользователей, состоящих в сегменте.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Returns users in the segment.
+// @Description  Get a page of users in the segment with the specified slug, ordered by user ID, with the time they were added.
+// @Description  The response is streamed, so "limit=0" can be used to export the whole segment.
+// @Description  The default request timeout does not apply to the stream; it is limited only by the timeout set for this route.
+// @Description  To get the next page, pass "next_cursor" from the response as "cursor"; it is absent on the last page.
+// @Tags         Segments
+// @Produce      json
+// @Param        slug path string true "Segment slug"
+// @Param        cursor query int false "ID of the user after which to start"
+// @Param        limit query int false "Maximum number of users (0 for all)" default(100)
+// @Success      200 {object} models.MembersPage
+// @Failure      400 {object} models.Err
+// @Failure      404 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /segments/{slug}/users [get]
+func (app *App) GetSegmentMembers(c *fiber.Ctx) error {
+	slug, ok, err := getSlugParam(c)
+	if !ok {
+		return err
+	}
+	after, limit, ok, err := getCursor(c)
+	if !ok {
+		return err
+	}
+
+	// Контекст отменяется после окончания передачи потока пользователей, а не при выходе из обработчика.
+	ctx, cancel := app.streamContext(c)
+	body, err := streamMembers(ctx, cancel, func(fn func(models.Member) error) error {
+		return app.dbProcessor.GetSegmentMembers(ctx, slug, after, limit, fn)
+	}, limit)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(models.Err{Text: err.Error()})
+		return sendError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Context().SetBodyStream(body, -1)
+
+	return nil
+}
+
+// PatchSegment - изменяет метаданные сегмента.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Modifies segment's metadata.
+// @Description  Change description and/or owner team of the segment with the specified slug. Omitted fields are not changed.
+// @Tags         Segments
+// @Accept       json
+// @Produce      json
+// @Param        slug path string true "Segment slug"
+// @Param        update body models.SegmentUpdate true "New segment metadata"
+// @Success      200 {string} string "OK"
+// @Failure      400 {object} models.Err
+// @Failure      404 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /segments/{slug} [patch]
+func (app *App) PatchSegment(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	if ok, err := checkType(c); !ok {
+		return err
+	}
+	slug, ok, err := getSlugParam(c)
+	if !ok {
+		return err
+	}
+	update, ok, err := getSegmentUpdate(c)
+	if !ok {
+		return err
+	}
+
+	err = app.dbProcessor.UpdateSegment(ctx, slug, update)
+	if err != nil {
+		return sendError(c, err)
 	}
 
 	return c.JSON("OK")
@@ -82,15 +327,29 @@ func (app *App) DeleteSegment(c *fiber.Ctx) error {
 
 // @Summary      Modifies user's relations with segments.
 // @Description  Append and remove user with the specified ID to/from segments.
+// @Description  Each appended segment is either a slug or an object with the slug and "expires_at" (RFC 3339) or "ttl" (e.g. "72h").
+// @Description  All changes are applied atomically. If some of the segments do not exist, nothing is changed,
+// @Description  unless "partial" is true: then the changes are applied to the existing segments and the rest are reported as "unknown".
+// @Description  The response reports the status of each segment: "added", "already_present", "removed", "not_member" or "unknown".
 // @Tags         Users
 // @Accept       json
 // @Produce      json
 // @Param        params body models.UserModification true "User modification parameters"
-// @Success      200 {string} string "OK"
+// @Success      200 {object} models.ModificationReport
 // @Failure      400 {object} models.Err
+// @Failure      404 {object} models.Err "Some of the segments do not exist or user is not registered (only in strict mode)"
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
 // @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
 // @Router       /users [patch]
 func (app *App) ModifyUser(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
 	if ok, err := checkType(c); !ok {
 		return err
 	}
@@ -98,13 +357,58 @@ func (app *App) ModifyUser(c *fiber.Ctx) error {
 	if !ok {
 		return err
 	}
+	setUserID(c, mod.Value)
 
-	err = app.dbProcessor.ModifyUser(mod.Value, mod.Append, mod.Remove)
+	report, err := app.dbProcessor.ModifyUser(ctx, mod.Value, mod.Append, mod.Remove, mod.Partial)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(models.Err{Text: err.Error()})
+		return sendError(c, err)
 	}
 
-	return c.JSON("OK")
+	return c.JSON(report)
+}
+
+// ModifyUsers - массово изменяет сегменты пользователей.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Modifies relations with segments of many users.
+// @Description  Apply a list of user modifications (as in PATCH /users), or add/remove a list of users to/from a single segment.
+// @Description  Modifications are applied in batches; a modification that can not be applied (unknown segment, or unregistered user in strict mode) is skipped and reported.
+// @Description  On a database error the batches applied before it are kept.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        params body models.BulkModification true "List of user modifications, or segment with list of user IDs"
+// @Success      200 {object} models.BulkReport
+// @Failure      400 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /users/bulk [patch]
+func (app *App) ModifyUsers(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	if ok, err := checkType(c); !ok {
+		return err
+	}
+	mods, ok, err := getBulkMods(c)
+	if !ok {
+		return err
+	}
+
+	report, err := app.dbProcessor.ModifyUsers(ctx, mods)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON(report)
 }
 
 // GetUserRelations - возвращает сегменты, в которых состоит пользователь.
@@ -115,28 +419,219 @@ func (app *App) ModifyUser(c *fiber.Ctx) error {
 
 // @Summary      Returns segments in which the user is located.
 // @Description  Get a list of segments in which the user with the specified ID is located.
+// @Description  With with_expiry=true, membership expiry time is added to the segments whose membership expires.
 // @Tags         Users
 // @Produce      json
 // @Param        id path int true "User ID"
-// @Success      200 {object} []models.Segment
+// @Param        with_expiry query bool false "Add membership expiry time"
+// @Success      200 {object} []models.Relation
 // @Failure      400 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
 // @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
 // @Router       /users/{id} [get]
 func (app *App) GetUserRelations(c *fiber.Ctx) error {
-	idStr := c.Params("id")
-	id, err := strconv.Atoi(idStr)
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	id, ok, err := getPathID(c)
+	if !ok {
+		return err
+	}
+	setUserID(c, id)
+	withExpiry, ok, err := getWithExpiry(c)
+	if !ok {
+		return err
+	}
+
+	relations, err := app.dbProcessor.GetUserRelations(ctx, id)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if withExpiry {
+		return c.JSON(relations)
+	}
+
+	slugs := make([]models.Slug, len(relations))
+	for i, relation := range relations {
+		slugs[i].Value = relation.Slug
+	}
+
+	return c.JSON(slugs)
+}
+
+// PostUser - регистрирует пользователя.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Registers user.
+// @Description  Register user with the specified ID and add him to the segments with automatic rollout he falls into.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        id body models.ID true "User ID"
+// @Success      200 {string} string "OK"
+// @Failure      400 {object} models.Err
+// @Failure      409 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /users [post]
+func (app *App) PostUser(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	if ok, err := checkType(c); !ok {
+		return err
+	}
+	id, ok, err := getID(c)
+	if !ok {
+		return err
+	}
+	setUserID(c, id)
+
+	err = app.dbProcessor.AddUser(ctx, id)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON("OK")
+}
+
+// GetUsers - возвращает зарегистрированных пользователей.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Returns registered users.
+// @Description  Get a page of registered users ordered by ID.
+// @Tags         Users
+// @Produce      json
+// @Param        limit query int false "Maximum number of users (from 1 to 1000)" default(100)
+// @Param        offset query int false "Number of users to skip" default(0)
+// @Success      200 {object} []models.User
+// @Failure      400 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /users [get]
+func (app *App) GetUsers(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	limit, offset, ok, err := getPagination(c)
+	if !ok {
+		return err
+	}
+
+	users, err := app.dbProcessor.GetUsers(ctx, limit, offset)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(models.Err{Text: `path parameter "id" must be an integer`})
+		return sendError(c, err)
 	}
 
-	slugs, err := app.dbProcessor.GetUserRelations(id)
+	return c.JSON(users)
+}
+
+// DeleteUser - удаляет пользователя.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Deletes user.
+// @Description  Delete user with the specified ID and all his relations with segments.
+// @Tags         Users
+// @Produce      json
+// @Param        id path int true "User ID"
+// @Success      200 {string} string "OK"
+// @Failure      400 {object} models.Err
+// @Failure      404 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /users/{id} [delete]
+func (app *App) DeleteUser(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	id, ok, err := getPathID(c)
+	if !ok {
+		return err
+	}
+	setUserID(c, id)
+
+	err = app.dbProcessor.DeleteUser(ctx, id)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(models.Err{Text: err.Error()})
+		return sendError(c, err)
 	}
-	segments := make([]models.Segment, len(slugs))
-	for i, slug := range slugs {
-		segments[i].Slug = slug
+
+	return c.JSON("OK")
+}
+
+// GetHistoryReport - возвращает CSV отчёт по истории изменений сегментов пользователей за месяц.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Returns CSV report of users' segments history.
+// @Description  Get a CSV report of all additions and removals of users to/from segments during the specified month.
+// @Tags         History
+// @Produce      text/csv
+// @Produce      json
+// @Param        period path string true "Year and month in format YYYY-MM"
+// @Success      200 {string} string "CSV report: user_id,segment,operation,time"
+// @Failure      400 {object} models.Err
+// @Failure      401 {object} models.Err "Bearer token or API key is missing or invalid"
+// @Failure      403 {object} models.Err "Role of the client is insufficient"
+// @Failure      429 {object} models.Err "Rate limit of the client is exceeded"
+// @Failure      500 {object} models.Err
+// @Failure      504 {object} models.Err "Request timed out"
+// @Security     BearerAuth
+// @Security     APIKeyAuth
+// @Router       /history/{period} [get]
+func (app *App) GetHistoryReport(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	from, ok, err := getPeriod(c)
+	if !ok {
+		return err
 	}
 
-	return c.JSON(segments)
+	records, err := app.dbProcessor.GetHistory(ctx, from, from.AddDate(0, 1, 0))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="history_%s.csv"`, from.Format(periodLayout)))
+
+	w := csv.NewWriter(c)
+	w.Write([]string{"user_id", "segment", "operation", "time"})
+	for _, record := range records {
+		w.Write([]string{strconv.Itoa(record.UserID), record.Slug, record.Operation, record.Time.UTC().Format(time.RFC3339)})
+	}
+	w.Flush()
+
+	return w.Error()
 }
@@ -0,0 +1,108 @@
+package usersegmentation
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HealthCheck - функция проверки готовности компонента сервиса (например, доступности БД).
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку (nil, если компонент готов к работе).
+type HealthCheck func(ctx context.Context) error
+
+// readyCheckTimeout - максимальное время проверки готовности компонентов.
+const readyCheckTimeout = 5 * time.Second
+
+// Healthz - возвращает состояние процесса сервиса.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Returns liveness of the service.
+// @Description  Always returns "ok" while the process is able to handle requests; the state of the storage is not checked.
+// @Tags         Health
+// @Produce      json
+// @Success      200 {object} models.Health
+// @Router       /healthz [get]
+func (app *App) Healthz(c *fiber.Ctx) error {
+	return c.JSON(models.Health{Status: models.HealthOK})
+}
+
+// Readyz - возвращает готовность сервиса к обработке запросов.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+
+// @Summary      Returns readiness of the service.
+// @Description  Check the components of the service (e.g. database availability and schema version) and report their statuses.
+// @Description  The results are cached for a short interval. When the service is shutting down, readiness fails immediately.
+// @Tags         Health
+// @Produce      json
+// @Success      200 {object} models.Health
+// @Failure      503 {object} models.Health "Some of the components are failing or the service is shutting down"
+// @Router       /readyz [get]
+func (app *App) Readyz(c *fiber.Ctx) error {
+	ctx, cancel := app.requestContext(c)
+	defer cancel()
+
+	if app.shuttingDown.Load() {
+		return c.Status(http.StatusServiceUnavailable).JSON(models.Health{Status: models.HealthShuttingDown})
+	}
+
+	health := app.readiness(ctx)
+	if health.Status != models.HealthOK {
+		return c.Status(http.StatusServiceUnavailable).JSON(health)
+	}
+
+	return c.JSON(health)
+}
+
+// readiness - получение готовности компонентов сервиса.
+// Если с последней проверки прошло меньше Options.ReadyCacheTTL, возвращается её результат, иначе компоненты проверяются заново.
+// Проверки не отменяются вместе с контекстом запроса (например, при отключении клиента), а ограничиваются readyCheckTimeout,
+// поэтому в кеш не попадают ошибки, вызванные отменой запроса.
+//
+// Принимает: контекст.
+//
+// Возвращает: состояние сервиса.
+func (app *App) readiness(ctx context.Context) models.Health {
+	app.readyMu.Lock()
+	defer app.readyMu.Unlock()
+
+	if !app.readyAt.IsZero() && time.Since(app.readyAt) < app.options.ReadyCacheTTL {
+		return app.ready
+	}
+
+	names := make([]string, 0, len(app.options.HealthChecks))
+	for name := range app.options.HealthChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readyCheckTimeout)
+	defer cancel()
+
+	health := models.Health{Status: models.HealthOK, Components: make(map[string]models.ComponentHealth, len(names))}
+	for _, name := range names {
+		component := models.ComponentHealth{Status: models.HealthOK}
+		if err := app.options.HealthChecks[name](ctx); err != nil {
+			app.logger.Warn("component is not ready", "component", name, "error", err)
+			component = models.ComponentHealth{Status: models.HealthFailing, Error: err.Error()}
+			health.Status = models.HealthFailing
+		}
+		health.Components[name] = component
+	}
+
+	app.ready, app.readyAt = health, time.Now()
+
+	return health
+}
@@ -1,11 +1,22 @@
 package usersegmentation
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
 	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -15,17 +26,314 @@ import (
 //
 // Возвращает: имя сегмента, флаг успешности, ошибку.
 func getSlug(c *fiber.Ctx) (string, bool, error) {
-	segment := models.Segment{}
+	slug := models.Slug{}
 
 	dec := json.NewDecoder(bytes.NewReader(c.Body()))
 	dec.DisallowUnknownFields()
 
-	if err := dec.Decode(&segment); err != nil {
-		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"slug":"some text"}`})
+	if err := dec.Decode(&slug); err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"slug":"some text"}`, Code: models.CodeBadRequest})
+		return "", false, err
+	}
+
+	return slug.Value, true, nil
+}
+
+// getSlugParam - получение имени сегмента из параметра пути "slug".
+//
+// Принимает: контекст.
+//
+// Возвращает: имя сегмента, флаг успешности, ошибку.
+func getSlugParam(c *fiber.Ctx) (string, bool, error) {
+	slug, err := url.PathUnescape(c.Params("slug"))
+	if err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `path parameter "slug" must be a valid URL-encoded string`, Code: models.CodeBadRequest})
 		return "", false, err
 	}
 
-	return segment.Slug, true, nil
+	return slug, true, nil
+}
+
+// getSegmentUpdate - получение изменений метаданных сегмента из контекста.
+//
+// Принимает: контекст.
+//
+// Возвращает: изменения метаданных сегмента, флаг успешности, ошибку.
+func getSegmentUpdate(c *fiber.Ctx) (models.SegmentUpdate, bool, error) {
+	update := models.SegmentUpdate{}
+
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&update); err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"description":"some text","owner_team":"some text"}`, Code: models.CodeBadRequest})
+		return update, false, err
+	}
+
+	return update, true, nil
+}
+
+// getSegmentCreation - получение параметров создания сегмента из контекста.
+//
+// Принимает: контекст.
+//
+// Возвращает: параметры создания сегмента, флаг успешности, ошибку.
+func getSegmentCreation(c *fiber.Ctx) (models.SegmentCreation, bool, error) {
+	segment := models.SegmentCreation{}
+
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&segment); err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"slug":"some text","auto_percent":0}`, Code: models.CodeBadRequest})
+		return segment, false, err
+	}
+	if segment.AutoPercent < 0 || segment.AutoPercent > 100 {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `"auto_percent" must be between 0 and 100`, Code: models.CodeBadRequest})
+		return segment, false, err
+	}
+
+	return segment, true, nil
+}
+
+// validID - проверка id: id пользователей и ключей API хранятся в БД в столбцах типа integer.
+//
+// Принимает: id.
+//
+// Возвращает: true, если id помещается в integer.
+func validID(id int) bool {
+	return id >= math.MinInt32 && id <= math.MaxInt32
+}
+
+// idRangeText - текст ошибки для id, не помещающегося в integer (см. validID).
+var idRangeText = fmt.Sprintf(`must be between %d and %d`, math.MinInt32, math.MaxInt32)
+
+// getID - получение id из тела запроса.
+//
+// Принимает: контекст.
+//
+// Возвращает: id, флаг успешности, ошибку.
+func getID(c *fiber.Ctx) (int, bool, error) {
+	id := models.ID{}
+
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&id); err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"id":0}`, Code: models.CodeBadRequest})
+		return 0, false, err
+	}
+	if !validID(id.Value) {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `"id" ` + idRangeText, Code: models.CodeBadRequest})
+		return 0, false, err
+	}
+
+	return id.Value, true, nil
+}
+
+// getPathID - получение id пользователя или ключа API из параметра пути "id".
+//
+// Принимает: контекст.
+//
+// Возвращает: id, флаг успешности, ошибку.
+func getPathID(c *fiber.Ctx) (int, bool, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `path parameter "id" must be an integer`, Code: models.CodeBadRequest})
+		return 0, false, err
+	}
+	if !validID(id) {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `path parameter "id" ` + idRangeText, Code: models.CodeBadRequest})
+		return 0, false, err
+	}
+
+	return id, true, nil
+}
+
+// maxAPIKeyNameLength - максимальная длина названия ключа API.
+const maxAPIKeyNameLength = 100
+
+// getAPIKeyCreation - получение параметров создания ключа API из контекста.
+//
+// Принимает: контекст.
+//
+// Возвращает: параметры создания ключа, флаг успешности, ошибку.
+func getAPIKeyCreation(c *fiber.Ctx) (models.APIKeyCreation, bool, error) {
+	creation := models.APIKeyCreation{}
+
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&creation); err != nil || creation.Name == "" || len(creation.Name) > maxAPIKeyNameLength {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: fmt.Sprintf(`request's body must implement the template {"name":"some text","role":"reader","expires_at":"2030-01-01T00:00:00Z"} with a name of at most %d bytes`, maxAPIKeyNameLength), Code: models.CodeBadRequest})
+		return creation, false, err
+	}
+	if !auth.ValidRole(auth.Role(creation.Role)) {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `"role" must be reader, editor or admin`, Code: models.CodeBadRequest})
+		return creation, false, err
+	}
+	if creation.ExpiresAt != nil && !creation.ExpiresAt.After(time.Now()) {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `"expires_at" must be in the future`, Code: models.CodeBadRequest})
+		return creation, false, err
+	}
+
+	return creation, true, nil
+}
+
+// getAPIKeyExpiry - получение нового времени истечения ключа API из контекста.
+//
+// Принимает: контекст.
+//
+// Возвращает: время истечения ключа, флаг успешности, ошибку.
+func getAPIKeyExpiry(c *fiber.Ctx) (models.APIKeyExpiry, bool, error) {
+	expiry := models.APIKeyExpiry{}
+
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&expiry); err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"expires_at":"2030-01-01T00:00:00Z"}`, Code: models.CodeBadRequest})
+		return expiry, false, err
+	}
+
+	return expiry, true, nil
+}
+
+// Ограничения размера страницы при постраничном получении данных.
+const (
+	defaultLimit = 100  // defaultLimit - размер страницы по умолчанию.
+	maxLimit     = 1000 // maxLimit - максимальный размер страницы.
+)
+
+// getPagination - получение параметров постраничного получения данных из query параметров "limit" и "offset".
+//
+// Принимает: контекст.
+//
+// Возвращает: размер страницы, смещение, флаг успешности, ошибку.
+func getPagination(c *fiber.Ctx) (int, int, bool, error) {
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 || limit > maxLimit {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: fmt.Sprintf(`query parameter "limit" must be an integer from 1 to %d`, maxLimit), Code: models.CodeBadRequest})
+		return 0, 0, false, err
+	}
+	offset, err := strconv.Atoi(c.Query("offset", "0"))
+	if err != nil || offset < 0 {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `query parameter "offset" must be a non-negative integer`, Code: models.CodeBadRequest})
+		return 0, 0, false, err
+	}
+
+	return limit, offset, true, nil
+}
+
+// getWithExpiry - получение флага вывода времени истечения членств из query параметра "with_expiry".
+//
+// Принимает: контекст.
+//
+// Возвращает: флаг вывода времени истечения (false, если параметр не указан), флаг успешности, ошибку.
+func getWithExpiry(c *fiber.Ctx) (bool, bool, error) {
+	param := c.Query("with_expiry")
+	if param == "" {
+		return false, true, nil
+	}
+	withExpiry, err := strconv.ParseBool(param)
+	if err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `query parameter "with_expiry" must be a boolean`, Code: models.CodeBadRequest})
+		return false, false, err
+	}
+
+	return withExpiry, true, nil
+}
+
+// getCursor - получение параметров постраничного получения пользователей сегмента из query параметров "cursor" и "limit".
+//
+// Принимает: контекст.
+//
+// Возвращает: id пользователя, после которого начинать, размер страницы (0 - без ограничения), флаг успешности, ошибку.
+func getCursor(c *fiber.Ctx) (int, int, bool, error) {
+	after := math.MinInt
+	if cursor := c.Query("cursor"); cursor != "" {
+		var err error
+		if after, err = strconv.Atoi(cursor); err != nil {
+			err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `query parameter "cursor" must be an integer`, Code: models.CodeBadRequest})
+			return 0, 0, false, err
+		}
+	}
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 0 {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `query parameter "limit" must be a non-negative integer`, Code: models.CodeBadRequest})
+		return 0, 0, false, err
+	}
+
+	return after, limit, true, nil
+}
+
+// streamMembers - потоковая запись пользователей сегмента в формате models.MembersPage.
+//
+// Пользователи записываются в тело ответа по мере получения из обработчика БД.
+// Ошибка, возникшая до получения первого пользователя, возвращается, и тело ответа не создаётся;
+// ошибка, возникшая позже, записывается в лог и обрывает тело ответа.
+//
+// Функция отмены контекста запроса вызывается после окончания передачи пользователей.
+//
+// Принимает: контекст запроса и функцию его отмены, функцию получения пользователей, размер страницы (0 - без ограничения).
+//
+// Возвращает: тело ответа и ошибку.
+func streamMembers(ctx context.Context, cancel context.CancelFunc, get func(fn func(models.Member) error) error, limit int) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	started := make(chan error, 1)
+
+	go func() {
+		defer cancel()
+
+		var (
+			w     = bufio.NewWriter(pw)
+			count = 0
+			last  = 0
+		)
+
+		err := get(func(member models.Member) error {
+			if count == 0 {
+				started <- nil
+				w.WriteString(`{"users":[`)
+			} else {
+				w.WriteByte(',')
+			}
+			b, err := json.Marshal(member)
+			if err != nil {
+				return err
+			}
+			count, last = count+1, member.UserID
+			_, err = w.Write(b)
+			return err
+		})
+		if count == 0 {
+			started <- err
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			w.WriteString(`{"users":[`)
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("error while streaming segment members", "error", err)
+			pw.CloseWithError(err)
+			return
+		}
+
+		w.WriteByte(']')
+		if limit > 0 && count == limit {
+			fmt.Fprintf(w, `,"next_cursor":%d`, last)
+		}
+		w.WriteByte('}')
+		pw.CloseWithError(w.Flush())
+	}()
+
+	if err := <-started; err != nil {
+		pr.Close()
+		return nil, err
+	}
+
+	return pr, nil
 }
 
 // getUserMod - получение требуемых изменений пользователя из контекста.
@@ -40,13 +348,158 @@ func getUserMod(c *fiber.Ctx) (models.UserModification, bool, error) {
 	dec.DisallowUnknownFields()
 
 	if err := dec.Decode(&mod); err != nil {
-		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"id":0,"append":["test1","test2"],"remove":["test3","test4"]}`})
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"id":0,"append":["test1","test2"],"remove":["test3","test4"],"partial":false}`, Code: models.CodeBadRequest})
+		return mod, false, err
+	}
+	if !validID(mod.Value) {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `"id" ` + idRangeText, Code: models.CodeBadRequest})
 		return mod, false, err
 	}
 
 	return mod, true, nil
 }
 
+// maxBulkSize - максимальное количество изменений пользователей в одном запросе массового изменения.
+const maxBulkSize = 100000
+
+// getBulkMods - получение требуемых массовых изменений пользователей из контекста.
+// Сегмент со списком id пользователей преобразуется в изменение для каждого пользователя.
+//
+// Принимает: контекст.
+//
+// Возвращает: список изменений пользователей, флаг успешности, ошибку.
+func getBulkMods(c *fiber.Ctx) ([]models.UserModification, bool, error) {
+	bulk := models.BulkModification{}
+
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&bulk)
+	bySegment := bulk.Segment != nil || len(bulk.IDs) > 0 || bulk.Operation != ""
+	valid := err == nil
+	if bySegment {
+		valid = valid && len(bulk.Users) == 0 && bulk.Segment != nil && len(bulk.IDs) > 0 &&
+			(bulk.Operation == "" || bulk.Operation == models.OperationAdd || (bulk.Operation == models.OperationRemove && bulk.Segment.ExpiresAt == nil))
+	} else {
+		valid = valid && len(bulk.Users) > 0
+	}
+	if !valid {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's body must implement the template {"users":[{"id":0,"append":["test1"],"remove":["test2"]}]} or {"segment":"test1","ids":[0],"operation":"add"}`, Code: models.CodeBadRequest})
+		return nil, false, err
+	}
+
+	if !bySegment {
+		if len(bulk.Users) > maxBulkSize {
+			err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: fmt.Sprintf(`request must contain at most %d modifications`, maxBulkSize), Code: models.CodeBadRequest})
+			return nil, false, err
+		}
+		for _, mod := range bulk.Users {
+			if !validID(mod.Value) {
+				err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `"id" of every user ` + idRangeText, Code: models.CodeBadRequest})
+				return nil, false, err
+			}
+		}
+		return bulk.Users, true, nil
+	}
+
+	if len(bulk.IDs) > maxBulkSize {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: fmt.Sprintf(`request must contain at most %d modifications`, maxBulkSize), Code: models.CodeBadRequest})
+		return nil, false, err
+	}
+	for _, id := range bulk.IDs {
+		if !validID(id) {
+			err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `"ids" ` + idRangeText, Code: models.CodeBadRequest})
+			return nil, false, err
+		}
+	}
+	mods := make([]models.UserModification, len(bulk.IDs))
+	for i, id := range bulk.IDs {
+		mods[i].Value = id
+		if bulk.Operation == models.OperationRemove {
+			mods[i].Remove = []string{bulk.Segment.Slug}
+		} else {
+			mods[i].Append = []models.SegmentAddition{*bulk.Segment}
+		}
+	}
+
+	return mods, true, nil
+}
+
+// periodLayout - формат периода отчёта по истории (год-месяц).
+const periodLayout = "2006-01"
+
+// getPeriod - получение начала месяца, указанного в параметре пути "period", из контекста.
+//
+// Принимает: контекст.
+//
+// Возвращает: начало месяца в UTC, флаг успешности, ошибку.
+func getPeriod(c *fiber.Ctx) (time.Time, bool, error) {
+	from, err := time.Parse(periodLayout, c.Params("period"))
+	if err != nil {
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `path parameter "period" must be in format YYYY-MM`, Code: models.CodeBadRequest})
+		return time.Time{}, false, err
+	}
+
+	return from, true, nil
+}
+
+// requestContext - создание контекста обработки запроса с ограничением времени.
+// Время обработки берётся из настройки Timeouts для маршрута запроса, а если она не задана - из настройки Timeout.
+// Созданный контекст сохраняется в контексте Fiber и доступен через c.UserContext().
+//
+// Принимает: контекст.
+//
+// Возвращает: контекст обработки запроса и функцию его отмены.
+func (app *App) requestContext(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	timeout, ok := app.options.Timeouts[routeKey(c.Route().Method, c.Route().Path)]
+	if !ok {
+		timeout = app.options.Timeout
+	}
+
+	return withTimeout(c, timeout)
+}
+
+// streamContext - создание контекста передачи потока ответа.
+// В отличие от requestContext, настройка Timeout не применяется: передача большого потока может длиться дольше обычного запроса,
+// поэтому время ограничивается, только если оно задано для маршрута в настройке Timeouts.
+// Контекст всё равно отменяется при завершении работы приложения и при закрытии потока (например, если клиент отключился).
+//
+// Принимает: контекст.
+//
+// Возвращает: контекст передачи потока и функцию его отмены.
+func (app *App) streamContext(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	return withTimeout(c, app.options.Timeouts[routeKey(c.Route().Method, c.Route().Path)])
+}
+
+// withTimeout - создание контекста с ограничением времени, сохраняемого в контексте Fiber.
+//
+// Принимает: контекст и время (0 - без ограничения).
+//
+// Возвращает: созданный контекст и функцию его отмены.
+func withTimeout(c *fiber.Ctx, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.UserContext(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.UserContext())
+	}
+	c.SetUserContext(ctx)
+
+	return ctx, cancel
+}
+
+// routeKey - получение ключа маршрута в настройке Timeouts.
+//
+// Принимает: метод и путь маршрута.
+//
+// Возвращает: ключ маршрута в формате "METHOD /path".
+func routeKey(method string, path string) string {
+	return method + " " + path
+}
+
 // checkType - проверка типа запроса на json.
 //
 // Принимает: контекст.
@@ -54,9 +507,46 @@ func getUserMod(c *fiber.Ctx) (models.UserModification, bool, error) {
 // Возвращает: флаг успешности, ошибку.
 func checkType(c *fiber.Ctx) (bool, error) {
 	if !c.Is("json") {
-		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's Content-Type must be application/json`})
+		err := c.Status(http.StatusBadRequest).JSON(models.Err{Text: `request's Content-Type must be application/json`, Code: models.CodeBadRequest})
 		return false, err
 	}
 
 	return true, nil
 }
+
+// sendError - отправка ошибки обработчика БД.
+// Ошибки из пакета models отправляются с соответствующими кодом состояния и кодом ошибки (см. models.ErrorCode), остальные - с кодом состояния 500.
+// Если время обработки запроса истекло, ошибка отправляется с кодом состояния 504.
+//
+// Принимает: контекст, ошибку.
+//
+// Возвращает: ошибку.
+func sendError(c *fiber.Ctx, err error) error {
+	if errors.Is(c.UserContext().Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s: %w", err, models.ErrTimeout)
+	}
+	code := models.ErrorCode(err)
+	if code == models.CodeInternal {
+		logging.FromContext(c.UserContext()).Error("error while handling request", "error", err)
+	}
+
+	status := http.StatusInternalServerError
+	switch code {
+	case models.CodeSegmentNotFound, models.CodeUserNotFound, models.CodeAPIKeyNotFound:
+		status = http.StatusNotFound
+	case models.CodeSegmentExists, models.CodeUserExists:
+		status = http.StatusConflict
+	case models.CodeInvalidSlug:
+		status = http.StatusUnprocessableEntity
+	case models.CodeTimeout:
+		status = http.StatusGatewayTimeout
+	case models.CodeUnauthorized:
+		status = http.StatusUnauthorized
+	case models.CodeForbidden:
+		status = http.StatusForbidden
+	case models.CodeRateLimited:
+		status = http.StatusTooManyRequests
+	}
+
+	return c.Status(status).JSON(models.Err{Text: err.Error(), Code: code})
+}
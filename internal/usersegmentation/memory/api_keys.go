@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// APIKeys - хранилище ключей API в памяти.
+// Все методы безопасны для одновременного вызова из нескольких горутин.
+type APIKeys struct {
+	mu     sync.RWMutex           // mu - мьютекс, защищающий ключи.
+	now    func() time.Time       // now - функция получения текущего времени.
+	nextID int                    // nextID - id следующего создаваемого ключа.
+	keys   map[int]*models.APIKey // keys - ключи по id.
+	byHash map[string]int         // byHash - id ключей по хешу секрета.
+}
+
+// NewAPIKeyStore - создание хранилища ключей API в памяти.
+//
+// Возвращает хранилище ключей API.
+func NewAPIKeyStore() models.APIKeyStore {
+	return &APIKeys{
+		now:    time.Now,
+		nextID: 1,
+		keys:   make(map[int]*models.APIKey),
+		byHash: make(map[string]int),
+	}
+}
+
+// AddAPIKey - добавление ключа API.
+//
+// Принимает: контекст и параметры ключа.
+//
+// Возвращает: добавленный ключ и ошибку.
+func (store *APIKeys) AddAPIKey(ctx context.Context, key models.NewAPIKey) (models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.byHash[string(key.Hash)]; ok {
+		return models.APIKey{}, fmt.Errorf("error while adding api key: key with the same hash already exists")
+	}
+	added := &models.APIKey{
+		ID:        store.nextID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Role:      key.Role,
+		CreatedAt: store.now(),
+		ExpiresAt: key.ExpiresAt,
+	}
+	store.nextID++
+	store.keys[added.ID] = added
+	store.byHash[string(key.Hash)] = added.ID
+
+	return *added, nil
+}
+
+// GetAPIKeys - получение всех ключей API.
+//
+// Принимает: контекст.
+//
+// Возвращает: список ключей, упорядоченный по id, и ошибку.
+func (store *APIKeys) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return []models.APIKey{}, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(store.keys))
+	for id := 1; id < store.nextID; id++ {
+		if key, ok := store.keys[id]; ok {
+			keys = append(keys, *key)
+		}
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash - получение ключа API по хешу секрета.
+//
+// Принимает: контекст и хеш секрета.
+//
+// Возвращает: ключ и ошибку (models.ErrAPIKeyNotFound, если ключа с таким хешем нет).
+func (store *APIKeys) GetAPIKeyByHash(ctx context.Context, hash []byte) (models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	id, ok := store.byHash[string(hash)]
+	if !ok {
+		return models.APIKey{}, models.ErrAPIKeyNotFound
+	}
+
+	return *store.keys[id], nil
+}
+
+// RevokeAPIKey - отзыв ключа API.
+//
+// Принимает: контекст и id ключа.
+//
+// Возвращает: ошибку (models.ErrAPIKeyNotFound, если ключ не существует).
+func (store *APIKeys) RevokeAPIKey(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key, ok := store.keys[id]
+	if !ok {
+		return fmt.Errorf("api key %d: %w", id, models.ErrAPIKeyNotFound)
+	}
+	if key.RevokedAt == nil {
+		now := store.now()
+		key.RevokedAt = &now
+	}
+
+	return nil
+}
+
+// SetAPIKeyExpiry - установка времени истечения ключа API.
+//
+// Принимает: контекст, id ключа и время истечения (nil - ключ бессрочный).
+//
+// Возвращает: ошибку (models.ErrAPIKeyNotFound, если ключ не существует).
+func (store *APIKeys) SetAPIKeyExpiry(ctx context.Context, id int, expiresAt *time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key, ok := store.keys[id]
+	if !ok {
+		return fmt.Errorf("api key %d: %w", id, models.ErrAPIKeyNotFound)
+	}
+	key.ExpiresAt = expiresAt
+
+	return nil
+}
+
+// RecordAPIKeyUsage - учёт использований ключей API.
+//
+// Принимает: контекст и использования ключей по их id.
+//
+// Возвращает: ошибку.
+func (store *APIKeys) RecordAPIKeyUsage(ctx context.Context, usage map[int]models.APIKeyUsage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for id, u := range usage {
+		key, ok := store.keys[id]
+		if !ok {
+			continue
+		}
+		key.UsageCount += u.Count
+		if key.LastUsedAt == nil || u.LastUsed.After(*key.LastUsedAt) {
+			lastUsed := u.LastUsed
+			key.LastUsedAt = &lastUsed
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// bulkBatchSize - количество изменений пользователей, применяемых за одну блокировку модели при массовом изменении.
+const bulkBatchSize = 1000
+
+// ModifyUsers - массовое изменение сегментов пользователей.
+// Изменения применяются пачками по bulkBatchSize так же, как в модели postgres:
+// в каждой пачке сначала выполняются все добавления, затем все удаления.
+//
+// Принимает: контекст, список изменений пользователей.
+//
+// Возвращает: итог изменения и ошибку.
+func (model *UserSegmentation) ModifyUsers(ctx context.Context, mods []models.UserModification) (models.BulkReport, error) {
+	report := models.BulkReport{Failed: make([]models.BulkFailure, 0)}
+
+	for start := 0; start < len(mods); start += bulkBatchSize {
+		if err := ctx.Err(); err != nil {
+			return report, fmt.Errorf("error after applying %d of %d modifications: %w", report.Applied, len(mods), err)
+		}
+		end := min(start+bulkBatchSize, len(mods))
+		applied, failed := model.modifyBatch(mods[start:end])
+		report.Applied += applied
+		report.Failed = append(report.Failed, failed...)
+	}
+
+	return report, nil
+}
+
+// modifyBatch - применение пачки изменений сегментов пользователей.
+//
+// Изменение пользователя не применяется, если какой-либо из его сегментов не существует (если только в нём не указан флаг Partial),
+// или, в строгом режиме, если пользователь не зарегистрирован.
+// Если пользователь добавляется в один сегмент несколько раз, то используется время истечения из последнего добавления.
+//
+// Принимает: пачку изменений пользователей.
+//
+// Возвращает: количество применённых изменений и список неприменённых изменений.
+func (model *UserSegmentation) modifyBatch(batch []models.UserModification) (int, []models.BulkFailure) {
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	var (
+		failed   = make([]models.BulkFailure, 0)
+		accepted = make([]models.UserModification, 0, len(batch))
+	)
+
+	for _, mod := range batch {
+		if unknown := model.unknownSlugs(mod.Append, mod.Remove); len(unknown) > 0 && !mod.Partial {
+			failed = append(failed, bulkFailure(mod.Value, fmt.Errorf("segments %q: %w", unknown, models.ErrSegmentNotFound)))
+			continue
+		}
+		if _, ok := model.users[mod.Value]; !ok && model.strictUsers {
+			failed = append(failed, bulkFailure(mod.Value, fmt.Errorf("user %d: %w", mod.Value, models.ErrUserNotFound)))
+			continue
+		}
+		accepted = append(accepted, mod)
+	}
+
+	now := model.now()
+	for _, mod := range accepted {
+		if _, ok := model.users[mod.Value]; !ok {
+			model.register(mod.Value)
+		}
+	}
+	for _, mod := range accepted {
+		model.deleteExpired(model.sortedRelations(mod.Value), now)
+	}
+
+	for _, mod := range accepted {
+		for _, addition := range mod.Append {
+			if s, ok := model.active(addition.Slug); ok {
+				model.link(mod.Value, s, addition.ExpiresAt, now)
+			}
+		}
+	}
+	for _, mod := range accepted {
+		for _, slug := range mod.Remove {
+			if s, ok := model.active(slug); ok {
+				model.unlinkUser(mod.Value, s, now)
+			}
+		}
+	}
+
+	return len(accepted), failed
+}
+
+// bulkFailure - создание описания неприменённого изменения пользователя.
+//
+// Принимает: id пользователя и ошибку.
+//
+// Возвращает: описание неприменённого изменения.
+func bulkFailure(id int, err error) models.BulkFailure {
+	return models.BulkFailure{ID: id, Text: err.Error(), Code: models.ErrorCode(err)}
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+func Test_ModifyUsers(t *testing.T) {
+	t.Run("normal case", func(t *testing.T) {
+		model, _ := newTestModel(false)
+		mustAddSegment(t, model, "a")
+		mustAddSegment(t, model, "b")
+
+		mods := make([]models.UserModification, 0, bulkBatchSize+10)
+		for id := 0; id < bulkBatchSize+10; id++ {
+			mods = append(mods, models.UserModification{ID: models.ID{Value: id}, Append: []models.SegmentAddition{{Slug: "a"}}})
+		}
+		mods = append(mods,
+			models.UserModification{ID: models.ID{Value: 1}, Append: []models.SegmentAddition{{Slug: "unknown"}}},
+			models.UserModification{ID: models.ID{Value: 2}, Append: []models.SegmentAddition{{Slug: "b"}, {Slug: "unknown"}}, Remove: []string{"a"}, Partial: true},
+		)
+
+		report, err := model.ModifyUsers(ctx, mods)
+		expected := models.BulkReport{
+			Applied: bulkBatchSize + 11,
+			Failed:  []models.BulkFailure{{ID: 1, Text: `segments ["unknown"]: segment not found`, Code: models.CodeSegmentNotFound}},
+		}
+		if err != nil || !reflect.DeepEqual(report, expected) {
+			t.Errorf("got report = %+v, err = %v\nexpected: %+v\n", report, err, expected)
+		}
+
+		segment, _ := model.GetSegment(ctx, "a")
+		if segment.Members != bulkBatchSize+9 {
+			t.Errorf("got %d members, expected %d", segment.Members, bulkBatchSize+9)
+		}
+		relations, _ := model.GetUserRelations(ctx, 2)
+		if !reflect.DeepEqual(relations, []models.Relation{{Slug: "b"}}) {
+			t.Errorf("got relations: %+v", relations)
+		}
+	})
+
+	t.Run("removals after additions", func(t *testing.T) {
+		model, _ := newTestModel(false)
+		mustAddSegment(t, model, "a")
+
+		_, err := model.ModifyUsers(ctx, []models.UserModification{
+			{ID: models.ID{Value: 1}, Remove: []string{"a"}},
+			{ID: models.ID{Value: 1}, Append: []models.SegmentAddition{{Slug: "a"}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if relations, _ := model.GetUserRelations(ctx, 1); len(relations) != 0 {
+			t.Errorf("got relations: %+v", relations)
+		}
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		model, _ := newTestModel(true)
+		mustAddSegment(t, model, "a")
+		model.AddUser(ctx, 1)
+
+		report, err := model.ModifyUsers(ctx, []models.UserModification{
+			{ID: models.ID{Value: 1}, Append: []models.SegmentAddition{{Slug: "a"}}},
+			{ID: models.ID{Value: 2}, Append: []models.SegmentAddition{{Slug: "a"}}},
+		})
+		expected := models.BulkReport{
+			Applied: 1,
+			Failed:  []models.BulkFailure{{ID: 2, Text: "user 2: user not found", Code: models.CodeUserNotFound}},
+		}
+		if err != nil || !reflect.DeepEqual(report, expected) {
+			t.Errorf("got report = %+v, err = %v\nexpected: %+v\n", report, err, expected)
+		}
+	})
+}
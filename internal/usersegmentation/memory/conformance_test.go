@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/storagetest"
+)
+
+func Test_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, strictUsers bool) models.UserSegmentationDbProcessor {
+		return GetModel(strictUsers)
+	})
+}
+
+func Test_APIKeysConformance(t *testing.T) {
+	storagetest.RunAPIKeys(t, func(t *testing.T) models.APIKeyStore {
+		return NewAPIKeyStore()
+	})
+}
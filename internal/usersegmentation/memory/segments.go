@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// GetSegments - получение списка сегментов.
+//
+// Принимает: контекст, префикс названия сегментов, максимальное количество сегментов и смещение.
+//
+// Возвращает: список сегментов, упорядоченный по названию, и ошибку.
+func (model *UserSegmentation) GetSegments(ctx context.Context, prefix string, limit int, offset int) ([]models.Segment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	model.mu.RLock()
+	defer model.mu.RUnlock()
+
+	slugs := make([]string, 0, len(model.segments))
+	for slug, s := range model.segments {
+		if s.deletedAt == nil && strings.HasPrefix(slug, prefix) {
+			slugs = append(slugs, slug)
+		}
+	}
+	sort.Strings(slugs)
+
+	slugs = slugs[min(max(offset, 0), len(slugs)):]
+	slugs = slugs[:min(max(limit, 0), len(slugs))]
+
+	segments := make([]models.Segment, 0, len(slugs))
+	for _, slug := range slugs {
+		segments = append(segments, model.segmentModel(model.segments[slug]))
+	}
+
+	return segments, nil
+}
+
+// GetSegment - получение сегмента.
+//
+// Принимает: контекст, название сегмента.
+//
+// Возвращает: сегмент и ошибку (models.ErrSegmentNotFound, если сегмент не существует).
+func (model *UserSegmentation) GetSegment(ctx context.Context, slug string) (models.Segment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Segment{}, err
+	}
+
+	model.mu.RLock()
+	defer model.mu.RUnlock()
+
+	s, ok := model.active(slug)
+	if !ok {
+		return models.Segment{}, fmt.Errorf("segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+
+	return model.segmentModel(s), nil
+}
+
+// UpdateSegment - изменение метаданных сегмента.
+//
+// Принимает: контекст, название сегмента и изменения.
+//
+// Возвращает: ошибку (models.ErrSegmentNotFound, если сегмент не существует).
+func (model *UserSegmentation) UpdateSegment(ctx context.Context, slug string, update models.SegmentUpdate) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	s, ok := model.active(slug)
+	if !ok {
+		return fmt.Errorf("segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+
+	if update.Description != nil {
+		s.description = *update.Description
+	}
+	if update.OwnerTeam != nil {
+		s.ownerTeam = *update.OwnerTeam
+	}
+
+	return nil
+}
+
+// GetSegmentMembers - получение пользователей, состоящих в сегменте.
+// Пользователи копируются под блокировкой и передаются в fn уже после её снятия,
+// чтобы медленный обработчик не задерживал изменения модели.
+//
+// Принимает: контекст, название сегмента, id пользователя, после которого начинать,
+// максимальное количество пользователей (0 - без ограничения) и функцию-обработчик.
+//
+// Возвращает: ошибку (models.ErrSegmentNotFound, если сегмент не существует).
+func (model *UserSegmentation) GetSegmentMembers(ctx context.Context, slug string, after int, limit int, fn func(models.Member) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	members, err := model.segmentMembers(slug, after, limit)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = fn(member); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// segmentMembers - получение страницы пользователей, состоящих в сегменте.
+//
+// Принимает: название сегмента, курсор и максимальное количество пользователей (0 - без ограничения).
+//
+// Возвращает: пользователей, упорядоченных по id, и ошибку.
+func (model *UserSegmentation) segmentMembers(slug string, after int, limit int) ([]models.Member, error) {
+	model.mu.RLock()
+	defer model.mu.RUnlock()
+
+	s, ok := model.active(slug)
+	if !ok {
+		return nil, fmt.Errorf("segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+
+	now := model.now()
+	members := make([]models.Member, 0)
+	for _, r := range model.sortedMembers(s.id) {
+		if r.userID <= after || expired(r, now) {
+			continue
+		}
+		if limit > 0 && len(members) == limit {
+			break
+		}
+		members = append(members, models.Member{UserID: r.userID, AddedAt: r.createdAt, ExpiresAt: copyTime(r.expiresAt)})
+	}
+
+	return members, nil
+}
+
+// segmentModel - преобразование сегмента в models.Segment.
+// Количество пользователей в сегменте не учитывает истёкшие членства.
+//
+// Принимает: сегмент.
+//
+// Возвращает: сегмент.
+func (model *UserSegmentation) segmentModel(s *segment) models.Segment {
+	now := model.now()
+	members := 0
+	for _, r := range model.members[s.id] {
+		if !expired(r, now) {
+			members++
+		}
+	}
+
+	return models.Segment{
+		ID:          s.id,
+		Slug:        s.slug,
+		CreatedAt:   s.createdAt,
+		Description: s.description,
+		OwnerTeam:   s.ownerTeam,
+		AutoPercent: s.autoPercent,
+		Members:     members,
+	}
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+func Test_GetSegments(t *testing.T) {
+	model, clock := newTestModel(false)
+	for _, slug := range []string{"AVITO_B", "OTHER", "AVITO_A", "AVITO_C"} {
+		mustAddSegment(t, model, slug)
+	}
+	model.DeleteSegment(ctx, "AVITO_C")
+	expiresAt := clock.t.Add(time.Minute)
+	mustModify(t, model, 1, []models.SegmentAddition{{Slug: "AVITO_A"}}, nil)
+	mustModify(t, model, 2, []models.SegmentAddition{{Slug: "AVITO_A", ExpiresAt: &expiresAt}}, nil)
+	clock.t = expiresAt
+
+	cases := []struct {
+		name     string
+		prefix   string
+		limit    int
+		offset   int
+		expected []string
+	}{
+		{name: "all segments", limit: 10, expected: []string{"AVITO_A", "AVITO_B", "OTHER"}},
+		{name: "prefix", prefix: "AVITO_", limit: 10, expected: []string{"AVITO_A", "AVITO_B"}},
+		{name: "limit and offset", limit: 1, offset: 1, expected: []string{"AVITO_B"}},
+		{name: "offset out of range", limit: 10, offset: 10, expected: []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			segments, err := model.GetSegments(ctx, c.prefix, c.limit, c.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(segments))
+			for _, segment := range segments {
+				got = append(got, segment.Slug)
+			}
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("got segments: %v\nexpected: %v\n", got, c.expected)
+			}
+		})
+	}
+
+	t.Run("members count", func(t *testing.T) {
+		segment, err := model.GetSegment(ctx, "AVITO_A")
+		if err != nil || segment.Members != 1 {
+			t.Errorf("got segment = %+v, err = %v, expected 1 member", segment, err)
+		}
+	})
+}
+
+func Test_UpdateSegment(t *testing.T) {
+	model, _ := newTestModel(false)
+	mustAddSegment(t, model, "test")
+	description, ownerTeam := "description", "team"
+
+	if err := model.UpdateSegment(ctx, "test", models.SegmentUpdate{Description: &description}); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.UpdateSegment(ctx, "test", models.SegmentUpdate{OwnerTeam: &ownerTeam}); err != nil {
+		t.Fatal(err)
+	}
+	segment, _ := model.GetSegment(ctx, "test")
+	if segment.Description != description || segment.OwnerTeam != ownerTeam {
+		t.Errorf("got segment: %+v", segment)
+	}
+
+	if err := model.UpdateSegment(ctx, "unknown", models.SegmentUpdate{}); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+}
+
+func Test_GetSegmentMembers(t *testing.T) {
+	model, _ := newTestModel(false)
+	mustAddSegment(t, model, "test")
+	for _, id := range []int{5, 1, 3, 4, 2} {
+		mustModify(t, model, id, []models.SegmentAddition{{Slug: "test"}}, nil)
+	}
+
+	collect := func(after int, limit int) []int {
+		ids := make([]int, 0)
+		err := model.GetSegmentMembers(ctx, "test", after, limit, func(member models.Member) error {
+			ids = append(ids, member.UserID)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	if got := collect(0, 0); !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("got members: %v", got)
+	}
+	if got := collect(2, 2); !reflect.DeepEqual(got, []int{3, 4}) {
+		t.Errorf("got members: %v", got)
+	}
+
+	testErr := errors.New("test error")
+	err := model.GetSegmentMembers(ctx, "test", 0, 0, func(models.Member) error { return testErr })
+	if err != testErr {
+		t.Errorf("got err = %v, expected %v", err, testErr)
+	}
+
+	err = model.GetSegmentMembers(ctx, "unknown", 0, 0, func(models.Member) error {
+		t.Error("handler was called for unknown segment")
+		return nil
+	})
+	if !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+}
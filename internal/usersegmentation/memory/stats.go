@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// GetStats - получение общего количества сегментов, пользователей и членств пользователей в сегментах.
+//
+// Принимает: контекст.
+//
+// Возвращает: статистику и ошибку.
+func (model *UserSegmentation) GetStats(ctx context.Context) (models.Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Stats{}, err
+	}
+
+	model.mu.RLock()
+	defer model.mu.RUnlock()
+
+	stats := models.Stats{Users: len(model.users)}
+	now := model.now()
+	for _, s := range model.segments {
+		if s.deletedAt != nil {
+			stats.DeletedSegments++
+			continue
+		}
+		stats.Segments++
+		for _, r := range model.members[s.id] {
+			if !expired(r, now) {
+				stats.Memberships++
+			}
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+func Test_Stats(t *testing.T) {
+	model, clock := newTestModel(false)
+	expiresAt := clock.t.Add(time.Hour)
+
+	mustAddSegment(t, model, "a")
+	mustAddSegment(t, model, "b")
+	mustAddSegment(t, model, "deleted")
+	mustModify(t, model, 1, []models.SegmentAddition{{Slug: "a"}, {Slug: "b", ExpiresAt: &expiresAt}, {Slug: "deleted"}}, nil)
+	mustModify(t, model, 2, []models.SegmentAddition{{Slug: "a"}}, nil)
+	if err := model.DeleteSegment(ctx, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	clock.t = expiresAt
+
+	stats, err := model.GetStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := models.Stats{Segments: 2, DeletedSegments: 1, Users: 2, Memberships: 2}
+	if stats != expected {
+		t.Errorf("got stats: %+v\nexpected: %+v\n", stats, expected)
+	}
+}
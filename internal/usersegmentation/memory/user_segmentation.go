@@ -0,0 +1,573 @@
+// memory - пакет, реализующий модель сегментирования пользователей, хранящую данные в памяти процесса.
+// Модель повторяет поведение модели postgres и предназначена для запуска сервиса без базы данных (разработка, тестирование).
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// UserSegmentation - модель сегментирования пользователей, хранящая данные в памяти.
+// Все методы безопасны для одновременного вызова из нескольких горутин.
+type UserSegmentation struct {
+	mu          sync.RWMutex           // mu - мьютекс, защищающий данные модели.
+	strictUsers bool                   // strictUsers - флаг строгого режима (если true, то незарегистрированные пользователи не создаются неявно).
+	now         func() time.Time       // now - функция получения текущего времени.
+	nextID      int                    // nextID - id следующего создаваемого сегмента.
+	segments    map[string]*segment    // segments - сегменты (в том числе мягко удалённые) по названию.
+	byID        map[int]*segment       // byID - сегменты (в том числе мягко удалённые) по id.
+	users       map[int]time.Time      // users - время регистрации пользователей по id.
+	members     map[int]relationsSet   // members - членства пользователей по id сегмента и id пользователя.
+	relations   map[int]relationsSet   // relations - членства пользователей по id пользователя и id сегмента.
+	history     []models.HistoryRecord // history - история изменений сегментов пользователей в порядке записи.
+}
+
+// segment - сегмент, хранящийся в памяти.
+type segment struct {
+	id          int        // id - id сегмента.
+	slug        string     // slug - название сегмента.
+	autoPercent int        // autoPercent - процент пользователей, автоматически добавляемых в сегмент.
+	createdAt   time.Time  // createdAt - время создания сегмента.
+	description string     // description - описание сегмента.
+	ownerTeam   string     // ownerTeam - команда, владеющая сегментом.
+	deletedAt   *time.Time // deletedAt - время мягкого удаления сегмента (nil, если сегмент не удалён).
+}
+
+// relation - членство пользователя в сегменте.
+type relation struct {
+	userID    int        // userID - id пользователя.
+	segmentID int        // segmentID - id сегмента.
+	createdAt time.Time  // createdAt - время добавления пользователя в сегмент.
+	expiresAt *time.Time // expiresAt - время истечения членства (nil, если членство бессрочное).
+}
+
+// relationsSet - множество членств по id пользователя или сегмента.
+type relationsSet map[int]*relation
+
+// GetModel - создание модели сегментирования пользователей, хранящей данные в памяти.
+//
+// Принимает флаг строгого режима (если true, то изменение сегментов незарегистрированного пользователя завершается ошибкой models.ErrUserNotFound).
+//
+// Возвращает модель сегментирования пользователей.
+func GetModel(strictUsers bool) models.UserSegmentationDbProcessor {
+	return newModel(strictUsers, time.Now)
+}
+
+// newModel - создание пустой модели.
+//
+// Принимает: флаг строгого режима и функцию получения текущего времени.
+//
+// Возвращает: модель.
+func newModel(strictUsers bool, now func() time.Time) *UserSegmentation {
+	return &UserSegmentation{
+		strictUsers: strictUsers,
+		now:         now,
+		nextID:      1,
+		segments:    make(map[string]*segment),
+		byID:        make(map[int]*segment),
+		users:       make(map[int]time.Time),
+		members:     make(map[int]relationsSet),
+		relations:   make(map[int]relationsSet),
+		history:     make([]models.HistoryRecord, 0),
+	}
+}
+
+// AddSegment - добавление нового сегмента.
+// Если процент автоматического добавления больше 0, то в сегмент добавляются выбранные зарегистрированные пользователи (см. models.InRollout).
+//
+// Принимает: контекст, имя сегмента, процент пользователей, автоматически добавляемых в сегмент.
+//
+// Возвращает: id добавленного сегмента и ошибку (models.ErrInvalidSlug, если название недопустимо, models.ErrSegmentExists, если сегмент уже существует).
+func (model *UserSegmentation) AddSegment(ctx context.Context, slug string, autoPercent int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := models.ValidateSlug(slug); err != nil {
+		return 0, err
+	}
+	if autoPercent < 0 || autoPercent > 100 {
+		return 0, fmt.Errorf("segment %q: auto_percent must be between 0 and 100", slug)
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	if _, ok := model.segments[slug]; ok {
+		return 0, fmt.Errorf("segment %q: %w", slug, models.ErrSegmentExists)
+	}
+
+	s := &segment{id: model.nextID, slug: slug, autoPercent: autoPercent, createdAt: model.now()}
+	model.nextID++
+	model.segments[slug] = s
+	model.byID[s.id] = s
+	model.members[s.id] = make(relationsSet)
+
+	model.rollout(s)
+
+	return s.id, nil
+}
+
+// DeleteSegment - мягкое удаление сегмента.
+// Членства пользователей в сегменте сохраняются, а их удаление записывается в историю.
+//
+// Принимает: контекст, имя сегмента.
+//
+// Возвращает: ошибку (models.ErrSegmentNotFound, если активного сегмента с таким названием нет).
+func (model *UserSegmentation) DeleteSegment(ctx context.Context, slug string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	s, ok := model.active(slug)
+	if !ok {
+		return fmt.Errorf("segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+
+	now := model.now()
+	s.deletedAt = &now
+	for _, r := range model.sortedMembers(s.id) {
+		model.record(r.userID, s.slug, models.OperationRemove, removalTime(r, now))
+	}
+
+	return nil
+}
+
+// RestoreSegment - восстановление мягко удалённого сегмента.
+// Истёкшие за время удаления членства удаляются, восстановление остальных записывается в историю,
+// а пользователи, зарегистрированные за время удаления, добавляются в сегмент, если попадают в процент автоматического добавления.
+//
+// Принимает: контекст, имя сегмента.
+//
+// Возвращает: ошибку (models.ErrSegmentNotFound, если удалённого сегмента с таким названием нет).
+func (model *UserSegmentation) RestoreSegment(ctx context.Context, slug string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	s, ok := model.segments[slug]
+	if !ok || s.deletedAt == nil {
+		return fmt.Errorf("deleted segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+
+	now := model.now()
+	s.deletedAt = nil
+	for _, r := range model.sortedMembers(s.id) {
+		if expired(r, now) {
+			model.unlink(r)
+			continue
+		}
+		model.record(r.userID, s.slug, models.OperationAdd, now)
+	}
+	model.rollout(s)
+
+	return nil
+}
+
+// PurgeDeleted - окончательное удаление сегментов, удалённых до указанного времени, и членств пользователей в них.
+// Удаление членств не записывается в историю, так как оно было записано при мягком удалении.
+//
+// Принимает: контекст, время, до которого сегмент должен быть удалён.
+//
+// Возвращает: количество окончательно удалённых сегментов и ошибку.
+func (model *UserSegmentation) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	n := 0
+	for slug, s := range model.segments {
+		if s.deletedAt == nil || s.deletedAt.After(before) {
+			continue
+		}
+		for _, r := range model.members[s.id] {
+			model.unlink(r)
+		}
+		delete(model.members, s.id)
+		delete(model.byID, s.id)
+		delete(model.segments, slug)
+		n++
+	}
+
+	return n, nil
+}
+
+// ModifyUser - изменение сегментов пользователя по id.
+//
+// Все изменения применяются атомарно: при любой ошибке ни одно из них не применяется.
+// Перед изменением истёкшие членства пользователя удаляются, чтобы повторное добавление в сегмент было записано в историю.
+//
+// Принимает: контекст, id пользователя, сегменты, в которые необходимо добавить пользователя, имена сегментов, из которых необходимо убрать пользователя,
+// и флаг частичного применения (если false, то при несуществующих сегментах возвращается models.ErrSegmentNotFound).
+//
+// Возвращает: отчёт о результатах изменения и ошибку.
+func (model *UserSegmentation) ModifyUser(ctx context.Context, id int, append []models.SegmentAddition, remove []string, partial bool) (models.ModificationReport, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ModificationReport{}, err
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	report := models.ModificationReport{
+		Append: make([]models.SlugStatus, 0, len(append)),
+		Remove: make([]models.SlugStatus, 0, len(remove)),
+	}
+
+	if unknown := model.unknownSlugs(append, remove); len(unknown) > 0 && !partial {
+		return models.ModificationReport{}, fmt.Errorf("segments %q: %w", unknown, models.ErrSegmentNotFound)
+	}
+
+	if _, ok := model.users[id]; !ok {
+		if model.strictUsers {
+			return models.ModificationReport{}, fmt.Errorf("user %d: %w", id, models.ErrUserNotFound)
+		}
+		model.register(id)
+	}
+
+	now := model.now()
+	model.deleteExpired(model.sortedRelations(id), now)
+
+	for _, addition := range append {
+		s, ok := model.active(addition.Slug)
+		if !ok {
+			report.Append = appendStatus(report.Append, addition.Slug, models.StatusUnknown)
+			continue
+		}
+		if model.link(id, s, addition.ExpiresAt, now) {
+			report.Append = appendStatus(report.Append, addition.Slug, models.StatusAdded)
+		} else {
+			report.Append = appendStatus(report.Append, addition.Slug, models.StatusAlreadyPresent)
+		}
+	}
+
+	for _, slug := range remove {
+		s, ok := model.active(slug)
+		if !ok {
+			report.Remove = appendStatus(report.Remove, slug, models.StatusUnknown)
+			continue
+		}
+		if model.unlinkUser(id, s, now) {
+			report.Remove = appendStatus(report.Remove, slug, models.StatusRemoved)
+		} else {
+			report.Remove = appendStatus(report.Remove, slug, models.StatusNotMember)
+		}
+	}
+
+	return report, nil
+}
+
+// GetUserRelations - получение сегментов, в которых состоит пользователь, упорядоченных по названию.
+// Истёкшие членства не возвращаются, даже если они ещё не были удалены.
+//
+// Принимает: контекст, id пользователя.
+//
+// Возвращает: список отношений пользователя с сегментами, в которых он состоит, и ошибку.
+func (model *UserSegmentation) GetUserRelations(ctx context.Context, id int) ([]models.Relation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	model.mu.RLock()
+	defer model.mu.RUnlock()
+
+	now := model.now()
+	relations := make([]models.Relation, 0)
+	for _, r := range model.relations[id] {
+		s := model.byID[r.segmentID]
+		if s.deletedAt != nil || expired(r, now) {
+			continue
+		}
+		relations = append(relations, models.Relation{Slug: s.slug, ExpiresAt: copyTime(r.expiresAt)})
+	}
+	sort.Slice(relations, func(i, j int) bool { return relations[i].Slug < relations[j].Slug })
+
+	return relations, nil
+}
+
+// DeleteExpired - удаление истёкших членств пользователей в сегментах.
+// Удаления записываются в историю со временем истечения членства.
+//
+// Принимает: контекст.
+//
+// Возвращает: количество удалённых отношений и ошибку.
+func (model *UserSegmentation) DeleteExpired(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	ids := make([]int, 0, len(model.relations))
+	for id := range model.relations {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	now := model.now()
+	n := 0
+	for _, id := range ids {
+		n += model.deleteExpired(model.sortedRelations(id), now)
+	}
+
+	return n, nil
+}
+
+// GetHistory - получение истории изменений сегментов пользователей за период.
+//
+// Принимает: контекст, начало периода (включительно) и конец периода (не включительно).
+//
+// Возвращает: список записей истории, упорядоченный по времени и id пользователя, и ошибку.
+func (model *UserSegmentation) GetHistory(ctx context.Context, from time.Time, to time.Time) ([]models.HistoryRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	model.mu.RLock()
+	defer model.mu.RUnlock()
+
+	records := make([]models.HistoryRecord, 0)
+	for _, record := range model.history {
+		if !record.Time.Before(from) && record.Time.Before(to) {
+			records = append(records, record)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if !records[i].Time.Equal(records[j].Time) {
+			return records[i].Time.Before(records[j].Time)
+		}
+		return records[i].UserID < records[j].UserID
+	})
+
+	return records, nil
+}
+
+// active - получение не удалённого сегмента по названию.
+//
+// Принимает: название сегмента.
+//
+// Возвращает: сегмент и флаг его наличия.
+func (model *UserSegmentation) active(slug string) (*segment, bool) {
+	s, ok := model.segments[slug]
+	if !ok || s.deletedAt != nil {
+		return nil, false
+	}
+	return s, true
+}
+
+// unknownSlugs - получение названий несуществующих (или удалённых) сегментов.
+//
+// Принимает: добавления пользователя в сегменты и названия сегментов, из которых необходимо убрать пользователя.
+//
+// Возвращает: названия несуществующих сегментов без повторов, в порядке запроса.
+func (model *UserSegmentation) unknownSlugs(append []models.SegmentAddition, remove []string) []string {
+	unknown := make([]string, 0)
+	for _, addition := range append {
+		if _, ok := model.active(addition.Slug); !ok {
+			unknown = appendSlug(unknown, addition.Slug)
+		}
+	}
+	for _, slug := range remove {
+		if _, ok := model.active(slug); !ok {
+			unknown = appendSlug(unknown, slug)
+		}
+	}
+	return unknown
+}
+
+// rollout - добавление в сегмент выбранных зарегистрированных пользователей (см. models.InRollout).
+// Пользователи, уже состоящие в сегменте, не изменяются.
+//
+// Принимает: сегмент.
+func (model *UserSegmentation) rollout(s *segment) {
+	if s.autoPercent <= 0 {
+		return
+	}
+
+	now := model.now()
+	for _, id := range model.sortedUsers() {
+		if models.InRollout(id, s.slug, s.autoPercent) {
+			model.link(id, s, nil, now)
+		}
+	}
+}
+
+// link - добавление пользователя в сегмент или замена времени истечения его членства, если он уже состоит в сегменте.
+// Добавление записывается в историю.
+//
+// Принимает: id пользователя, сегмент, время истечения членства и текущее время.
+//
+// Возвращает: true, если пользователь был добавлен в сегмент.
+func (model *UserSegmentation) link(userID int, s *segment, expiresAt *time.Time, now time.Time) bool {
+	if r, ok := model.members[s.id][userID]; ok {
+		r.expiresAt = copyTime(expiresAt)
+		return false
+	}
+
+	r := &relation{userID: userID, segmentID: s.id, createdAt: now, expiresAt: copyTime(expiresAt)}
+	model.members[s.id][userID] = r
+	if model.relations[userID] == nil {
+		model.relations[userID] = make(relationsSet)
+	}
+	model.relations[userID][s.id] = r
+	model.record(userID, s.slug, models.OperationAdd, now)
+
+	return true
+}
+
+// unlinkUser - удаление пользователя из сегмента с записью в историю.
+//
+// Принимает: id пользователя, сегмент и текущее время.
+//
+// Возвращает: true, если пользователь состоял в сегменте.
+func (model *UserSegmentation) unlinkUser(userID int, s *segment, now time.Time) bool {
+	r, ok := model.members[s.id][userID]
+	if !ok {
+		return false
+	}
+
+	model.unlink(r)
+	model.record(userID, s.slug, models.OperationRemove, now)
+
+	return true
+}
+
+// unlink - удаление членства без записи в историю.
+//
+// Принимает: членство.
+func (model *UserSegmentation) unlink(r *relation) {
+	delete(model.members[r.segmentID], r.userID)
+	delete(model.relations[r.userID], r.segmentID)
+	if len(model.relations[r.userID]) == 0 {
+		delete(model.relations, r.userID)
+	}
+}
+
+// deleteExpired - удаление истёкших членств из списка.
+// Удаления из не удалённых сегментов записываются в историю со временем истечения членства.
+//
+// Принимает: список членств и текущее время.
+//
+// Возвращает: количество удалённых членств.
+func (model *UserSegmentation) deleteExpired(relations []*relation, now time.Time) int {
+	n := 0
+	for _, r := range relations {
+		if !expired(r, now) {
+			continue
+		}
+		model.unlink(r)
+		if s := model.byID[r.segmentID]; s.deletedAt == nil {
+			model.record(r.userID, s.slug, models.OperationRemove, *r.expiresAt)
+		}
+		n++
+	}
+	return n
+}
+
+// record - запись операции в историю.
+//
+// Принимает: id пользователя, название сегмента, операцию и время операции.
+func (model *UserSegmentation) record(userID int, slug string, operation string, at time.Time) {
+	model.history = append(model.history, models.HistoryRecord{UserID: userID, Slug: slug, Operation: operation, Time: at})
+}
+
+// sortedMembers - получение членств пользователей в сегменте, упорядоченных по id пользователя.
+//
+// Принимает: id сегмента.
+//
+// Возвращает: список членств.
+func (model *UserSegmentation) sortedMembers(segmentID int) []*relation {
+	members := make([]*relation, 0, len(model.members[segmentID]))
+	for _, r := range model.members[segmentID] {
+		members = append(members, r)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].userID < members[j].userID })
+	return members
+}
+
+// sortedRelations - получение членств пользователя в сегментах, упорядоченных по id сегмента.
+//
+// Принимает: id пользователя.
+//
+// Возвращает: список членств.
+func (model *UserSegmentation) sortedRelations(userID int) []*relation {
+	relations := make([]*relation, 0, len(model.relations[userID]))
+	for _, r := range model.relations[userID] {
+		relations = append(relations, r)
+	}
+	sort.Slice(relations, func(i, j int) bool { return relations[i].segmentID < relations[j].segmentID })
+	return relations
+}
+
+// expired - проверка истечения членства.
+//
+// Принимает: членство и текущее время.
+//
+// Возвращает: true, если членство истекло.
+func expired(r *relation, now time.Time) bool {
+	return r.expiresAt != nil && !r.expiresAt.After(now)
+}
+
+// removalTime - получение времени удаления пользователя из сегмента для записи в историю:
+// время истечения членства, если оно уже истекло, иначе текущее время.
+//
+// Принимает: членство и текущее время.
+//
+// Возвращает: время удаления.
+func removalTime(r *relation, now time.Time) time.Time {
+	if expired(r, now) {
+		return *r.expiresAt
+	}
+	return now
+}
+
+// copyTime - копирование указателя на время, чтобы данные модели не изменялись извне.
+//
+// Принимает: указатель на время.
+//
+// Возвращает: указатель на копию.
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// appendSlug - добавление названия сегмента в список, если его там ещё нет.
+//
+// Принимает: список названий и название.
+//
+// Возвращает: список названий.
+func appendSlug(slugs []string, slug string) []string {
+	for _, s := range slugs {
+		if s == slug {
+			return slugs
+		}
+	}
+	return append(slugs, slug)
+}
+
+// appendStatus - добавление результата изменения для сегмента в отчёт.
+//
+// Принимает: список результатов, название сегмента и статус.
+//
+// Возвращает: список результатов.
+func appendStatus(statuses []models.SlugStatus, slug string, status string) []models.SlugStatus {
+	return append(statuses, models.SlugStatus{Slug: slug, Status: status})
+}
@@ -0,0 +1,288 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+var ctx = context.Background()
+
+// clock - управляемые часы модели.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+// newTestModel - создание модели с управляемыми часами.
+func newTestModel(strict bool) (*UserSegmentation, *clock) {
+	c := &clock{t: time.Unix(1<<30+rand.Int63n(1<<30), 0).UTC()}
+	return newModel(strict, c.now), c
+}
+
+func Test_AddSegment(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		model, _ := newTestModel(false)
+		slug := fmt.Sprintf("TEST %d", rand.Int())
+
+		t.Run("normal case", func(t *testing.T) {
+			id, err := model.AddSegment(ctx, slug, 0)
+			if err != nil || id != 1 {
+				t.Errorf("got id = %d, err = %v, expected id = 1", id, err)
+			}
+		})
+
+		t.Run("segment already exists", func(t *testing.T) {
+			_, err := model.AddSegment(ctx, slug, 0)
+			if !errors.Is(err, models.ErrSegmentExists) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrSegmentExists)
+			}
+		})
+
+		t.Run("deleted segment still exists", func(t *testing.T) {
+			if err := model.DeleteSegment(ctx, slug); err != nil {
+				t.Fatal(err)
+			}
+			_, err := model.AddSegment(ctx, slug, 0)
+			if !errors.Is(err, models.ErrSegmentExists) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrSegmentExists)
+			}
+		})
+
+		t.Run("invalid slug", func(t *testing.T) {
+			_, err := model.AddSegment(ctx, "", 0)
+			if !errors.Is(err, models.ErrInvalidSlug) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrInvalidSlug)
+			}
+		})
+	}
+
+	t.Run("rollout", func(t *testing.T) {
+		model, _ := newTestModel(false)
+		percent := 1 + rand.Intn(99)
+		for id := 0; id < 100; id++ {
+			if err := model.AddUser(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := model.AddSegment(ctx, "auto", percent); err != nil {
+			t.Fatal(err)
+		}
+
+		for id := 0; id < 100; id++ {
+			relations, _ := model.GetUserRelations(ctx, id)
+			if got := len(relations) == 1; got != models.InRollout(id, "auto", percent) {
+				t.Errorf("user %d: got in segment = %v, expected %v", id, got, !got)
+			}
+		}
+	})
+}
+
+func Test_DeleteAndRestoreSegment(t *testing.T) {
+	model, clock := newTestModel(false)
+	start := clock.t
+	expiresAt := start.Add(time.Hour)
+	mustAddSegment(t, model, "test")
+	mustModify(t, model, 1, []models.SegmentAddition{{Slug: "test"}}, nil)
+	mustModify(t, model, 2, []models.SegmentAddition{{Slug: "test", ExpiresAt: &expiresAt}}, nil)
+
+	clock.t = start.Add(time.Minute)
+	if err := model.DeleteSegment(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := model.GetSegment(ctx, "test"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	if relations, _ := model.GetUserRelations(ctx, 1); len(relations) != 0 {
+		t.Errorf("got relations of deleted segment: %v", relations)
+	}
+	if err := model.DeleteSegment(ctx, "test"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("repeated deletion: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+
+	clock.t = start.Add(2 * time.Hour)
+	if err := model.RestoreSegment(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.RestoreSegment(ctx, "test"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+
+	segment, err := model.GetSegment(ctx, "test")
+	if err != nil || segment.Members != 1 {
+		t.Errorf("got segment = %+v, err = %v, expected 1 member", segment, err)
+	}
+
+	history, _ := model.GetHistory(ctx, start, clock.t.Add(time.Second))
+	expected := []models.HistoryRecord{
+		{UserID: 1, Slug: "test", Operation: models.OperationAdd, Time: start},
+		{UserID: 2, Slug: "test", Operation: models.OperationAdd, Time: start},
+		{UserID: 1, Slug: "test", Operation: models.OperationRemove, Time: start.Add(time.Minute)},
+		{UserID: 2, Slug: "test", Operation: models.OperationRemove, Time: start.Add(time.Minute)},
+		{UserID: 1, Slug: "test", Operation: models.OperationAdd, Time: clock.t},
+	}
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("got history: %+v\nexpected: %+v\n", history, expected)
+	}
+}
+
+func Test_PurgeDeleted(t *testing.T) {
+	model, clock := newTestModel(false)
+	start := clock.t
+	mustAddSegment(t, model, "old")
+	mustAddSegment(t, model, "new")
+	mustAddSegment(t, model, "alive")
+	mustModify(t, model, 1, []models.SegmentAddition{{Slug: "old"}, {Slug: "new"}, {Slug: "alive"}}, nil)
+
+	model.DeleteSegment(ctx, "old")
+	clock.t = start.Add(time.Hour)
+	model.DeleteSegment(ctx, "new")
+
+	n, err := model.PurgeDeleted(ctx, start.Add(time.Minute))
+	if err != nil || n != 1 {
+		t.Errorf("got n = %d, err = %v, expected 1 purged segment", n, err)
+	}
+	if err := model.RestoreSegment(ctx, "old"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("purged segment was restored: %v", err)
+	}
+	if _, err := model.AddSegment(ctx, "old", 0); err != nil {
+		t.Errorf("unexpected error on adding purged segment again: %v", err)
+	}
+	if err := model.RestoreSegment(ctx, "new"); err != nil {
+		t.Errorf("unexpected error on restoring not purged segment: %v", err)
+	}
+
+	relations, _ := model.GetUserRelations(ctx, 1)
+	expected := []models.Relation{{Slug: "alive"}, {Slug: "new"}}
+	if !reflect.DeepEqual(relations, expected) {
+		t.Errorf("got relations: %+v\nexpected: %+v\n", relations, expected)
+	}
+}
+
+func Test_ModifyUser(t *testing.T) {
+	model, clock := newTestModel(false)
+	mustAddSegment(t, model, "a")
+	mustAddSegment(t, model, "b")
+	expiresAt := clock.t.Add(time.Hour)
+
+	t.Run("unknown segments", func(t *testing.T) {
+		_, err := model.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: "a"}, {Slug: "x"}}, []string{"y", "x"}, false)
+		if err == nil || err.Error() != `segments ["x" "y"]: segment not found` {
+			t.Errorf("got err = %v", err)
+		}
+		if users, _ := model.GetUsers(ctx, 10, 0); len(users) != 0 {
+			t.Errorf("user was registered by failed modification: %v", users)
+		}
+	})
+
+	t.Run("partial modification", func(t *testing.T) {
+		report, err := model.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: "a"}, {Slug: "x"}, {Slug: "a", ExpiresAt: &expiresAt}}, []string{"b", "x"}, true)
+		expected := models.ModificationReport{
+			Append: []models.SlugStatus{{Slug: "a", Status: models.StatusAdded}, {Slug: "x", Status: models.StatusUnknown}, {Slug: "a", Status: models.StatusAlreadyPresent}},
+			Remove: []models.SlugStatus{{Slug: "b", Status: models.StatusNotMember}, {Slug: "x", Status: models.StatusUnknown}},
+		}
+		if err != nil || !reflect.DeepEqual(report, expected) {
+			t.Errorf("got report = %+v, err = %v\nexpected: %+v\n", report, err, expected)
+		}
+		relations, _ := model.GetUserRelations(ctx, 1)
+		if len(relations) != 1 || relations[0].ExpiresAt == nil || !relations[0].ExpiresAt.Equal(expiresAt) {
+			t.Errorf("got relations: %+v", relations)
+		}
+	})
+
+	t.Run("re-adding after expiry", func(t *testing.T) {
+		clock.t = expiresAt
+		report, err := model.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: "a"}}, []string{"a"}, false)
+		expected := models.ModificationReport{
+			Append: []models.SlugStatus{{Slug: "a", Status: models.StatusAdded}},
+			Remove: []models.SlugStatus{{Slug: "a", Status: models.StatusRemoved}},
+		}
+		if err != nil || !reflect.DeepEqual(report, expected) {
+			t.Errorf("got report = %+v, err = %v\nexpected: %+v\n", report, err, expected)
+		}
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		strict, _ := newTestModel(true)
+		mustAddSegment(t, strict, "a")
+		if _, err := strict.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: "a"}}, nil, false); !errors.Is(err, models.ErrUserNotFound) {
+			t.Errorf("got err = %v, expected %v", err, models.ErrUserNotFound)
+		}
+	})
+}
+
+func Test_DeleteExpired(t *testing.T) {
+	model, clock := newTestModel(false)
+	start := clock.t
+	mustAddSegment(t, model, "a")
+	mustAddSegment(t, model, "b")
+	for id := 1; id <= 10; id++ {
+		expiresAt := start.Add(time.Duration(id) * time.Minute)
+		mustModify(t, model, id, []models.SegmentAddition{{Slug: "a", ExpiresAt: &expiresAt}, {Slug: "b"}}, nil)
+	}
+
+	clock.t = start.Add(5 * time.Minute)
+	n, err := model.DeleteExpired(ctx)
+	if err != nil || n != 5 {
+		t.Errorf("got n = %d, err = %v, expected 5", n, err)
+	}
+
+	history, _ := model.GetHistory(ctx, start.Add(time.Second), clock.t.Add(time.Second))
+	if len(history) != 5 {
+		t.Fatalf("got history: %+v", history)
+	}
+	for i, record := range history {
+		if record.UserID != i+1 || record.Operation != models.OperationRemove || !record.Time.Equal(start.Add(time.Duration(i+1)*time.Minute)) {
+			t.Errorf("got record: %+v", record)
+		}
+	}
+}
+
+func Test_Concurrency(t *testing.T) {
+	model, _ := newTestModel(false)
+	mustAddSegment(t, model, "a")
+
+	var wg sync.WaitGroup
+	for id := 0; id < 100; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			model.ModifyUser(ctx, id, []models.SegmentAddition{{Slug: "a"}}, nil, false)
+			model.GetUserRelations(ctx, id)
+			model.GetSegment(ctx, "a")
+		}(id)
+	}
+	wg.Wait()
+
+	segment, err := model.GetSegment(ctx, "a")
+	if err != nil || segment.Members != 100 {
+		t.Errorf("got segment = %+v, err = %v, expected 100 members", segment, err)
+	}
+}
+
+// mustAddSegment - добавление сегмента с проверкой ошибки.
+func mustAddSegment(t *testing.T, model *UserSegmentation, slug string) {
+	t.Helper()
+	if _, err := model.AddSegment(ctx, slug, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustModify - изменение сегментов пользователя с проверкой ошибки.
+func mustModify(t *testing.T, model *UserSegmentation, id int, append []models.SegmentAddition, remove []string) {
+	t.Helper()
+	if _, err := model.ModifyUser(ctx, id, append, remove, false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// AddUser - регистрация пользователя.
+//
+// Принимает: контекст, id пользователя.
+//
+// Возвращает: ошибку (models.ErrUserExists, если пользователь уже зарегистрирован).
+func (model *UserSegmentation) AddUser(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	if _, ok := model.users[id]; ok {
+		return fmt.Errorf("user %d: %w", id, models.ErrUserExists)
+	}
+	model.register(id)
+
+	return nil
+}
+
+// GetUsers - получение списка зарегистрированных пользователей.
+//
+// Принимает: контекст, максимальное количество пользователей и смещение.
+//
+// Возвращает: список пользователей, упорядоченный по id, и ошибку.
+func (model *UserSegmentation) GetUsers(ctx context.Context, limit int, offset int) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	model.mu.RLock()
+	defer model.mu.RUnlock()
+
+	ids := model.sortedUsers()
+	ids = ids[min(max(offset, 0), len(ids)):]
+	ids = ids[:min(max(limit, 0), len(ids))]
+
+	users := make([]models.User, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, models.User{ID: id, CreatedAt: model.users[id]})
+	}
+
+	return users, nil
+}
+
+// DeleteUser - удаление пользователя и всех его отношений с сегментами.
+// Удаление пользователя из не удалённых сегментов записывается в историю.
+//
+// Принимает: контекст, id пользователя.
+//
+// Возвращает: ошибку (models.ErrUserNotFound, если пользователь не зарегистрирован).
+func (model *UserSegmentation) DeleteUser(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+
+	if _, ok := model.users[id]; !ok {
+		return fmt.Errorf("user %d: %w", id, models.ErrUserNotFound)
+	}
+	delete(model.users, id)
+
+	now := model.now()
+	for _, r := range model.sortedRelations(id) {
+		model.unlink(r)
+		if s := model.byID[r.segmentID]; s.deletedAt == nil {
+			model.record(id, s.slug, models.OperationRemove, removalTime(r, now))
+		}
+	}
+
+	return nil
+}
+
+// register - регистрация нового пользователя.
+// Пользователь добавляется в сегменты с автоматическим добавлением, в процент которых он попадает (см. models.InRollout).
+//
+// Принимает: id пользователя.
+func (model *UserSegmentation) register(id int) {
+	now := model.now()
+	model.users[id] = now
+
+	segmentIDs := make([]int, 0, len(model.byID))
+	for segmentID := range model.byID {
+		segmentIDs = append(segmentIDs, segmentID)
+	}
+	sort.Ints(segmentIDs)
+
+	for _, segmentID := range segmentIDs {
+		s := model.byID[segmentID]
+		if s.deletedAt == nil && models.InRollout(id, s.slug, s.autoPercent) {
+			model.link(id, s, nil, now)
+		}
+	}
+}
+
+// sortedUsers - получение id зарегистрированных пользователей по возрастанию.
+//
+// Возвращает: список id.
+func (model *UserSegmentation) sortedUsers() []int {
+	ids := make([]int, 0, len(model.users))
+	for id := range model.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
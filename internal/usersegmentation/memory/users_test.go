@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+func Test_Users(t *testing.T) {
+	model, clock := newTestModel(false)
+	start := clock.t
+
+	for _, id := range []int{3, 1, 2} {
+		if err := model.AddUser(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := model.AddUser(ctx, 1); !errors.Is(err, models.ErrUserExists) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrUserExists)
+	}
+
+	users, _ := model.GetUsers(ctx, 2, 1)
+	expected := []models.User{{ID: 2, CreatedAt: start}, {ID: 3, CreatedAt: start}}
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("got users: %+v\nexpected: %+v\n", users, expected)
+	}
+
+	mustAddSegment(t, model, "test")
+	mustModify(t, model, 1, []models.SegmentAddition{{Slug: "test"}}, nil)
+	clock.t = start.Add(time.Minute)
+
+	if err := model.DeleteUser(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DeleteUser(ctx, 1); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrUserNotFound)
+	}
+	if segment, _ := model.GetSegment(ctx, "test"); segment.Members != 0 {
+		t.Errorf("deleted user is still a member: %+v", segment)
+	}
+
+	history, _ := model.GetHistory(ctx, clock.t, clock.t.Add(time.Second))
+	expectedHistory := []models.HistoryRecord{{UserID: 1, Slug: "test", Operation: models.OperationRemove, Time: clock.t}}
+	if !reflect.DeepEqual(history, expectedHistory) {
+		t.Errorf("got history: %+v\nexpected: %+v\n", history, expectedHistory)
+	}
+}
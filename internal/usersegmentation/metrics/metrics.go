@@ -0,0 +1,174 @@
+// metrics - пакет, реализующий метрики сервиса сегментации пользователей в формате Prometheus.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/cache"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace - префикс названий метрик сервиса.
+const namespace = "usersegmentation"
+
+// Metrics - структура, описывающая метрики сервиса.
+type Metrics struct {
+	registry        *prometheus.Registry     // registry - реестр метрик.
+	requests        *prometheus.CounterVec   // requests - количество обработанных запросов по методу, маршруту и коду ответа.
+	requestDuration *prometheus.HistogramVec // requestDuration - время обработки запросов по методу, маршруту и коду ответа.
+	storageDuration *prometheus.HistogramVec // storageDuration - время выполнения методов хранилища.
+	storageErrors   *prometheus.CounterVec   // storageErrors - количество ошибок методов хранилища по коду ошибки.
+	segments        prometheus.Gauge         // segments - количество сегментов, кроме удалённых.
+	deletedSegments prometheus.Gauge         // deletedSegments - количество удалённых, но ещё не удалённых окончательно сегментов.
+	users           prometheus.Gauge         // users - количество зарегистрированных пользователей.
+	memberships     prometheus.Gauge         // memberships - количество неистёкших членств пользователей в сегментах.
+}
+
+// New - создание метрик сервиса.
+// Кроме метрик сервиса, в реестр добавляются метрики среды выполнения Go и процесса.
+//
+// Возвращает: метрики.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of handled HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests handling by method, route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_call_duration_seconds",
+			Help:      "Duration of storage calls by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Number of storage calls that returned an error, by method and error code.",
+		}, []string{"method", "code"}),
+		segments: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "segments",
+			Help:      "Number of segments, except the deleted ones.",
+		}),
+		deletedSegments: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "deleted_segments",
+			Help:      "Number of deleted segments that are not purged yet.",
+		}),
+		users: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "users",
+			Help:      "Number of registered users.",
+		}),
+		memberships: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "memberships",
+			Help:      "Number of unexpired users' memberships in segments, except the deleted ones.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration,
+		m.storageDuration, m.storageErrors,
+		m.segments, m.deletedSegments, m.users, m.memberships,
+	)
+
+	return m
+}
+
+// Handler - получение обработчика HTTP запросов, возвращающего метрики в текстовом формате Prometheus.
+//
+// Возвращает: обработчик.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB - добавление статистики пула соединений с базой данных в метрики.
+//
+// Принимает: указатель на базу данных и её название (значение метки db_name).
+//
+// Возвращает: ошибку.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterCache - добавление статистики кеша сегментов пользователей в метрики.
+//
+// Принимает: кеш.
+//
+// Возвращает: ошибку.
+func (m *Metrics) RegisterCache(c *cache.Processor) error {
+	counters := []struct {
+		name  string
+		help  string
+		value func(stats cache.Stats) uint64
+	}{
+		{"cache_hits_total", "Number of users' segments requests served from the cache.", func(stats cache.Stats) uint64 { return stats.Hits }},
+		{"cache_misses_total", "Number of users' segments requests served from the storage.", func(stats cache.Stats) uint64 { return stats.Misses }},
+		{"cache_evictions_total", "Number of users evicted from the cache because of its size limit.", func(stats cache.Stats) uint64 { return stats.Evictions }},
+		{"cache_invalidations_total", "Number of users removed from the cache because of modifications.", func(stats cache.Stats) uint64 { return stats.Invalidations }},
+	}
+	for _, counter := range counters {
+		value := counter.value
+		collector := prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      counter.name,
+			Help:      counter.help,
+		}, func() float64 { return float64(value(c.Stats())) })
+		if err := m.registry.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	return m.registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_users",
+		Help:      "Number of users in the cache.",
+	}, func() float64 { return float64(c.Stats().Size) }))
+}
+
+// ObserveRequest - учёт обработанного HTTP запроса.
+//
+// Принимает: метод, маршрут, код ответа и время обработки запроса.
+func (m *Metrics) ObserveRequest(method string, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(method, route, code).Inc()
+	m.requestDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// SetStats - обновление метрик общего количества данных в хранилище.
+//
+// Принимает: статистику хранилища.
+func (m *Metrics) SetStats(stats models.Stats) {
+	m.segments.Set(float64(stats.Segments))
+	m.deletedSegments.Set(float64(stats.DeletedSegments))
+	m.users.Set(float64(stats.Users))
+	m.memberships.Set(float64(stats.Memberships))
+}
+
+// observeStorage - учёт вызова метода хранилища.
+//
+// Принимает: название метода, время начала вызова и ошибку, возвращённую методом.
+func (m *Metrics) observeStorage(method string, start time.Time, err error) {
+	m.storageDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.storageErrors.WithLabelValues(method, models.ErrorCode(err)).Inc()
+	}
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/cache"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/memory"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Test_Instrument - тестирование учёта вызовов обработчика БД.
+func Test_Instrument(t *testing.T) {
+	m := New()
+	p := m.Instrument(memory.GetModel(false))
+	ctx := context.Background()
+
+	if _, err := p.AddSegment(ctx, "test", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddSegment(ctx, "test", 0); !errors.Is(err, models.ErrSegmentExists) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentExists)
+	}
+	if _, err := p.GetSegment(ctx, "unknown"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	report, err := p.ModifyUser(ctx, 1, []models.SegmentAddition{{Slug: "test"}}, nil, false)
+	if err != nil || len(report.Append) != 1 || report.Append[0].Status != models.StatusAdded {
+		t.Errorf("got report %+v and err = %v", report, err)
+	}
+
+	if got := testutil.CollectAndCount(m.storageDuration); got != 3 {
+		t.Errorf("got %d observed methods, expected 3", got)
+	}
+	if got := testutil.ToFloat64(m.storageErrors.WithLabelValues("AddSegment", models.CodeSegmentExists)); got != 1 {
+		t.Errorf("got %v AddSegment errors, expected 1", got)
+	}
+	if got := testutil.ToFloat64(m.storageErrors.WithLabelValues("GetSegment", models.CodeSegmentNotFound)); got != 1 {
+		t.Errorf("got %v GetSegment errors, expected 1", got)
+	}
+	if got := testutil.CollectAndCount(m.storageErrors); got != 2 {
+		t.Errorf("got %d error series, expected 2", got)
+	}
+}
+
+// Test_Handler - тестирование получения метрик в текстовом формате Prometheus.
+func Test_Handler(t *testing.T) {
+	m := New()
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := m.RegisterDB(db, "postgres"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := cache.New(memory.GetModel(false), cache.Options{Size: 10, TTL: time.Minute})
+	if err := m.RegisterCache(c); err != nil {
+		t.Fatal(err)
+	}
+	c.GetUserRelations(context.Background(), 1)
+	c.GetUserRelations(context.Background(), 1)
+	c.GetUserRelations(context.Background(), 2)
+
+	m.ObserveRequest(http.MethodGet, "/users/:id", http.StatusOK, 15*time.Millisecond)
+	m.SetStats(models.Stats{Segments: 3, DeletedSegments: 1, Users: 10, Memberships: 7})
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	for _, expected := range []string{
+		`usersegmentation_http_requests_total{method="GET",route="/users/:id",status="200"} 1`,
+		`usersegmentation_http_request_duration_seconds_count{method="GET",route="/users/:id",status="200"} 1`,
+		`usersegmentation_segments 3`,
+		`usersegmentation_deleted_segments 1`,
+		`usersegmentation_users 10`,
+		`usersegmentation_memberships 7`,
+		`usersegmentation_cache_hits_total 1`,
+		`usersegmentation_cache_misses_total 2`,
+		`usersegmentation_cache_users 2`,
+		`go_sql_open_connections{db_name="postgres"}`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("metrics do not contain %q", expected)
+		}
+	}
+}
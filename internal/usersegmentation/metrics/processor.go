@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// processor - обработчик БД, учитывающий время выполнения и ошибки вызовов другого обработчика БД.
+// Методы processor вызывают одноимённые методы next и учитывают их в метриках, не изменяя их аргументы и результаты.
+type processor struct {
+	next    models.UserSegmentationDbProcessor // next - обработчик БД, вызовы которого учитываются.
+	metrics *Metrics                           // metrics - метрики, в которых учитываются вызовы.
+}
+
+// Instrument - создание обработчика БД, учитывающего вызовы обработчика p в метриках.
+//
+// Принимает: обработчик БД.
+//
+// Возвращает: обработчик БД.
+func (m *Metrics) Instrument(p models.UserSegmentationDbProcessor) models.UserSegmentationDbProcessor {
+	return &processor{next: p, metrics: m}
+}
+
+func (p *processor) AddSegment(ctx context.Context, slug string, autoPercent int) (int, error) {
+	start := time.Now()
+	result, err := p.next.AddSegment(ctx, slug, autoPercent)
+	p.metrics.observeStorage("AddSegment", start, err)
+	return result, err
+}
+
+func (p *processor) DeleteSegment(ctx context.Context, slug string) error {
+	start := time.Now()
+	err := p.next.DeleteSegment(ctx, slug)
+	p.metrics.observeStorage("DeleteSegment", start, err)
+	return err
+}
+
+func (p *processor) RestoreSegment(ctx context.Context, slug string) error {
+	start := time.Now()
+	err := p.next.RestoreSegment(ctx, slug)
+	p.metrics.observeStorage("RestoreSegment", start, err)
+	return err
+}
+
+func (p *processor) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	start := time.Now()
+	result, err := p.next.PurgeDeleted(ctx, before)
+	p.metrics.observeStorage("PurgeDeleted", start, err)
+	return result, err
+}
+
+func (p *processor) GetSegments(ctx context.Context, prefix string, limit int, offset int) ([]models.Segment, error) {
+	start := time.Now()
+	result, err := p.next.GetSegments(ctx, prefix, limit, offset)
+	p.metrics.observeStorage("GetSegments", start, err)
+	return result, err
+}
+
+func (p *processor) GetSegment(ctx context.Context, slug string) (models.Segment, error) {
+	start := time.Now()
+	result, err := p.next.GetSegment(ctx, slug)
+	p.metrics.observeStorage("GetSegment", start, err)
+	return result, err
+}
+
+func (p *processor) UpdateSegment(ctx context.Context, slug string, update models.SegmentUpdate) error {
+	start := time.Now()
+	err := p.next.UpdateSegment(ctx, slug, update)
+	p.metrics.observeStorage("UpdateSegment", start, err)
+	return err
+}
+
+func (p *processor) GetSegmentMembers(ctx context.Context, slug string, after int, limit int, fn func(models.Member) error) error {
+	start := time.Now()
+	err := p.next.GetSegmentMembers(ctx, slug, after, limit, fn)
+	p.metrics.observeStorage("GetSegmentMembers", start, err)
+	return err
+}
+
+func (p *processor) ModifyUser(ctx context.Context, id int, append []models.SegmentAddition, remove []string, partial bool) (models.ModificationReport, error) {
+	start := time.Now()
+	result, err := p.next.ModifyUser(ctx, id, append, remove, partial)
+	p.metrics.observeStorage("ModifyUser", start, err)
+	return result, err
+}
+
+func (p *processor) ModifyUsers(ctx context.Context, mods []models.UserModification) (models.BulkReport, error) {
+	start := time.Now()
+	result, err := p.next.ModifyUsers(ctx, mods)
+	p.metrics.observeStorage("ModifyUsers", start, err)
+	return result, err
+}
+
+func (p *processor) GetUserRelations(ctx context.Context, id int) ([]models.Relation, error) {
+	start := time.Now()
+	result, err := p.next.GetUserRelations(ctx, id)
+	p.metrics.observeStorage("GetUserRelations", start, err)
+	return result, err
+}
+
+func (p *processor) DeleteExpired(ctx context.Context) (int, error) {
+	start := time.Now()
+	result, err := p.next.DeleteExpired(ctx)
+	p.metrics.observeStorage("DeleteExpired", start, err)
+	return result, err
+}
+
+func (p *processor) AddUser(ctx context.Context, id int) error {
+	start := time.Now()
+	err := p.next.AddUser(ctx, id)
+	p.metrics.observeStorage("AddUser", start, err)
+	return err
+}
+
+func (p *processor) GetUsers(ctx context.Context, limit int, offset int) ([]models.User, error) {
+	start := time.Now()
+	result, err := p.next.GetUsers(ctx, limit, offset)
+	p.metrics.observeStorage("GetUsers", start, err)
+	return result, err
+}
+
+func (p *processor) DeleteUser(ctx context.Context, id int) error {
+	start := time.Now()
+	err := p.next.DeleteUser(ctx, id)
+	p.metrics.observeStorage("DeleteUser", start, err)
+	return err
+}
+
+func (p *processor) GetHistory(ctx context.Context, from time.Time, to time.Time) ([]models.HistoryRecord, error) {
+	start := time.Now()
+	result, err := p.next.GetHistory(ctx, from, to)
+	p.metrics.observeStorage("GetHistory", start, err)
+	return result, err
+}
+
+func (p *processor) GetStats(ctx context.Context) (models.Stats, error) {
+	start := time.Now()
+	result, err := p.next.GetStats(ctx)
+	p.metrics.observeStorage("GetStats", start, err)
+	return result, err
+}
@@ -0,0 +1,117 @@
+package usersegmentation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestIDHeader - заголовок, в котором передаётся ID запроса.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength - максимальная длина ID запроса, принимаемого от клиента.
+const maxRequestIDLength = 128
+
+// unknownRoute - маршрут, под которым в метриках учитываются запросы к незарегистрированным маршрутам.
+const unknownRoute = "unknown"
+
+// userIDKey - ключ ID пользователя, к которому относится запрос, в локальных значениях контекста Fiber.
+const userIDKey = "user_id"
+
+// observeRequests - промежуточный обработчик, назначающий запросу ID, записывающий запрос в журнал доступа и учитывающий его в метриках.
+// ID запроса берётся из заголовка X-Request-ID или генерируется, возвращается в том же заголовке ответа
+// и добавляется ко всем записям лога, сделанным при обработке запроса (см. logging.FromContext).
+// В метриках запрос учитывается по шаблону маршрута (например, "/users/:id"), а запросы к незарегистрированным маршрутам - под маршрутом unknownRoute.
+//
+// Принимает: контекст.
+//
+// Возвращает: ошибку.
+func (app *App) observeRequests(c *fiber.Ctx) error {
+	start := time.Now()
+
+	id := c.Get(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	c.Set(requestIDHeader, id)
+
+	logger := app.logger.With("request_id", id)
+	c.SetUserContext(logging.WithLogger(app.requestsCtx, logger))
+
+	if err := c.Next(); err != nil {
+		if err = c.App().ErrorHandler(c, err); err != nil {
+			c.Status(http.StatusInternalServerError)
+		}
+	}
+
+	status, latency := c.Response().StatusCode(), time.Since(start)
+	if app.options.Metrics != nil {
+		route := c.Route().Path
+		if !app.routes[routeKey(c.Method(), route)] {
+			route = unknownRoute
+		}
+		app.options.Metrics.ObserveRequest(c.Method(), route, status, latency)
+	}
+
+	attrs := []any{
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.Int("status", status),
+		slog.Duration("latency", latency),
+	}
+	if userID, ok := c.Locals(userIDKey).(int); ok {
+		attrs = append(attrs, slog.Int("user_id", userID))
+	}
+	if principal, ok := auth.FromContext(c.UserContext()); ok {
+		attrs = append(attrs, slog.String("subject", principal.Subject))
+	}
+
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	logger.Log(c.UserContext(), level, "request", attrs...)
+
+	return nil
+}
+
+// setUserID - сохранение ID пользователя, к которому относится запрос, для журнала доступа.
+//
+// Принимает: контекст, ID пользователя.
+func setUserID(c *fiber.Ctx, id int) {
+	c.Locals(userIDKey, id)
+}
+
+// validRequestID - проверка ID запроса, полученного от клиента.
+//
+// Принимает: ID запроса.
+//
+// Возвращает: true, если ID непустой, не длиннее maxRequestIDLength и состоит из печатных символов ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID - генерация ID запроса.
+//
+// Возвращает: случайный ID запроса из 32 шестнадцатеричных символов.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// APIKeyStore - интерфейс, предоставляющий методы для работы с БД, хранящей ключи API.
+// Секреты ключей не хранятся: ключ находится по хешу секрета.
+type APIKeyStore interface {
+	// AddAPIKey - добавляет ключ API в БД.
+	//
+	// Принимает: контекст и параметры ключа (хеш секрета, префикс секрета, название, роль и время истечения).
+	//
+	// Возвращает: добавленный ключ и ошибку.
+	AddAPIKey(ctx context.Context, key NewAPIKey) (APIKey, error)
+	// GetAPIKeys - возвращает все ключи API, в том числе отозванные и истёкшие, упорядоченные по id.
+	//
+	// Принимает: контекст.
+	//
+	// Возвращает: список ключей и ошибку.
+	GetAPIKeys(ctx context.Context) ([]APIKey, error)
+	// GetAPIKeyByHash - возвращает ключ API по хешу его секрета.
+	//
+	// Принимает: контекст и хеш секрета.
+	//
+	// Возвращает: ключ и ошибку (ErrAPIKeyNotFound, если ключа с таким хешем нет).
+	GetAPIKeyByHash(ctx context.Context, hash []byte) (APIKey, error)
+	// RevokeAPIKey - отзывает ключ API. Повторный отзыв не изменяет время отзыва.
+	//
+	// Принимает: контекст и id ключа.
+	//
+	// Возвращает: ошибку (ErrAPIKeyNotFound, если ключ не существует).
+	RevokeAPIKey(ctx context.Context, id int) error
+	// SetAPIKeyExpiry - устанавливает время истечения ключа API.
+	//
+	// Принимает: контекст, id ключа и время истечения (nil - ключ бессрочный).
+	//
+	// Возвращает: ошибку (ErrAPIKeyNotFound, если ключ не существует).
+	SetAPIKeyExpiry(ctx context.Context, id int, expiresAt *time.Time) error
+	// RecordAPIKeyUsage - учитывает использования ключей API.
+	// Количество использований каждого ключа увеличивается, а время последнего использования не уменьшается; неизвестные ключи пропускаются.
+	//
+	// Принимает: контекст и использования ключей по их id.
+	//
+	// Возвращает: ошибку.
+	RecordAPIKeyUsage(ctx context.Context, usage map[int]APIKeyUsage) error
+}
+
+// APIKey - структура, описывающая ключ API.
+type APIKey struct {
+	ID         int        `json:"id"`                     // ID - id ключа.
+	Name       string     `json:"name"`                   // Name - название ключа (например, потребитель, которому он выдан).
+	Prefix     string     `json:"prefix"`                 // Prefix - начало секрета ключа, по которому ключ можно узнать.
+	Role       string     `json:"role"`                   // Role - роль, с которой выполняются запросы с ключом (reader, editor или admin).
+	CreatedAt  time.Time  `json:"created_at"`             // CreatedAt - время создания ключа.
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`   // ExpiresAt - время истечения ключа (nil - ключ бессрочный).
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`   // RevokedAt - время отзыва ключа (nil - ключ не отозван).
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // LastUsedAt - время последнего использования ключа (nil - ключ не использовался).
+	UsageCount int64      `json:"usage_count"`            // UsageCount - количество запросов с ключом.
+}
+
+// Active - проверка действительности ключа API.
+//
+// Принимает: текущее время.
+//
+// Возвращает: true, если ключ не отозван и не истёк.
+func (key APIKey) Active(now time.Time) bool {
+	return key.RevokedAt == nil && (key.ExpiresAt == nil || now.Before(*key.ExpiresAt))
+}
+
+// NewAPIKey - структура, описывающая параметры добавляемого ключа API.
+type NewAPIKey struct {
+	Hash      []byte     // Hash - хеш секрета ключа.
+	Prefix    string     // Prefix - начало секрета ключа.
+	Name      string     // Name - название ключа.
+	Role      string     // Role - роль ключа.
+	ExpiresAt *time.Time // ExpiresAt - время истечения ключа (nil - ключ бессрочный).
+}
+
+// APIKeyUsage - структура, описывающая использования ключа API за период.
+type APIKeyUsage struct {
+	Count    int64     // Count - количество запросов с ключом.
+	LastUsed time.Time // LastUsed - время последнего запроса с ключом.
+}
+
+// APIKeyCreation - структура, описывающая запрос создания ключа API.
+type APIKeyCreation struct {
+	Name      string     `json:"name"`                 // Name - название ключа.
+	Role      string     `json:"role"`                 // Role - роль ключа: reader, editor или admin.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // ExpiresAt - время истечения ключа (не задано - ключ бессрочный).
+}
+
+// APIKeyExpiry - структура, описывающая запрос изменения времени истечения ключа API.
+type APIKeyExpiry struct {
+	ExpiresAt *time.Time `json:"expires_at"` // ExpiresAt - время истечения ключа (null - ключ бессрочный).
+}
+
+// CreatedAPIKey - структура, описывающая созданный ключ API вместе с его секретом.
+type CreatedAPIKey struct {
+	APIKey
+	Secret string `json:"secret"` // Secret - секрет ключа, передаваемый в заголовке X-API-Key; возвращается только при создании.
+}
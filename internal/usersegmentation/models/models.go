@@ -1,37 +1,275 @@
 // models - пакет, содержащий структуры, описывающие сущности, используемые в проекте.
 package models
 
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
 // UserSegmentationDbProcessor - интерфейс, предоставляющий методы для работы с БД, хранящей данные о сегментации пользователей.
+//
+// Все методы принимают контекст: если он отменён или его срок истёк, то операция прерывается,
+// её незавершённые изменения не применяются и возвращается ошибка.
 type UserSegmentationDbProcessor interface {
 	// AddSegment - добавляет сегмент в БД.
+	// Если процент автоматического добавления больше 0, то в сегмент добавляются пользователи, для которых InRollout возвращает true.
+	//
+	// Принимает: название сегмента, процент пользователей, автоматически добавляемых в сегмент.
+	//
+	// Возвращает: id добавленного сегмента и ошибку (ErrInvalidSlug, если название не проходит ValidateSlug, ErrSegmentExists, если сегмент уже существует).
+	AddSegment(ctx context.Context, slug string, autoPercent int) (int, error)
+	// DeleteSegment - помечает сегмент удалённым (мягкое удаление).
+	// Удалённый сегмент не возвращается и не может быть изменён, а пользователи считаются удалёнными из него,
+	// но их членства сохраняются до окончательного удаления сегмента (см. PurgeDeleted) и восстанавливаются вместе с ним (см. RestoreSegment).
 	//
 	// Принимает: название сегмента.
 	//
-	// Возвращает: id добавленного сегмента и ошибку.
-	AddSegment(slug string) (int, error)
-	// DeleteSegment - удаляет сегмент из БД.
+	// Возвращает: ошибку (ErrSegmentNotFound, если активного сегмента с таким названием нет).
+	DeleteSegment(ctx context.Context, slug string) error
+	// RestoreSegment - восстанавливает удалённый сегмент вместе с членствами пользователей в нём, кроме истёкших.
 	//
 	// Принимает: название сегмента.
 	//
-	// Возвращает: ошибку.
-	DeleteSegment(slug string) error
+	// Возвращает: ошибку (ErrSegmentNotFound, если удалённого сегмента с таким названием нет).
+	RestoreSegment(ctx context.Context, slug string) error
+	// PurgeDeleted - окончательно удаляет сегменты, удалённые до указанного времени, вместе с членствами пользователей в них.
+	//
+	// Принимает: время, до которого сегмент должен быть удалён.
+	//
+	// Возвращает: количество окончательно удалённых сегментов и ошибку.
+	PurgeDeleted(ctx context.Context, before time.Time) (int, error)
+	// GetSegments - возвращает сегменты, упорядоченные по названию.
+	//
+	// Принимает: префикс названия сегментов (пустая строка - все сегменты), максимальное количество сегментов и смещение.
+	//
+	// Возвращает: список сегментов и ошибку.
+	GetSegments(ctx context.Context, prefix string, limit int, offset int) ([]Segment, error)
+	// GetSegment - возвращает сегмент.
+	//
+	// Принимает: название сегмента.
+	//
+	// Возвращает: сегмент и ошибку (ErrSegmentNotFound, если сегмент не существует).
+	GetSegment(ctx context.Context, slug string) (Segment, error)
+	// UpdateSegment - изменяет метаданные сегмента.
+	//
+	// Принимает: название сегмента и изменения.
+	//
+	// Возвращает: ошибку (ErrSegmentNotFound, если сегмент не существует).
+	UpdateSegment(ctx context.Context, slug string, update SegmentUpdate) error
+	// GetSegmentMembers - передаёт пользователей, состоящих в сегменте, в функцию fn по одному, в порядке возрастания id.
+	// Истёкшие членства не передаются. Если fn возвращает ошибку, то получение прекращается и ошибка возвращается.
+	//
+	// Принимает: название сегмента, id пользователя, после которого начинать (курсор), максимальное количество пользователей (0 - без ограничения) и функцию-обработчик.
+	//
+	// Возвращает: ошибку (ErrSegmentNotFound, если сегмент не существует; в этом случае fn не вызывается).
+	GetSegmentMembers(ctx context.Context, slug string, after int, limit int, fn func(Member) error) error
 	// ModifyUser - изменяет сегменты пользователя.
+	// Если пользователь ещё не зарегистрирован, то он регистрируется и добавляется в сегменты с автоматическим добавлением,
+	// либо, если хранилище работает в строгом режиме, возвращается ErrUserNotFound.
+	//
+	// Все изменения применяются атомарно. Если какой-либо из сегментов не существует, то, если partial равен false,
+	// ничего не изменяется и возвращается ErrSegmentNotFound, иначе изменения применяются к существующим сегментам,
+	// а остальные получают в отчёте статус StatusUnknown.
+	//
+	// Принимает: id пользователя, сегменты, в которые необходимо добавить пользователя (с необязательным сроком истечения),
+	// имена сегментов, из которых необходимо убрать пользователя, и флаг частичного применения.
+	//
+	// Возвращает: отчёт о результатах изменения для каждого сегмента и ошибку.
+	ModifyUser(ctx context.Context, id int, append []SegmentAddition, remove []string, partial bool) (ModificationReport, error)
+	// ModifyUsers - изменяет сегменты нескольких пользователей, как ModifyUser для каждого изменения.
+	// Изменения применяются пачками; изменение, которое не может быть применено (например, из-за несуществующего сегмента),
+	// пропускается и попадает в список неудавшихся, не мешая остальным.
 	//
-	// Принимает: id пользователя, имена сегментов, в которые необходимо добавить пользователя, и имена сегментов, из которых необходимо убрать пользователя.
+	// Принимает: список изменений пользователей.
 	//
-	// Возвращает: ошибку.
-	ModifyUser(id int, append []string, remove []string) error
+	// Возвращает: итог изменения и ошибку.
+	ModifyUsers(ctx context.Context, mods []UserModification) (BulkReport, error)
 	// GetUserRelations - возвращает сегменты, в которых состоит пользователь.
+	// Истёкшие членства пользователя в сегментах не возвращаются.
+	//
+	// Принимает: id пользователя.
+	//
+	// Возвращает: список отношений пользователя с сегментами, в которых он состоит, и ошибку.
+	GetUserRelations(ctx context.Context, id int) ([]Relation, error)
+	// DeleteExpired - удаляет истёкшие членства пользователей в сегментах.
+	//
+	// Возвращает: количество удалённых отношений и ошибку.
+	DeleteExpired(ctx context.Context) (int, error)
+	// AddUser - регистрирует пользователя и добавляет его в сегменты с автоматическим добавлением.
+	//
+	// Принимает: id пользователя.
+	//
+	// Возвращает: ошибку (ErrUserExists, если пользователь уже зарегистрирован).
+	AddUser(ctx context.Context, id int) error
+	// GetUsers - возвращает зарегистрированных пользователей, упорядоченных по id.
+	//
+	// Принимает: максимальное количество пользователей и смещение.
+	//
+	// Возвращает: список пользователей и ошибку.
+	GetUsers(ctx context.Context, limit int, offset int) ([]User, error)
+	// DeleteUser - удаляет пользователя и все его отношения с сегментами.
 	//
 	// Принимает: id пользователя.
 	//
-	// Возвращает: список сегментов, в которых состоит пользователь, и ошибку.
-	GetUserRelations(id int) ([]string, error)
+	// Возвращает: ошибку (ErrUserNotFound, если пользователь не зарегистрирован).
+	DeleteUser(ctx context.Context, id int) error
+	// GetHistory - возвращает историю изменений сегментов пользователей за период.
+	//
+	// Принимает: начало периода (включительно) и конец периода (не включительно).
+	//
+	// Возвращает: список записей истории, упорядоченный по времени, и ошибку.
+	GetHistory(ctx context.Context, from time.Time, to time.Time) ([]HistoryRecord, error)
+	// GetStats - возвращает общее количество сегментов, пользователей и членств пользователей в сегментах.
+	//
+	// Возвращает: статистику и ошибку.
+	GetStats(ctx context.Context) (Stats, error)
+}
+
+// Ошибки, возвращаемые обработчиками БД.
+var (
+	ErrUserNotFound = errors.New("user not found")      // ErrUserNotFound - пользователь не зарегистрирован.
+	ErrUserExists   = errors.New("user already exists") // ErrUserExists - пользователь уже зарегистрирован.
+
+	ErrSegmentNotFound = errors.New("segment not found")      // ErrSegmentNotFound - сегмент не существует.
+	ErrSegmentExists   = errors.New("segment already exists") // ErrSegmentExists - сегмент уже существует.
+	ErrInvalidSlug     = errors.New("invalid slug")           // ErrInvalidSlug - недопустимое название сегмента.
+
+	ErrTimeout = errors.New("request timed out") // ErrTimeout - запрос не был обработан за отведённое время.
+
+	ErrUnauthorized = errors.New("unauthorized") // ErrUnauthorized - клиент не аутентифицирован.
+	ErrForbidden    = errors.New("forbidden")    // ErrForbidden - у клиента нет прав на выполнение запроса.
+
+	ErrAPIKeyNotFound = errors.New("api key not found") // ErrAPIKeyNotFound - ключ API не существует.
+
+	ErrRateLimited = errors.New("rate limit exceeded") // ErrRateLimited - клиент превысил допустимую частоту запросов.
+)
+
+// Коды ошибок, передаваемые клиенту в поле code структуры Err.
+const (
+	CodeBadRequest      = "bad_request"       // CodeBadRequest - некорректный запрос.
+	CodeInternal        = "internal_error"    // CodeInternal - внутренняя ошибка сервера.
+	CodeUserNotFound    = "user_not_found"    // CodeUserNotFound - см. ErrUserNotFound.
+	CodeUserExists      = "user_exists"       // CodeUserExists - см. ErrUserExists.
+	CodeSegmentNotFound = "segment_not_found" // CodeSegmentNotFound - см. ErrSegmentNotFound.
+	CodeSegmentExists   = "segment_exists"    // CodeSegmentExists - см. ErrSegmentExists.
+	CodeInvalidSlug     = "invalid_slug"      // CodeInvalidSlug - см. ErrInvalidSlug.
+	CodeTimeout         = "timeout"           // CodeTimeout - см. ErrTimeout.
+	CodeUnauthorized    = "unauthorized"      // CodeUnauthorized - см. ErrUnauthorized.
+	CodeForbidden       = "forbidden"         // CodeForbidden - см. ErrForbidden.
+	CodeAPIKeyNotFound  = "api_key_not_found" // CodeAPIKeyNotFound - см. ErrAPIKeyNotFound.
+	CodeRateLimited     = "rate_limited"      // CodeRateLimited - см. ErrRateLimited.
+)
+
+// ErrorCode - получение кода ошибки.
+//
+// Принимает: ошибку.
+//
+// Возвращает: код, соответствующий ошибке из этого пакета, или CodeInternal для остальных ошибок.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrSegmentNotFound):
+		return CodeSegmentNotFound
+	case errors.Is(err, ErrUserNotFound):
+		return CodeUserNotFound
+	case errors.Is(err, ErrSegmentExists):
+		return CodeSegmentExists
+	case errors.Is(err, ErrUserExists):
+		return CodeUserExists
+	case errors.Is(err, ErrInvalidSlug):
+		return CodeInvalidSlug
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, ErrUnauthorized):
+		return CodeUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return CodeForbidden
+	case errors.Is(err, ErrAPIKeyNotFound):
+		return CodeAPIKeyNotFound
+	case errors.Is(err, ErrRateLimited):
+		return CodeRateLimited
+	}
+
+	return CodeInternal
+}
+
+// MaxSlugLength - максимальная длина названия сегмента в символах.
+const MaxSlugLength = 255
+
+// ValidateSlug - проверка названия сегмента.
+// Название должно быть непустой строкой UTF-8 длиной не более MaxSlugLength символов без управляющих символов.
+//
+// Принимает: название сегмента.
+//
+// Возвращает: ошибку (ErrInvalidSlug, если название недопустимо).
+func ValidateSlug(slug string) error {
+	switch {
+	case slug == "":
+		return fmt.Errorf("slug must not be empty: %w", ErrInvalidSlug)
+	case !utf8.ValidString(slug):
+		return fmt.Errorf("slug must be a valid UTF-8 string: %w", ErrInvalidSlug)
+	case utf8.RuneCountInString(slug) > MaxSlugLength:
+		return fmt.Errorf("slug must be at most %d characters long: %w", MaxSlugLength, ErrInvalidSlug)
+	case strings.IndexFunc(slug, unicode.IsControl) >= 0:
+		return fmt.Errorf("slug must not contain control characters: %w", ErrInvalidSlug)
+	}
+
+	return nil
 }
 
 // Segment - структура, описывающая сегмент.
 type Segment struct {
-	Slug string `json:"slug"` // Slug - название сегмента.
+	ID          int       `json:"id"`           // ID - id сегмента.
+	Slug        string    `json:"slug"`         // Slug - название сегмента.
+	CreatedAt   time.Time `json:"created_at"`   // CreatedAt - время создания сегмента.
+	Description string    `json:"description"`  // Description - описание сегмента.
+	OwnerTeam   string    `json:"owner_team"`   // OwnerTeam - команда, владеющая сегментом.
+	AutoPercent int       `json:"auto_percent"` // AutoPercent - процент пользователей, автоматически добавляемых в сегмент.
+	Members     int       `json:"members"`      // Members - количество пользователей в сегменте.
+}
+
+// Slug - структура, описывающая название сегмента.
+type Slug struct {
+	Value string `json:"slug"` // Value - название сегмента.
+}
+
+// SegmentCreation - структура, описывающая создание сегмента.
+type SegmentCreation struct {
+	Slug            // Slug - название сегмента.
+	AutoPercent int `json:"auto_percent"` // AutoPercent - процент пользователей, автоматически добавляемых в сегмент (от 0 до 100).
+}
+
+// SegmentUpdate - структура, описывающая изменение метаданных сегмента.
+// Поля, равные nil, не изменяются.
+type SegmentUpdate struct {
+	Description *string `json:"description"` // Description - новое описание сегмента.
+	OwnerTeam   *string `json:"owner_team"`  // OwnerTeam - новая команда, владеющая сегментом.
+}
+
+// InRollout - проверяет, попадает ли пользователь в процент автоматического добавления в сегмент.
+//
+// Выбор детерминирован: пользователь попадает в сегмент, если первые 4 байта MD5 хеша строки "slug:id",
+// прочитанные как big-endian беззнаковое число, по модулю 100 меньше процента.
+// Хранилища, выполняющие выбор на своей стороне, должны использовать ту же формулу.
+//
+// Принимает: id пользователя, название сегмента, процент автоматического добавления.
+//
+// Возвращает: true, если пользователь должен быть добавлен в сегмент.
+func InRollout(userID int, slug string, percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	sum := md5.Sum([]byte(slug + ":" + strconv.Itoa(userID)))
+	return binary.BigEndian.Uint32(sum[:4])%100 < uint32(percent)
 }
 
 // ID - структура, описывающая id.
@@ -39,14 +277,175 @@ type ID struct {
 	Value int `json:"id"` // Value - id.
 }
 
+// User - структура, описывающая зарегистрированного пользователя.
+type User struct {
+	ID        int       `json:"id"`         // ID - id пользователя.
+	CreatedAt time.Time `json:"created_at"` // CreatedAt - время регистрации пользователя.
+}
+
+// Relation - структура, описывающая членство пользователя в сегменте.
+type Relation struct {
+	Slug      string     `json:"slug"`                 // Slug - название сегмента.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // ExpiresAt - время истечения членства (nil, если членство бессрочное).
+}
+
+// Member - структура, описывающая пользователя, состоящего в сегменте.
+type Member struct {
+	UserID    int        `json:"user_id"`              // UserID - id пользователя.
+	AddedAt   time.Time  `json:"added_at"`             // AddedAt - время добавления пользователя в сегмент.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // ExpiresAt - время истечения членства (nil, если членство бессрочное).
+}
+
+// MembersPage - структура, описывающая страницу пользователей, состоящих в сегменте.
+type MembersPage struct {
+	Users      []Member `json:"users"`                 // Users - пользователи, состоящие в сегменте.
+	NextCursor *int     `json:"next_cursor,omitempty"` // NextCursor - курсор следующей страницы (nil, если страница последняя).
+}
+
 // UserModification - структура, описывающая изменение сегментов пользователя.
 type UserModification struct {
-	ID              // ID - id пользователя.
-	Append []string `json:"append"` // Append - список сегментов, в которые необходимо добавить пользователя.
-	Remove []string `json:"remove"` // Remove - список сегментов, из которых необходимо убрать пользователя.
+	ID                        // ID - id пользователя.
+	Append  []SegmentAddition `json:"append"`  // Append - список сегментов, в которые необходимо добавить пользователя.
+	Remove  []string          `json:"remove"`  // Remove - список сегментов, из которых необходимо убрать пользователя.
+	Partial bool              `json:"partial"` // Partial - флаг частичного применения (если true, то несуществующие сегменты пропускаются).
+}
+
+// Статусы сегментов в отчёте об изменении сегментов пользователя.
+const (
+	StatusAdded          = "added"           // StatusAdded - пользователь добавлен в сегмент.
+	StatusAlreadyPresent = "already_present" // StatusAlreadyPresent - пользователь уже состоял в сегменте (время истечения членства заменено).
+	StatusRemoved        = "removed"         // StatusRemoved - пользователь удалён из сегмента.
+	StatusNotMember      = "not_member"      // StatusNotMember - пользователь не состоял в сегменте.
+	StatusUnknown        = "unknown"         // StatusUnknown - сегмент не существует.
+)
+
+// SlugStatus - структура, описывающая результат изменения для одного сегмента.
+type SlugStatus struct {
+	Slug   string `json:"slug"`   // Slug - название сегмента.
+	Status string `json:"status"` // Status - статус (одна из констант Status*).
+}
+
+// ModificationReport - структура, описывающая отчёт об изменении сегментов пользователя.
+// Результаты перечислены в порядке сегментов в запросе.
+type ModificationReport struct {
+	Append []SlugStatus `json:"append"` // Append - результаты добавления в сегменты.
+	Remove []SlugStatus `json:"remove"` // Remove - результаты удаления из сегментов.
+}
+
+// SegmentAddition - структура, описывающая добавление пользователя в сегмент.
+//
+// В JSON задаётся либо строкой с названием сегмента ("slug"),
+// либо объектом {"slug":"slug","expires_at":"2023-09-01T00:00:00Z"} или {"slug":"slug","ttl":"72h"}.
+type SegmentAddition struct {
+	Slug      string     `json:"slug"`                 // Slug - название сегмента.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // ExpiresAt - время истечения членства (nil, если членство бессрочное).
+}
+
+// UnmarshalJSON - разбор добавления пользователя в сегмент из JSON.
+// Срок жизни "ttl" переводится во время истечения относительно текущего момента.
+func (a *SegmentAddition) UnmarshalJSON(data []byte) error {
+	var slug string
+	if err := json.Unmarshal(data, &slug); err == nil {
+		*a = SegmentAddition{Slug: slug}
+		return nil
+	}
+
+	var obj struct {
+		Slug      string     `json:"slug"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		TTL       string     `json:"ttl"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&obj); err != nil {
+		return err
+	}
+
+	if obj.ExpiresAt != nil && obj.TTL != "" {
+		return errors.New(`only one of "expires_at" and "ttl" can be specified`)
+	}
+	if obj.TTL != "" {
+		ttl, err := time.ParseDuration(obj.TTL)
+		if err != nil {
+			return err
+		}
+		if ttl <= 0 {
+			return errors.New(`"ttl" must be positive`)
+		}
+		expiresAt := time.Now().Add(ttl)
+		obj.ExpiresAt = &expiresAt
+	}
+
+	*a = SegmentAddition{Slug: obj.Slug, ExpiresAt: obj.ExpiresAt}
+	return nil
+}
+
+// Операции над отношениями пользователь-сегмент, сохраняемые в истории.
+const (
+	OperationAdd    = "add"    // OperationAdd - добавление пользователя в сегмент.
+	OperationRemove = "remove" // OperationRemove - удаление пользователя из сегмента.
+)
+
+// HistoryRecord - структура, описывающая запись истории изменений сегментов пользователя.
+type HistoryRecord struct {
+	UserID    int       // UserID - id пользователя.
+	Slug      string    // Slug - название сегмента.
+	Operation string    // Operation - операция (OperationAdd или OperationRemove).
+	Time      time.Time // Time - дата и время операции.
+}
+
+// BulkModification - структура, описывающая массовое изменение сегментов пользователей.
+//
+// Задаётся либо списком изменений пользователей (Users), либо сегментом и списком id пользователей (Segment, IDs, Operation).
+type BulkModification struct {
+	Users     []UserModification `json:"users,omitempty"`     // Users - список изменений пользователей.
+	Segment   *SegmentAddition   `json:"segment,omitempty"`   // Segment - сегмент, в который необходимо добавить (или из которого необходимо убрать) пользователей.
+	IDs       []int              `json:"ids,omitempty"`       // IDs - список id пользователей.
+	Operation string             `json:"operation,omitempty"` // Operation - операция над сегментом (OperationAdd, по умолчанию, или OperationRemove).
+}
+
+// BulkReport - структура, описывающая итог массового изменения сегментов пользователей.
+type BulkReport struct {
+	Applied int           `json:"applied"` // Applied - количество применённых изменений пользователей.
+	Failed  []BulkFailure `json:"failed"`  // Failed - список изменений пользователей, которые не были применены.
+}
+
+// BulkFailure - структура, описывающая изменение сегментов пользователя, которое не было применено.
+type BulkFailure struct {
+	ID   int    `json:"id"`    // ID - id пользователя.
+	Text string `json:"error"` // Text - текст ошибки.
+	Code string `json:"code"`  // Code - код ошибки (см. ErrorCode).
+}
+
+// Stats - структура, описывающая общее количество данных в хранилище.
+type Stats struct {
+	Segments        int // Segments - количество сегментов, кроме удалённых.
+	DeletedSegments int // DeletedSegments - количество удалённых, но ещё не удалённых окончательно сегментов.
+	Users           int // Users - количество зарегистрированных пользователей.
+	Memberships     int // Memberships - количество неистёкших членств пользователей в сегментах, кроме удалённых.
+}
+
+// Статусы состояния сервиса и его компонентов.
+const (
+	HealthOK           = "ok"            // HealthOK - сервис или компонент работает.
+	HealthFailing      = "failing"       // HealthFailing - компонент не работает, сервис не готов обрабатывать запросы.
+	HealthShuttingDown = "shutting_down" // HealthShuttingDown - сервис завершает работу и не принимает новые запросы.
+)
+
+// Health - структура, описывающая состояние сервиса.
+type Health struct {
+	Status     string                     `json:"status"`               // Status - статус сервиса (HealthOK, HealthFailing или HealthShuttingDown).
+	Components map[string]ComponentHealth `json:"components,omitempty"` // Components - состояния компонентов сервиса по их названиям.
+}
+
+// ComponentHealth - структура, описывающая состояние компонента сервиса.
+type ComponentHealth struct {
+	Status string `json:"status"`          // Status - статус компонента (HealthOK или HealthFailing).
+	Error  string `json:"error,omitempty"` // Error - текст ошибки проверки компонента.
 }
 
 // Err - структура, описывающая ошибку.
 type Err struct {
 	Text string `json:"error"` // Text - текст ошибки.
+	Code string `json:"code"`  // Code - машиночитаемый код ошибки (см. константы Code*).
 }
@@ -0,0 +1,234 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/lib/pq"
+)
+
+// APIKeys - модель базы данных ключей API.
+type APIKeys struct {
+	db *sql.DB // db - указатель на базу данных.
+}
+
+// GetAPIKeyStore - создание модели базы данных ключей API.
+// Схема базы данных должна быть проверена через GetModel.
+//
+// Принимает базу данных.
+//
+// Возвращает модель базы данных ключей API.
+func GetAPIKeyStore(db *sql.DB) models.APIKeyStore {
+	return &APIKeys{db}
+}
+
+// AddAPIKey - добавление ключа API в базу данных.
+//
+// Принимает: контекст и параметры ключа.
+//
+// Возвращает: добавленный ключ и ошибку.
+func (model *APIKeys) AddAPIKey(ctx context.Context, key models.NewAPIKey) (models.APIKey, error) {
+	return addAPIKeyToDB(ctx, model.db, key)
+}
+
+// GetAPIKeys - получение всех ключей API из базы данных.
+//
+// Принимает: контекст.
+//
+// Возвращает: список ключей и ошибку.
+func (model *APIKeys) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	return getAPIKeysFromDB(ctx, model.db)
+}
+
+// GetAPIKeyByHash - получение ключа API по хешу секрета из базы данных.
+//
+// Принимает: контекст и хеш секрета.
+//
+// Возвращает: ключ и ошибку.
+func (model *APIKeys) GetAPIKeyByHash(ctx context.Context, hash []byte) (models.APIKey, error) {
+	return getAPIKeyByHashFromDB(ctx, model.db, hash)
+}
+
+// RevokeAPIKey - отзыв ключа API в базе данных.
+//
+// Принимает: контекст и id ключа.
+//
+// Возвращает: ошибку.
+func (model *APIKeys) RevokeAPIKey(ctx context.Context, id int) error {
+	return revokeAPIKeyInDB(ctx, model.db, id)
+}
+
+// SetAPIKeyExpiry - установка времени истечения ключа API в базе данных.
+//
+// Принимает: контекст, id ключа и время истечения.
+//
+// Возвращает: ошибку.
+func (model *APIKeys) SetAPIKeyExpiry(ctx context.Context, id int, expiresAt *time.Time) error {
+	return setAPIKeyExpiryInDB(ctx, model.db, id, expiresAt)
+}
+
+// RecordAPIKeyUsage - учёт использований ключей API в базе данных.
+//
+// Принимает: контекст и использования ключей по их id.
+//
+// Возвращает: ошибку.
+func (model *APIKeys) RecordAPIKeyUsage(ctx context.Context, usage map[int]models.APIKeyUsage) error {
+	return recordAPIKeyUsageInDB(ctx, model.db, usage)
+}
+
+// apiKeyColumns - столбцы таблицы api_keys, считываемые scanAPIKey.
+const apiKeyColumns = `id, name, prefix, role, created_at, expires_at, revoked_at, last_used_at, usage_count`
+
+// scanAPIKey - считывание ключа API из строки результата запроса.
+//
+// Принимает: функцию считывания строки (Scan у sql.Row или sql.Rows).
+//
+// Возвращает: ключ и ошибку.
+func scanAPIKey(scan func(dest ...any) error) (models.APIKey, error) {
+	var key models.APIKey
+	err := scan(&key.ID, &key.Name, &key.Prefix, &key.Role, &key.CreatedAt, &key.ExpiresAt, &key.RevokedAt, &key.LastUsedAt, &key.UsageCount)
+
+	return key, err
+}
+
+// addAPIKeyToDB - добавление ключа API в базу данных.
+//
+// Принимает: контекст, указатель на базу данных и параметры ключа.
+//
+// Возвращает: добавленный ключ и ошибку.
+func addAPIKeyToDB(ctx context.Context, db *sql.DB, key models.NewAPIKey) (models.APIKey, error) {
+	q := `INSERT INTO api_keys (hash, prefix, name, role, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING ` + apiKeyColumns + `;`
+	added, err := scanAPIKey(db.QueryRowContext(ctx, q, key.Hash, key.Prefix, key.Name, key.Role, key.ExpiresAt).Scan)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("error while adding api key to the database: %s", err.Error())
+	}
+
+	return added, nil
+}
+
+// getAPIKeysFromDB - получение всех ключей API из базы данных.
+//
+// Принимает: контекст, указатель на базу данных.
+//
+// Возвращает: список ключей, упорядоченный по id, и ошибку.
+func getAPIKeysFromDB(ctx context.Context, db *sql.DB) ([]models.APIKey, error) {
+	q := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id;`
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return []models.APIKey{}, fmt.Errorf("error while getting api keys from the database: %s", err.Error())
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return []models.APIKey{}, fmt.Errorf("error while getting api keys from the database: %s", err.Error())
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return []models.APIKey{}, fmt.Errorf("error while getting api keys from the database: %s", err.Error())
+	}
+
+	return keys, nil
+}
+
+// getAPIKeyByHashFromDB - получение ключа API по хешу секрета из базы данных.
+//
+// Принимает: контекст, указатель на базу данных и хеш секрета.
+//
+// Возвращает: ключ и ошибку (models.ErrAPIKeyNotFound, если ключа с таким хешем нет).
+func getAPIKeyByHashFromDB(ctx context.Context, db *sql.DB, hash []byte) (models.APIKey, error) {
+	q := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE hash = $1;`
+	key, err := scanAPIKey(db.QueryRowContext(ctx, q, hash).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, models.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("error while getting api key from the database: %s", err.Error())
+	}
+
+	return key, nil
+}
+
+// revokeAPIKeyInDB - отзыв ключа API в базе данных.
+// Повторный отзыв не изменяет время отзыва.
+//
+// Принимает: контекст, указатель на базу данных и id ключа.
+//
+// Возвращает: ошибку (models.ErrAPIKeyNotFound, если ключ не существует).
+func revokeAPIKeyInDB(ctx context.Context, db *sql.DB, id int) error {
+	q := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1;`
+	return updateAPIKeyInDB(ctx, db, id, "revoking", q, id)
+}
+
+// setAPIKeyExpiryInDB - установка времени истечения ключа API в базе данных.
+//
+// Принимает: контекст, указатель на базу данных, id ключа и время истечения (nil - ключ бессрочный).
+//
+// Возвращает: ошибку (models.ErrAPIKeyNotFound, если ключ не существует).
+func setAPIKeyExpiryInDB(ctx context.Context, db *sql.DB, id int, expiresAt *time.Time) error {
+	q := `UPDATE api_keys SET expires_at = $2 WHERE id = $1;`
+	return updateAPIKeyInDB(ctx, db, id, "updating", q, id, expiresAt)
+}
+
+// updateAPIKeyInDB - выполнение запроса изменения одного ключа API.
+//
+// Принимает: контекст, указатель на базу данных, id ключа, название действия для текста ошибки, запрос и его параметры.
+//
+// Возвращает: ошибку (models.ErrAPIKeyNotFound, если запрос не изменил ни одной строки).
+func updateAPIKeyInDB(ctx context.Context, db *sql.DB, id int, action string, q string, args ...any) error {
+	errStr := "error while %s api key %d in the database: %s"
+	res, err := db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf(errStr, action, id, err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf(errStr, action, id, err.Error())
+	}
+	if n == 0 {
+		return fmt.Errorf("api key %d: %w", id, models.ErrAPIKeyNotFound)
+	}
+
+	return nil
+}
+
+// recordUsageQuery - запрос учёта использований ключей API.
+// Параметры: массивы id ключей, количеств использований и времён последнего использования.
+const recordUsageQuery = `UPDATE api_keys SET usage_count = api_keys.usage_count + usage.count, last_used_at = GREATEST(api_keys.last_used_at, usage.last_used)
+	FROM unnest($1::integer[], $2::bigint[], $3::timestamptz[]) AS usage(id, count, last_used) WHERE api_keys.id = usage.id;`
+
+// recordAPIKeyUsageInDB - учёт использований ключей API в базе данных одним запросом.
+//
+// Принимает: контекст, указатель на базу данных и использования ключей по их id.
+//
+// Возвращает: ошибку.
+func recordAPIKeyUsageInDB(ctx context.Context, db *sql.DB, usage map[int]models.APIKeyUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(usage))
+	for id := range usage {
+		ids = append(ids, int64(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	counts, lastUsed := make([]int64, len(ids)), make([]string, len(ids))
+	for i, id := range ids {
+		counts[i] = usage[int(id)].Count
+		lastUsed[i] = usage[int(id)].LastUsed.UTC().Format(time.RFC3339Nano)
+	}
+
+	if _, err := db.ExecContext(ctx, recordUsageQuery, pq.Array(ids), pq.Array(counts), pq.Array(lastUsed)); err != nil {
+		return fmt.Errorf("error while recording api keys usage in the database: %s", err.Error())
+	}
+
+	return nil
+}
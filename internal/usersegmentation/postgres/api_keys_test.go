@@ -0,0 +1,332 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/lib/pq"
+)
+
+// apiKeyRowColumns - столбцы строк с ключами API в тестах.
+var apiKeyRowColumns = []string{"id", "name", "prefix", "role", "created_at", "expires_at", "revoked_at", "last_used_at", "usage_count"}
+
+// randomAPIKey - создание случайного ключа API для тестов.
+func randomAPIKey() models.APIKey {
+	key := models.APIKey{
+		ID:         rand.Intn(1000) + 1,
+		Name:       "key " + strconv.Itoa(rand.Int()),
+		Prefix:     "usk_" + strconv.Itoa(rand.Intn(100000000)),
+		Role:       []string{"reader", "editor", "admin"}[rand.Intn(3)],
+		CreatedAt:  time.Now().Add(-time.Duration(rand.Intn(1000)) * time.Hour),
+		UsageCount: rand.Int63n(1000),
+	}
+	if rand.Intn(2) == 0 {
+		expiresAt := time.Now().Add(time.Duration(rand.Intn(1000)) * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+	if rand.Intn(2) == 0 {
+		lastUsedAt := time.Now().Add(-time.Duration(rand.Intn(1000)) * time.Minute)
+		key.LastUsedAt = &lastUsedAt
+	}
+	return key
+}
+
+// addAPIKeyRow - добавление ключа API в строки результата запроса.
+func addAPIKeyRow(rows *sqlmock.Rows, key models.APIKey) *sqlmock.Rows {
+	return rows.AddRow(key.ID, key.Name, key.Prefix, key.Role, key.CreatedAt, key.ExpiresAt, key.RevokedAt, key.LastUsedAt, key.UsageCount)
+}
+
+func Test_addAPIKeyToDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testKey = randomAPIKey()
+			testNew = models.NewAPIKey{Hash: []byte(strconv.Itoa(rand.Int())), Prefix: testKey.Prefix, Name: testKey.Name, Role: testKey.Role, ExpiresAt: testKey.ExpiresAt}
+			testErr = errors.New("test error " + strconv.Itoa(rand.Int()))
+			query   = `INSERT INTO api_keys (hash, prefix, name, role, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING ` + apiKeyColumns + `;`
+		)
+		testKey.LastUsedAt, testKey.UsageCount = nil, 0
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testNew.Hash, testNew.Prefix, testNew.Name, testNew.Role, testNew.ExpiresAt).
+				WillReturnRows(addAPIKeyRow(sqlmock.NewRows(apiKeyRowColumns), testKey))
+
+			key, err := addAPIKeyToDB(context.Background(), db, testNew)
+			if err = checkResponce(err, nil, mock, t); err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(key, testKey) {
+				t.Errorf("got key: %+v\nexpected: %+v\n", key, testKey)
+			}
+		})
+
+		t.Run("error while adding api key", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testNew.Hash, testNew.Prefix, testNew.Name, testNew.Role, testNew.ExpiresAt).WillReturnError(testErr)
+
+			_, err := addAPIKeyToDB(context.Background(), db, testNew)
+			err = checkResponce(err, fmt.Errorf("error while adding api key to the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_getAPIKeysFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id;`
+	for i := 0; i < 10; i++ {
+		var (
+			testKeys = make([]models.APIKey, rand.Intn(10))
+			testErr  = errors.New("test error " + strconv.Itoa(rand.Int()))
+		)
+		rows := sqlmock.NewRows(apiKeyRowColumns)
+		for j := range testKeys {
+			testKeys[j] = randomAPIKey()
+			rows = addAPIKeyRow(rows, testKeys[j])
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectQuery(query).WillReturnRows(rows)
+
+			keys, err := getAPIKeysFromDB(context.Background(), db)
+			if err = checkResponce(err, nil, mock, t); err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(keys, testKeys) {
+				t.Errorf("got keys: %+v\nexpected: %+v\n", keys, testKeys)
+			}
+		})
+
+		t.Run("error while getting api keys", func(t *testing.T) {
+			mock.ExpectQuery(query).WillReturnError(testErr)
+
+			_, err := getAPIKeysFromDB(context.Background(), db)
+			err = checkResponce(err, fmt.Errorf("error while getting api keys from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while iterating over api keys", func(t *testing.T) {
+			mock.ExpectQuery(query).WillReturnRows(addAPIKeyRow(sqlmock.NewRows(apiKeyRowColumns), randomAPIKey()).RowError(0, testErr))
+
+			_, err := getAPIKeysFromDB(context.Background(), db)
+			err = checkResponce(err, fmt.Errorf("error while getting api keys from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_getAPIKeyByHashFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE hash = $1;`
+	for i := 0; i < 10; i++ {
+		var (
+			testKey  = randomAPIKey()
+			testHash = []byte(strconv.Itoa(rand.Int()))
+			testErr  = errors.New("test error " + strconv.Itoa(rand.Int()))
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testHash).WillReturnRows(addAPIKeyRow(sqlmock.NewRows(apiKeyRowColumns), testKey))
+
+			key, err := getAPIKeyByHashFromDB(context.Background(), db, testHash)
+			if err = checkResponce(err, nil, mock, t); err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(key, testKey) {
+				t.Errorf("got key: %+v\nexpected: %+v\n", key, testKey)
+			}
+		})
+
+		t.Run("api key not found", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testHash).WillReturnRows(sqlmock.NewRows(apiKeyRowColumns))
+
+			_, err := getAPIKeyByHashFromDB(context.Background(), db, testHash)
+			if err = checkResponce(err, models.ErrAPIKeyNotFound, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while getting api key", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testHash).WillReturnError(testErr)
+
+			_, err := getAPIKeyByHashFromDB(context.Background(), db, testHash)
+			err = checkResponce(err, fmt.Errorf("error while getting api key from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_revokeAPIKeyInDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1;`
+	for i := 0; i < 10; i++ {
+		var (
+			testID  = rand.Intn(1000) + 1
+			testErr = errors.New("test error " + strconv.Itoa(rand.Int()))
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testID).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			if err := checkResponce(revokeAPIKeyInDB(context.Background(), db, testID), nil, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("api key not found", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			err := revokeAPIKeyInDB(context.Background(), db, testID)
+			if !errors.Is(err, models.ErrAPIKeyNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrAPIKeyNotFound)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while revoking api key", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testID).WillReturnError(testErr)
+
+			err := checkResponce(revokeAPIKeyInDB(context.Background(), db, testID),
+				fmt.Errorf("error while revoking api key %d in the database: %s", testID, testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_setAPIKeyExpiryInDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	query := `UPDATE api_keys SET expires_at = $2 WHERE id = $1;`
+	for i := 0; i < 10; i++ {
+		var (
+			testKey = randomAPIKey()
+			testErr = errors.New("test error " + strconv.Itoa(rand.Int()))
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testKey.ID, testKey.ExpiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			if err := checkResponce(setAPIKeyExpiryInDB(context.Background(), db, testKey.ID, testKey.ExpiresAt), nil, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("api key not found", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testKey.ID, testKey.ExpiresAt).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			err := setAPIKeyExpiryInDB(context.Background(), db, testKey.ID, testKey.ExpiresAt)
+			if !errors.Is(err, models.ErrAPIKeyNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrAPIKeyNotFound)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while updating api key", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testKey.ID, testKey.ExpiresAt).WillReturnError(testErr)
+
+			err := checkResponce(setAPIKeyExpiryInDB(context.Background(), db, testKey.ID, testKey.ExpiresAt),
+				fmt.Errorf("error while updating api key %d in the database: %s", testKey.ID, testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_recordAPIKeyUsageInDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testUsage = make(map[int]models.APIKeyUsage)
+			testErr   = errors.New("test error " + strconv.Itoa(rand.Int()))
+		)
+		for j := 0; j < rand.Intn(10)+1; j++ {
+			testUsage[rand.Intn(1000)+1] = models.APIKeyUsage{Count: rand.Int63n(100) + 1, LastUsed: time.Now().Add(-time.Duration(rand.Intn(1000)) * time.Second)}
+		}
+		ids := make([]int64, 0, len(testUsage))
+		for id := 0; id <= 1000; id++ {
+			if _, ok := testUsage[id]; ok {
+				ids = append(ids, int64(id))
+			}
+		}
+		counts, lastUsed := make([]int64, len(ids)), make([]string, len(ids))
+		for j, id := range ids {
+			counts[j] = testUsage[int(id)].Count
+			lastUsed[j] = testUsage[int(id)].LastUsed.UTC().Format(time.RFC3339Nano)
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectExec(recordUsageQuery).WithArgs(pq.Array(ids), pq.Array(counts), pq.Array(lastUsed)).WillReturnResult(sqlmock.NewResult(0, int64(len(ids))))
+
+			if err := checkResponce(recordAPIKeyUsageInDB(context.Background(), db, testUsage), nil, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("no usage", func(t *testing.T) {
+			if err := checkResponce(recordAPIKeyUsageInDB(context.Background(), db, nil), nil, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while recording usage", func(t *testing.T) {
+			mock.ExpectExec(recordUsageQuery).WithArgs(pq.Array(ids), pq.Array(counts), pq.Array(lastUsed)).WillReturnError(testErr)
+
+			err := checkResponce(recordAPIKeyUsageInDB(context.Background(), db, testUsage),
+				fmt.Errorf("error while recording api keys usage in the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
+	"github.com/lib/pq"
+)
+
+// bulkBatchSize - количество изменений пользователей, применяемых в одной транзакции при массовом изменении.
+const bulkBatchSize = 1000
+
+// ModifyUsers - массовое изменение сегментов пользователей.
+//
+// Принимает: контекст, список изменений пользователей.
+//
+// Возвращает: итог изменения и ошибку.
+func (model *UserSegmentation) ModifyUsers(ctx context.Context, mods []models.UserModification) (models.BulkReport, error) {
+	return modifyUsersInDB(ctx, model.db, mods, model.strictUsers)
+}
+
+// modifyUsersInDB - массовое изменение сегментов пользователей в базе данных.
+// Изменения применяются пачками по bulkBatchSize, каждая пачка - в отдельной транзакции.
+//
+// Принимает: контекст, указатель на базу данных, список изменений пользователей
+// и флаг строгого режима (если true, то изменения незарегистрированных пользователей не применяются).
+//
+// Возвращает: итог изменения и ошибку (при ошибке пачки, применённые до неё, остаются в базе данных).
+func modifyUsersInDB(ctx context.Context, db *sql.DB, mods []models.UserModification, strict bool) (models.BulkReport, error) {
+	report := models.BulkReport{Failed: make([]models.BulkFailure, 0)}
+
+	for start := 0; start < len(mods); start += bulkBatchSize {
+		end := min(start+bulkBatchSize, len(mods))
+		applied, failed, err := modifyBatchInDB(ctx, db, mods[start:end], strict)
+		if err != nil {
+			return report, fmt.Errorf("error after applying %d of %d modifications: %s", report.Applied, len(mods), err.Error())
+		}
+		report.Applied += applied
+		report.Failed = append(report.Failed, failed...)
+		logging.FromContext(ctx).Debug("bulk batch applied to the database", "from", start, "to", end, "applied", applied, "failed", len(failed))
+	}
+
+	return report, nil
+}
+
+// modifyBatchInDB - применение пачки изменений сегментов пользователей в одной транзакции.
+//
+// Изменение пользователя не применяется, если какой-либо из его сегментов не существует (если только в нём не указан флаг Partial),
+// или, в строгом режиме, если пользователь не зарегистрирован.
+// Добавления выполняются одним многострочным запросом до удалений, также выполняемых одним запросом.
+// Если пользователь добавляется в один сегмент несколько раз, то используется время истечения из последнего добавления.
+//
+// Принимает: контекст, указатель на базу данных, пачку изменений пользователей и флаг строгого режима.
+//
+// Возвращает: количество применённых изменений, список неприменённых изменений и ошибку.
+func modifyBatchInDB(ctx context.Context, db *sql.DB, batch []models.UserModification, strict bool) (int, []models.BulkFailure, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, errors.New("error while starting transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	var (
+		qExpired = `WITH expired AS (
+		DELETE FROM user_segment_relations WHERE user_id = ANY($1::integer[]) AND expires_at <= now() RETURNING user_id, segment_id, expires_at
+	)
+	INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+	SELECT expired.user_id, segments.slug, 'remove', expired.expires_at FROM expired JOIN segments ON segments.id = expired.segment_id
+	WHERE segments.deleted_at IS NULL;`
+		qAppend = `WITH added AS (
+		INSERT INTO user_segment_relations (user_id, segment_id, expires_at)
+		SELECT * FROM unnest($1::integer[], $2::integer[], $3::timestamptz[])
+		ON CONFLICT (user_id, segment_id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		RETURNING user_id, segment_id, xmax = 0 AS inserted
+	)
+	INSERT INTO user_segment_history (user_id, segment_slug, operation)
+	SELECT added.user_id, segments.slug, 'add' FROM added JOIN segments ON segments.id = added.segment_id WHERE added.inserted;`
+		qRemove = `WITH removed AS (
+		DELETE FROM user_segment_relations USING unnest($1::integer[], $2::integer[]) AS input (user_id, segment_id)
+		WHERE user_segment_relations.user_id = input.user_id AND user_segment_relations.segment_id = input.segment_id
+		RETURNING user_segment_relations.user_id, user_segment_relations.segment_id
+	)
+	INSERT INTO user_segment_history (user_id, segment_slug, operation)
+	SELECT removed.user_id, segments.slug, 'remove' FROM removed JOIN segments ON segments.id = removed.segment_id;`
+		failed   = make([]models.BulkFailure, 0)
+		accepted = make([]models.UserModification, 0, len(batch))
+		userIDs  = make([]int, 0, len(batch))
+	)
+
+	slugs := make([]string, 0)
+	for _, mod := range batch {
+		for _, addition := range mod.Append {
+			slugs = appendSlug(slugs, addition.Slug)
+		}
+		for _, slug := range mod.Remove {
+			slugs = appendSlug(slugs, slug)
+		}
+	}
+	segmentIDs, err := lockSegmentsInTx(ctx, tx, slugs)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, mod := range batch {
+		modSlugs := make([]string, 0, len(mod.Append)+len(mod.Remove))
+		for _, addition := range mod.Append {
+			modSlugs = appendSlug(modSlugs, addition.Slug)
+		}
+		for _, slug := range mod.Remove {
+			modSlugs = appendSlug(modSlugs, slug)
+		}
+		if unknown := unknownSlugs(modSlugs, segmentIDs); len(unknown) > 0 && !mod.Partial {
+			failed = append(failed, bulkFailure(mod.Value, fmt.Errorf("segments %q: %w", unknown, models.ErrSegmentNotFound)))
+			continue
+		}
+		accepted = append(accepted, mod)
+		userIDs = append(userIDs, mod.Value)
+	}
+
+	if strict {
+		registered, err := lockUsersInTx(ctx, tx, userIDs)
+		if err != nil {
+			return 0, nil, err
+		}
+		filtered := accepted[:0]
+		userIDs = userIDs[:0]
+		for _, mod := range accepted {
+			if !registered[mod.Value] {
+				failed = append(failed, bulkFailure(mod.Value, fmt.Errorf("user %d: %w", mod.Value, models.ErrUserNotFound)))
+				continue
+			}
+			filtered = append(filtered, mod)
+			userIDs = append(userIDs, mod.Value)
+		}
+		accepted = filtered
+	} else if err = registerUsersInTx(ctx, tx, userIDs); err != nil {
+		return 0, nil, err
+	}
+
+	if len(accepted) == 0 {
+		return 0, failed, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, qExpired, pq.Array(userIDs)); err != nil {
+		return 0, nil, fmt.Errorf("error while removing users' expired segments: %s", err.Error())
+	}
+
+	type relation struct{ userID, segmentID int }
+	var (
+		appendIndex      = make(map[relation]int)
+		appendUsers      = make([]int, 0)
+		appendSegments   = make([]int, 0)
+		appendExpiration = make([]*time.Time, 0)
+		removeUsers      = make([]int, 0)
+		removeSegments   = make([]int, 0)
+	)
+	for _, mod := range accepted {
+		for _, addition := range mod.Append {
+			segmentID, ok := segmentIDs[addition.Slug]
+			if !ok {
+				continue
+			}
+			key := relation{mod.Value, segmentID}
+			if i, ok := appendIndex[key]; ok {
+				appendExpiration[i] = addition.ExpiresAt
+				continue
+			}
+			appendIndex[key] = len(appendUsers)
+			appendUsers = append(appendUsers, mod.Value)
+			appendSegments = append(appendSegments, segmentID)
+			appendExpiration = append(appendExpiration, addition.ExpiresAt)
+		}
+		for _, slug := range mod.Remove {
+			segmentID, ok := segmentIDs[slug]
+			if !ok {
+				continue
+			}
+			removeUsers = append(removeUsers, mod.Value)
+			removeSegments = append(removeSegments, segmentID)
+		}
+	}
+
+	if len(appendUsers) > 0 {
+		if _, err = tx.ExecContext(ctx, qAppend, pq.Array(appendUsers), pq.Array(appendSegments), pq.Array(appendExpiration)); err != nil {
+			return 0, nil, fmt.Errorf("error while adding users to the segments: %s", err.Error())
+		}
+	}
+	if len(removeUsers) > 0 {
+		if _, err = tx.ExecContext(ctx, qRemove, pq.Array(removeUsers), pq.Array(removeSegments)); err != nil {
+			return 0, nil, fmt.Errorf("error while removing users from the segments: %s", err.Error())
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, nil, errors.New("error while committing transaction: " + err.Error())
+	}
+
+	return len(accepted), failed, nil
+}
+
+// bulkFailure - создание описания неприменённого изменения пользователя.
+//
+// Принимает: id пользователя и ошибку.
+//
+// Возвращает: описание неприменённого изменения.
+func bulkFailure(id int, err error) models.BulkFailure {
+	return models.BulkFailure{ID: id, Text: err.Error(), Code: models.ErrorCode(err)}
+}
@@ -0,0 +1,260 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func Test_modifyUsersInDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	var queries = []string{
+		`SELECT id, slug FROM segments WHERE slug = ANY($1) AND deleted_at IS NULL FOR SHARE;`,
+		`WITH registered AS (
+			INSERT INTO users (id) SELECT DISTINCT unnest($1::integer[]) ON CONFLICT DO NOTHING RETURNING id
+		), added AS (
+			INSERT INTO user_segment_relations (user_id, segment_id) SELECT registered.id, segments.id FROM registered CROSS JOIN segments
+			WHERE segments.deleted_at IS NULL AND segments.auto_percent > 0 AND ('x' || substr(md5(segments.slug || ':' || registered.id::text), 1, 8))::bit(32)::bigint % 100 < segments.auto_percent
+			ON CONFLICT (user_id, segment_id) DO NOTHING
+			RETURNING user_id, segment_id
+		)
+		INSERT INTO user_segment_history (user_id, segment_slug, operation)
+		SELECT added.user_id, segments.slug, 'add' FROM added JOIN segments ON segments.id = added.segment_id;`,
+		`SELECT id FROM users WHERE id = ANY($1::integer[]) FOR SHARE;`,
+		`WITH expired AS (
+			DELETE FROM user_segment_relations WHERE user_id = ANY($1::integer[]) AND expires_at <= now() RETURNING user_id, segment_id, expires_at
+		)
+		INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+		SELECT expired.user_id, segments.slug, 'remove', expired.expires_at FROM expired JOIN segments ON segments.id = expired.segment_id
+			WHERE segments.deleted_at IS NULL;`,
+		`WITH added AS (
+			INSERT INTO user_segment_relations (user_id, segment_id, expires_at)
+			SELECT * FROM unnest($1::integer[], $2::integer[], $3::timestamptz[])
+			ON CONFLICT (user_id, segment_id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+			RETURNING user_id, segment_id, xmax = 0 AS inserted
+		)
+		INSERT INTO user_segment_history (user_id, segment_slug, operation)
+		SELECT added.user_id, segments.slug, 'add' FROM added JOIN segments ON segments.id = added.segment_id WHERE added.inserted;`,
+		`WITH removed AS (
+			DELETE FROM user_segment_relations USING unnest($1::integer[], $2::integer[]) AS input (user_id, segment_id)
+			WHERE user_segment_relations.user_id = input.user_id AND user_segment_relations.segment_id = input.segment_id
+			RETURNING user_segment_relations.user_id, user_segment_relations.segment_id
+		)
+		INSERT INTO user_segment_history (user_id, segment_slug, operation)
+		SELECT removed.user_id, segments.slug, 'remove' FROM removed JOIN segments ON segments.id = removed.segment_id;`,
+	}
+
+	for i := 0; i < 10; i++ {
+		var (
+			testErrText   = "test error " + strconv.Itoa(rand.Int())
+			testSlugs     = []string{"TEST " + strconv.Itoa(rand.Int()), "TEST " + strconv.Itoa(rand.Int())}
+			testUnknown   = "UNKNOWN " + strconv.Itoa(rand.Int())
+			testIDs       = map[string]int{testSlugs[0]: rand.Int(), testSlugs[1]: rand.Int()}
+			testExpiresAt = time.Now().Add(time.Duration(1+rand.Intn(1000)) * time.Hour)
+			testMods      = make([]models.UserModification, 1+rand.Intn(bulkBatchSize-1))
+			testUsers     = make([]int, len(testMods))
+		)
+		for j := range testMods {
+			testUsers[j] = rand.Int()
+			testMods[j] = models.UserModification{
+				ID:     models.ID{Value: testUsers[j]},
+				Append: []models.SegmentAddition{{Slug: testSlugs[0]}, {Slug: testSlugs[0], ExpiresAt: &testExpiresAt}},
+				Remove: []string{testSlugs[1]},
+			}
+		}
+		segmentRows := func() *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"id", "slug"}).AddRow(testIDs[testSlugs[0]], testSlugs[0]).AddRow(testIDs[testSlugs[1]], testSlugs[1])
+		}
+		// expectChanges - ожидание изменений для пользователей users: добавление в первый сегмент до testExpiresAt и удаление из второго.
+		expectChanges := func(users []int) {
+			appendSegments, removeSegments, expiration := make([]int, len(users)), make([]int, len(users)), make([]*time.Time, len(users))
+			for j := range users {
+				appendSegments[j], removeSegments[j], expiration[j] = testIDs[testSlugs[0]], testIDs[testSlugs[1]], &testExpiresAt
+			}
+			mock.ExpectExec(queries[3]).WithArgs(pq.Array(users)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[4]).WithArgs(pq.Array(users), pq.Array(appendSegments), pq.Array(expiration)).WillReturnResult(sqlmock.NewResult(0, int64(len(users))))
+			mock.ExpectExec(queries[5]).WithArgs(pq.Array(users), pq.Array(removeSegments)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(queries[0]).WithArgs(pq.Array(testSlugs)).WillReturnRows(segmentRows())
+			mock.ExpectExec(queries[1]).WithArgs(pq.Array(testUsers)).WillReturnResult(sqlmock.NewResult(0, 0))
+			expectChanges(testUsers)
+			mock.ExpectCommit()
+
+			report, err := modifyUsersInDB(context.Background(), db, testMods, false)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+			expected := models.BulkReport{Applied: len(testMods), Failed: []models.BulkFailure{}}
+			if !reflect.DeepEqual(report, expected) {
+				t.Errorf("got report = %v, expected %v", report, expected)
+			}
+		})
+
+		t.Run("unknown segments", func(t *testing.T) {
+			mods := append([]models.UserModification{}, testMods...)
+			mods[0] = models.UserModification{ID: models.ID{Value: testUsers[0]}, Append: []models.SegmentAddition{{Slug: testUnknown}}}
+			mods = append(mods, models.UserModification{ID: models.ID{Value: -1}, Append: []models.SegmentAddition{{Slug: testUnknown}}, Partial: true})
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(queries[0]).WithArgs(pq.Array([]string{testUnknown, testSlugs[0], testSlugs[1]})).WillReturnRows(segmentRows())
+			mock.ExpectExec(queries[1]).WithArgs(pq.Array(append(append([]int{}, testUsers[1:]...), -1))).WillReturnResult(sqlmock.NewResult(0, 0))
+			if len(testUsers) > 1 {
+				users := testUsers[1:]
+				appendSegments, removeSegments, expiration := make([]int, len(users)), make([]int, len(users)), make([]*time.Time, len(users))
+				for j := range users {
+					appendSegments[j], removeSegments[j], expiration[j] = testIDs[testSlugs[0]], testIDs[testSlugs[1]], &testExpiresAt
+				}
+				mock.ExpectExec(queries[3]).WithArgs(pq.Array(append(append([]int{}, users...), -1))).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(queries[4]).WithArgs(pq.Array(users), pq.Array(appendSegments), pq.Array(expiration)).WillReturnResult(sqlmock.NewResult(0, int64(len(users))))
+				mock.ExpectExec(queries[5]).WithArgs(pq.Array(users), pq.Array(removeSegments)).WillReturnResult(sqlmock.NewResult(0, 0))
+			} else {
+				mock.ExpectExec(queries[3]).WithArgs(pq.Array([]int{-1})).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			mock.ExpectCommit()
+
+			report, err := modifyUsersInDB(context.Background(), db, mods, false)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+			expected := models.BulkReport{Applied: len(testMods), Failed: []models.BulkFailure{{
+				ID:   testUsers[0],
+				Text: fmt.Sprintf("segments %q: segment not found", []string{testUnknown}),
+				Code: models.CodeSegmentNotFound,
+			}}}
+			if !reflect.DeepEqual(report, expected) {
+				t.Errorf("got report = %v, expected %v", report, expected)
+			}
+		})
+
+		t.Run("strict mode", func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"id"})
+			for _, id := range testUsers[1:] {
+				rows.AddRow(id)
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(queries[0]).WithArgs(pq.Array(testSlugs)).WillReturnRows(segmentRows())
+			mock.ExpectQuery(queries[2]).WithArgs(pq.Array(testUsers)).WillReturnRows(rows)
+			if len(testUsers) > 1 {
+				expectChanges(testUsers[1:])
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			report, err := modifyUsersInDB(context.Background(), db, testMods, true)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+			expected := models.BulkReport{Applied: len(testMods) - 1, Failed: []models.BulkFailure{{
+				ID:   testUsers[0],
+				Text: fmt.Sprintf("user %d: user not found", testUsers[0]),
+				Code: models.CodeUserNotFound,
+			}}}
+			if !reflect.DeepEqual(report, expected) {
+				t.Errorf("got report = %v, expected %v", report, expected)
+			}
+		})
+
+		t.Run("several batches", func(t *testing.T) {
+			mods := make([]models.UserModification, bulkBatchSize+len(testMods))
+			users := make([]int, len(mods))
+			for j := range mods {
+				mods[j] = testMods[j%len(testMods)]
+				users[j] = mods[j].Value
+			}
+
+			for _, batch := range [][]int{users[:bulkBatchSize], users[bulkBatchSize:]} {
+				mock.ExpectBegin()
+				mock.ExpectQuery(queries[0]).WithArgs(pq.Array(testSlugs)).WillReturnRows(segmentRows())
+				mock.ExpectExec(queries[1]).WithArgs(pq.Array(batch)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(queries[3]).WithArgs(pq.Array(batch)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(queries[4]).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(queries[5]).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			}
+
+			report, err := modifyUsersInDB(context.Background(), db, mods, false)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+			if report.Applied != len(mods) {
+				t.Errorf("got %d applied modifications, expected %d", report.Applied, len(mods))
+			}
+		})
+
+		t.Run("error in the second batch", func(t *testing.T) {
+			mods := make([]models.UserModification, bulkBatchSize+1)
+			for j := range mods {
+				mods[j] = testMods[j%len(testMods)]
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(queries[0]).WithArgs(pq.Array(testSlugs)).WillReturnRows(segmentRows())
+			mock.ExpectExec(queries[1]).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[3]).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[4]).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[5]).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectCommit()
+			mock.ExpectBegin()
+			mock.ExpectQuery(queries[0]).WithArgs(pq.Array(testSlugs)).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			report, err := modifyUsersInDB(context.Background(), db, mods, false)
+			err = checkResponce(err, fmt.Errorf("error after applying %d of %d modifications: error while getting segments from the database: %s", bulkBatchSize, len(mods), testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+			if report.Applied != bulkBatchSize {
+				t.Errorf("got %d applied modifications, expected %d", report.Applied, bulkBatchSize)
+			}
+		})
+
+		t.Run("error while adding users to the segments", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(queries[0]).WithArgs(pq.Array(testSlugs)).WillReturnRows(segmentRows())
+			mock.ExpectExec(queries[1]).WithArgs(pq.Array(testUsers)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[3]).WithArgs(pq.Array(testUsers)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[4]).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			_, err := modifyUsersInDB(context.Background(), db, testMods, false)
+			err = checkResponce(err, fmt.Errorf("error after applying 0 of %d modifications: error while adding users to the segments: %s", len(testMods), testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while starting transaction", func(t *testing.T) {
+			mock.ExpectBegin().WillReturnError(errors.New(testErrText))
+
+			_, err := modifyUsersInDB(context.Background(), db, testMods, false)
+			err = checkResponce(err, fmt.Errorf("error after applying 0 of %d modifications: %s%s", len(testMods), startTransactionErrText, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
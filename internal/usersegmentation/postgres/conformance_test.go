@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/storagetest"
+	"github.com/famusovsky/AvitoTestTask/pkg/db"
+)
+
+// Test_Conformance - проверка поведения модели на настоящей базе данных.
+// Запускается, только если задана переменная окружения TEST_POSTGRES_DSN; все данные в базе данных удаляются.
+func Test_Conformance(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	database, err := db.OpenViaDsn(dsn, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	if _, err = MigrateUp(database); err != nil {
+		t.Fatal(err)
+	}
+
+	storagetest.Run(t, func(t *testing.T, strictUsers bool) models.UserSegmentationDbProcessor {
+		q := `TRUNCATE segments, users, user_segment_relations, user_segment_history, api_keys RESTART IDENTITY;`
+		if _, err := database.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+
+		model, err := GetModel(database, false, strictUsers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return model
+	})
+
+	storagetest.RunAPIKeys(t, func(t *testing.T) models.APIKeyStore {
+		if _, err := database.Exec(`TRUNCATE api_keys RESTART IDENTITY;`); err != nil {
+			t.Fatal(err)
+		}
+		return GetAPIKeyStore(database)
+	})
+}
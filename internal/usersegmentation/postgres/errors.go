@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/lib/pq"
+)
+
+// Коды ошибок PostgreSQL, переводимые в ошибки models (см. https://www.postgresql.org/docs/current/errcodes-appendix.html).
+const (
+	uniqueViolation = pq.ErrorCode("23505") // uniqueViolation - нарушение ограничения уникальности.
+	checkViolation  = pq.ErrorCode("23514") // checkViolation - нарушение ограничения CHECK.
+	undefinedTable  = pq.ErrorCode("42P01") // undefinedTable - обращение к несуществующей таблице.
+)
+
+// domainError - перевод ошибки PostgreSQL в ошибку models.
+//
+// Принимает: ошибку, полученную от базы данных.
+//
+// Возвращает: соответствующую ошибку models или nil, если такой нет.
+func domainError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil
+	}
+
+	switch {
+	case pqErr.Code == uniqueViolation && pqErr.Table == "segments":
+		return models.ErrSegmentExists
+	case pqErr.Code == checkViolation && pqErr.Constraint == "segments_slug_check":
+		return models.ErrInvalidSlug
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// CheckHealth - проверка доступности базы данных и соответствия версии её схемы версии последней встроенной миграции.
+//
+// Принимает: контекст, указатель на базу данных.
+//
+// Возвращает: ошибку (nil, если база данных готова к работе).
+func CheckHealth(ctx context.Context, db *sql.DB) error {
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("error while pinging the database: %s", err)
+	}
+
+	return checkSchemaVersion(ctx, db, SchemaVersion())
+}
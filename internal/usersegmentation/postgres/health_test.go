@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func Test_CheckHealth(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			other       = SchemaVersion() + 1 + rand.Intn(100)
+			testErrText = "test error " + strconv.Itoa(rand.Int())
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectPing()
+			mock.ExpectQuery(migrationQueries[2]).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(SchemaVersion()))
+
+			if err = checkResponce(CheckHealth(context.Background(), db), nil, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("database is unavailable", func(t *testing.T) {
+			mock.ExpectPing().WillReturnError(errors.New(testErrText))
+
+			expectedErr := fmt.Errorf("error while pinging the database: %s", testErrText)
+			if err = checkResponce(CheckHealth(context.Background(), db), expectedErr, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("wrong schema version", func(t *testing.T) {
+			mock.ExpectPing()
+			mock.ExpectQuery(migrationQueries[2]).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(other))
+
+			expectedErr := fmt.Errorf("schema version is %d, expected %d: run 'migrate up' to apply migrations", other, SchemaVersion())
+			if err = checkResponce(CheckHealth(context.Background(), db), expectedErr, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationsList - миграции схемы базы данных, встроенные в исполняемый файл, упорядоченные по версии.
+var migrationsList = mustLoadMigrations(migrationFiles, "migrations")
+
+// migrationName - формат имени файла миграции: <версия>_<название>.<up|down>.sql.
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLockID - ключ advisory lock, под которым применяются миграции.
+const migrationLockID = 2023_08_31
+
+// migration - версионированное изменение схемы базы данных.
+type migration struct {
+	version int    // version - версия схемы после применения миграции.
+	name    string // name - название миграции.
+	up      string // up - запрос, применяющий миграцию.
+	down    string // down - запрос, отменяющий миграцию.
+}
+
+// MigrationStatus - состояние миграции схемы базы данных.
+type MigrationStatus struct {
+	Version   int        // Version - версия схемы после применения миграции.
+	Name      string     // Name - название миграции.
+	AppliedAt *time.Time // AppliedAt - время применения миграции (nil, если миграция не применена).
+}
+
+// SchemaVersion - получение версии схемы базы данных, которую ожидает модель.
+//
+// Возвращает: версию схемы.
+func SchemaVersion() int {
+	return migrationsList[len(migrationsList)-1].version
+}
+
+// MigrateUp - применение всех неприменённых миграций схемы базы данных.
+//
+// Принимает: указатель на базу данных.
+//
+// Возвращает: версию схемы после применения миграций и ошибку.
+func MigrateUp(db *sql.DB) (int, error) {
+	return migrateUp(db, migrationsList)
+}
+
+// MigrateDown - отмена последней применённой миграции схемы базы данных.
+//
+// Принимает: указатель на базу данных.
+//
+// Возвращает: версию схемы после отмены миграции и ошибку.
+func MigrateDown(db *sql.DB) (int, error) {
+	return migrateDown(db, migrationsList)
+}
+
+// GetMigrationStatus - получение состояния миграций схемы базы данных.
+//
+// Принимает: указатель на базу данных.
+//
+// Возвращает: состояния всех известных миграций и ошибку.
+func GetMigrationStatus(db *sql.DB) ([]MigrationStatus, error) {
+	return getMigrationStatus(db, migrationsList)
+}
+
+const (
+	qLockMigrations = `SELECT pg_advisory_xact_lock($1);`
+	qCreateVersions = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`
+	qSchemaVersion = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`
+)
+
+// migrateUp - применение неприменённых миграций в одной транзакции.
+//
+// Принимает: указатель на базу данных и упорядоченный список миграций.
+//
+// Возвращает: версию схемы после применения миграций и ошибку.
+func migrateUp(db *sql.DB, migrations []migration) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error while starting transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	version, err := lockVersionInTx(tx)
+	if err != nil {
+		return 0, err
+	}
+	if version > len(migrations) {
+		return 0, fmt.Errorf("schema version %d is newer than the latest known migration %d", version, len(migrations))
+	}
+
+	for _, m := range migrations[version:] {
+		if _, err = tx.Exec(m.up); err != nil {
+			return 0, fmt.Errorf("error while applying migration %04d_%s: %s", m.version, m.name, err)
+		}
+		if _, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`, m.version, m.name); err != nil {
+			return 0, fmt.Errorf("error while recording migration %04d_%s: %s", m.version, m.name, err)
+		}
+		version = m.version
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error while committing transaction: %s", err)
+	}
+
+	return version, nil
+}
+
+// migrateDown - отмена последней применённой миграции.
+//
+// Принимает: указатель на базу данных и упорядоченный список миграций.
+//
+// Возвращает: версию схемы после отмены миграции и ошибку.
+func migrateDown(db *sql.DB, migrations []migration) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error while starting transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	version, err := lockVersionInTx(tx)
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, errors.New("no applied migrations to revert")
+	}
+	if version > len(migrations) {
+		return 0, fmt.Errorf("schema version %d is newer than the latest known migration %d", version, len(migrations))
+	}
+
+	m := migrations[version-1]
+	if _, err = tx.Exec(m.down); err != nil {
+		return 0, fmt.Errorf("error while reverting migration %04d_%s: %s", m.version, m.name, err)
+	}
+	if _, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1;`, m.version); err != nil {
+		return 0, fmt.Errorf("error while recording migration %04d_%s: %s", m.version, m.name, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error while committing transaction: %s", err)
+	}
+
+	return version - 1, nil
+}
+
+// lockVersionInTx - блокировка миграций от параллельного применения и получение текущей версии схемы.
+//
+// Принимает: транзакцию.
+//
+// Возвращает: текущую версию схемы и ошибку.
+func lockVersionInTx(tx *sql.Tx) (int, error) {
+	if _, err := tx.Exec(qLockMigrations, migrationLockID); err != nil {
+		return 0, fmt.Errorf("error while locking migrations: %s", err)
+	}
+	if _, err := tx.Exec(qCreateVersions); err != nil {
+		return 0, fmt.Errorf("error while creating schema_migrations table: %s", err)
+	}
+
+	var version int
+	if err := tx.QueryRow(qSchemaVersion).Scan(&version); err != nil {
+		return 0, fmt.Errorf("error while getting schema version: %s", err)
+	}
+
+	return version, nil
+}
+
+// getMigrationStatus - получение состояния миграций.
+//
+// Принимает: указатель на базу данных и упорядоченный список миграций.
+//
+// Возвращает: состояния миграций и ошибку.
+func getMigrationStatus(db *sql.DB, migrations []migration) ([]MigrationStatus, error) {
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Version: m.version, Name: m.name}
+	}
+
+	rows, err := db.Query(`SELECT version, name, applied_at FROM schema_migrations ORDER BY version;`)
+	if isUndefinedTable(err) {
+		return statuses, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while getting applied migrations: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version   int
+			name      string
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &name, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error while getting applied migrations: %s", err)
+		}
+		if version < 1 || version > len(statuses) {
+			statuses = append(statuses, MigrationStatus{Version: version, Name: name, AppliedAt: &appliedAt})
+			continue
+		}
+		statuses[version-1].AppliedAt = &appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while getting applied migrations: %s", err)
+	}
+
+	return statuses, nil
+}
+
+// checkSchemaVersion - проверка соответствия версии схемы базы данных ожидаемой.
+//
+// Принимает: контекст, указатель на базу данных и ожидаемую версию схемы.
+//
+// Возвращает: ошибку.
+func checkSchemaVersion(ctx context.Context, db *sql.DB, expected int) error {
+	var version int
+	err := db.QueryRowContext(ctx, qSchemaVersion).Scan(&version)
+	if isUndefinedTable(err) {
+		version, err = 0, nil
+	}
+	if err != nil {
+		return fmt.Errorf("error while getting schema version: %s", err)
+	}
+
+	if version != expected {
+		return fmt.Errorf("schema version is %d, expected %d: run 'migrate up' to apply migrations", version, expected)
+	}
+
+	return nil
+}
+
+// isUndefinedTable - проверка, является ли ошибка обращением к несуществующей таблице.
+//
+// Принимает: ошибку, полученную от базы данных.
+//
+// Возвращает: true, если таблица не существует.
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == undefinedTable
+}
+
+// loadMigrations - чтение миграций из файловой системы.
+//
+// Принимает: файловую систему и каталог с миграциями.
+//
+// Возвращает: упорядоченный по версии список миграций и ошибку.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading migrations: %s", err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %q does not match <version>_<name>.<up|down>.sql", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		}
+		if m.name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q", version, m.name, match[2])
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error while reading migration %q: %s", entry.Name(), err)
+		}
+		if match[3] == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	if len(migrations) == 0 {
+		return nil, errors.New("no migrations found")
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration versions must start from 1 without gaps, got %d at position %d", m.version, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// mustLoadMigrations - чтение встроенных миграций.
+// Завершается паникой, если миграции некорректны.
+//
+// Принимает: файловую систему и каталог с миграциями.
+//
+// Возвращает: упорядоченный по версии список миграций.
+func mustLoadMigrations(fsys fs.FS, dir string) []migration {
+	migrations, err := loadMigrations(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	return migrations
+}
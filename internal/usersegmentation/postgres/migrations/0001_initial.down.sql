@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_segment_relations;
+DROP TABLE IF EXISTS segments;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS segments (
+	id SERIAL UNIQUE,
+	slug TEXT PRIMARY KEY CHECK (slug <> '')
+);
+
+CREATE TABLE IF NOT EXISTS user_segment_relations (
+	user_id INTEGER,
+	segment_id INTEGER,
+	CONSTRAINT unique_user_segment UNIQUE (user_id, segment_id)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_segment_history (
+	user_id INTEGER NOT NULL,
+	segment_slug TEXT NOT NULL,
+	operation TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS user_segment_history_created_at ON user_segment_history (created_at);
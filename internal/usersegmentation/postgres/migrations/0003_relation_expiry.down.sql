@@ -0,0 +1,5 @@
+DELETE FROM user_segment_relations WHERE expires_at <= now();
+
+DROP INDEX IF EXISTS user_segment_relations_expires_at;
+
+ALTER TABLE user_segment_relations DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,3 @@
+ALTER TABLE user_segment_relations ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS user_segment_relations_expires_at ON user_segment_relations (expires_at) WHERE expires_at IS NOT NULL;
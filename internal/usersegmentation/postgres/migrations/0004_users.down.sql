@@ -0,0 +1,3 @@
+ALTER TABLE segments DROP COLUMN IF EXISTS auto_percent;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO users (id) SELECT DISTINCT user_id FROM user_segment_relations ON CONFLICT DO NOTHING;
+
+ALTER TABLE segments ADD COLUMN IF NOT EXISTS auto_percent INTEGER NOT NULL DEFAULT 0 CHECK (auto_percent BETWEEN 0 AND 100);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS user_segment_relations_segment_id_user_id;
+
+ALTER TABLE user_segment_relations DROP COLUMN IF EXISTS created_at;
+
+ALTER TABLE segments DROP COLUMN IF EXISTS owner_team;
+ALTER TABLE segments DROP COLUMN IF EXISTS description;
+ALTER TABLE segments DROP COLUMN IF EXISTS created_at;
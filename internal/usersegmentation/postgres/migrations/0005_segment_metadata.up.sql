@@ -0,0 +1,7 @@
+ALTER TABLE segments ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE segments ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE segments ADD COLUMN IF NOT EXISTS owner_team TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE user_segment_relations ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS user_segment_relations_segment_id_user_id ON user_segment_relations (segment_id, user_id);
@@ -0,0 +1,6 @@
+DELETE FROM user_segment_relations WHERE segment_id IN (SELECT id FROM segments WHERE deleted_at IS NOT NULL);
+DELETE FROM segments WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS segments_deleted_at;
+
+ALTER TABLE segments DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE segments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS segments_deleted_at ON segments (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL CHECK (name <> ''),
+	prefix TEXT NOT NULL,
+	hash BYTEA NOT NULL UNIQUE,
+	role TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	usage_count BIGINT NOT NULL DEFAULT 0
+);
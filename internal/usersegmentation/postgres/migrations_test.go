@@ -0,0 +1,356 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var migrationQueries = []string{
+	`SELECT pg_advisory_xact_lock($1);`,
+	`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`,
+	`SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`,
+	`INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`,
+	`DELETE FROM schema_migrations WHERE version = $1;`,
+	`SELECT version, name, applied_at FROM schema_migrations ORDER BY version;`,
+}
+
+// testMigrations - создание списка из n тестовых миграций.
+func testMigrations(n int) []migration {
+	migrations := make([]migration, n)
+	for i := range migrations {
+		migrations[i] = migration{
+			version: i + 1,
+			name:    fmt.Sprintf("test_%d", rand.Int()),
+			up:      fmt.Sprintf("CREATE TABLE test_%d (id INTEGER);", i+1),
+			down:    fmt.Sprintf("DROP TABLE test_%d;", i+1),
+		}
+	}
+	return migrations
+}
+
+// expectVersion - ожидание блокировки миграций и получения текущей версии схемы.
+func expectVersion(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(migrationQueries[0]).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(migrationQueries[1]).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(migrationQueries[2]).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+func Test_loadMigrations(t *testing.T) {
+	t.Run("embedded migrations", func(t *testing.T) {
+		migrations, err := loadMigrations(migrationFiles, "migrations")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != SchemaVersion() {
+			t.Errorf("got %d migrations, expected %d", len(migrations), SchemaVersion())
+		}
+		for i, m := range migrations {
+			if m.version != i+1 || m.up == "" || m.down == "" {
+				t.Errorf("migration %d is not ok: %+v", i+1, m)
+			}
+		}
+	})
+
+	t.Run("normal case", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"m/0002_second.up.sql":   {Data: []byte("UP 2")},
+			"m/0002_second.down.sql": {Data: []byte("DOWN 2")},
+			"m/0001_first.up.sql":    {Data: []byte("UP 1")},
+			"m/0001_first.down.sql":  {Data: []byte("DOWN 1")},
+		}
+		expected := []migration{
+			{version: 1, name: "first", up: "UP 1", down: "DOWN 1"},
+			{version: 2, name: "second", up: "UP 2", down: "DOWN 2"},
+		}
+
+		got, err := loadMigrations(fsys, "m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("got migrations: %+v\nexpected: %+v\n", got, expected)
+		}
+	})
+
+	errCases := []struct {
+		name     string
+		fsys     fstest.MapFS
+		expected error
+	}{
+		{
+			name:     "wrong file name",
+			fsys:     fstest.MapFS{"m/first.sql": {Data: []byte("UP")}},
+			expected: errors.New(`migration file "first.sql" does not match <version>_<name>.<up|down>.sql`),
+		},
+		{
+			name:     "missing down file",
+			fsys:     fstest.MapFS{"m/0001_first.up.sql": {Data: []byte("UP")}},
+			expected: errors.New("migration 0001_first must have both up and down files"),
+		},
+		{
+			name: "different names",
+			fsys: fstest.MapFS{
+				"m/0001_first.down.sql": {Data: []byte("DOWN")},
+				"m/0001_second.up.sql":  {Data: []byte("UP")},
+			},
+			expected: errors.New(`migration 1 has different names: "first" and "second"`),
+		},
+		{
+			name: "gap in versions",
+			fsys: fstest.MapFS{
+				"m/0002_second.up.sql":   {Data: []byte("UP")},
+				"m/0002_second.down.sql": {Data: []byte("DOWN")},
+			},
+			expected: errors.New("migration versions must start from 1 without gaps, got 2 at position 1"),
+		},
+		{
+			name:     "no migrations",
+			fsys:     fstest.MapFS{"m": {Mode: fs.ModeDir}},
+			expected: errors.New("no migrations found"),
+		},
+	}
+
+	for _, c := range errCases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := loadMigrations(c.fsys, "m")
+			if err == nil || err.Error() != c.expected.Error() {
+				t.Errorf("got err = %v\nexpected err = %v\n", err, c.expected)
+			}
+		})
+	}
+}
+
+func Test_migrateUp(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			migrations  = testMigrations(1 + rand.Intn(10))
+			version     = rand.Intn(len(migrations) + 1)
+			testErrText = "test error " + strconv.Itoa(rand.Int())
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			expectVersion(mock, version)
+			for _, m := range migrations[version:] {
+				mock.ExpectExec(m.up).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(migrationQueries[3]).WithArgs(m.version, m.name).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			got, err := migrateUp(db, migrations)
+			if err = checkResponce(err, nil, mock, t); err != nil {
+				t.Error(err)
+			}
+			if got != len(migrations) {
+				t.Errorf("got version %d, expected %d", got, len(migrations))
+			}
+		})
+
+		t.Run("schema is newer than migrations", func(t *testing.T) {
+			newer := len(migrations) + 1 + rand.Intn(10)
+			expectVersion(mock, newer)
+			mock.ExpectRollback()
+
+			_, err := migrateUp(db, migrations)
+			expected := fmt.Errorf("schema version %d is newer than the latest known migration %d", newer, len(migrations))
+			if err = checkResponce(err, expected, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		if version == len(migrations) {
+			continue
+		}
+
+		t.Run("error while applying migration", func(t *testing.T) {
+			m := migrations[version]
+			expectVersion(mock, version)
+			mock.ExpectExec(m.up).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			_, err := migrateUp(db, migrations)
+			expected := fmt.Errorf("error while applying migration %04d_%s: %s", m.version, m.name, testErrText)
+			if err = checkResponce(err, expected, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	t.Run("error while locking migrations", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(migrationQueries[0]).WithArgs(migrationLockID).WillReturnError(errors.New("test error"))
+		mock.ExpectRollback()
+
+		_, err := migrateUp(db, testMigrations(1))
+		if err = checkResponce(err, errors.New("error while locking migrations: test error"), mock, t); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func Test_migrateDown(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			migrations  = testMigrations(1 + rand.Intn(10))
+			version     = 1 + rand.Intn(len(migrations))
+			m           = migrations[version-1]
+			testErrText = "test error " + strconv.Itoa(rand.Int())
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			expectVersion(mock, version)
+			mock.ExpectExec(m.down).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(migrationQueries[4]).WithArgs(m.version).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			got, err := migrateDown(db, migrations)
+			if err = checkResponce(err, nil, mock, t); err != nil {
+				t.Error(err)
+			}
+			if got != version-1 {
+				t.Errorf("got version %d, expected %d", got, version-1)
+			}
+		})
+
+		t.Run("no applied migrations", func(t *testing.T) {
+			expectVersion(mock, 0)
+			mock.ExpectRollback()
+
+			_, err := migrateDown(db, migrations)
+			if err = checkResponce(err, errors.New("no applied migrations to revert"), mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while reverting migration", func(t *testing.T) {
+			expectVersion(mock, version)
+			mock.ExpectExec(m.down).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			_, err := migrateDown(db, migrations)
+			expected := fmt.Errorf("error while reverting migration %04d_%s: %s", m.version, m.name, testErrText)
+			if err = checkResponce(err, expected, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_getMigrationStatus(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			migrations = testMigrations(1 + rand.Intn(10))
+			version    = rand.Intn(len(migrations) + 1)
+			rows       = sqlmock.NewRows([]string{"version", "name", "applied_at"})
+			expected   = make([]MigrationStatus, len(migrations))
+		)
+		for j, m := range migrations {
+			expected[j] = MigrationStatus{Version: m.version, Name: m.name}
+			if j < version {
+				appliedAt := time.Unix(rand.Int63n(1<<32), 0)
+				expected[j].AppliedAt = &appliedAt
+				rows.AddRow(m.version, m.name, appliedAt)
+			}
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectQuery(migrationQueries[5]).WillReturnRows(rows)
+
+			got, err := getMigrationStatus(db, migrations)
+			if err = checkResponce(err, nil, mock, t); err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("got statuses: %+v\nexpected: %+v\n", got, expected)
+			}
+		})
+
+		t.Run("no schema_migrations table", func(t *testing.T) {
+			mock.ExpectQuery(migrationQueries[5]).WillReturnError(&pq.Error{Code: undefinedTable})
+
+			got, err := getMigrationStatus(db, migrations)
+			if err = checkResponce(err, nil, mock, t); err != nil {
+				t.Error(err)
+			}
+			for _, status := range got {
+				if status.AppliedAt != nil {
+					t.Errorf("migration %d is marked as applied", status.Version)
+				}
+			}
+		})
+	}
+}
+
+func Test_checkSchemaVersion(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			expected = 1 + rand.Intn(100)
+			other    = expected + 1 + rand.Intn(100)
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectQuery(migrationQueries[2]).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(expected))
+
+			if err = checkResponce(checkSchemaVersion(context.Background(), db, expected), nil, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("wrong version", func(t *testing.T) {
+			mock.ExpectQuery(migrationQueries[2]).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(other))
+
+			expectedErr := fmt.Errorf("schema version is %d, expected %d: run 'migrate up' to apply migrations", other, expected)
+			if err = checkResponce(checkSchemaVersion(context.Background(), db, expected), expectedErr, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("no schema_migrations table", func(t *testing.T) {
+			mock.ExpectQuery(migrationQueries[2]).WillReturnError(&pq.Error{Code: undefinedTable})
+
+			expectedErr := fmt.Errorf("schema version is 0, expected %d: run 'migrate up' to apply migrations", expected)
+			if err = checkResponce(checkSchemaVersion(context.Background(), db, expected), expectedErr, mock, t); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// segmentColumns - столбцы, выбираемые при получении сегментов.
+// Количество пользователей в сегменте не учитывает истёкшие членства.
+const segmentColumns = `segments.id, segments.slug, segments.created_at, segments.description, segments.owner_team, segments.auto_percent,
+	(SELECT COUNT(*) FROM user_segment_relations
+	WHERE user_segment_relations.segment_id = segments.id
+	AND (user_segment_relations.expires_at IS NULL OR user_segment_relations.expires_at > now()))`
+
+// GetSegments - получение списка сегментов.
+//
+// Принимает: контекст, префикс названия сегментов, максимальное количество сегментов и смещение.
+//
+// Возвращает: список сегментов и ошибку.
+func (model *UserSegmentation) GetSegments(ctx context.Context, prefix string, limit int, offset int) ([]models.Segment, error) {
+	return getSegmentsFromDB(ctx, model.db, prefix, limit, offset)
+}
+
+// GetSegment - получение сегмента.
+//
+// Принимает: контекст, название сегмента.
+//
+// Возвращает: сегмент и ошибку.
+func (model *UserSegmentation) GetSegment(ctx context.Context, slug string) (models.Segment, error) {
+	return getSegmentFromDB(ctx, model.db, slug)
+}
+
+// UpdateSegment - изменение метаданных сегмента.
+//
+// Принимает: контекст, название сегмента и изменения.
+//
+// Возвращает: ошибку.
+func (model *UserSegmentation) UpdateSegment(ctx context.Context, slug string, update models.SegmentUpdate) error {
+	return updateSegmentInDB(ctx, model.db, slug, update)
+}
+
+// GetSegmentMembers - получение пользователей, состоящих в сегменте.
+//
+// Принимает: контекст, название сегмента, курсор, максимальное количество пользователей и функцию-обработчик.
+//
+// Возвращает: ошибку.
+func (model *UserSegmentation) GetSegmentMembers(ctx context.Context, slug string, after int, limit int, fn func(models.Member) error) error {
+	return getSegmentMembersFromDB(ctx, model.db, slug, after, limit, fn)
+}
+
+// getSegmentsFromDB - получение списка сегментов из базы данных.
+//
+// Принимает: контекст, указатель на базу данных, префикс названия сегментов, максимальное количество сегментов и смещение.
+//
+// Возвращает: список сегментов, упорядоченный по названию, и ошибку.
+func getSegmentsFromDB(ctx context.Context, db *sql.DB, prefix string, limit int, offset int) ([]models.Segment, error) {
+	q := `SELECT ` + segmentColumns + ` FROM segments WHERE segments.deleted_at IS NULL AND starts_with(segments.slug, $1) ORDER BY segments.slug LIMIT $2 OFFSET $3;`
+	rows, err := db.QueryContext(ctx, q, prefix, limit, offset)
+	if err != nil {
+		return []models.Segment{}, fmt.Errorf("error while getting segments from the database: %s", err.Error())
+	}
+	defer rows.Close()
+
+	segments := make([]models.Segment, 0)
+	for rows.Next() {
+		segment, err := scanSegment(rows)
+		if err != nil {
+			return []models.Segment{}, fmt.Errorf("error while getting segments from the database: %s", err.Error())
+		}
+		segments = append(segments, segment)
+	}
+	if err = rows.Err(); err != nil {
+		return []models.Segment{}, fmt.Errorf("error while getting segments from the database: %s", err.Error())
+	}
+
+	return segments, nil
+}
+
+// getSegmentFromDB - получение сегмента из базы данных.
+//
+// Принимает: контекст, указатель на базу данных и название сегмента.
+//
+// Возвращает: сегмент и ошибку (models.ErrSegmentNotFound, если сегмент не существует).
+func getSegmentFromDB(ctx context.Context, db *sql.DB, slug string) (models.Segment, error) {
+	q := `SELECT ` + segmentColumns + ` FROM segments WHERE segments.slug = $1 AND segments.deleted_at IS NULL;`
+	segment, err := scanSegment(db.QueryRowContext(ctx, q, slug))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Segment{}, fmt.Errorf("segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+	if err != nil {
+		return models.Segment{}, fmt.Errorf("error while getting segment %q from the database: %s", slug, err.Error())
+	}
+
+	return segment, nil
+}
+
+// updateSegmentInDB - изменение метаданных сегмента в базе данных.
+//
+// Принимает: контекст, указатель на базу данных, название сегмента и изменения.
+//
+// Возвращает: ошибку (models.ErrSegmentNotFound, если сегмент не существует).
+func updateSegmentInDB(ctx context.Context, db *sql.DB, slug string, update models.SegmentUpdate) error {
+	q := `UPDATE segments SET description = COALESCE($2, description), owner_team = COALESCE($3, owner_team) WHERE slug = $1 AND deleted_at IS NULL;`
+	errStr := "error while updating segment %q in the database: %s"
+	res, err := db.ExecContext(ctx, q, slug, update.Description, update.OwnerTeam)
+	if err != nil {
+		return fmt.Errorf(errStr, slug, err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf(errStr, slug, err.Error())
+	}
+	if n == 0 {
+		return fmt.Errorf("segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+
+	return nil
+}
+
+// getSegmentMembersFromDB - получение пользователей, состоящих в сегменте, из базы данных.
+// Строки читаются и передаются в fn по одной, без накопления всего результата в памяти.
+//
+// Принимает: контекст, указатель на базу данных, название сегмента, id пользователя, после которого начинать,
+// максимальное количество пользователей (0 - без ограничения) и функцию-обработчик.
+//
+// Возвращает: ошибку (models.ErrSegmentNotFound, если сегмент не существует).
+func getSegmentMembersFromDB(ctx context.Context, db *sql.DB, slug string, after int, limit int, fn func(models.Member) error) error {
+	var segmentID int
+	err := db.QueryRowContext(ctx, `SELECT id FROM segments WHERE slug = $1 AND deleted_at IS NULL;`, slug).Scan(&segmentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error while getting segment %q from the database: %s", slug, err.Error())
+	}
+
+	q := `SELECT user_id, created_at, expires_at FROM user_segment_relations
+	WHERE segment_id = $1 AND user_id > $2::bigint AND (expires_at IS NULL OR expires_at > now())
+	ORDER BY user_id LIMIT NULLIF($3, 0);`
+	errStr := "error while getting members of segment %q from the database: %s"
+	rows, err := db.QueryContext(ctx, q, segmentID, after, limit)
+	if err != nil {
+		return fmt.Errorf(errStr, slug, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member models.Member
+		if err = rows.Scan(&member.UserID, &member.AddedAt, &member.ExpiresAt); err != nil {
+			return fmt.Errorf(errStr, slug, err.Error())
+		}
+		if err = fn(member); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf(errStr, slug, err.Error())
+	}
+
+	return nil
+}
+
+// scanner - интерфейс, объединяющий *sql.Row и *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSegment - чтение сегмента, выбранного столбцами segmentColumns.
+//
+// Принимает: строку результата запроса.
+//
+// Возвращает: сегмент и ошибку.
+func scanSegment(row scanner) (models.Segment, error) {
+	var segment models.Segment
+	err := row.Scan(&segment.ID, &segment.Slug, &segment.CreatedAt, &segment.Description, &segment.OwnerTeam, &segment.AutoPercent, &segment.Members)
+	return segment, err
+}
@@ -0,0 +1,316 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+var segmentRowColumns = []string{"id", "slug", "created_at", "description", "owner_team", "auto_percent", "members"}
+
+func Test_getSegmentsFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testPrefix   = "TEST" + strconv.Itoa(rand.Intn(10))
+			testLimit    = 1 + rand.Intn(1000)
+			testOffset   = rand.Intn(1000)
+			testErr      = errors.New("test error " + strconv.Itoa(testLimit))
+			testSegments = make([]models.Segment, rand.Intn(15))
+			query        = `SELECT segments.id, segments.slug, segments.created_at, segments.description, segments.owner_team, segments.auto_percent,
+				(SELECT COUNT(*) FROM user_segment_relations
+				WHERE user_segment_relations.segment_id = segments.id
+				AND (user_segment_relations.expires_at IS NULL OR user_segment_relations.expires_at > now()))
+			FROM segments WHERE segments.deleted_at IS NULL AND starts_with(segments.slug, $1) ORDER BY segments.slug LIMIT $2 OFFSET $3;`
+		)
+
+		for j := 0; j < len(testSegments); j++ {
+			testSegments[j] = randomSegment(testPrefix + strconv.Itoa(j))
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			rows := sqlmock.NewRows(segmentRowColumns)
+			for _, segment := range testSegments {
+				rows.AddRow(segment.ID, segment.Slug, segment.CreatedAt, segment.Description, segment.OwnerTeam, segment.AutoPercent, segment.Members)
+			}
+			mock.ExpectQuery(query).WithArgs(testPrefix, testLimit, testOffset).WillReturnRows(rows)
+
+			segments, err := getSegmentsFromDB(context.Background(), db, testPrefix, testLimit, testOffset)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if reflect.DeepEqual(segments, testSegments) == false {
+				t.Fatalf("got segments = %v, expected %v", segments, testSegments)
+			}
+		})
+
+		t.Run("error while getting segments from the database", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testPrefix, testLimit, testOffset).WillReturnError(testErr)
+
+			_, err := getSegmentsFromDB(context.Background(), db, testPrefix, testLimit, testOffset)
+			err = checkResponce(err, fmt.Errorf("error while getting segments from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while iterating over segments", func(t *testing.T) {
+			segment := randomSegment(testPrefix)
+			rows := sqlmock.NewRows(segmentRowColumns).
+				AddRow(segment.ID, segment.Slug, segment.CreatedAt, segment.Description, segment.OwnerTeam, segment.AutoPercent, segment.Members).
+				RowError(0, testErr)
+			mock.ExpectQuery(query).WithArgs(testPrefix, testLimit, testOffset).WillReturnRows(rows)
+
+			_, err := getSegmentsFromDB(context.Background(), db, testPrefix, testLimit, testOffset)
+			err = checkResponce(err, fmt.Errorf("error while getting segments from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_getSegmentFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testSegment = randomSegment("TEST " + strconv.Itoa(rand.Int()))
+			testErr     = errors.New("test error " + strconv.Itoa(testSegment.ID))
+			query       = `SELECT segments.id, segments.slug, segments.created_at, segments.description, segments.owner_team, segments.auto_percent,
+				(SELECT COUNT(*) FROM user_segment_relations
+				WHERE user_segment_relations.segment_id = segments.id
+				AND (user_segment_relations.expires_at IS NULL OR user_segment_relations.expires_at > now()))
+			FROM segments WHERE segments.slug = $1 AND segments.deleted_at IS NULL;`
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			rows := sqlmock.NewRows(segmentRowColumns).AddRow(testSegment.ID, testSegment.Slug, testSegment.CreatedAt,
+				testSegment.Description, testSegment.OwnerTeam, testSegment.AutoPercent, testSegment.Members)
+			mock.ExpectQuery(query).WithArgs(testSegment.Slug).WillReturnRows(rows)
+
+			segment, err := getSegmentFromDB(context.Background(), db, testSegment.Slug)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if reflect.DeepEqual(segment, testSegment) == false {
+				t.Fatalf("got segment = %v, expected %v", segment, testSegment)
+			}
+		})
+
+		t.Run("segment not found", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testSegment.Slug).WillReturnRows(sqlmock.NewRows(segmentRowColumns))
+
+			_, err := getSegmentFromDB(context.Background(), db, testSegment.Slug)
+			if !errors.Is(err, models.ErrSegmentNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while getting segment from the database", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testSegment.Slug).WillReturnError(testErr)
+
+			_, err := getSegmentFromDB(context.Background(), db, testSegment.Slug)
+			err = checkResponce(err, fmt.Errorf("error while getting segment %q from the database: %s", testSegment.Slug, testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_updateSegmentInDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testSlug        = "TEST " + strconv.Itoa(rand.Int())
+			testErr         = errors.New("test error " + testSlug)
+			testDescription = "description " + strconv.Itoa(rand.Int())
+			testUpdate      = models.SegmentUpdate{Description: &testDescription}
+			query           = `UPDATE segments SET description = COALESCE($2, description), owner_team = COALESCE($3, owner_team) WHERE slug = $1 AND deleted_at IS NULL;`
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testSlug, testUpdate.Description, testUpdate.OwnerTeam).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			err = checkResponce(updateSegmentInDB(context.Background(), db, testSlug, testUpdate), nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("segment not found", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testSlug, testUpdate.Description, testUpdate.OwnerTeam).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			err := updateSegmentInDB(context.Background(), db, testSlug, testUpdate)
+			if !errors.Is(err, models.ErrSegmentNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while updating segment", func(t *testing.T) {
+			mock.ExpectExec(query).WithArgs(testSlug, testUpdate.Description, testUpdate.OwnerTeam).WillReturnError(testErr)
+
+			err = checkResponce(updateSegmentInDB(context.Background(), db, testSlug, testUpdate),
+				fmt.Errorf("error while updating segment %q in the database: %s", testSlug, testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_getSegmentMembersFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testSlug      = "TEST " + strconv.Itoa(rand.Int())
+			testSegmentID = rand.Intn(1000)
+			testAfter     = rand.Intn(1000)
+			testLimit     = rand.Intn(100)
+			testErr       = errors.New("test error " + testSlug)
+			testMembers   = make([]models.Member, rand.Intn(15))
+			queries       = []string{
+				`SELECT id FROM segments WHERE slug = $1 AND deleted_at IS NULL;`,
+				`SELECT user_id, created_at, expires_at FROM user_segment_relations
+				WHERE segment_id = $1 AND user_id > $2::bigint AND (expires_at IS NULL OR expires_at > now())
+				ORDER BY user_id LIMIT NULLIF($3, 0);`,
+			}
+		)
+
+		for j := 0; j < len(testMembers); j++ {
+			testMembers[j] = models.Member{UserID: testAfter + j + 1, AddedAt: time.Now().Add(-time.Duration(rand.Intn(1000)) * time.Hour)}
+			if rand.Intn(2) == 0 {
+				expiresAt := time.Now().Add(time.Duration(rand.Intn(1000)) * time.Hour)
+				testMembers[j].ExpiresAt = &expiresAt
+			}
+		}
+		memberRows := func() *sqlmock.Rows {
+			rows := sqlmock.NewRows([]string{"user_id", "created_at", "expires_at"})
+			for _, member := range testMembers {
+				if member.ExpiresAt == nil {
+					rows.AddRow(member.UserID, member.AddedAt, nil)
+				} else {
+					rows.AddRow(member.UserID, member.AddedAt, *member.ExpiresAt)
+				}
+			}
+			return rows
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testSegmentID))
+			mock.ExpectQuery(queries[1]).WithArgs(testSegmentID, testAfter, testLimit).WillReturnRows(memberRows())
+
+			members := make([]models.Member, 0)
+			err := getSegmentMembersFromDB(context.Background(), db, testSlug, testAfter, testLimit, func(member models.Member) error {
+				members = append(members, member)
+				return nil
+			})
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if reflect.DeepEqual(members, testMembers) == false {
+				t.Fatalf("got members = %v, expected %v", members, testMembers)
+			}
+		})
+
+		t.Run("handler stops reading", func(t *testing.T) {
+			if len(testMembers) == 0 {
+				return
+			}
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testSegmentID))
+			mock.ExpectQuery(queries[1]).WithArgs(testSegmentID, testAfter, testLimit).WillReturnRows(memberRows()).RowsWillBeClosed()
+
+			calls := 0
+			err := getSegmentMembersFromDB(context.Background(), db, testSlug, testAfter, testLimit, func(member models.Member) error {
+				calls++
+				return testErr
+			})
+			err = checkResponce(err, testErr, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if calls != 1 {
+				t.Fatalf("got %d calls of handler, expected 1", calls)
+			}
+		})
+
+		t.Run("segment not found", func(t *testing.T) {
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			err := getSegmentMembersFromDB(context.Background(), db, testSlug, testAfter, testLimit, func(member models.Member) error {
+				t.Error("handler must not be called")
+				return nil
+			})
+			if !errors.Is(err, models.ErrSegmentNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while getting members from the database", func(t *testing.T) {
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testSegmentID))
+			mock.ExpectQuery(queries[1]).WithArgs(testSegmentID, testAfter, testLimit).WillReturnError(testErr)
+
+			err := getSegmentMembersFromDB(context.Background(), db, testSlug, testAfter, testLimit, func(member models.Member) error { return nil })
+			err = checkResponce(err, fmt.Errorf("error while getting members of segment %q from the database: %s", testSlug, testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func randomSegment(slug string) models.Segment {
+	return models.Segment{
+		ID:          rand.Int(),
+		Slug:        slug,
+		CreatedAt:   time.Now().Add(-time.Duration(rand.Intn(1000)) * time.Hour),
+		Description: "description " + strconv.Itoa(rand.Int()),
+		OwnerTeam:   "team " + strconv.Itoa(rand.Int()),
+		AutoPercent: rand.Intn(101),
+		Members:     rand.Intn(1000),
+	}
+}
@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// statsQuery - запрос общего количества сегментов, пользователей и членств пользователей в сегментах.
+const statsQuery = `SELECT
+	(SELECT COUNT(*) FROM segments WHERE deleted_at IS NULL),
+	(SELECT COUNT(*) FROM segments WHERE deleted_at IS NOT NULL),
+	(SELECT COUNT(*) FROM users),
+	(SELECT COUNT(*) FROM user_segment_relations JOIN segments ON segments.id = user_segment_relations.segment_id
+		WHERE segments.deleted_at IS NULL AND (user_segment_relations.expires_at IS NULL OR user_segment_relations.expires_at > now()));`
+
+// getStatsFromDB - получение общего количества сегментов, пользователей и членств пользователей в сегментах из базы данных.
+//
+// Принимает: контекст, указатель на базу данных.
+//
+// Возвращает: статистику и ошибку.
+func getStatsFromDB(ctx context.Context, db *sql.DB) (models.Stats, error) {
+	var stats models.Stats
+	err := db.QueryRowContext(ctx, statsQuery).Scan(&stats.Segments, &stats.DeletedSegments, &stats.Users, &stats.Memberships)
+	if err != nil {
+		return models.Stats{}, fmt.Errorf("error while getting stats from the database: %s", err.Error())
+	}
+
+	return stats, nil
+}
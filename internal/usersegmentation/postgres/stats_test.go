@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+func Test_getStatsFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testStats = models.Stats{
+				Segments:        rand.Intn(1000),
+				DeletedSegments: rand.Intn(1000),
+				Users:           rand.Intn(1000),
+				Memberships:     rand.Intn(1000),
+			}
+			testErrText = "test error " + strconv.Itoa(rand.Int())
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"segments", "deleted_segments", "users", "memberships"}).
+				AddRow(testStats.Segments, testStats.DeletedSegments, testStats.Users, testStats.Memberships)
+			mock.ExpectQuery(statsQuery).WillReturnRows(rows)
+
+			stats, err := getStatsFromDB(context.Background(), db)
+			if err = checkResponce(err, nil, mock, t); err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(stats, testStats) {
+				t.Errorf("got stats: %+v\nexpected: %+v\n", stats, testStats)
+			}
+		})
+
+		t.Run("error while getting stats", func(t *testing.T) {
+			mock.ExpectQuery(statsQuery).WillReturnError(errors.New(testErrText))
+
+			_, err := getStatsFromDB(context.Background(), db)
+			err = checkResponce(err, fmt.Errorf("error while getting stats from the database: %s", testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
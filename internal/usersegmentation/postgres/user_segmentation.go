@@ -2,268 +2,576 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
+	"github.com/lib/pq"
 )
 
 // UserSegmentation - модель базы данных сегментирования пользователей.
 type UserSegmentation struct {
-	db *sql.DB // db - указатель на базу данных.
+	db          *sql.DB // db - указатель на базу данных.
+	strictUsers bool    // strictUsers - флаг строгого режима (если true, то незарегистрированные пользователи не создаются неявно).
 }
 
 // GetModel - создание модели базы данных сегментирования пользователей.
 //
-// Принимает базу данных и флаг создания таблиц (если true, то таблицы будут созданы в базе данных).
+// Принимает базу данных, флаг применения миграций (если true, то неприменённые миграции схемы будут применены)
+// и флаг строгого режима (если true, то изменение сегментов незарегистрированного пользователя завершается ошибкой models.ErrUserNotFound).
 //
 // Возвращает модель базы данных сегментирования пользователей и ошибку.
-func GetModel(db *sql.DB, createTables bool) (models.UserSegmentationDbProcessor, error) {
-	if createTables {
-		err := createDB(db)
-		if err != nil {
+// Если версия схемы базы данных не совпадает с SchemaVersion, возвращается ошибка.
+func GetModel(db *sql.DB, migrate bool, strictUsers bool) (models.UserSegmentationDbProcessor, error) {
+	if migrate {
+		if _, err := MigrateUp(db); err != nil {
 			return nil, err
 		}
 	}
 
-	err := checkDB(db)
+	err := checkSchemaVersion(context.Background(), db, SchemaVersion())
 	if err != nil {
 		return nil, err
 	}
 
-	return &UserSegmentation{db}, nil
+	return &UserSegmentation{db, strictUsers}, nil
 }
 
 // AddSegment - добавление нового сегмента в базу данных.
 //
-// Принимает: имя сегмента.
+// Принимает: контекст, имя сегмента, процент пользователей, автоматически добавляемых в сегмент.
 //
 // Возвращает: id добавленного сегмента и ошибку.
-func (model *UserSegmentation) AddSegment(slug string) (int, error) {
-	return addSegmentToDB(model.db, slug)
+func (model *UserSegmentation) AddSegment(ctx context.Context, slug string, autoPercent int) (int, error) {
+	return addSegmentToDB(ctx, model.db, slug, autoPercent)
 }
 
-// DeleteSegment - удаление сегмента из базы данных.
+// DeleteSegment - мягкое удаление сегмента из базы данных.
 //
-// Принимает: имя сегмента.
+// Принимает: контекст, имя сегмента.
 //
 // Возвращает: ошибку.
-func (model *UserSegmentation) DeleteSegment(slug string) error {
-	return deleteSegmentFromDB(model.db, slug)
+func (model *UserSegmentation) DeleteSegment(ctx context.Context, slug string) error {
+	return deleteSegmentFromDB(ctx, model.db, slug)
 }
 
-// ModifyUser - изменение пользователя по id.
+// RestoreSegment - восстановление удалённого сегмента.
 //
-// Принимает: id пользователя, имена сегментов, в которые необходимо добавить пользователя, и имена сегментов, из которых необходимо убрать пользователя.
+// Принимает: контекст, имя сегмента.
 //
 // Возвращает: ошибку.
-func (model *UserSegmentation) ModifyUser(id int, append []string, remove []string) error {
-	return modifyUserInDB(model.db, id, append, remove)
+func (model *UserSegmentation) RestoreSegment(ctx context.Context, slug string) error {
+	return restoreSegmentInDB(ctx, model.db, slug)
+}
+
+// PurgeDeleted - окончательное удаление сегментов, удалённых до указанного времени.
+//
+// Принимает: контекст, время, до которого сегмент должен быть удалён.
+//
+// Возвращает: количество окончательно удалённых сегментов и ошибку.
+func (model *UserSegmentation) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	return purgeDeletedFromDB(ctx, model.db, before)
+}
+
+// ModifyUser - изменение пользователя по id.
+//
+// Принимает: контекст, id пользователя, сегменты, в которые необходимо добавить пользователя, имена сегментов, из которых необходимо убрать пользователя,
+// и флаг частичного применения.
+//
+// Возвращает: отчёт о результатах изменения и ошибку.
+func (model *UserSegmentation) ModifyUser(ctx context.Context, id int, append []models.SegmentAddition, remove []string, partial bool) (models.ModificationReport, error) {
+	return modifyUserInDB(ctx, model.db, id, append, remove, partial, model.strictUsers)
 }
 
 // GetUserRelations - получение данных о пользователе по id.
 //
-// Принимает: id пользователя.
+// Принимает: контекст, id пользователя.
+//
+// Возвращает: список отношений пользователя с сегментами, в которых он состоит, и ошибку.
+func (model *UserSegmentation) GetUserRelations(ctx context.Context, id int) ([]models.Relation, error) {
+	return getUserRelationsInDB(ctx, model.db, id)
+}
+
+// DeleteExpired - удаление истёкших членств пользователей в сегментах.
+//
+// Принимает: контекст.
 //
-// Возвращает: список сегментов, в которых состоит пользователь и ошибку.
-func (model *UserSegmentation) GetUserRelations(id int) ([]string, error) {
-	return getUserRelationsInDB(model.db, id)
+// Возвращает: количество удалённых отношений и ошибку.
+func (model *UserSegmentation) DeleteExpired(ctx context.Context) (int, error) {
+	return deleteExpiredFromDB(ctx, model.db)
+}
+
+// AddUser - регистрация пользователя.
+//
+// Принимает: контекст, id пользователя.
+//
+// Возвращает: ошибку.
+func (model *UserSegmentation) AddUser(ctx context.Context, id int) error {
+	return addUserToDB(ctx, model.db, id)
+}
+
+// GetUsers - получение списка зарегистрированных пользователей.
+//
+// Принимает: контекст, максимальное количество пользователей и смещение.
+//
+// Возвращает: список пользователей и ошибку.
+func (model *UserSegmentation) GetUsers(ctx context.Context, limit int, offset int) ([]models.User, error) {
+	return getUsersFromDB(ctx, model.db, limit, offset)
+}
+
+// DeleteUser - удаление пользователя.
+//
+// Принимает: контекст, id пользователя.
+//
+// Возвращает: ошибку.
+func (model *UserSegmentation) DeleteUser(ctx context.Context, id int) error {
+	return deleteUserFromDB(ctx, model.db, id)
+}
+
+// GetHistory - получение истории изменений сегментов пользователей за период.
+//
+// Принимает: контекст, начало и конец периода.
+//
+// Возвращает: список записей истории и ошибку.
+func (model *UserSegmentation) GetHistory(ctx context.Context, from time.Time, to time.Time) ([]models.HistoryRecord, error) {
+	return getHistoryFromDB(ctx, model.db, from, to)
+}
+
+// GetStats - получение общего количества сегментов, пользователей и членств пользователей в сегментах.
+//
+// Принимает: контекст.
+//
+// Возвращает: статистику и ошибку.
+func (model *UserSegmentation) GetStats(ctx context.Context) (models.Stats, error) {
+	return getStatsFromDB(ctx, model.db)
 }
 
 // addSegmentToDB - добавление нового сегмента в базу данных.
+// Если процент автоматического добавления больше 0, то в сегмент добавляются выбранные зарегистрированные пользователи (см. models.InRollout).
 //
-// Принимает: указатель на базу данных и имя сегмента.
+// Принимает: контекст, указатель на базу данных, имя сегмента и процент пользователей, автоматически добавляемых в сегмент.
 //
-// Возвращает: id добавленного сегмента и ошибку.
-func addSegmentToDB(db *sql.DB, slug string) (int, error) {
-	tx, err := db.Begin()
+// Возвращает: id добавленного сегмента и ошибку (models.ErrInvalidSlug, если название недопустимо, models.ErrSegmentExists, если сегмент уже существует).
+func addSegmentToDB(ctx context.Context, db *sql.DB, slug string, autoPercent int) (int, error) {
+	if err := models.ValidateSlug(slug); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, errors.New("error while starting transaction: " + err.Error())
 	}
 	defer tx.Rollback()
 
-	q := `INSERT INTO segments (slug) VALUES ($1) RETURNING id;`
+	q := `INSERT INTO segments (slug, auto_percent) VALUES ($1, $2) RETURNING id;`
 	var id int
-	err = tx.QueryRow(q, slug).Scan(&id)
+	err = tx.QueryRowContext(ctx, q, slug, autoPercent).Scan(&id)
+	if domainErr := domainError(err); domainErr != nil {
+		return 0, fmt.Errorf("segment %q: %w", slug, domainErr)
+	}
 	if err != nil {
 		return 0, errors.New("error while adding segment to the database: " + err.Error())
 	}
+
+	if autoPercent > 0 {
+		if _, err = tx.ExecContext(ctx, rolloutQuery, id, slug, autoPercent); err != nil {
+			return 0, errors.New("error while adding users to the segment: " + err.Error())
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return 0, errors.New("error while committing transaction: " + err.Error())
 	}
+	logging.FromContext(ctx).Debug("segment added to the database", "slug", slug, "id", id, "auto_percent", autoPercent)
 
 	return id, nil
 }
 
-// deleteSegmentFromDB - удаление сегмента из базы данных.
+// rolloutQuery - запрос добавления в сегмент выбранных зарегистрированных пользователей (см. models.InRollout).
+// Параметры: id сегмента, название сегмента и процент пользователей.
+const rolloutQuery = `WITH added AS (
+	INSERT INTO user_segment_relations (user_id, segment_id) SELECT users.id, $1 FROM users
+	WHERE ('x' || substr(md5($2::text || ':' || users.id::text), 1, 8))::bit(32)::bigint % 100 < $3
+	ON CONFLICT (user_id, segment_id) DO NOTHING
+	RETURNING user_id
+)
+INSERT INTO user_segment_history (user_id, segment_slug, operation) SELECT user_id, $2, 'add' FROM added;`
+
+// deleteSegmentFromDB - мягкое удаление сегмента из базы данных.
+// Членства пользователей в сегменте сохраняются, а их удаление записывается в историю.
 //
-// Принимает: указатель на базу данных и имя сегмента.
+// Принимает: контекст, указатель на базу данных и имя сегмента.
 //
-// Возвращает: ошибку.
-func deleteSegmentFromDB(db *sql.DB, slug string) error {
-	tx, err := db.Begin()
+// Возвращает: ошибку (models.ErrSegmentNotFound, если активного сегмента с таким названием нет).
+func deleteSegmentFromDB(ctx context.Context, db *sql.DB, slug string) error {
+	q := `WITH deleted AS (
+		UPDATE segments SET deleted_at = now() WHERE slug = $1 AND deleted_at IS NULL RETURNING id
+	), history AS (
+		INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+		SELECT user_id, $1, 'remove', LEAST(COALESCE(expires_at, now()), now()) FROM user_segment_relations WHERE segment_id = (SELECT id FROM deleted)
+	)
+	SELECT id FROM deleted;`
+	var id int
+	err := db.QueryRowContext(ctx, q, slug).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error while deleting segment with slug = %s from the database: %s", slug, err.Error())
+	}
+
+	return nil
+}
+
+// restoreSegmentInDB - восстановление мягко удалённого сегмента в базе данных.
+// Истёкшие за время удаления членства удаляются, восстановление остальных записывается в историю,
+// а пользователи, зарегистрированные за время удаления, добавляются в сегмент, если попадают в процент автоматического добавления.
+//
+// Принимает: контекст, указатель на базу данных и имя сегмента.
+//
+// Возвращает: ошибку (models.ErrSegmentNotFound, если удалённого сегмента с таким названием нет).
+func restoreSegmentInDB(ctx context.Context, db *sql.DB, slug string) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.New("error while starting transaction: " + err.Error())
 	}
 	defer tx.Rollback()
 
-	q := `DELETE FROM user_segment_relations WHERE segment_id = (SELECT id FROM segments WHERE slug = $1);`
-	errStr := "error while deleting segment with slug = %s from the database: %s"
-	if _, err = tx.Exec(q, slug); err != nil {
+	var (
+		id          int
+		autoPercent int
+		errStr      = "error while restoring segment %q in the database: %s"
+	)
+	q := `UPDATE segments SET deleted_at = NULL WHERE slug = $1 AND deleted_at IS NOT NULL RETURNING id, auto_percent;`
+	err = tx.QueryRowContext(ctx, q, slug).Scan(&id, &autoPercent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("deleted segment %q: %w", slug, models.ErrSegmentNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf(errStr, slug, err.Error())
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_segment_relations WHERE segment_id = $1 AND expires_at <= now();`, id); err != nil {
 		return fmt.Errorf(errStr, slug, err.Error())
 	}
-	q = `DELETE FROM segments WHERE slug = $1;`
-	if _, err = tx.Exec(q, slug); err != nil {
+	q = `INSERT INTO user_segment_history (user_id, segment_slug, operation) SELECT user_id, $2::text, 'add' FROM user_segment_relations WHERE segment_id = $1;`
+	if _, err = tx.ExecContext(ctx, q, id, slug); err != nil {
 		return fmt.Errorf(errStr, slug, err.Error())
 	}
+	if autoPercent > 0 {
+		if _, err = tx.ExecContext(ctx, rolloutQuery, id, slug, autoPercent); err != nil {
+			return fmt.Errorf(errStr, slug, err.Error())
+		}
+	}
 
 	err = tx.Commit()
 	if err != nil {
 		return errors.New("error while committing transaction: " + err.Error())
 	}
+	logging.FromContext(ctx).Debug("segment restored in the database", "slug", slug, "id", id)
 
 	return nil
 }
 
+// purgeDeletedFromDB - окончательное удаление мягко удалённых сегментов и членств пользователей в них из базы данных.
+// Удаление членств не записывается в историю, так как оно было записано при мягком удалении.
+//
+// Принимает: контекст, указатель на базу данных и время, до которого сегмент должен быть удалён.
+//
+// Возвращает: количество окончательно удалённых сегментов и ошибку.
+func purgeDeletedFromDB(ctx context.Context, db *sql.DB, before time.Time) (int, error) {
+	q := `WITH purged AS (
+		DELETE FROM segments WHERE deleted_at <= $1 RETURNING id
+	), relations AS (
+		DELETE FROM user_segment_relations WHERE segment_id IN (SELECT id FROM purged)
+	)
+	SELECT COUNT(*) FROM purged;`
+	var n int
+	if err := db.QueryRowContext(ctx, q, before).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error while purging deleted segments from the database: %s", err.Error())
+	}
+
+	return n, nil
+}
+
 // modifyUserInDB - изменение пользователя в базе данных по id.
 //
-// Принимает: указатель на базу данных, id пользователя, имена сегментов, в которые необходимо добавить пользователя, и имена сегментов, из которых необходимо убрать пользователя.
+// Все изменения выполняются в одной транзакции: при любой ошибке ни одно из них не применяется.
+// Перед изменением сегменты блокируются от удаления, а истёкшие членства пользователя удаляются, чтобы повторное добавление в сегмент было записано в историю.
 //
-// Возвращает: ошибку.
-func modifyUserInDB(db *sql.DB, id int, append []string, remove []string) error {
-	tx, err := db.Begin()
+// Принимает: контекст, указатель на базу данных, id пользователя, сегменты, в которые необходимо добавить пользователя, имена сегментов, из которых необходимо убрать пользователя,
+// флаг частичного применения (если false, то при несуществующих сегментах возвращается models.ErrSegmentNotFound)
+// и флаг строгого режима (если true, то незарегистрированный пользователь не создаётся, а возвращается models.ErrUserNotFound).
+//
+// Возвращает: отчёт о результатах изменения и ошибку.
+func modifyUserInDB(ctx context.Context, db *sql.DB, id int, append []models.SegmentAddition, remove []string, partial bool, strict bool) (models.ModificationReport, error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return errors.New("error while starting transaction: " + err.Error())
+		return models.ModificationReport{}, errors.New("error while starting transaction: " + err.Error())
 	}
 	defer tx.Rollback()
 
-	errText := ""
+	var (
+		qExpired = `WITH expired AS (
+		DELETE FROM user_segment_relations WHERE user_id = $1 AND expires_at <= now() RETURNING user_id, segment_id, expires_at
+	)
+	INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+	SELECT expired.user_id, segments.slug, 'remove', expired.expires_at FROM expired JOIN segments ON segments.id = expired.segment_id
+	WHERE segments.deleted_at IS NULL;`
+		qAppend = `WITH added AS (
+		INSERT INTO user_segment_relations (user_id, segment_id, expires_at) VALUES ($1, $2, $4)
+		ON CONFLICT (user_id, segment_id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		RETURNING user_id, xmax = 0 AS inserted
+	), history AS (
+		INSERT INTO user_segment_history (user_id, segment_slug, operation) SELECT user_id, $3::text, 'add' FROM added WHERE inserted
+	)
+	SELECT inserted FROM added;`
+		qRemove = `WITH removed AS (
+		DELETE FROM user_segment_relations WHERE user_id = $1 AND segment_id = $2 RETURNING user_id
+	)
+	INSERT INTO user_segment_history (user_id, segment_slug, operation) SELECT user_id, $3::text, 'remove' FROM removed;`
+		report = models.ModificationReport{
+			Append: make([]models.SlugStatus, 0, len(append)),
+			Remove: make([]models.SlugStatus, 0, len(remove)),
+		}
+	)
 
-	for _, slug := range append {
-		_, err = tx.Exec(`INSERT INTO user_segment_relations (user_id, segment_id) SELECT $1, id FROM segments WHERE slug = $2;`, id, slug)
-		if err != nil {
-			errText += fmt.Sprintf(`error while adding user %d to the segment "%s": %s`, id, slug, err.Error())
-			errText += fmt.Sprintln()
+	slugs := make([]string, 0, len(append)+len(remove))
+	for _, addition := range append {
+		slugs = appendSlug(slugs, addition.Slug)
+	}
+	for _, slug := range remove {
+		slugs = appendSlug(slugs, slug)
+	}
+	segmentIDs, err := lockSegmentsInTx(ctx, tx, slugs)
+	if err != nil {
+		return models.ModificationReport{}, err
+	}
+	if unknown := unknownSlugs(slugs, segmentIDs); len(unknown) > 0 && !partial {
+		return models.ModificationReport{}, fmt.Errorf("segments %q: %w", unknown, models.ErrSegmentNotFound)
+	}
+
+	if strict {
+		err = lockUserInTx(ctx, tx, id)
+	} else {
+		_, err = registerUserInTx(ctx, tx, id)
+	}
+	if err != nil {
+		return models.ModificationReport{}, err
+	}
+
+	if _, err = tx.ExecContext(ctx, qExpired, id); err != nil {
+		return models.ModificationReport{}, fmt.Errorf("error while removing user %d's expired segments: %s", id, err.Error())
+	}
+
+	for _, addition := range append {
+		segmentID, ok := segmentIDs[addition.Slug]
+		if !ok {
+			report.Append = appendStatus(report.Append, addition.Slug, models.StatusUnknown)
+			continue
+		}
+
+		var inserted bool
+		if err = tx.QueryRowContext(ctx, qAppend, id, segmentID, addition.Slug, addition.ExpiresAt).Scan(&inserted); err != nil {
+			return models.ModificationReport{}, fmt.Errorf(`error while adding user %d to the segment "%s": %s`, id, addition.Slug, err.Error())
+		}
+		if inserted {
+			report.Append = appendStatus(report.Append, addition.Slug, models.StatusAdded)
+		} else {
+			report.Append = appendStatus(report.Append, addition.Slug, models.StatusAlreadyPresent)
 		}
 	}
 
 	for _, slug := range remove {
-		_, err = tx.Exec(`DELETE FROM user_segment_relations WHERE user_id = $1 AND segment_id = (SELECT id FROM segments WHERE slug = $2);`, id, slug)
+		segmentID, ok := segmentIDs[slug]
+		if !ok {
+			report.Remove = appendStatus(report.Remove, slug, models.StatusUnknown)
+			continue
+		}
+
+		res, err := tx.ExecContext(ctx, qRemove, id, segmentID, slug)
 		if err != nil {
-			errText += fmt.Sprintf(`error while removing user %d from the segment "%s": %s`, id, slug, err.Error())
-			errText += fmt.Sprintln()
+			return models.ModificationReport{}, fmt.Errorf(`error while removing user %d from the segment "%s": %s`, id, slug, err.Error())
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return models.ModificationReport{}, fmt.Errorf(`error while removing user %d from the segment "%s": %s`, id, slug, err.Error())
+		}
+		if n > 0 {
+			report.Remove = appendStatus(report.Remove, slug, models.StatusRemoved)
+		} else {
+			report.Remove = appendStatus(report.Remove, slug, models.StatusNotMember)
 		}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return errors.New("error while committing transaction: " + err.Error())
+		return models.ModificationReport{}, errors.New("error while committing transaction: " + err.Error())
 	}
+	logging.FromContext(ctx).Debug("user modified in the database", "user_id", id, "append", len(report.Append), "remove", len(report.Remove))
 
-	if errText != "" {
-		return errors.New(errText)
-	}
-	return nil
+	return report, nil
 }
 
-// GetUserRelationsInDB - получение данных о пользователе из базы данных по id.
+// lockSegmentsInTx - получение id сегментов и их блокировка от удаления до конца транзакции.
 //
-// Принимает: указатель на базу данных и id пользователя.
+// Принимает: контекст, транзакцию и названия сегментов.
 //
-// Возвращает: список сегментов, в которых состоит пользователь и ошибку.
-func getUserRelationsInDB(db *sql.DB, id int) ([]string, error) {
-	q := `SELECT slug FROM segments WHERE id IN (SELECT segment_id FROM user_segment_relations WHERE user_id = $1);`
-	rows, err := db.Query(q, id)
+// Возвращает: id существующих сегментов по их названиям и ошибку.
+func lockSegmentsInTx(ctx context.Context, tx *sql.Tx, slugs []string) (map[string]int, error) {
+	ids := make(map[string]int, len(slugs))
+	if len(slugs) == 0 {
+		return ids, nil
+	}
+
+	errStr := "error while getting segments from the database: %s"
+	rows, err := tx.QueryContext(ctx, `SELECT id, slug FROM segments WHERE slug = ANY($1) AND deleted_at IS NULL FOR SHARE;`, pq.Array(slugs))
 	if err != nil {
-		return []string{}, fmt.Errorf("error while getting user %d's segments from the database: %s", id, err.Error())
+		return nil, fmt.Errorf(errStr, err.Error())
 	}
 	defer rows.Close()
 
-	segments := make([]string, 0)
 	for rows.Next() {
-		var slug string
-		err = rows.Scan(&slug)
-		if err != nil {
-			return []string{}, fmt.Errorf("error while getting user %d's segments from the database: %s", id, err.Error())
+		var (
+			id   int
+			slug string
+		)
+		if err = rows.Scan(&id, &slug); err != nil {
+			return nil, fmt.Errorf(errStr, err.Error())
 		}
-		segments = append(segments, slug)
+		ids[slug] = id
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf(errStr, err.Error())
 	}
 
-	return segments, nil
+	return ids, nil
 }
 
-// checkDB - проверка базы данных на соответствие требуемой б.д. сегментирования пользователей.
-// Возвращает: ошибку.
-func checkDB(db *sql.DB) error {
-	var (
-		qSegments = `SELECT COUNT(*) = 2 AS properSegments
-		FROM information_schema.columns
-		WHERE table_schema = 'public'
-		AND table_name = 'segments'
-		AND (
-			(column_name = 'id' AND data_type = 'integer')
-			OR (column_name = 'slug' AND data_type = 'text')
-		);`
-		qRelations = `SELECT COUNT(*) = 2 AS properRelations
-		FROM information_schema.columns
-		WHERE table_schema = 'public'
-		AND table_name = 'user_segment_relations'
-		AND (
-			(column_name = 'user_id' AND data_type = 'integer')
-			OR (column_name = 'segment_id' AND data_type = 'integer')
-		);`
-		properSegments  bool
-		properRelations bool
-	)
-
-	var err error = nil
+// appendSlug - добавление названия сегмента в список, если его там ещё нет.
+//
+// Принимает: список названий и название.
+//
+// Возвращает: список названий.
+func appendSlug(slugs []string, slug string) []string {
+	for _, s := range slugs {
+		if s == slug {
+			return slugs
+		}
+	}
+	return append(slugs, slug)
+}
 
-	err = db.QueryRow(qSegments).Scan(&properSegments)
-	if err != nil {
-		return errors.Join(errors.New("error while checking 'segments' table"), err)
+// unknownSlugs - получение названий несуществующих сегментов.
+//
+// Принимает: список названий и id существующих сегментов по их названиям.
+//
+// Возвращает: названия, отсутствующие среди существующих сегментов, в порядке списка.
+func unknownSlugs(slugs []string, ids map[string]int) []string {
+	unknown := make([]string, 0)
+	for _, slug := range slugs {
+		if _, ok := ids[slug]; !ok {
+			unknown = append(unknown, slug)
+		}
 	}
-	err = db.QueryRow(qRelations).Scan(&properRelations)
+	return unknown
+}
+
+// appendStatus - добавление результата изменения для сегмента в отчёт.
+//
+// Принимает: список результатов, название сегмента и статус.
+//
+// Возвращает: список результатов.
+func appendStatus(statuses []models.SlugStatus, slug string, status string) []models.SlugStatus {
+	return append(statuses, models.SlugStatus{Slug: slug, Status: status})
+}
+
+// GetUserRelationsInDB - получение данных о пользователе из базы данных по id.
+// Истёкшие членства не возвращаются, даже если они ещё не были удалены.
+//
+// Принимает: контекст, указатель на базу данных и id пользователя.
+//
+// Возвращает: список отношений пользователя с сегментами, в которых он состоит, и ошибку.
+func getUserRelationsInDB(ctx context.Context, db *sql.DB, id int) ([]models.Relation, error) {
+	q := `SELECT segments.slug, user_segment_relations.expires_at FROM segments
+	JOIN user_segment_relations ON segments.id = user_segment_relations.segment_id
+	WHERE user_segment_relations.user_id = $1 AND (user_segment_relations.expires_at IS NULL OR user_segment_relations.expires_at > now())
+	AND segments.deleted_at IS NULL;`
+	rows, err := db.QueryContext(ctx, q, id)
 	if err != nil {
-		return errors.Join(errors.New("error while checking 'user_segment_relations' table"), err)
+		return []models.Relation{}, fmt.Errorf("error while getting user %d's segments from the database: %s", id, err.Error())
 	}
+	defer rows.Close()
 
-	if !properSegments {
-		err = errors.Join(err, errors.New(
-			"'segments' table is not ok: proper 'segments' table is { id INTEGER; slug TEXT }"))
+	relations := make([]models.Relation, 0)
+	for rows.Next() {
+		var relation models.Relation
+		err = rows.Scan(&relation.Slug, &relation.ExpiresAt)
+		if err != nil {
+			return []models.Relation{}, fmt.Errorf("error while getting user %d's segments from the database: %s", id, err.Error())
+		}
+		relations = append(relations, relation)
 	}
-	if !properRelations {
-		err = errors.Join(err, errors.New(
-			"'user_segment_relations' table is not ok: proper 'user_segment_relations' table is { user_id INTEGER; segment_id INTEGER }"))
+	if err = rows.Err(); err != nil {
+		return []models.Relation{}, fmt.Errorf("error while getting user %d's segments from the database: %s", id, err.Error())
 	}
 
-	return err
+	return relations, nil
 }
 
-// createDB - создание таблиц сегментов и отношений пользователь-сегмент в базе данных.
+// deleteExpiredFromDB - удаление истёкших членств пользователей в сегментах из базы данных.
+// Удаления записываются в историю со временем истечения членства.
 //
-// Принимает: указатель на базу данных.
+// Принимает: контекст, указатель на базу данных.
 //
-// Возвращает: ошибку.
-// TODO test
-func createDB(db *sql.DB) error {
-	q :=
-		`CREATE TABLE IF NOT EXISTS user_segment_relations (
-		user_id INTEGER,
-		segment_id INTEGER,
-		CONSTRAINT unique_user_segment UNIQUE (user_id, segment_id)
-	);
-	
-	CREATE TABLE IF NOT EXISTS segments (
-		id SERIAL UNIQUE,
-		slug TEXT PRIMARY KEY
-	);`
-
-	_, err := db.Exec(q)
+// Возвращает: количество удалённых отношений и ошибку.
+func deleteExpiredFromDB(ctx context.Context, db *sql.DB) (int, error) {
+	q := `WITH expired AS (
+		DELETE FROM user_segment_relations WHERE expires_at <= now() RETURNING user_id, segment_id, expires_at
+	), history AS (
+		INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+		SELECT expired.user_id, segments.slug, 'remove', expired.expires_at FROM expired JOIN segments ON segments.id = expired.segment_id
+		WHERE segments.deleted_at IS NULL
+	)
+	SELECT COUNT(*) FROM expired;`
+	var n int
+	if err := db.QueryRowContext(ctx, q).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error while deleting expired relations from the database: %s", err.Error())
+	}
+
+	return n, nil
+}
+
+// getHistoryFromDB - получение истории изменений сегментов пользователей за период из базы данных.
+//
+// Принимает: контекст, указатель на базу данных, начало и конец периода.
+//
+// Возвращает: список записей истории и ошибку.
+func getHistoryFromDB(ctx context.Context, db *sql.DB, from time.Time, to time.Time) ([]models.HistoryRecord, error) {
+	q := `SELECT user_id, segment_slug, operation, created_at FROM user_segment_history WHERE created_at >= $1 AND created_at < $2 ORDER BY created_at, user_id;`
+	rows, err := db.QueryContext(ctx, q, from, to)
 	if err != nil {
-		return errors.Join(fmt.Errorf("error while creating tables: %s", err))
+		return []models.HistoryRecord{}, fmt.Errorf("error while getting history from the database: %s", err.Error())
 	}
+	defer rows.Close()
 
-	return nil
+	records := make([]models.HistoryRecord, 0)
+	for rows.Next() {
+		var record models.HistoryRecord
+		err = rows.Scan(&record.UserID, &record.Slug, &record.Operation, &record.Time)
+		if err != nil {
+			return []models.HistoryRecord{}, fmt.Errorf("error while getting history from the database: %s", err.Error())
+		}
+		records = append(records, record)
+	}
+	if err = rows.Err(); err != nil {
+		return []models.HistoryRecord{}, fmt.Errorf("error while getting history from the database: %s", err.Error())
+	}
+
+	return records, nil
 }
@@ -1,17 +1,28 @@
 package postgres
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+const (
+	startTransactionErrText  = "error while starting transaction: "
+	commitTransactionErrText = "error while committing transaction: "
 )
 
-func Test_checkDB(t *testing.T) {
+func Test_addSegmentToDB(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		t.Fatal("error creating mock database")
@@ -19,103 +30,136 @@ func Test_checkDB(t *testing.T) {
 	defer db.Close()
 
 	for i := 0; i < 10; i++ {
-		queries := []string{
-			`SELECT COUNT(*) = 2 AS properSegments
-		FROM information_schema.columns
-		WHERE table_schema = 'public'
-		AND table_name = 'segments'
-		AND (
-			(column_name = 'id' AND data_type = 'integer')
-			OR (column_name = 'slug' AND data_type = 'text')
-		);`,
-			`SELECT COUNT(*) = 2 AS properRelations
-		FROM information_schema.columns
-		WHERE table_schema = 'public'
-		AND table_name = 'user_segment_relations'
-		AND (
-			(column_name = 'user_id' AND data_type = 'integer')
-			OR (column_name = 'segment_id' AND data_type = 'integer')
-		);`,
-		}
+		var (
+			testId      = rand.Int()
+			testErrText = "test error " + strconv.Itoa(testId)
+			testSlug    = "TEST " + strconv.Itoa(testId)
+			testPercent = 1 + rand.Intn(100)
+			query       = "INSERT INTO segments (slug, auto_percent) VALUES ($1, $2) RETURNING id;"
+			rollout     = `WITH added AS (
+				INSERT INTO user_segment_relations (user_id, segment_id) SELECT users.id, $1 FROM users
+				WHERE ('x' || substr(md5($2::text || ':' || users.id::text), 1, 8))::bit(32)::bigint % 100 < $3
+				ON CONFLICT (user_id, segment_id) DO NOTHING
+				RETURNING user_id
+			)
+			INSERT INTO user_segment_history (user_id, segment_slug, operation) SELECT user_id, $2, 'add' FROM added;`
+		)
 
-		t.Run("normal db", func(t *testing.T) {
-			mock.ExpectQuery(queries[0]).WillReturnRows(sqlmock.NewRows([]string{"properSegments"}).AddRow("true"))
-			mock.ExpectQuery(queries[1]).WillReturnRows(sqlmock.NewRows([]string{"properRelations"}).AddRow("true"))
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(query).WithArgs(testSlug, 0).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testId))
+			mock.ExpectCommit()
 
-			err = checkResponce(checkDB(db), nil, mock, t)
+			id, err := addSegmentToDB(context.Background(), db, testSlug, 0)
+			err = checkResponce(err, nil, mock, t)
 			if err != nil {
 				t.Error(err)
 			}
-		})
 
-		segmentErr := errors.New("'segments' table is not ok: proper 'segments' table is { id INTEGER; slug TEXT }")
-		relationsErr := errors.New("'user_segment_relations' table is not ok: proper 'user_segment_relations' table is { user_id INTEGER; segment_id INTEGER }")
+			if id != testId {
+				t.Fatalf("got id = %d, expected %d", id, testId)
+			}
+		})
 
-		t.Run("db with wrong 'segments' table", func(t *testing.T) {
-			mock.ExpectQuery(queries[0]).WillReturnRows(sqlmock.NewRows([]string{"properSegments"}).AddRow("false"))
-			mock.ExpectQuery(queries[1]).WillReturnRows(sqlmock.NewRows([]string{"properRelations"}).AddRow("true"))
+		t.Run("normal case - auto percent", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(query).WithArgs(testSlug, testPercent).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testId))
+			mock.ExpectExec(rollout).WithArgs(testId, testSlug, testPercent).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(100)))
+			mock.ExpectCommit()
 
-			err = checkResponce(checkDB(db), segmentErr, mock, t)
+			id, err := addSegmentToDB(context.Background(), db, testSlug, testPercent)
+			err = checkResponce(err, nil, mock, t)
 			if err != nil {
 				t.Error(err)
 			}
+
+			if id != testId {
+				t.Fatalf("got id = %d, expected %d", id, testId)
+			}
 		})
 
-		t.Run("db with wrong 'user_segment_relations' table", func(t *testing.T) {
-			mock.ExpectQuery(queries[0]).WillReturnRows(sqlmock.NewRows([]string{"properSegments"}).AddRow("true"))
-			mock.ExpectQuery(queries[1]).WillReturnRows(sqlmock.NewRows([]string{"properRelations"}).AddRow("false"))
+		t.Run("error while adding users to the segment", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(query).WithArgs(testSlug, testPercent).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testId))
+			mock.ExpectExec(rollout).WithArgs(testId, testSlug, testPercent).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
 
-			err = checkResponce(checkDB(db), relationsErr, mock, t)
+			_, err := addSegmentToDB(context.Background(), db, testSlug, testPercent)
+			err = checkResponce(err, fmt.Errorf("error while adding users to the segment: %s", testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
 		})
 
-		t.Run("db with both wrong 'segments' and 'user_segment_relations' table", func(t *testing.T) {
-			mock.ExpectQuery(queries[0]).WillReturnRows(sqlmock.NewRows([]string{"properSegments"}).AddRow("false"))
-			mock.ExpectQuery(queries[1]).WillReturnRows(sqlmock.NewRows([]string{"properRelations"}).AddRow("false"))
+		t.Run("segment already exists", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(query).WithArgs(testSlug, 0).WillReturnError(&pq.Error{Code: "23505", Table: "segments", Constraint: "segments_pkey"})
+			mock.ExpectRollback()
 
-			err = checkResponce(checkDB(db), errors.Join(segmentErr, relationsErr), mock, t)
-			if err != nil {
+			_, err := addSegmentToDB(context.Background(), db, testSlug, 0)
+			if !errors.Is(err, models.ErrSegmentExists) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrSegmentExists)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
 				t.Error(err)
 			}
 		})
-	}
-}
 
-func Test_createDB(t *testing.T) {
-	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-	if err != nil {
-		t.Fatal("error creating mock database")
-	}
-	defer db.Close()
+		t.Run("invalid slug", func(t *testing.T) {
+			for _, slug := range []string{"", "TEST\n" + strconv.Itoa(testId), "\xff", strings.Repeat("a", models.MaxSlugLength+1)} {
+				_, err := addSegmentToDB(context.Background(), db, slug, 0)
+				if !errors.Is(err, models.ErrInvalidSlug) {
+					t.Errorf("got err = %v for slug %q, expected %v", err, slug, models.ErrInvalidSlug)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
 
-	for i := 0; i < 10; i++ {
-		query :=
-			`CREATE TABLE IF NOT EXISTS user_segment_relations (
-			user_id INTEGER,
-			segment_id INTEGER,
-			CONSTRAINT unique_user_segment UNIQUE (user_id, segment_id)
-		);
-		
-		CREATE TABLE IF NOT EXISTS segments (
-			id SERIAL UNIQUE,
-			slug TEXT PRIMARY KEY
-		);`
+		t.Run("slug check violation", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(query).WithArgs(testSlug, 0).WillReturnError(&pq.Error{Code: "23514", Table: "segments", Constraint: "segments_slug_check"})
+			mock.ExpectRollback()
 
-		t.Run("normal case", func(t *testing.T) {
-			mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 1))
+			_, err := addSegmentToDB(context.Background(), db, testSlug, 0)
+			if !errors.Is(err, models.ErrInvalidSlug) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrInvalidSlug)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("wrong case", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(query).WithArgs(testSlug, 0).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
 
-			err = checkResponce(createDB(db), nil, mock, t)
+			_, err := addSegmentToDB(context.Background(), db, testSlug, 0)
+			err = checkResponce(err, fmt.Errorf("error while adding segment to the database: %s", testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
 		})
 
-		t.Run("error while creating tables", func(t *testing.T) {
-			mock.ExpectExec(query).WillReturnError(errors.New("test error"))
+		t.Run("error while starting transaction", func(t *testing.T) {
+			mock.ExpectBegin().WillReturnError(errors.New(testErrText))
 
-			err = checkResponce(createDB(db), errors.New("error while creating tables: test error"), mock, t)
+			_, err := addSegmentToDB(context.Background(), db, testSlug, 0)
+			err = checkResponce(err, fmt.Errorf("%s%s", startTransactionErrText, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while commiting transaction", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(query).WithArgs(testSlug, 0).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testId))
+			mock.ExpectCommit().WillReturnError(errors.New(testErrText))
+
+			_, err := addSegmentToDB(context.Background(), db, testSlug, 0)
+			err = checkResponce(err, fmt.Errorf("error while committing transaction: %s", testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
@@ -123,12 +167,7 @@ func Test_createDB(t *testing.T) {
 	}
 }
 
-const (
-	startTransactionErrText  = "error while starting transaction: "
-	commitTransactionErrText = "error while committing transaction: "
-)
-
-func Test_addSegmentToDB(t *testing.T) {
+func Test_deleteSegmentFromDB(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		t.Fatal("error creating mock database")
@@ -140,54 +179,41 @@ func Test_addSegmentToDB(t *testing.T) {
 			testId      = rand.Int()
 			testErrText = "test error " + strconv.Itoa(testId)
 			testSlug    = "TEST " + strconv.Itoa(testId)
-			query       = "INSERT INTO segments (slug) VALUES ($1) RETURNING id;"
+			query       = `WITH deleted AS (
+				UPDATE segments SET deleted_at = now() WHERE slug = $1 AND deleted_at IS NULL RETURNING id
+			), history AS (
+				INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+				SELECT user_id, $1, 'remove', LEAST(COALESCE(expires_at, now()), now()) FROM user_segment_relations WHERE segment_id = (SELECT id FROM deleted)
+			)
+			SELECT id FROM deleted;`
 		)
 
 		t.Run("normal case", func(t *testing.T) {
-			mock.ExpectBegin()
 			mock.ExpectQuery(query).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testId))
-			mock.ExpectCommit()
 
-			id, err := addSegmentToDB(db, testSlug)
-			err = checkResponce(err, nil, mock, t)
+			err = checkResponce(deleteSegmentFromDB(context.Background(), db, testSlug), nil, mock, t)
 			if err != nil {
 				t.Error(err)
 			}
-
-			if id != testId {
-				t.Fatalf("got id = %d, expected %d", id, testId)
-			}
 		})
 
-		t.Run("wrong case", func(t *testing.T) {
-			mock.ExpectBegin()
-			mock.ExpectQuery(query).WithArgs(testSlug).WillReturnError(errors.New(testErrText))
-			mock.ExpectRollback()
+		t.Run("not found case", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
-			_, err := addSegmentToDB(db, testSlug)
-			err = checkResponce(err, fmt.Errorf("error while adding segment to the database: %s", testErrText), mock, t)
-			if err != nil {
-				t.Error(err)
+			err := deleteSegmentFromDB(context.Background(), db, testSlug)
+			if !errors.Is(err, models.ErrSegmentNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
 			}
-		})
-
-		t.Run("error while starting transaction", func(t *testing.T) {
-			mock.ExpectBegin().WillReturnError(errors.New(testErrText))
-
-			_, err := addSegmentToDB(db, testSlug)
-			err = checkResponce(err, fmt.Errorf("%s%s", startTransactionErrText, testErrText), mock, t)
-			if err != nil {
+			if err = mock.ExpectationsWereMet(); err != nil {
 				t.Error(err)
 			}
 		})
 
-		t.Run("error while commiting transaction", func(t *testing.T) {
-			mock.ExpectBegin()
-			mock.ExpectQuery(query).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testId))
-			mock.ExpectCommit().WillReturnError(errors.New(testErrText))
+		t.Run("wrong case", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testSlug).WillReturnError(errors.New(testErrText))
 
-			_, err := addSegmentToDB(db, testSlug)
-			err = checkResponce(err, fmt.Errorf("error while committing transaction: %s", testErrText), mock, t)
+			err = checkResponce(deleteSegmentFromDB(context.Background(), db, testSlug),
+				fmt.Errorf("error while deleting segment with slug = %s from the database: %s", testSlug, testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
@@ -195,7 +221,7 @@ func Test_addSegmentToDB(t *testing.T) {
 	}
 }
 
-func Test_deleteSegmentFromDB(t *testing.T) {
+func Test_restoreSegmentInDB(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	if err != nil {
 		t.Fatal("error creating mock database")
@@ -207,39 +233,65 @@ func Test_deleteSegmentFromDB(t *testing.T) {
 			testId      = rand.Int()
 			testErrText = "test error " + strconv.Itoa(testId)
 			testSlug    = "TEST " + strconv.Itoa(testId)
-			queries     = []string{`DELETE FROM user_segment_relations WHERE segment_id = (SELECT id FROM segments WHERE slug = $1);`,
-				`DELETE FROM segments WHERE slug = $1;`}
+			testPercent = 1 + rand.Intn(100)
+			queries     = []string{
+				`UPDATE segments SET deleted_at = NULL WHERE slug = $1 AND deleted_at IS NOT NULL RETURNING id, auto_percent;`,
+				`DELETE FROM user_segment_relations WHERE segment_id = $1 AND expires_at <= now();`,
+				`INSERT INTO user_segment_history (user_id, segment_slug, operation) SELECT user_id, $2::text, 'add' FROM user_segment_relations WHERE segment_id = $1;`,
+				rolloutQuery,
+			}
+			errStr = "error while restoring segment %q in the database: %s"
 		)
 
 		t.Run("normal case", func(t *testing.T) {
 			mock.ExpectBegin()
-			mock.ExpectExec(queries[0]).WithArgs(testSlug).WillReturnResult(sqlmock.NewResult(0, 1))
-			mock.ExpectExec(queries[1]).WithArgs(testSlug).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id", "auto_percent"}).AddRow(testId, 0))
+			mock.ExpectExec(queries[1]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(10)))
+			mock.ExpectExec(queries[2]).WithArgs(testId, testSlug).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(100)))
 			mock.ExpectCommit()
 
-			err = checkResponce(deleteSegmentFromDB(db, testSlug), nil, mock, t)
+			err = checkResponce(restoreSegmentInDB(context.Background(), db, testSlug), nil, mock, t)
 			if err != nil {
 				t.Error(err)
 			}
 		})
 
-		t.Run("wrong case", func(t *testing.T) {
-			expectedErr := fmt.Errorf("error while deleting segment with slug = %s from the database: %s", testSlug, testErrText)
+		t.Run("normal case - auto percent", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id", "auto_percent"}).AddRow(testId, testPercent))
+			mock.ExpectExec(queries[1]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(10)))
+			mock.ExpectExec(queries[2]).WithArgs(testId, testSlug).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(100)))
+			mock.ExpectExec(queries[3]).WithArgs(testId, testSlug, testPercent).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(100)))
+			mock.ExpectCommit()
+
+			err = checkResponce(restoreSegmentInDB(context.Background(), db, testSlug), nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
 
+		t.Run("deleted segment not found", func(t *testing.T) {
 			mock.ExpectBegin()
-			mock.ExpectExec(queries[0]).WillReturnError(errors.New(testErrText))
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id", "auto_percent"}))
 			mock.ExpectRollback()
 
-			err = checkResponce(deleteSegmentFromDB(db, testSlug), expectedErr, mock, t)
-			if err != nil {
+			err := restoreSegmentInDB(context.Background(), db, testSlug)
+			if !errors.Is(err, models.ErrSegmentNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
 				t.Error(err)
 			}
+		})
 
+		t.Run("error while restoring memberships", func(t *testing.T) {
 			mock.ExpectBegin()
-			mock.ExpectExec(queries[0]).WillReturnError(errors.New(testErrText))
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id", "auto_percent"}).AddRow(testId, 0))
+			mock.ExpectExec(queries[1]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(10)))
+			mock.ExpectExec(queries[2]).WithArgs(testId, testSlug).WillReturnError(errors.New(testErrText))
 			mock.ExpectRollback()
 
-			err = checkResponce(deleteSegmentFromDB(db, testSlug), expectedErr, mock, t)
+			err = checkResponce(restoreSegmentInDB(context.Background(), db, testSlug), fmt.Errorf(errStr, testSlug, testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
@@ -248,8 +300,7 @@ func Test_deleteSegmentFromDB(t *testing.T) {
 		t.Run("error while starting transaction", func(t *testing.T) {
 			mock.ExpectBegin().WillReturnError(errors.New(testErrText))
 
-			err = checkResponce(deleteSegmentFromDB(db, testSlug),
-				fmt.Errorf("%s%s", startTransactionErrText, testErrText), mock, t)
+			err = checkResponce(restoreSegmentInDB(context.Background(), db, testSlug), fmt.Errorf("%s%s", startTransactionErrText, testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
@@ -257,12 +308,57 @@ func Test_deleteSegmentFromDB(t *testing.T) {
 
 		t.Run("error while commiting transaction", func(t *testing.T) {
 			mock.ExpectBegin()
-			mock.ExpectExec(queries[0]).WithArgs(testSlug).WillReturnResult(sqlmock.NewResult(0, 1))
-			mock.ExpectExec(queries[1]).WithArgs(testSlug).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(queries[0]).WithArgs(testSlug).WillReturnRows(sqlmock.NewRows([]string{"id", "auto_percent"}).AddRow(testId, 0))
+			mock.ExpectExec(queries[1]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(10)))
+			mock.ExpectExec(queries[2]).WithArgs(testId, testSlug).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(100)))
 			mock.ExpectCommit().WillReturnError(errors.New(testErrText))
 
-			err = checkResponce(deleteSegmentFromDB(db, testSlug),
-				fmt.Errorf("%s%s", commitTransactionErrText, testErrText), mock, t)
+			err = checkResponce(restoreSegmentInDB(context.Background(), db, testSlug), fmt.Errorf("%s%s", commitTransactionErrText, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_purgeDeletedFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testErrText = "test error " + strconv.Itoa(rand.Int())
+			testBefore  = time.Now().Add(-time.Duration(rand.Intn(1000)) * time.Hour)
+			testCount   = rand.Intn(100)
+			query       = `WITH purged AS (
+				DELETE FROM segments WHERE deleted_at <= $1 RETURNING id
+			), relations AS (
+				DELETE FROM user_segment_relations WHERE segment_id IN (SELECT id FROM purged)
+			)
+			SELECT COUNT(*) FROM purged;`
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testBefore).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(testCount))
+
+			n, err := purgeDeletedFromDB(context.Background(), db, testBefore)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+			if n != testCount {
+				t.Fatalf("got n = %d, expected %d", n, testCount)
+			}
+		})
+
+		t.Run("wrong case", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testBefore).WillReturnError(errors.New(testErrText))
+
+			_, err := purgeDeletedFromDB(context.Background(), db, testBefore)
+			err = checkResponce(err, fmt.Errorf("error while purging deleted segments from the database: %s", testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
@@ -277,66 +373,277 @@ func Test_modifyUserInDB(t *testing.T) {
 	}
 	defer db.Close()
 
-	for i := 0; i < 1; i++ {
+	for i := 0; i < 10; i++ {
 		var (
 			testId      = rand.Int()
 			testErrText = "test error " + strconv.Itoa(testId)
-			testAppend  = make([]string, rand.Intn(15))
+			testAppend  = make([]models.SegmentAddition, rand.Intn(15))
 			testRemove  = make([]string, rand.Intn(15))
+			testSlugs   = make([]string, 0)
+			testIDs     = make(map[string]int)
 			queries     = []string{
-				`INSERT INTO user_segment_relations (user_id, segment_id) SELECT $1, id FROM segments WHERE slug = $2;`,
-				`DELETE FROM user_segment_relations WHERE user_id = $1 AND segment_id = (SELECT id FROM segments WHERE slug = $2);`,
+				`WITH added AS (
+				INSERT INTO user_segment_relations (user_id, segment_id, expires_at) VALUES ($1, $2, $4)
+				ON CONFLICT (user_id, segment_id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+				RETURNING user_id, xmax = 0 AS inserted
+			), history AS (
+				INSERT INTO user_segment_history (user_id, segment_slug, operation) SELECT user_id, $3::text, 'add' FROM added WHERE inserted
+			)
+			SELECT inserted FROM added;`,
+				`WITH removed AS (
+				DELETE FROM user_segment_relations WHERE user_id = $1 AND segment_id = $2 RETURNING user_id
+			)
+			INSERT INTO user_segment_history (user_id, segment_slug, operation) SELECT user_id, $3::text, 'remove' FROM removed;`,
+				`WITH expired AS (
+				DELETE FROM user_segment_relations WHERE user_id = $1 AND expires_at <= now() RETURNING user_id, segment_id, expires_at
+			)
+			INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+			SELECT expired.user_id, segments.slug, 'remove', expired.expires_at FROM expired JOIN segments ON segments.id = expired.segment_id
+			WHERE segments.deleted_at IS NULL;`,
+				`INSERT INTO users (id) VALUES ($1) ON CONFLICT DO NOTHING;`,
+				`SELECT id FROM users WHERE id = $1 FOR SHARE;`,
+				`SELECT id, slug FROM segments WHERE slug = ANY($1) AND deleted_at IS NULL FOR SHARE;`,
 			}
 		)
 
 		for j := 0; j < len(testAppend); j++ {
-			testAppend[j] = "TEST " + strconv.Itoa(rand.Int())
+			testAppend[j].Slug = "TEST " + strconv.Itoa(rand.Int())
+			if rand.Intn(2) == 0 {
+				expiresAt := time.Now().Add(time.Duration(rand.Intn(1000)) * time.Hour)
+				testAppend[j].ExpiresAt = &expiresAt
+			}
+			testSlugs = append(testSlugs, testAppend[j].Slug)
 		}
 		for j := 0; j < len(testRemove); j++ {
 			testRemove[j] = "TEST " + strconv.Itoa(rand.Int())
+			testSlugs = append(testSlugs, testRemove[j])
+		}
+		for _, slug := range testSlugs {
+			testIDs[slug] = rand.Int()
 		}
 
-		t.Run("normal case - segment and user could already exist or not", func(t *testing.T) {
-			mock.ExpectBegin()
+		// expectLock - ожидание блокировки сегментов, из которых существуют только указанные в ids.
+		expectLock := func(ids map[string]int) {
+			if len(testSlugs) == 0 {
+				return
+			}
+			rows := sqlmock.NewRows([]string{"id", "slug"})
+			for slug, id := range ids {
+				rows.AddRow(id, slug)
+			}
+			mock.ExpectQuery(queries[5]).WithArgs(pq.Array(testSlugs)).WillReturnRows(rows)
+		}
+		// expectChanges - ожидание изменений для существующих сегментов.
+		//
+		// Возвращает: ожидаемый отчёт.
+		expectChanges := func(ids map[string]int) models.ModificationReport {
+			report := models.ModificationReport{Append: []models.SlugStatus{}, Remove: []models.SlugStatus{}}
 			for _, segment := range testAppend {
-				mock.ExpectExec(
-					queries[0]).WithArgs(testId, segment).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
+				id, ok := ids[segment.Slug]
+				if !ok {
+					report.Append = append(report.Append, models.SlugStatus{Slug: segment.Slug, Status: models.StatusUnknown})
+					continue
+				}
+				inserted := rand.Intn(2) == 0
+				mock.ExpectQuery(queries[0]).WithArgs(testId, id, segment.Slug, segment.ExpiresAt).
+					WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(inserted))
+				if inserted {
+					report.Append = append(report.Append, models.SlugStatus{Slug: segment.Slug, Status: models.StatusAdded})
+				} else {
+					report.Append = append(report.Append, models.SlugStatus{Slug: segment.Slug, Status: models.StatusAlreadyPresent})
+				}
 			}
-			for _, segment := range testRemove {
-				mock.ExpectExec(
-					queries[1]).WithArgs(testId, segment).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
+			for _, slug := range testRemove {
+				id, ok := ids[slug]
+				if !ok {
+					report.Remove = append(report.Remove, models.SlugStatus{Slug: slug, Status: models.StatusUnknown})
+					continue
+				}
+				n := rand.Int63n(2)
+				mock.ExpectExec(queries[1]).WithArgs(testId, id, slug).WillReturnResult(sqlmock.NewResult(0, n))
+				if n > 0 {
+					report.Remove = append(report.Remove, models.SlugStatus{Slug: slug, Status: models.StatusRemoved})
+				} else {
+					report.Remove = append(report.Remove, models.SlugStatus{Slug: slug, Status: models.StatusNotMember})
+				}
 			}
+			return report
+		}
+		// someIDs - id случайной части сегментов и названия остальных.
+		someIDs := func() (map[string]int, []string) {
+			ids, unknown := make(map[string]int), make([]string, 0)
+			for _, slug := range testSlugs {
+				if rand.Intn(2) == 0 {
+					ids[slug] = testIDs[slug]
+				} else {
+					unknown = append(unknown, slug)
+				}
+			}
+			return ids, unknown
+		}
+
+		t.Run("normal case - segments exist, user could already exist or not", func(t *testing.T) {
+			mock.ExpectBegin()
+			expectLock(testIDs)
+			mock.ExpectExec(queries[3]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[2]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
+			expected := expectChanges(testIDs)
 			mock.ExpectCommit()
 
-			err = checkResponce(modifyUserInDB(db, testId, testAppend, testRemove), nil, mock, t)
+			report, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, nil, mock, t)
 			if err != nil {
 				t.Error(err)
 			}
+			if !reflect.DeepEqual(report, expected) {
+				t.Errorf("got report = %v, expected %v", report, expected)
+			}
 		})
 
-		t.Run("some relations already exist", func(t *testing.T) {
-			expectedErrStr := ""
+		t.Run("unknown segments", func(t *testing.T) {
+			ids, unknown := someIDs()
+			if len(unknown) == 0 {
+				return
+			}
+			mock.ExpectBegin()
+			expectLock(ids)
+			mock.ExpectRollback()
+
+			_, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, fmt.Errorf("segments %q: %w", unknown, models.ErrSegmentNotFound), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
 
+		t.Run("unknown segments - partial", func(t *testing.T) {
+			ids, _ := someIDs()
 			mock.ExpectBegin()
+			expectLock(ids)
+			mock.ExpectExec(queries[3]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[2]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
+			expected := expectChanges(ids)
+			mock.ExpectCommit()
+
+			report, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, true, false)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(report, expected) {
+				t.Errorf("got report = %v, expected %v", report, expected)
+			}
+		})
+
+		t.Run("error while adding user to the segment", func(t *testing.T) {
+			if len(testAppend) == 0 {
+				return
+			}
+			segment := testAppend[0]
+			mock.ExpectBegin()
+			expectLock(testIDs)
+			mock.ExpectExec(queries[3]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[2]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
+			mock.ExpectQuery(queries[0]).WithArgs(testId, testIDs[segment.Slug], segment.Slug, segment.ExpiresAt).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			_, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, fmt.Errorf(`error while adding user %d to the segment "%s": %s`, testId, segment.Slug, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while removing user from the segment", func(t *testing.T) {
+			if len(testRemove) == 0 {
+				return
+			}
+			mock.ExpectBegin()
+			expectLock(testIDs)
+			mock.ExpectExec(queries[3]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[2]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
 			for _, segment := range testAppend {
-				if rand.Intn(2) == 0 {
-					mock.ExpectExec(
-						queries[0]).WithArgs(testId, segment).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
-				} else {
-					err := fmt.Errorf("duplicate key value violates unique constraint %d", rand.Int())
-					mock.ExpectExec(
-						queries[0]).WithArgs(testId, segment).WillReturnError(err)
+				mock.ExpectQuery(queries[0]).WithArgs(testId, testIDs[segment.Slug], segment.Slug, segment.ExpiresAt).
+					WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+			}
+			mock.ExpectExec(queries[1]).WithArgs(testId, testIDs[testRemove[0]], testRemove[0]).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
 
-					expectedErrStr += fmt.Sprintf(`error while adding user %d to the segment "%s": %s`, testId, segment, err.Error())
-					expectedErrStr += fmt.Sprintln()
-				}
+			_, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, fmt.Errorf(`error while removing user %d from the segment "%s": %s`, testId, testRemove[0], testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
 			}
-			for _, segment := range testRemove {
-				mock.ExpectExec(queries[1]).WithArgs(testId, segment).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
+		})
+
+		t.Run("error while getting segments", func(t *testing.T) {
+			if len(testSlugs) == 0 {
+				return
 			}
+			mock.ExpectBegin()
+			mock.ExpectQuery(queries[5]).WithArgs(pq.Array(testSlugs)).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			_, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, fmt.Errorf("error while getting segments from the database: %s", testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("strict mode", func(t *testing.T) {
+			mock.ExpectBegin()
+			expectLock(testIDs)
+			mock.ExpectQuery(queries[4]).WithArgs(testId).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testId))
+			mock.ExpectExec(queries[2]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			expected := expectChanges(testIDs)
 			mock.ExpectCommit()
 
-			err = checkResponce(modifyUserInDB(db, testId, testAppend, testRemove), errors.New(expectedErrStr), mock, t)
+			report, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, true)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(report, expected) {
+				t.Errorf("got report = %v, expected %v", report, expected)
+			}
+
+			mock.ExpectBegin()
+			expectLock(testIDs)
+			mock.ExpectQuery(queries[4]).WithArgs(testId).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectRollback()
+
+			_, err = modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, true)
+			if !errors.Is(err, models.ErrUserNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrUserNotFound)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while registering user", func(t *testing.T) {
+			mock.ExpectBegin()
+			expectLock(testIDs)
+			mock.ExpectExec(queries[3]).WithArgs(testId).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			_, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, fmt.Errorf("error while registering user %d: %s", testId, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while removing expired relations", func(t *testing.T) {
+			mock.ExpectBegin()
+			expectLock(testIDs)
+			mock.ExpectExec(queries[3]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[2]).WithArgs(testId).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			_, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, fmt.Errorf("error while removing user %d's expired segments: %s", testId, testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
@@ -345,7 +652,8 @@ func Test_modifyUserInDB(t *testing.T) {
 		t.Run("error while starting transaction", func(t *testing.T) {
 			mock.ExpectBegin().WillReturnError(errors.New(testErrText))
 
-			err = checkResponce(modifyUserInDB(db, testId, testAppend, testRemove), fmt.Errorf("%s%s", startTransactionErrText, testErrText), mock, t)
+			_, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, fmt.Errorf("%s%s", startTransactionErrText, testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
@@ -353,17 +661,14 @@ func Test_modifyUserInDB(t *testing.T) {
 
 		t.Run("error while commiting transaction", func(t *testing.T) {
 			mock.ExpectBegin()
-			for _, segment := range testAppend {
-				mock.ExpectExec(
-					queries[0]).WithArgs(testId, segment).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
-			}
-			for _, segment := range testRemove {
-				mock.ExpectExec(
-					queries[1]).WithArgs(testId, segment).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
-			}
+			expectLock(testIDs)
+			mock.ExpectExec(queries[3]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(queries[2]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(2)))
+			expectChanges(testIDs)
 			mock.ExpectCommit().WillReturnError(errors.New(testErrText))
 
-			err = checkResponce(modifyUserInDB(db, testId, testAppend, testRemove), fmt.Errorf("%s%s", commitTransactionErrText, testErrText), mock, t)
+			_, err := modifyUserInDB(context.Background(), db, testId, testAppend, testRemove, false, false)
+			err = checkResponce(err, fmt.Errorf("%s%s", commitTransactionErrText, testErrText), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
@@ -380,43 +685,181 @@ func Test_GetUserRelationsInDB(t *testing.T) {
 
 	for i := 0; i < 1; i++ {
 		var (
-			testId       = rand.Int()
-			testErr      = errors.New("test error " + strconv.Itoa(testId))
-			testSegments = make([]string, rand.Intn(15))
-			query        = `SELECT slug FROM segments WHERE id IN (SELECT segment_id FROM user_segment_relations WHERE user_id = $1);`
+			testId        = rand.Int()
+			testErr       = errors.New("test error " + strconv.Itoa(testId))
+			testRelations = make([]models.Relation, rand.Intn(15))
+			query         = `SELECT segments.slug, user_segment_relations.expires_at FROM segments
+			JOIN user_segment_relations ON segments.id = user_segment_relations.segment_id
+			WHERE user_segment_relations.user_id = $1 AND (user_segment_relations.expires_at IS NULL OR user_segment_relations.expires_at > now())
+		AND segments.deleted_at IS NULL;`
 		)
 
-		for j := 0; j < len(testSegments); j++ {
-			testSegments[j] = "TEST " + strconv.Itoa(rand.Int())
+		for j := 0; j < len(testRelations); j++ {
+			testRelations[j].Slug = "TEST " + strconv.Itoa(rand.Int())
+			if rand.Intn(2) == 0 {
+				expiresAt := time.Now().Add(time.Duration(rand.Intn(1000)) * time.Hour)
+				testRelations[j].ExpiresAt = &expiresAt
+			}
 		}
 
 		t.Run("normal case", func(t *testing.T) {
-			rows := sqlmock.NewRows([]string{"slug"})
-			for _, segment := range testSegments {
-				rows.AddRow(segment)
+			rows := sqlmock.NewRows([]string{"slug", "expires_at"})
+			for _, relation := range testRelations {
+				if relation.ExpiresAt == nil {
+					rows.AddRow(relation.Slug, nil)
+				} else {
+					rows.AddRow(relation.Slug, *relation.ExpiresAt)
+				}
 			}
 			mock.ExpectQuery(query).WithArgs(testId).WillReturnRows(rows)
 
-			segments, err := getUserRelationsInDB(db, testId)
+			relations, err := getUserRelationsInDB(context.Background(), db, testId)
 			err = checkResponce(err, nil, mock, t)
 			if err != nil {
 				t.Error(err)
 			}
 
-			if reflect.DeepEqual(segments, testSegments) == false {
-				t.Fatalf("got segments = %v, expected %v", segments, testSegments)
+			if reflect.DeepEqual(relations, testRelations) == false {
+				t.Fatalf("got relations = %v, expected %v", relations, testRelations)
 			}
 		})
 
 		t.Run("error while getting user's segments from the database", func(t *testing.T) {
 			mock.ExpectQuery(query).WithArgs(testId).WillReturnError(testErr)
 
-			_, err := getUserRelationsInDB(db, testId)
+			_, err := getUserRelationsInDB(context.Background(), db, testId)
 			err = checkResponce(err, fmt.Errorf("error while getting user %d's segments from the database: %s", testId, testErr), mock, t)
 			if err != nil {
 				t.Error(err)
 			}
 		})
+
+		t.Run("error while iterating over user's segments", func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"slug", "expires_at"}).AddRow("TEST", nil).RowError(0, testErr)
+			mock.ExpectQuery(query).WithArgs(testId).WillReturnRows(rows)
+
+			_, err := getUserRelationsInDB(context.Background(), db, testId)
+			err = checkResponce(err, fmt.Errorf("error while getting user %d's segments from the database: %s", testId, testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_deleteExpiredFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testCount = rand.Intn(1000)
+			testErr   = errors.New("test error " + strconv.Itoa(testCount))
+			query     = `WITH expired AS (
+				DELETE FROM user_segment_relations WHERE expires_at <= now() RETURNING user_id, segment_id, expires_at
+			), history AS (
+				INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+				SELECT expired.user_id, segments.slug, 'remove', expired.expires_at FROM expired JOIN segments ON segments.id = expired.segment_id
+				WHERE segments.deleted_at IS NULL
+			)
+			SELECT COUNT(*) FROM expired;`
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(testCount))
+
+			n, err := deleteExpiredFromDB(context.Background(), db)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if n != testCount {
+				t.Fatalf("got count = %d, expected %d", n, testCount)
+			}
+		})
+
+		t.Run("error while deleting expired relations", func(t *testing.T) {
+			mock.ExpectQuery(query).WillReturnError(testErr)
+
+			_, err := deleteExpiredFromDB(context.Background(), db)
+			err = checkResponce(err, fmt.Errorf("error while deleting expired relations from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_getHistoryFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testId      = rand.Int()
+			testErr     = errors.New("test error " + strconv.Itoa(testId))
+			testFrom    = time.Date(2000+rand.Intn(30), time.Month(1+rand.Intn(12)), 1, 0, 0, 0, 0, time.UTC)
+			testTo      = testFrom.AddDate(0, 1, 0)
+			testRecords = make([]models.HistoryRecord, rand.Intn(15))
+			query       = `SELECT user_id, segment_slug, operation, created_at FROM user_segment_history WHERE created_at >= $1 AND created_at < $2 ORDER BY created_at, user_id;`
+		)
+
+		for j := 0; j < len(testRecords); j++ {
+			testRecords[j] = models.HistoryRecord{
+				UserID:    rand.Int(),
+				Slug:      "TEST " + strconv.Itoa(rand.Int()),
+				Operation: []string{models.OperationAdd, models.OperationRemove}[rand.Intn(2)],
+				Time:      testFrom.Add(time.Duration(j) * time.Hour),
+			}
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"user_id", "segment_slug", "operation", "created_at"})
+			for _, record := range testRecords {
+				rows.AddRow(record.UserID, record.Slug, record.Operation, record.Time)
+			}
+			mock.ExpectQuery(query).WithArgs(testFrom, testTo).WillReturnRows(rows)
+
+			records, err := getHistoryFromDB(context.Background(), db, testFrom, testTo)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if reflect.DeepEqual(records, testRecords) == false {
+				t.Fatalf("got records = %v, expected %v", records, testRecords)
+			}
+		})
+
+		t.Run("error while getting history from the database", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testFrom, testTo).WillReturnError(testErr)
+
+			_, err := getHistoryFromDB(context.Background(), db, testFrom, testTo)
+			err = checkResponce(err, fmt.Errorf("error while getting history from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while iterating over history", func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"user_id", "segment_slug", "operation", "created_at"}).
+				AddRow(testId, "TEST", models.OperationAdd, testFrom).
+				RowError(0, testErr)
+			mock.ExpectQuery(query).WithArgs(testFrom, testTo).WillReturnRows(rows)
+
+			_, err := getHistoryFromDB(context.Background(), db, testFrom, testTo)
+			err = checkResponce(err, fmt.Errorf("error while getting history from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
 	}
 }
 
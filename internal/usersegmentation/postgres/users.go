@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/lib/pq"
+)
+
+// addUserToDB - регистрация пользователя в базе данных.
+//
+// Принимает: контекст, указатель на базу данных и id пользователя.
+//
+// Возвращает: ошибку (models.ErrUserExists, если пользователь уже зарегистрирован).
+func addUserToDB(ctx context.Context, db *sql.DB, id int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("error while starting transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	registered, err := registerUserInTx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if !registered {
+		return fmt.Errorf("user %d: %w", id, models.ErrUserExists)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.New("error while committing transaction: " + err.Error())
+	}
+
+	return nil
+}
+
+// getUsersFromDB - получение списка зарегистрированных пользователей из базы данных.
+//
+// Принимает: контекст, указатель на базу данных, максимальное количество пользователей и смещение.
+//
+// Возвращает: список пользователей, упорядоченный по id, и ошибку.
+func getUsersFromDB(ctx context.Context, db *sql.DB, limit int, offset int) ([]models.User, error) {
+	q := `SELECT id, created_at FROM users ORDER BY id LIMIT $1 OFFSET $2;`
+	rows, err := db.QueryContext(ctx, q, limit, offset)
+	if err != nil {
+		return []models.User{}, fmt.Errorf("error while getting users from the database: %s", err.Error())
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		err = rows.Scan(&user.ID, &user.CreatedAt)
+		if err != nil {
+			return []models.User{}, fmt.Errorf("error while getting users from the database: %s", err.Error())
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return []models.User{}, fmt.Errorf("error while getting users from the database: %s", err.Error())
+	}
+
+	return users, nil
+}
+
+// deleteUserFromDB - удаление пользователя и всех его отношений с сегментами из базы данных.
+// Удаление пользователя из сегментов записывается в историю.
+//
+// Принимает: контекст, указатель на базу данных и id пользователя.
+//
+// Возвращает: ошибку (models.ErrUserNotFound, если пользователь не зарегистрирован).
+func deleteUserFromDB(ctx context.Context, db *sql.DB, id int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("error while starting transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	errStr := "error while deleting user %d from the database: %s"
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1;`, id)
+	if err != nil {
+		return fmt.Errorf(errStr, id, err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf(errStr, id, err.Error())
+	}
+	if n == 0 {
+		return fmt.Errorf("user %d: %w", id, models.ErrUserNotFound)
+	}
+
+	q := `WITH removed AS (
+		DELETE FROM user_segment_relations WHERE user_id = $1 RETURNING segment_id, expires_at
+	)
+	INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+	SELECT $1::integer, segments.slug, 'remove', LEAST(COALESCE(removed.expires_at, now()), now()) FROM removed JOIN segments ON segments.id = removed.segment_id
+	WHERE segments.deleted_at IS NULL;`
+	if _, err = tx.ExecContext(ctx, q, id); err != nil {
+		return fmt.Errorf(errStr, id, err.Error())
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.New("error while committing transaction: " + err.Error())
+	}
+
+	return nil
+}
+
+// registerUserInTx - регистрация пользователя в рамках транзакции.
+// Новый пользователь добавляется в сегменты с автоматическим добавлением, в процент которых он попадает (см. models.InRollout).
+// Если пользователь уже зарегистрирован, то ничего не происходит.
+//
+// Принимает: контекст, транзакцию и id пользователя.
+//
+// Возвращает: флаг регистрации (false, если пользователь уже был зарегистрирован) и ошибку.
+func registerUserInTx(ctx context.Context, tx *sql.Tx, id int) (bool, error) {
+	errStr := "error while registering user %d: %s"
+	res, err := tx.ExecContext(ctx, `INSERT INTO users (id) VALUES ($1) ON CONFLICT DO NOTHING;`, id)
+	if err != nil {
+		return false, fmt.Errorf(errStr, id, err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf(errStr, id, err.Error())
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	q := `WITH added AS (
+		INSERT INTO user_segment_relations (user_id, segment_id) SELECT $1::integer, id FROM segments
+		WHERE deleted_at IS NULL AND auto_percent > 0 AND ('x' || substr(md5(slug || ':' || $1::integer::text), 1, 8))::bit(32)::bigint % 100 < auto_percent
+		ON CONFLICT (user_id, segment_id) DO NOTHING
+		RETURNING segment_id
+	)
+	INSERT INTO user_segment_history (user_id, segment_slug, operation)
+	SELECT $1::integer, segments.slug, 'add' FROM added JOIN segments ON segments.id = added.segment_id;`
+	if _, err = tx.ExecContext(ctx, q, id); err != nil {
+		return false, fmt.Errorf(errStr, id, err.Error())
+	}
+
+	return true, nil
+}
+
+// lockUserInTx - проверка существования пользователя и его блокировка от удаления до конца транзакции.
+//
+// Принимает: контекст, транзакцию и id пользователя.
+//
+// Возвращает: ошибку (models.ErrUserNotFound, если пользователь не зарегистрирован).
+func lockUserInTx(ctx context.Context, tx *sql.Tx, id int) error {
+	err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = $1 FOR SHARE;`, id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %d: %w", id, models.ErrUserNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("error while checking user %d: %s", id, err.Error())
+	}
+
+	return nil
+}
+
+// registerUsersInTx - регистрация нескольких пользователей в рамках транзакции, как registerUserInTx для каждого из них.
+//
+// Принимает: контекст, транзакцию и id пользователей.
+//
+// Возвращает: ошибку.
+func registerUsersInTx(ctx context.Context, tx *sql.Tx, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	q := `WITH registered AS (
+		INSERT INTO users (id) SELECT DISTINCT unnest($1::integer[]) ON CONFLICT DO NOTHING RETURNING id
+	), added AS (
+		INSERT INTO user_segment_relations (user_id, segment_id) SELECT registered.id, segments.id FROM registered CROSS JOIN segments
+		WHERE segments.deleted_at IS NULL AND segments.auto_percent > 0 AND ('x' || substr(md5(segments.slug || ':' || registered.id::text), 1, 8))::bit(32)::bigint % 100 < segments.auto_percent
+		ON CONFLICT (user_id, segment_id) DO NOTHING
+		RETURNING user_id, segment_id
+	)
+	INSERT INTO user_segment_history (user_id, segment_slug, operation)
+	SELECT added.user_id, segments.slug, 'add' FROM added JOIN segments ON segments.id = added.segment_id;`
+	if _, err := tx.ExecContext(ctx, q, pq.Array(ids)); err != nil {
+		return fmt.Errorf("error while registering users: %s", err.Error())
+	}
+
+	return nil
+}
+
+// lockUsersInTx - проверка существования нескольких пользователей и их блокировка от удаления до конца транзакции.
+//
+// Принимает: контекст, транзакцию и id пользователей.
+//
+// Возвращает: множество id зарегистрированных пользователей и ошибку.
+func lockUsersInTx(ctx context.Context, tx *sql.Tx, ids []int) (map[int]bool, error) {
+	registered := make(map[int]bool, len(ids))
+	if len(ids) == 0 {
+		return registered, nil
+	}
+
+	errStr := "error while checking users: %s"
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM users WHERE id = ANY($1::integer[]) FOR SHARE;`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf(errStr, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf(errStr, err.Error())
+		}
+		registered[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf(errStr, err.Error())
+	}
+
+	return registered, nil
+}
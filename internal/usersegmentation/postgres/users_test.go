@@ -0,0 +1,248 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+var (
+	registerUserQueries = []string{
+		`INSERT INTO users (id) VALUES ($1) ON CONFLICT DO NOTHING;`,
+		`WITH added AS (
+			INSERT INTO user_segment_relations (user_id, segment_id) SELECT $1::integer, id FROM segments
+			WHERE deleted_at IS NULL AND auto_percent > 0 AND ('x' || substr(md5(slug || ':' || $1::integer::text), 1, 8))::bit(32)::bigint % 100 < auto_percent
+			ON CONFLICT (user_id, segment_id) DO NOTHING
+			RETURNING segment_id
+		)
+		INSERT INTO user_segment_history (user_id, segment_slug, operation)
+		SELECT $1::integer, segments.slug, 'add' FROM added JOIN segments ON segments.id = added.segment_id;`,
+	}
+)
+
+func Test_addUserToDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testId      = rand.Int()
+			testErrText = "test error " + strconv.Itoa(testId)
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(registerUserQueries[0]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(registerUserQueries[1]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(10)))
+			mock.ExpectCommit()
+
+			err = checkResponce(addUserToDB(context.Background(), db, testId), nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("user already exists", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(registerUserQueries[0]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectRollback()
+
+			err := addUserToDB(context.Background(), db, testId)
+			if !errors.Is(err, models.ErrUserExists) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrUserExists)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while registering user", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(registerUserQueries[0]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(registerUserQueries[1]).WithArgs(testId).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			err = checkResponce(addUserToDB(context.Background(), db, testId), fmt.Errorf("error while registering user %d: %s", testId, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while starting transaction", func(t *testing.T) {
+			mock.ExpectBegin().WillReturnError(errors.New(testErrText))
+
+			err = checkResponce(addUserToDB(context.Background(), db, testId), fmt.Errorf("%s%s", startTransactionErrText, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while commiting transaction", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(registerUserQueries[0]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(registerUserQueries[1]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(10)))
+			mock.ExpectCommit().WillReturnError(errors.New(testErrText))
+
+			err = checkResponce(addUserToDB(context.Background(), db, testId), fmt.Errorf("%s%s", commitTransactionErrText, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_getUsersFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testLimit  = 1 + rand.Intn(1000)
+			testOffset = rand.Intn(1000)
+			testErr    = errors.New("test error " + strconv.Itoa(testLimit))
+			testUsers  = make([]models.User, rand.Intn(15))
+			query      = `SELECT id, created_at FROM users ORDER BY id LIMIT $1 OFFSET $2;`
+		)
+
+		for j := 0; j < len(testUsers); j++ {
+			testUsers[j] = models.User{ID: j, CreatedAt: time.Now().Add(-time.Duration(rand.Intn(1000)) * time.Hour)}
+		}
+
+		t.Run("normal case", func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"id", "created_at"})
+			for _, user := range testUsers {
+				rows.AddRow(user.ID, user.CreatedAt)
+			}
+			mock.ExpectQuery(query).WithArgs(testLimit, testOffset).WillReturnRows(rows)
+
+			users, err := getUsersFromDB(context.Background(), db, testLimit, testOffset)
+			err = checkResponce(err, nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if reflect.DeepEqual(users, testUsers) == false {
+				t.Fatalf("got users = %v, expected %v", users, testUsers)
+			}
+		})
+
+		t.Run("error while getting users from the database", func(t *testing.T) {
+			mock.ExpectQuery(query).WithArgs(testLimit, testOffset).WillReturnError(testErr)
+
+			_, err := getUsersFromDB(context.Background(), db, testLimit, testOffset)
+			err = checkResponce(err, fmt.Errorf("error while getting users from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while iterating over users", func(t *testing.T) {
+			rows := sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()).RowError(0, testErr)
+			mock.ExpectQuery(query).WithArgs(testLimit, testOffset).WillReturnRows(rows)
+
+			_, err := getUsersFromDB(context.Background(), db, testLimit, testOffset)
+			err = checkResponce(err, fmt.Errorf("error while getting users from the database: %s", testErr), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func Test_deleteUserFromDB(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal("error creating mock database")
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		var (
+			testId      = rand.Int()
+			testErrText = "test error " + strconv.Itoa(testId)
+			queries     = []string{
+				`DELETE FROM users WHERE id = $1;`,
+				`WITH removed AS (
+					DELETE FROM user_segment_relations WHERE user_id = $1 RETURNING segment_id, expires_at
+				)
+				INSERT INTO user_segment_history (user_id, segment_slug, operation, created_at)
+				SELECT $1::integer, segments.slug, 'remove', LEAST(COALESCE(removed.expires_at, now()), now()) FROM removed JOIN segments ON segments.id = removed.segment_id
+		WHERE segments.deleted_at IS NULL;`,
+			}
+		)
+
+		t.Run("normal case", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(queries[0]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(queries[1]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(10)))
+			mock.ExpectCommit()
+
+			err = checkResponce(deleteUserFromDB(context.Background(), db, testId), nil, mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("user not found", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(queries[0]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectRollback()
+
+			err := deleteUserFromDB(context.Background(), db, testId)
+			if !errors.Is(err, models.ErrUserNotFound) {
+				t.Errorf("got err = %v, expected %v", err, models.ErrUserNotFound)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("wrong case", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(queries[0]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(queries[1]).WithArgs(testId).WillReturnError(errors.New(testErrText))
+			mock.ExpectRollback()
+
+			err = checkResponce(deleteUserFromDB(context.Background(), db, testId),
+				fmt.Errorf("error while deleting user %d from the database: %s", testId, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while starting transaction", func(t *testing.T) {
+			mock.ExpectBegin().WillReturnError(errors.New(testErrText))
+
+			err = checkResponce(deleteUserFromDB(context.Background(), db, testId), fmt.Errorf("%s%s", startTransactionErrText, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("error while commiting transaction", func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectExec(queries[0]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(queries[1]).WithArgs(testId).WillReturnResult(sqlmock.NewResult(0, rand.Int63n(10)))
+			mock.ExpectCommit().WillReturnError(errors.New(testErrText))
+
+			err = checkResponce(deleteUserFromDB(context.Background(), db, testId), fmt.Errorf("%s%s", commitTransactionErrText, testErrText), mock, t)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
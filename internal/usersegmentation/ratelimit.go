@@ -0,0 +1,92 @@
+package usersegmentation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/auth"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Заголовки ответа с состоянием ограничения частоты запросов клиента.
+const (
+	rateLimitLimitHeader     = "RateLimit-Limit"     // rateLimitLimitHeader - максимальное количество запросов подряд.
+	rateLimitRemainingHeader = "RateLimit-Remaining" // rateLimitRemainingHeader - количество запросов, которые можно выполнить сразу.
+	rateLimitResetHeader     = "RateLimit-Reset"     // rateLimitResetHeader - количество секунд до восстановления всех запросов.
+)
+
+// limitRate - создание промежуточного обработчика, ограничивающего частоту запросов клиентов к маршрутам класса.
+// Клиент определяется по идентификатору аутентифицированного клиента (ключа API или поля sub токена), а если аутентификация отключена - по IP адресу,
+// поэтому обработчик должен следовать за authorize. Ограничения классов не зависят друг от друга.
+// Если для класса ограничение не задано (см. Options.RateLimits), то пропускаются все запросы.
+//
+// Принимает: класс маршрутов.
+//
+// Возвращает: промежуточный обработчик, добавляющий к ответу заголовки RateLimit-* и возвращающий 429 с заголовком Retry-After, если частота превышена.
+func (app *App) limitRate(class ratelimit.Class) fiber.Handler {
+	limiter, ok := app.limiters[class]
+	if !ok {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		key := "ip:" + c.IP()
+		if principal, ok := auth.FromContext(c.UserContext()); ok {
+			key = "subject:" + principal.Subject
+		}
+
+		result := limiter.Allow(key, time.Now())
+		c.Set(rateLimitLimitHeader, strconv.Itoa(result.Limit))
+		c.Set(rateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+		c.Set(rateLimitResetHeader, strconv.Itoa(seconds(result.Reset)))
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(seconds(result.RetryAfter), 1)))
+			return sendError(c, fmt.Errorf("too many %s requests: %w", class, models.ErrRateLimited))
+		}
+
+		return c.Next()
+	}
+}
+
+// limitAuthFailures - аутентификация клиента с ограничением частоты неудачных попыток с его IP адреса (класс ratelimit.ClassAuth).
+// Пока корзина IP адреса пуста, учётные данные не проверяются, поэтому подбор ключей API и токенов не создаёт нагрузки на хранилище.
+// Корзину расходуют только неудачные попытки (models.ErrUnauthorized). Если для класса ограничение не задано (см. Options.RateLimits),
+// то попытки не ограничиваются.
+//
+// Принимает: IP адрес клиента и функцию аутентификации.
+//
+// Возвращает: клиента, время до следующей разрешённой попытки и ошибку (models.ErrRateLimited, если неудачные попытки исчерпаны).
+func (app *App) limitAuthFailures(ip string, authenticate func() (auth.Principal, error)) (auth.Principal, time.Duration, error) {
+	limiter, ok := app.limiters[ratelimit.ClassAuth]
+	if !ok {
+		principal, err := authenticate()
+		return principal, 0, err
+	}
+
+	key := "ip:" + ip
+	if result := limiter.Check(key, time.Now()); !result.Allowed {
+		return auth.Principal{}, result.RetryAfter, fmt.Errorf("too many failed authentication attempts: %w", models.ErrRateLimited)
+	}
+	principal, err := authenticate()
+	if errors.Is(err, models.ErrUnauthorized) {
+		limiter.Allow(key, time.Now())
+	}
+
+	return principal, 0, err
+}
+
+// seconds - округление времени вверх до секунд для заголовков ответа.
+//
+// Принимает: время.
+//
+// Возвращает: количество секунд.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,155 @@
+// ratelimit - пакет, реализующий ограничение частоты запросов клиентов по алгоритму token bucket.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Class - класс маршрутов, запросы к которым ограничиваются совместно.
+type Class string
+
+// Классы маршрутов.
+const (
+	ClassRead  Class = "read"  // ClassRead - получение данных.
+	ClassWrite Class = "write" // ClassWrite - изменение пользователей и их сегментов.
+	ClassAdmin Class = "admin" // ClassAdmin - создание, изменение и удаление сегментов, управление ключами API.
+	ClassAuth  Class = "auth"  // ClassAuth - неудачные попытки аутентификации с одного IP адреса.
+)
+
+// Limit - структура, описывающая ограничение частоты запросов одного клиента.
+type Limit struct {
+	Rate  float64 // Rate - средняя допустимая частота запросов в секунду.
+	Burst int     // Burst - максимальное количество запросов подряд (ёмкость корзины).
+}
+
+// Result - структура, описывающая результат проверки запроса.
+type Result struct {
+	Allowed    bool          // Allowed - флаг разрешения запроса.
+	Limit      int           // Limit - ёмкость корзины.
+	Remaining  int           // Remaining - количество запросов, которые можно выполнить сразу.
+	Reset      time.Duration // Reset - время, через которое корзина заполнится полностью.
+	RetryAfter time.Duration // RetryAfter - время, через которое запрос будет разрешён (0, если запрос разрешён).
+}
+
+// sweepInterval - период удаления корзин клиентов, которые заполнились и поэтому не отличаются от новых.
+const sweepInterval = time.Minute
+
+// bucket - структура, описывающая корзину клиента.
+type bucket struct {
+	tokens  float64   // tokens - количество запросов в корзине на момент updated.
+	updated time.Time // updated - время последнего пересчёта корзины.
+}
+
+// Limiter - ограничитель частоты запросов клиентов: у каждого клиента своя корзина.
+// Все методы безопасны для одновременного вызова из нескольких горутин.
+type Limiter struct {
+	limit   Limit              // limit - ограничение частоты запросов.
+	mu      sync.Mutex         // mu - мьютекс, защищающий корзины.
+	buckets map[string]*bucket // buckets - корзины по ключам клиентов.
+	swept   time.Time          // swept - время последнего удаления заполнившихся корзин.
+}
+
+// New - создание ограничителя частоты запросов.
+//
+// Принимает ограничение (Rate и Burst должны быть положительными).
+//
+// Возвращает ограничитель.
+func New(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow - проверка и учёт запроса клиента.
+// Новый клиент получает полную корзину; отклонённый запрос не расходует корзину.
+//
+// Принимает ключ клиента и время запроса.
+//
+// Возвращает результат проверки.
+func (l *Limiter) Allow(key string, now time.Time) Result {
+	return l.take(key, now, true)
+}
+
+// Check - проверка запроса клиента без учёта: корзина не расходуется, даже если запрос разрешён.
+//
+// Принимает ключ клиента и время запроса.
+//
+// Возвращает результат проверки.
+func (l *Limiter) Check(key string, now time.Time) Result {
+	return l.take(key, now, false)
+}
+
+// take - проверка запроса клиента и, если требуется, его учёт.
+//
+// Принимает ключ клиента, время запроса и флаг учёта разрешённого запроса.
+//
+// Возвращает результат проверки.
+func (l *Limiter) take(key string, now time.Time, consume bool) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	burst := float64(l.limit.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+
+	result := Result{Limit: l.limit.Burst}
+	if b.tokens >= 1 {
+		if consume {
+			b.tokens--
+		}
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(1 - b.tokens)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = l.duration(burst - b.tokens)
+
+	return result
+}
+
+// refill - получение количества запросов в корзине с учётом прошедшего времени.
+//
+// Принимает корзину и текущее время.
+//
+// Возвращает количество запросов, не превышающее ёмкость корзины.
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return math.Min(float64(l.limit.Burst), b.tokens+elapsed*l.limit.Rate)
+}
+
+// duration - получение времени накопления запросов в корзине.
+//
+// Принимает количество запросов.
+//
+// Возвращает время.
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.limit.Rate * float64(time.Second))
+}
+
+// sweep - удаление заполнившихся корзин.
+//
+// Принимает текущее время.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
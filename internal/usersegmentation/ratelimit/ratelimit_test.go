@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test_Allow - тестирование расходования и пополнения корзины.
+func Test_Allow(t *testing.T) {
+	l := New(Limit{Rate: 2, Burst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		result := l.Allow("client", now)
+		if !result.Allowed || result.Limit != 3 || result.Remaining != 2-i {
+			t.Errorf("request %d: got %+v", i, result)
+		}
+	}
+	result := l.Allow("client", now)
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 500*time.Millisecond || result.Reset != 1500*time.Millisecond {
+		t.Errorf("got %+v, expected the request to be rejected", result)
+	}
+
+	if other := l.Allow("other", now); !other.Allowed || other.Remaining != 2 {
+		t.Errorf("got %+v for another client, expected its own bucket", other)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if result = l.Allow("client", now); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("got %+v after refilling one request", result)
+	}
+	if result = l.Allow("client", now); result.Allowed {
+		t.Errorf("got %+v, expected the request to be rejected", result)
+	}
+
+	now = now.Add(time.Hour)
+	if result = l.Allow("client", now); !result.Allowed || result.Remaining != 2 || result.Reset != 500*time.Millisecond {
+		t.Errorf("got %+v after refilling the whole bucket", result)
+	}
+}
+
+// Test_Check - тестирование проверки запроса без расходования корзины.
+func Test_Check(t *testing.T) {
+	l := New(Limit{Rate: 1, Burst: 2})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if result := l.Check("client", now); !result.Allowed || result.Remaining != 2 {
+			t.Errorf("check %d: got %+v", i, result)
+		}
+	}
+	l.Allow("client", now)
+	l.Allow("client", now)
+	if result := l.Check("client", now); result.Allowed || result.RetryAfter != time.Second {
+		t.Errorf("got %+v, expected the request to be rejected", result)
+	}
+}
+
+// Test_Sweep - тестирование удаления заполнившихся корзин.
+func Test_Sweep(t *testing.T) {
+	l := New(Limit{Rate: 0.1, Burst: 10})
+	now := time.Now()
+	l.Allow("idle", now)
+	for i := 0; i < 10; i++ {
+		l.Allow("busy", now)
+	}
+
+	l.Allow("new", now.Add(sweepInterval-time.Second))
+	if len(l.buckets) != 3 {
+		t.Fatalf("got %d buckets before sweeping, expected 3", len(l.buckets))
+	}
+	l.Allow("new", now.Add(sweepInterval))
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("bucket that is not full was swept")
+	}
+}
+
+// Test_Concurrent - тестирование одновременных запросов одного клиента.
+func Test_Concurrent(t *testing.T) {
+	l := New(Limit{Rate: 0.001, Burst: 50})
+	now := time.Now()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.Allow("client", now).Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 50 {
+		t.Errorf("got %d allowed requests, expected 50", allowed)
+	}
+}
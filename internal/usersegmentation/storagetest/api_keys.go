@@ -0,0 +1,169 @@
+package storagetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// APIKeyFactory - функция создания хранилища ключей API для одного теста.
+// Хранилище должно быть пустым.
+//
+// Принимает: тест.
+//
+// Возвращает: хранилище ключей API.
+type APIKeyFactory func(t *testing.T) models.APIKeyStore
+
+// RunAPIKeys - запуск набора тестов поведения хранилища ключей API.
+// Тесты выполняются последовательно, каждый - на новом хранилище, созданном newStore.
+//
+// Принимает: тест и функцию создания хранилища.
+func RunAPIKeys(t *testing.T, newStore APIKeyFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, newStore APIKeyFactory)
+	}{
+		{"Lifecycle", testAPIKeyLifecycle},
+		{"Usage", testAPIKeyUsage},
+		{"NotFound", testAPIKeyNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStore)
+		})
+	}
+}
+
+// testAPIKeyLifecycle - создание, получение по хешу, изменение времени истечения и отзыв ключей.
+func testAPIKeyLifecycle(t *testing.T, newStore APIKeyFactory) {
+	s := newStore(t)
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	first := mustAddAPIKey(t, s, models.NewAPIKey{Hash: []byte("hash1"), Prefix: "usk_1", Name: "crm", Role: "editor"})
+	second := mustAddAPIKey(t, s, models.NewAPIKey{Hash: []byte("hash2"), Prefix: "usk_2", Name: "mobile", Role: "reader", ExpiresAt: &expiresAt})
+	if first.ID == second.ID {
+		t.Errorf("api keys got the same id %d", first.ID)
+	}
+	if first.Name != "crm" || first.Prefix != "usk_1" || first.Role != "editor" || first.ExpiresAt != nil || first.CreatedAt.IsZero() {
+		t.Errorf("got added key %+v", first)
+	}
+	if second.ExpiresAt == nil || !second.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("got expires_at %v, expected %v", second.ExpiresAt, expiresAt)
+	}
+
+	if _, err := s.AddAPIKey(ctx, models.NewAPIKey{Hash: []byte("hash1"), Prefix: "usk_1", Name: "copy", Role: "reader"}); err == nil {
+		t.Error("expected adding a key with the same hash to fail")
+	}
+
+	got, err := s.GetAPIKeyByHash(ctx, []byte("hash2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != second.ID || got.Name != "mobile" || !got.Active(time.Now()) {
+		t.Errorf("got key %+v by hash, expected active key %d", got, second.ID)
+	}
+
+	if err = s.SetAPIKeyExpiry(ctx, second.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RevokeAPIKey(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	revoked := apiKey(t, s, first.ID)
+	if revoked.RevokedAt == nil || revoked.Active(time.Now()) {
+		t.Errorf("got key %+v, expected it to be revoked", revoked)
+	}
+	if err = s.RevokeAPIKey(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if again := apiKey(t, s, first.ID); again.RevokedAt == nil || !again.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Errorf("got revoked_at %v after the second revocation, expected %v", again.RevokedAt, revoked.RevokedAt)
+	}
+	if unexpired := apiKey(t, s, second.ID); unexpired.ExpiresAt != nil {
+		t.Errorf("got expires_at %v, expected the key to never expire", unexpired.ExpiresAt)
+	}
+
+	keys, err := s.GetAPIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != first.ID || keys[1].ID != second.ID {
+		t.Errorf("got keys %+v, expected keys %d and %d", keys, first.ID, second.ID)
+	}
+}
+
+// testAPIKeyUsage - увеличение количества использований и неубывание времени последнего использования.
+func testAPIKeyUsage(t *testing.T, newStore APIKeyFactory) {
+	s := newStore(t)
+	key := mustAddAPIKey(t, s, models.NewAPIKey{Hash: []byte("hash"), Prefix: "usk_", Name: "crm", Role: "reader"})
+	if key.LastUsedAt != nil || key.UsageCount != 0 {
+		t.Errorf("got new key %+v, expected it to be unused", key)
+	}
+
+	later := time.Now().UTC().Truncate(time.Second)
+	earlier := later.Add(-time.Minute)
+	for _, usage := range []map[int]models.APIKeyUsage{
+		{key.ID: {Count: 3, LastUsed: later}},
+		{key.ID: {Count: 2, LastUsed: earlier}, key.ID + 1000: {Count: 1, LastUsed: later}},
+		{},
+	} {
+		if err := s.RecordAPIKeyUsage(ctx, usage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := apiKey(t, s, key.ID)
+	if got.UsageCount != 5 {
+		t.Errorf("got usage count %d, expected 5", got.UsageCount)
+	}
+	if got.LastUsedAt == nil || !got.LastUsedAt.Equal(later) {
+		t.Errorf("got last_used_at %v, expected %v", got.LastUsedAt, later)
+	}
+}
+
+// testAPIKeyNotFound - ошибки при обращении к несуществующим ключам.
+func testAPIKeyNotFound(t *testing.T, newStore APIKeyFactory) {
+	s := newStore(t)
+
+	if _, err := s.GetAPIKeyByHash(ctx, []byte("unknown")); !errors.Is(err, models.ErrAPIKeyNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrAPIKeyNotFound)
+	}
+	if err := s.RevokeAPIKey(ctx, 1); !errors.Is(err, models.ErrAPIKeyNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrAPIKeyNotFound)
+	}
+	if err := s.SetAPIKeyExpiry(ctx, 1, nil); !errors.Is(err, models.ErrAPIKeyNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrAPIKeyNotFound)
+	}
+	if keys, err := s.GetAPIKeys(ctx); err != nil || len(keys) != 0 {
+		t.Errorf("got keys %+v and err = %v, expected no keys", keys, err)
+	}
+}
+
+// mustAddAPIKey - добавление ключа API с завершением теста при ошибке.
+func mustAddAPIKey(t *testing.T, s models.APIKeyStore, key models.NewAPIKey) models.APIKey {
+	t.Helper()
+	added, err := s.AddAPIKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return added
+}
+
+// apiKey - получение ключа API по id из списка всех ключей.
+func apiKey(t *testing.T, s models.APIKeyStore, id int) models.APIKey {
+	t.Helper()
+	keys, err := s.GetAPIKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			return key
+		}
+	}
+	t.Fatalf("api key %d not found", id)
+	return models.APIKey{}
+}
@@ -0,0 +1,670 @@
+// storagetest - пакет, содержащий общий набор тестов поведения хранилищ сегментирования пользователей.
+//
+// Набор проверяет реализацию models.UserSegmentationDbProcessor только через интерфейс,
+// поэтому запускается для каждого хранилища одинаково:
+//
+//	func Test_Conformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T, strictUsers bool) models.UserSegmentationDbProcessor {
+//			return memory.GetModel(strictUsers)
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/internal/usersegmentation/models"
+)
+
+// ctx - контекст вызовов хранилища в тестах.
+var ctx = context.Background()
+
+// Factory - функция создания хранилища для одного теста.
+// Хранилище должно быть пустым: без сегментов, пользователей и истории.
+//
+// Принимает: тест и флаг строгого режима хранилища.
+//
+// Возвращает: хранилище.
+type Factory func(t *testing.T, strictUsers bool) models.UserSegmentationDbProcessor
+
+// Run - запуск набора тестов поведения хранилища.
+// Тесты выполняются последовательно, каждый - на новом хранилище, созданном newStorage.
+//
+// Принимает: тест и функцию создания хранилища.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, newStorage Factory)
+	}{
+		{"Segments", testSegments},
+		{"SegmentsListing", testSegmentsListing},
+		{"SegmentMembers", testSegmentMembers},
+		{"Rollout", testRollout},
+		{"DeleteSegment", testDeleteSegment},
+		{"RestoreAndPurge", testRestoreAndPurge},
+		{"ModifyUser", testModifyUser},
+		{"ModifyUserAtomic", testModifyUserAtomic},
+		{"Expiry", testExpiry},
+		{"StrictUsers", testStrictUsers},
+		{"ModifyUsers", testModifyUsers},
+		{"Users", testUsers},
+		{"History", testHistory},
+		{"ConcurrentModifications", testConcurrentModifications},
+		{"CancelledContext", testCancelledContext},
+		{"Stats", testStats},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStorage)
+		})
+	}
+}
+
+// testSegments - создание, получение и изменение сегментов, отказ в создании сегмента с тем же названием.
+func testSegments(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+
+	first := mustAddSegment(t, s, "conformance1", 0)
+	second := mustAddSegment(t, s, "conformance2", 0)
+	if first == second {
+		t.Errorf("segments got the same id %d", first)
+	}
+
+	if _, err := s.AddSegment(ctx, "conformance1", 0); !errors.Is(err, models.ErrSegmentExists) {
+		t.Errorf("duplicate slug: got err = %v, expected %v", err, models.ErrSegmentExists)
+	}
+	if _, err := s.AddSegment(ctx, "", 0); !errors.Is(err, models.ErrInvalidSlug) {
+		t.Errorf("empty slug: got err = %v, expected %v", err, models.ErrInvalidSlug)
+	}
+
+	segment, err := s.GetSegment(ctx, "conformance1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segment.ID != first || segment.Slug != "conformance1" || segment.Members != 0 || segment.Description != "" || segment.OwnerTeam != "" {
+		t.Errorf("got segment: %+v", segment)
+	}
+
+	description, ownerTeam := "description", "team"
+	if err = s.UpdateSegment(ctx, "conformance1", models.SegmentUpdate{Description: &description}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.UpdateSegment(ctx, "conformance1", models.SegmentUpdate{OwnerTeam: &ownerTeam}); err != nil {
+		t.Fatal(err)
+	}
+	if segment, _ = s.GetSegment(ctx, "conformance1"); segment.Description != description || segment.OwnerTeam != ownerTeam {
+		t.Errorf("got segment after update: %+v", segment)
+	}
+
+	if _, err = s.GetSegment(ctx, "unknown"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("unknown segment: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	if err = s.UpdateSegment(ctx, "unknown", models.SegmentUpdate{Description: &description}); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("update of unknown segment: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+}
+
+// testSegmentsListing - получение списка сегментов по префиксу с ограничением и смещением.
+func testSegmentsListing(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	for _, slug := range []string{"listb", "other", "lista", "listc", "listd"} {
+		mustAddSegment(t, s, slug, 0)
+	}
+	mustDeleteSegment(t, s, "listd")
+
+	cases := []struct {
+		prefix   string
+		limit    int
+		offset   int
+		expected []string
+	}{
+		{"", 10, 0, []string{"lista", "listb", "listc", "other"}},
+		{"list", 10, 0, []string{"lista", "listb", "listc"}},
+		{"list", 1, 1, []string{"listb"}},
+		{"list", 10, 10, []string{}},
+		{"none", 10, 0, []string{}},
+	}
+	for _, c := range cases {
+		segments, err := s.GetSegments(ctx, c.prefix, c.limit, c.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			got = append(got, segment.Slug)
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("prefix = %q, limit = %d, offset = %d: got segments %v, expected %v", c.prefix, c.limit, c.offset, got, c.expected)
+		}
+	}
+}
+
+// testSegmentMembers - получение пользователей сегмента по курсору.
+func testSegmentMembers(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "members", 0)
+	for _, id := range []int{5, 1, 4, 2, 3} {
+		mustModify(t, s, id, adds("members"), nil)
+	}
+	expired := time.Now().Add(-time.Hour)
+	mustModify(t, s, 6, []models.SegmentAddition{{Slug: "members", ExpiresAt: &expired}}, nil)
+
+	if got := members(t, s, "members", 0, 0); !reflect.DeepEqual(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("got members %v, expected [1 2 3 4 5]", got)
+	}
+	if got := members(t, s, "members", 2, 2); !reflect.DeepEqual(got, []int{3, 4}) {
+		t.Errorf("got members %v, expected [3 4]", got)
+	}
+	if segment, _ := s.GetSegment(ctx, "members"); segment.Members != 5 {
+		t.Errorf("got %d members, expected 5", segment.Members)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err := s.GetSegmentMembers(ctx, "members", 0, 0, func(models.Member) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("got err = %v after %d members, expected handler error after 1 member", err, count)
+	}
+
+	err = s.GetSegmentMembers(ctx, "unknown", 0, 0, func(models.Member) error {
+		t.Error("handler was called for unknown segment")
+		return nil
+	})
+	if !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("unknown segment: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+}
+
+// testRollout - автоматическое добавление зарегистрированных и новых пользователей в сегмент.
+func testRollout(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	for id := 1; id <= 50; id++ {
+		mustAddUser(t, s, id)
+	}
+
+	mustAddSegment(t, s, "rollout", 50)
+	for id := 51; id <= 100; id++ {
+		mustAddUser(t, s, id)
+	}
+
+	expected := make([]int, 0)
+	for id := 1; id <= 100; id++ {
+		if models.InRollout(id, "rollout", 50) {
+			expected = append(expected, id)
+		}
+	}
+	if got := members(t, s, "rollout", 0, 0); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got members %v, expected %v", got, expected)
+	}
+}
+
+// testDeleteSegment - удаление сегмента вместе с членствами пользователей в нём.
+func testDeleteSegment(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "deleted", 0)
+	mustAddSegment(t, s, "kept", 0)
+	mustModify(t, s, 1, adds("deleted", "kept"), nil)
+
+	mustDeleteSegment(t, s, "deleted")
+	if err := s.DeleteSegment(ctx, "unknown"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("deletion of unknown segment: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	if err := s.DeleteSegment(ctx, "deleted"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("repeated deletion: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+
+	if _, err := s.GetSegment(ctx, "deleted"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("deleted segment: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	if got := relations(t, s, 1); !reflect.DeepEqual(got, []string{"kept"}) {
+		t.Errorf("got relations %v, expected [kept]", got)
+	}
+	report, err := s.ModifyUser(ctx, 1, adds("deleted"), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := statuses("deleted", models.StatusUnknown); !reflect.DeepEqual(report.Append, expected) {
+		t.Errorf("modification of deleted segment: got %+v, expected %+v", report.Append, expected)
+	}
+	if _, err = s.AddSegment(ctx, "deleted", 0); !errors.Is(err, models.ErrSegmentExists) {
+		t.Errorf("slug of deleted segment: got err = %v, expected %v", err, models.ErrSegmentExists)
+	}
+}
+
+// testRestoreAndPurge - восстановление удалённого сегмента и окончательное удаление сегментов.
+func testRestoreAndPurge(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "restored", 0)
+	mustAddSegment(t, s, "purged", 0)
+	expired := time.Now().Add(-time.Hour)
+	mustModify(t, s, 1, adds("restored", "purged"), nil)
+	mustModify(t, s, 2, []models.SegmentAddition{{Slug: "restored", ExpiresAt: &expired}}, nil)
+	mustDeleteSegment(t, s, "restored")
+	mustDeleteSegment(t, s, "purged")
+
+	if err := s.RestoreSegment(ctx, "restored"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RestoreSegment(ctx, "restored"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("restore of active segment: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	if got := members(t, s, "restored", 0, 0); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("got members of restored segment %v, expected [1]", got)
+	}
+
+	if n, err := s.PurgeDeleted(ctx, time.Now().Add(-24*time.Hour)); err != nil || n != 0 {
+		t.Errorf("purge of recently deleted segments: got n = %d, err = %v, expected nothing purged", n, err)
+	}
+	if n, err := s.PurgeDeleted(ctx, time.Now().Add(24*time.Hour)); err != nil || n != 1 {
+		t.Errorf("got n = %d, err = %v, expected 1 purged segment", n, err)
+	}
+	if err := s.RestoreSegment(ctx, "purged"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("restore of purged segment: got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+
+	mustAddSegment(t, s, "purged", 0)
+	if got := members(t, s, "purged", 0, 0); len(got) != 0 {
+		t.Errorf("recreated segment has members of purged one: %v", got)
+	}
+	if got := relations(t, s, 1); !reflect.DeepEqual(got, []string{"restored"}) {
+		t.Errorf("got relations %v, expected [restored]", got)
+	}
+}
+
+// testModifyUser - статусы изменения сегментов пользователя и идемпотентность добавления.
+func testModifyUser(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+	mustAddSegment(t, s, "b", 0)
+	mustAddSegment(t, s, "c", 0)
+
+	report, err := s.ModifyUser(ctx, 1, adds("a", "b"), []string{"c"}, false)
+	expected := models.ModificationReport{
+		Append: append(statuses("a", models.StatusAdded), statuses("b", models.StatusAdded)...),
+		Remove: statuses("c", models.StatusNotMember),
+	}
+	if err != nil || !reflect.DeepEqual(report, expected) {
+		t.Errorf("got report = %+v, err = %v, expected %+v", report, err, expected)
+	}
+
+	report, err = s.ModifyUser(ctx, 1, adds("a", "a"), []string{"b"}, false)
+	expected = models.ModificationReport{
+		Append: append(statuses("a", models.StatusAlreadyPresent), statuses("a", models.StatusAlreadyPresent)...),
+		Remove: statuses("b", models.StatusRemoved),
+	}
+	if err != nil || !reflect.DeepEqual(report, expected) {
+		t.Errorf("got report = %+v, err = %v, expected %+v", report, err, expected)
+	}
+	if got := relations(t, s, 1); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("got relations %v, expected [a]", got)
+	}
+
+	report, err = s.ModifyUser(ctx, 1, adds("b", "x"), []string{"y"}, true)
+	expected = models.ModificationReport{
+		Append: append(statuses("b", models.StatusAdded), statuses("x", models.StatusUnknown)...),
+		Remove: statuses("y", models.StatusUnknown),
+	}
+	if err != nil || !reflect.DeepEqual(report, expected) {
+		t.Errorf("partial modification: got report = %+v, err = %v, expected %+v", report, err, expected)
+	}
+	if got := relations(t, s, 1); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got relations %v, expected [a b]", got)
+	}
+
+	if got := relations(t, s, 2); len(got) != 0 {
+		t.Errorf("unknown user has relations: %v", got)
+	}
+}
+
+// testModifyUserAtomic - отказ от всех изменений пользователя, если какой-либо из сегментов не существует.
+func testModifyUserAtomic(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+	mustAddSegment(t, s, "b", 0)
+	mustModify(t, s, 1, adds("a"), nil)
+
+	_, err := s.ModifyUser(ctx, 1, adds("b", "x"), []string{"a"}, false)
+	if !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	if got := relations(t, s, 1); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("got relations %v after failed modification, expected [a]", got)
+	}
+
+	if _, err = s.ModifyUser(ctx, 2, adds("x"), nil, false); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	users, err := s.GetUsers(ctx, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != 1 {
+		t.Errorf("failed modification registered the user: got users %+v", users)
+	}
+}
+
+// testExpiry - членства с истёкшим временем не возвращаются и удаляются DeleteExpired.
+func testExpiry(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+	mustAddSegment(t, s, "b", 0)
+	expired, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	mustModify(t, s, 1, []models.SegmentAddition{{Slug: "a", ExpiresAt: &expired}, {Slug: "b", ExpiresAt: &future}}, nil)
+	got, err := s.GetUserRelations(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Slug != "b" || got[0].ExpiresAt == nil || got[0].ExpiresAt.Sub(future).Abs() > time.Millisecond {
+		t.Errorf("got relations %+v, expected only b expiring at %v", got, future)
+	}
+
+	report, err := s.ModifyUser(ctx, 1, adds("a"), nil, false)
+	if expected := statuses("a", models.StatusAdded); err != nil || !reflect.DeepEqual(report.Append, expected) {
+		t.Errorf("re-adding after expiry: got %+v, err = %v, expected %+v", report.Append, err, expected)
+	}
+
+	mustModify(t, s, 2, []models.SegmentAddition{{Slug: "a", ExpiresAt: &expired}, {Slug: "b", ExpiresAt: &expired}}, nil)
+	// Истёкшее членство в удалённом сегменте удаляется и учитывается, хотя в историю не записывается.
+	mustAddSegment(t, s, "c", 0)
+	mustModify(t, s, 3, []models.SegmentAddition{{Slug: "c", ExpiresAt: &expired}}, nil)
+	mustDeleteSegment(t, s, "c")
+	if n, err := s.DeleteExpired(ctx); err != nil || n != 3 {
+		t.Errorf("got n = %d, err = %v, expected 3 expired relations", n, err)
+	}
+	if n, err := s.DeleteExpired(ctx); err != nil || n != 0 {
+		t.Errorf("got n = %d, err = %v, expected no expired relations", n, err)
+	}
+}
+
+// testStrictUsers - отказ в изменении сегментов незарегистрированного пользователя в строгом режиме.
+func testStrictUsers(t *testing.T, newStorage Factory) {
+	s := newStorage(t, true)
+	mustAddSegment(t, s, "a", 0)
+
+	if _, err := s.ModifyUser(ctx, 1, adds("a"), nil, false); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrUserNotFound)
+	}
+
+	mustAddUser(t, s, 1)
+	mustModify(t, s, 1, adds("a"), nil)
+	if got := relations(t, s, 1); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("got relations %v, expected [a]", got)
+	}
+}
+
+// testModifyUsers - массовое изменение сегментов пользователей с пропуском неприменимых изменений.
+func testModifyUsers(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+	mustAddSegment(t, s, "b", 0)
+
+	mods := make([]models.UserModification, 0)
+	for id := 1; id <= 1500; id++ {
+		mods = append(mods, models.UserModification{ID: models.ID{Value: id}, Append: adds("a")})
+	}
+	mods = append(mods,
+		models.UserModification{ID: models.ID{Value: 1}, Append: adds("x")},
+		models.UserModification{ID: models.ID{Value: 2}, Append: adds("b", "x"), Remove: []string{"a"}, Partial: true},
+	)
+
+	report, err := s.ModifyUsers(ctx, mods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Applied != 1501 || len(report.Failed) != 1 || report.Failed[0].ID != 1 || report.Failed[0].Code != models.CodeSegmentNotFound {
+		t.Errorf("got report: %+v", report)
+	}
+
+	if segment, _ := s.GetSegment(ctx, "a"); segment.Members != 1499 {
+		t.Errorf("got %d members of a, expected 1499", segment.Members)
+	}
+	if got := relations(t, s, 2); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("got relations %v, expected [b]", got)
+	}
+}
+
+// testUsers - регистрация, получение и удаление пользователей вместе с их членствами.
+func testUsers(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+
+	for _, id := range []int{3, 1, 2} {
+		mustAddUser(t, s, id)
+	}
+	if err := s.AddUser(ctx, 1); !errors.Is(err, models.ErrUserExists) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrUserExists)
+	}
+
+	users, err := s.GetUsers(ctx, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != 2 || users[1].ID != 3 {
+		t.Errorf("got users %+v, expected users 2 and 3", users)
+	}
+
+	mustModify(t, s, 1, adds("a"), nil)
+	if err = s.DeleteUser(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteUser(ctx, 1); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrUserNotFound)
+	}
+	if got := members(t, s, "a", 0, 0); len(got) != 0 {
+		t.Errorf("deleted user is still a member: %v", got)
+	}
+}
+
+// testHistory - запись фактических добавлений и удалений в историю.
+func testHistory(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+	mustAddSegment(t, s, "b", 0)
+
+	mustModify(t, s, 1, adds("a", "b"), nil)
+	mustModify(t, s, 1, adds("a"), []string{"b"})
+	mustModify(t, s, 2, adds("a"), nil)
+	mustDeleteSegment(t, s, "a")
+
+	records, err := s.GetHistory(ctx, time.Now().Add(-24*time.Hour), time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(records))
+	for _, record := range records {
+		got = append(got, fmt.Sprintf("%d %s %s", record.UserID, record.Slug, record.Operation))
+	}
+	sort.Strings(got)
+	expected := []string{"1 a add", "1 a remove", "1 b add", "1 b remove", "2 a add", "2 a remove"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got history %v, expected %v", got, expected)
+	}
+
+	for i := 1; i < len(records); i++ {
+		if records[i].Time.Before(records[i-1].Time) {
+			t.Errorf("history is not ordered by time: %+v", records)
+			break
+		}
+	}
+}
+
+// testConcurrentModifications - одновременное изменение сегментов пользователей из нескольких горутин.
+func testConcurrentModifications(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+	mustAddSegment(t, s, "b", 0)
+
+	const workers = 20
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, 2*workers)
+	)
+	for id := 1; id <= workers; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if _, err := s.ModifyUser(ctx, id, adds("a", "b"), nil, false); err != nil {
+				errs <- err
+			}
+			if _, err := s.ModifyUser(ctx, 0, adds("a"), nil, false); err != nil {
+				errs <- err
+			}
+		}(id)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if segment, _ := s.GetSegment(ctx, "a"); segment.Members != workers+1 {
+		t.Errorf("got %d members of a, expected %d", segment.Members, workers+1)
+	}
+	if segment, _ := s.GetSegment(ctx, "b"); segment.Members != workers {
+		t.Errorf("got %d members of b, expected %d", segment.Members, workers)
+	}
+
+	records, err := s.GetHistory(ctx, time.Now().Add(-24*time.Hour), time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2*workers+1 {
+		t.Errorf("got %d history records, expected %d: repeated additions must not be recorded", len(records), 2*workers+1)
+	}
+}
+
+// testCancelledContext - отказ хранилища выполнять изменения с отменённым контекстом.
+func testCancelledContext(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := s.AddSegment(cancelled, "b", 0); err == nil {
+		t.Error("expected AddSegment to fail with cancelled context")
+	}
+	if _, err := s.ModifyUser(cancelled, 1, adds("a"), nil, false); err == nil {
+		t.Error("expected ModifyUser to fail with cancelled context")
+	}
+	if _, err := s.ModifyUsers(cancelled, []models.UserModification{{ID: models.ID{Value: 2}, Append: adds("a")}}); err == nil {
+		t.Error("expected ModifyUsers to fail with cancelled context")
+	}
+
+	if _, err := s.GetSegment(ctx, "b"); !errors.Is(err, models.ErrSegmentNotFound) {
+		t.Errorf("got err = %v, expected %v", err, models.ErrSegmentNotFound)
+	}
+	if segment, _ := s.GetSegment(ctx, "a"); segment.Members != 0 {
+		t.Errorf("got %d members of a, expected 0", segment.Members)
+	}
+}
+
+// testStats - общее количество сегментов, пользователей и членств без учёта удалённых сегментов.
+func testStats(t *testing.T, newStorage Factory) {
+	s := newStorage(t, false)
+	mustAddSegment(t, s, "a", 0)
+	mustAddSegment(t, s, "b", 0)
+	mustAddSegment(t, s, "deleted", 0)
+	mustAddUser(t, s, 3)
+	mustModify(t, s, 1, adds("a", "b", "deleted"), nil)
+	mustModify(t, s, 2, adds("a"), nil)
+	mustDeleteSegment(t, s, "deleted")
+
+	stats, err := s.GetStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := models.Stats{Segments: 2, DeletedSegments: 1, Users: 3, Memberships: 3}
+	if stats != expected {
+		t.Errorf("got stats: %+v\nexpected: %+v\n", stats, expected)
+	}
+}
+
+// adds - создание бессрочных добавлений в сегменты.
+func adds(slugs ...string) []models.SegmentAddition {
+	additions := make([]models.SegmentAddition, 0, len(slugs))
+	for _, slug := range slugs {
+		additions = append(additions, models.SegmentAddition{Slug: slug})
+	}
+	return additions
+}
+
+// statuses - создание результата изменения для одного сегмента.
+func statuses(slug string, status string) []models.SlugStatus {
+	return []models.SlugStatus{{Slug: slug, Status: status}}
+}
+
+// relations - получение упорядоченных названий сегментов пользователя.
+func relations(t *testing.T, s models.UserSegmentationDbProcessor, id int) []string {
+	t.Helper()
+	relations, err := s.GetUserRelations(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slugs := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		slugs = append(slugs, relation.Slug)
+	}
+	sort.Strings(slugs)
+	return slugs
+}
+
+// members - получение id пользователей сегмента.
+func members(t *testing.T, s models.UserSegmentationDbProcessor, slug string, after int, limit int) []int {
+	t.Helper()
+	ids := make([]int, 0)
+	err := s.GetSegmentMembers(ctx, slug, after, limit, func(member models.Member) error {
+		ids = append(ids, member.UserID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+// mustAddSegment - добавление сегмента с проверкой ошибки.
+func mustAddSegment(t *testing.T, s models.UserSegmentationDbProcessor, slug string, autoPercent int) int {
+	t.Helper()
+	id, err := s.AddSegment(ctx, slug, autoPercent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// mustDeleteSegment - удаление сегмента с проверкой ошибки.
+func mustDeleteSegment(t *testing.T, s models.UserSegmentationDbProcessor, slug string) {
+	t.Helper()
+	if err := s.DeleteSegment(ctx, slug); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustAddUser - регистрация пользователя с проверкой ошибки.
+func mustAddUser(t *testing.T, s models.UserSegmentationDbProcessor, id int) {
+	t.Helper()
+	if err := s.AddUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustModify - изменение сегментов пользователя с проверкой ошибки.
+func mustModify(t *testing.T, s models.UserSegmentationDbProcessor, id int, append []models.SegmentAddition, remove []string) {
+	t.Helper()
+	if _, err := s.ModifyUser(ctx, id, append, remove, false); err != nil {
+		t.Fatal(err)
+	}
+}
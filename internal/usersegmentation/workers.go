@@ -0,0 +1,104 @@
+package usersegmentation
+
+import (
+	"context"
+	"time"
+)
+
+// runExpiryWorker - периодическое удаление истёкших членств пользователей в сегментах.
+//
+// Принимает: контекст, при отмене которого удаление прекращается, период удаления.
+func (app *App) runExpiryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := app.dbProcessor.DeleteExpired(ctx)
+			if err != nil {
+				app.logger.Error("error while deleting expired relations", "error", err)
+				continue
+			}
+			if n > 0 {
+				app.logger.Info("deleted expired relations", "count", n)
+			}
+		}
+	}
+}
+
+// purgeInterval - период окончательного удаления сегментов, время хранения которых истекло.
+const purgeInterval = time.Hour
+
+// runPurgeWorker - периодическое окончательное удаление сегментов, удалённых раньше, чем время хранения назад.
+//
+// Принимает: контекст, при отмене которого удаление прекращается, период удаления, время хранения удалённых сегментов.
+func (app *App) runPurgeWorker(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := app.dbProcessor.PurgeDeleted(ctx, time.Now().Add(-retention))
+			if err != nil {
+				app.logger.Error("error while purging deleted segments", "error", err)
+				continue
+			}
+			if n > 0 {
+				app.logger.Info("purged deleted segments", "count", n)
+			}
+		}
+	}
+}
+
+// runStatsWorker - периодическое обновление метрик общего количества данных в хранилище.
+// Метрики обновляются сразу при запуске и затем с указанным периодом.
+//
+// Принимает: контекст, при отмене которого обновление прекращается, период обновления.
+func (app *App) runStatsWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := app.dbProcessor.GetStats(ctx)
+		if err != nil {
+			app.logger.Error("error while getting storage stats", "error", err)
+		} else {
+			app.options.Metrics.SetStats(stats)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// apiKeyUsageInterval - период сохранения использований ключей API в хранилище.
+const apiKeyUsageInterval = 10 * time.Second
+
+// runAPIKeyUsageWorker - периодическое сохранение использований ключей API в хранилище.
+// Использования, учтённые после остановки процесса, сохраняются в Run после завершения обработки запросов.
+//
+// Принимает: контекст, при отмене которого сохранение прекращается, период сохранения.
+func (app *App) runAPIKeyUsageWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.flushAPIKeyUsage(ctx); err != nil {
+				app.logger.Error("error while recording api keys usage", "error", err)
+			}
+		}
+	}
+}
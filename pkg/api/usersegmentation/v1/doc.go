@@ -0,0 +1,4 @@
+// Пакет с кодом gRPC сервиса сегментации пользователей, сгенерированным из api/usersegmentation/v1/usersegmentation.proto
+package usersegmentationv1
+
+//go:generate protoc -I ../../../../api --go_out=../../../.. --go_opt=module=github.com/famusovsky/AvitoTestTask --go-grpc_out=../../../.. --go-grpc_opt=module=github.com/famusovsky/AvitoTestTask usersegmentation/v1/usersegmentation.proto
@@ -0,0 +1,320 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: usersegmentation/v1/usersegmentation.proto
+
+package usersegmentationv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	UserSegmentation_AddSegment_FullMethodName         = "/usersegmentation.v1.UserSegmentation/AddSegment"
+	UserSegmentation_DeleteSegment_FullMethodName      = "/usersegmentation.v1.UserSegmentation/DeleteSegment"
+	UserSegmentation_ModifyUser_FullMethodName         = "/usersegmentation.v1.UserSegmentation/ModifyUser"
+	UserSegmentation_GetUserRelations_FullMethodName   = "/usersegmentation.v1.UserSegmentation/GetUserRelations"
+	UserSegmentation_ListSegmentMembers_FullMethodName = "/usersegmentation.v1.UserSegmentation/ListSegmentMembers"
+)
+
+// UserSegmentationClient is the client API for UserSegmentation service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// UserSegmentation is the gRPC counterpart of the HTTP API.
+//
+// Clients authenticate with the same credentials as over HTTP, passed in metadata:
+// "authorization: Bearer <token>" or "x-api-key: <key>". Required roles and rate limits are the same
+// as for the corresponding HTTP routes.
+//
+// Errors are returned with a status code matching the HTTP status of the same error and a
+// google.rpc.ErrorInfo detail whose reason is the error code of the HTTP API (e.g. "segment_not_found").
+type UserSegmentationClient interface {
+	// AddSegment adds a segment, as POST /segments. Requires the admin role.
+	AddSegment(ctx context.Context, in *AddSegmentRequest, opts ...grpc.CallOption) (*AddSegmentResponse, error)
+	// DeleteSegment deletes a segment, as DELETE /segments. Requires the admin role.
+	DeleteSegment(ctx context.Context, in *DeleteSegmentRequest, opts ...grpc.CallOption) (*DeleteSegmentResponse, error)
+	// ModifyUser adds the user to segments and removes it from segments, as PATCH /users. Requires the editor role.
+	ModifyUser(ctx context.Context, in *ModifyUserRequest, opts ...grpc.CallOption) (*ModifyUserResponse, error)
+	// GetUserRelations returns the segments the user is a member of, as GET /users/{id}. Requires the reader role.
+	GetUserRelations(ctx context.Context, in *GetUserRelationsRequest, opts ...grpc.CallOption) (*GetUserRelationsResponse, error)
+	// ListSegmentMembers streams the members of a segment in ascending order of user ID, as GET /segments/{slug}/users.
+	// Requires the editor role.
+	ListSegmentMembers(ctx context.Context, in *ListSegmentMembersRequest, opts ...grpc.CallOption) (UserSegmentation_ListSegmentMembersClient, error)
+}
+
+type userSegmentationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUserSegmentationClient(cc grpc.ClientConnInterface) UserSegmentationClient {
+	return &userSegmentationClient{cc}
+}
+
+func (c *userSegmentationClient) AddSegment(ctx context.Context, in *AddSegmentRequest, opts ...grpc.CallOption) (*AddSegmentResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddSegmentResponse)
+	err := c.cc.Invoke(ctx, UserSegmentation_AddSegment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userSegmentationClient) DeleteSegment(ctx context.Context, in *DeleteSegmentRequest, opts ...grpc.CallOption) (*DeleteSegmentResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteSegmentResponse)
+	err := c.cc.Invoke(ctx, UserSegmentation_DeleteSegment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userSegmentationClient) ModifyUser(ctx context.Context, in *ModifyUserRequest, opts ...grpc.CallOption) (*ModifyUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ModifyUserResponse)
+	err := c.cc.Invoke(ctx, UserSegmentation_ModifyUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userSegmentationClient) GetUserRelations(ctx context.Context, in *GetUserRelationsRequest, opts ...grpc.CallOption) (*GetUserRelationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetUserRelationsResponse)
+	err := c.cc.Invoke(ctx, UserSegmentation_GetUserRelations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userSegmentationClient) ListSegmentMembers(ctx context.Context, in *ListSegmentMembersRequest, opts ...grpc.CallOption) (UserSegmentation_ListSegmentMembersClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserSegmentation_ServiceDesc.Streams[0], UserSegmentation_ListSegmentMembers_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &userSegmentationListSegmentMembersClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type UserSegmentation_ListSegmentMembersClient interface {
+	Recv() (*Member, error)
+	grpc.ClientStream
+}
+
+type userSegmentationListSegmentMembersClient struct {
+	grpc.ClientStream
+}
+
+func (x *userSegmentationListSegmentMembersClient) Recv() (*Member, error) {
+	m := new(Member)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UserSegmentationServer is the server API for UserSegmentation service.
+// All implementations must embed UnimplementedUserSegmentationServer
+// for forward compatibility
+//
+// UserSegmentation is the gRPC counterpart of the HTTP API.
+//
+// Clients authenticate with the same credentials as over HTTP, passed in metadata:
+// "authorization: Bearer <token>" or "x-api-key: <key>". Required roles and rate limits are the same
+// as for the corresponding HTTP routes.
+//
+// Errors are returned with a status code matching the HTTP status of the same error and a
+// google.rpc.ErrorInfo detail whose reason is the error code of the HTTP API (e.g. "segment_not_found").
+type UserSegmentationServer interface {
+	// AddSegment adds a segment, as POST /segments. Requires the admin role.
+	AddSegment(context.Context, *AddSegmentRequest) (*AddSegmentResponse, error)
+	// DeleteSegment deletes a segment, as DELETE /segments. Requires the admin role.
+	DeleteSegment(context.Context, *DeleteSegmentRequest) (*DeleteSegmentResponse, error)
+	// ModifyUser adds the user to segments and removes it from segments, as PATCH /users. Requires the editor role.
+	ModifyUser(context.Context, *ModifyUserRequest) (*ModifyUserResponse, error)
+	// GetUserRelations returns the segments the user is a member of, as GET /users/{id}. Requires the reader role.
+	GetUserRelations(context.Context, *GetUserRelationsRequest) (*GetUserRelationsResponse, error)
+	// ListSegmentMembers streams the members of a segment in ascending order of user ID, as GET /segments/{slug}/users.
+	// Requires the editor role.
+	ListSegmentMembers(*ListSegmentMembersRequest, UserSegmentation_ListSegmentMembersServer) error
+	mustEmbedUnimplementedUserSegmentationServer()
+}
+
+// UnimplementedUserSegmentationServer must be embedded to have forward compatible implementations.
+type UnimplementedUserSegmentationServer struct {
+}
+
+func (UnimplementedUserSegmentationServer) AddSegment(context.Context, *AddSegmentRequest) (*AddSegmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddSegment not implemented")
+}
+func (UnimplementedUserSegmentationServer) DeleteSegment(context.Context, *DeleteSegmentRequest) (*DeleteSegmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSegment not implemented")
+}
+func (UnimplementedUserSegmentationServer) ModifyUser(context.Context, *ModifyUserRequest) (*ModifyUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ModifyUser not implemented")
+}
+func (UnimplementedUserSegmentationServer) GetUserRelations(context.Context, *GetUserRelationsRequest) (*GetUserRelationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserRelations not implemented")
+}
+func (UnimplementedUserSegmentationServer) ListSegmentMembers(*ListSegmentMembersRequest, UserSegmentation_ListSegmentMembersServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListSegmentMembers not implemented")
+}
+func (UnimplementedUserSegmentationServer) mustEmbedUnimplementedUserSegmentationServer() {}
+
+// UnsafeUserSegmentationServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UserSegmentationServer will
+// result in compilation errors.
+type UnsafeUserSegmentationServer interface {
+	mustEmbedUnimplementedUserSegmentationServer()
+}
+
+func RegisterUserSegmentationServer(s grpc.ServiceRegistrar, srv UserSegmentationServer) {
+	s.RegisterService(&UserSegmentation_ServiceDesc, srv)
+}
+
+func _UserSegmentation_AddSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserSegmentationServer).AddSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserSegmentation_AddSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserSegmentationServer).AddSegment(ctx, req.(*AddSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserSegmentation_DeleteSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserSegmentationServer).DeleteSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserSegmentation_DeleteSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserSegmentationServer).DeleteSegment(ctx, req.(*DeleteSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserSegmentation_ModifyUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModifyUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserSegmentationServer).ModifyUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserSegmentation_ModifyUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserSegmentationServer).ModifyUser(ctx, req.(*ModifyUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserSegmentation_GetUserRelations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserRelationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserSegmentationServer).GetUserRelations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserSegmentation_GetUserRelations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserSegmentationServer).GetUserRelations(ctx, req.(*GetUserRelationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserSegmentation_ListSegmentMembers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListSegmentMembersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UserSegmentationServer).ListSegmentMembers(m, &userSegmentationListSegmentMembersServer{ServerStream: stream})
+}
+
+type UserSegmentation_ListSegmentMembersServer interface {
+	Send(*Member) error
+	grpc.ServerStream
+}
+
+type userSegmentationListSegmentMembersServer struct {
+	grpc.ServerStream
+}
+
+func (x *userSegmentationListSegmentMembersServer) Send(m *Member) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// UserSegmentation_ServiceDesc is the grpc.ServiceDesc for UserSegmentation service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UserSegmentation_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "usersegmentation.v1.UserSegmentation",
+	HandlerType: (*UserSegmentationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddSegment",
+			Handler:    _UserSegmentation_AddSegment_Handler,
+		},
+		{
+			MethodName: "DeleteSegment",
+			Handler:    _UserSegmentation_DeleteSegment_Handler,
+		},
+		{
+			MethodName: "ModifyUser",
+			Handler:    _UserSegmentation_ModifyUser_Handler,
+		},
+		{
+			MethodName: "GetUserRelations",
+			Handler:    _UserSegmentation_GetUserRelations_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListSegmentMembers",
+			Handler:       _UserSegmentation_ListSegmentMembers_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "usersegmentation/v1/usersegmentation.proto",
+}
@@ -2,42 +2,140 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/famusovsky/AvitoTestTask/pkg/logging"
 )
 
-// OpenViaEnvVars - открытие БД через переменные окружения.
-// Возвращает БД и ошибку.
-func OpenViaEnvVars(driver string) (*sql.DB, error) {
-	return OpenViaDsn(getDsnFromEnv(), driver)
+// Options - настройки открытия БД и пула соединений.
+type Options struct {
+	MaxOpenConns    int           // MaxOpenConns - максимальное количество открытых соединений (0 - без ограничения).
+	MaxIdleConns    int           // MaxIdleConns - максимальное количество простаивающих соединений (0 - значение database/sql по умолчанию).
+	ConnMaxLifetime time.Duration // ConnMaxLifetime - максимальное время жизни соединения (0 - без ограничения).
+	ConnMaxIdleTime time.Duration // ConnMaxIdleTime - максимальное время простоя соединения (0 - без ограничения).
+	ConnectTimeout  time.Duration // ConnectTimeout - время, в течение которого повторяются попытки подключения (0 - одна попытка).
+	InitialBackoff  time.Duration // InitialBackoff - пауза перед второй попыткой подключения, удваиваемая после каждой неудачной попытки.
+	MaxBackoff      time.Duration // MaxBackoff - максимальная пауза между попытками подключения.
 }
 
+// Значения настроек по умолчанию.
+const (
+	defaultInitialBackoff = 500 * time.Millisecond // defaultInitialBackoff - пауза перед второй попыткой подключения по умолчанию.
+	defaultMaxBackoff     = 10 * time.Second       // defaultMaxBackoff - максимальная пауза между попытками подключения по умолчанию.
+)
+
 // OpenViaDsn - открытие БД через строку DSN.
 // Принимает строку DSN.
 // Возвращает БД и ошибку.
 func OpenViaDsn(dsn string, driver string) (*sql.DB, error) {
+	return Open(context.Background(), driver, dsn, Options{})
+}
+
+// Open - открытие БД с повторными попытками подключения.
+// Пока не истечёт Options.ConnectTimeout или не будет отменён контекст, попытки подключения повторяются с экспоненциально растущей паузой.
+// Принимает контекст, драйвер, строку DSN и настройки.
+// Возвращает БД и ошибку.
+func Open(ctx context.Context, driver string, dsn string, options Options) (*sql.DB, error) {
 	if dsn == "" {
-		dsn = getDsnFromEnv()
+		return nil, errors.New("dsn must not be empty")
 	}
+	logger := logging.FromContext(ctx).With("dsn", RedactDSN(dsn))
 
 	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
-	if err = db.Ping(); err != nil {
+	db.SetMaxOpenConns(options.MaxOpenConns)
+	if options.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(options.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(options.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(options.ConnMaxIdleTime)
+
+	if err = connect(ctx, db, options, logger); err != nil {
+		db.Close()
 		return nil, err
 	}
+	logger.Info("connected to the database")
 
 	return db, nil
 }
 
-// getDsnFromEnv - получение строки DSN из переменных окружения.
-func getDsnFromEnv() string {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+// connect - проверка подключения к БД с повторными попытками.
+// Принимает контекст, БД, настройки и логгер.
+// Возвращает ошибку последней попытки.
+func connect(ctx context.Context, db *sql.DB, options Options, logger *slog.Logger) error {
+	backoff, maxBackoff := options.InitialBackoff, options.MaxBackoff
+	if backoff <= 0 {
+		backoff = defaultInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	deadline := time.Now().Add(options.ConnectTimeout)
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 || ctx.Err() != nil {
+			return fmt.Errorf("error while connecting to the database after %d attempts: %w", attempt, err)
+		}
+		wait = min(wait, backoff)
+		logger.Warn("database is not available, retrying", "attempt", attempt, "backoff", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("error while connecting to the database after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// ReadPasswordFile - чтение пароля из файла (например, секрета Docker или Kubernetes).
+// Принимает путь к файлу.
+// Возвращает содержимое файла без завершающего перевода строки и ошибку.
+func ReadPasswordFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error while reading password file: %s", err)
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// redacted - замена пароля в строке DSN.
+const redacted = "xxxxx"
+
+// dsnPassword - пароль в строке DSN в формате "key=value".
+var dsnPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
 
-	fmt.Println(dsn)
+// RedactDSN - скрытие пароля в строке DSN.
+// Принимает строку DSN в формате URL или "key=value".
+// Возвращает строку DSN, в которой пароль заменён на "xxxxx".
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if query := u.Query(); query.Get("password") != "" {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.Redacted()
+	}
 
-	return dsn
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
 }
@@ -0,0 +1,54 @@
+// Пакет для структурированного логирования
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// loggerKey - ключ логгера в контексте.
+type loggerKey struct{}
+
+// New - создание логгера.
+// Принимает поток вывода, формат (text или json) и минимальный уровень (debug, info, warn или error).
+// Возвращает логгер и ошибку.
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q: must be debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+
+	return nil, fmt.Errorf("unknown log format %q: must be text or json", format)
+}
+
+// WithLogger - сохранение логгера в контексте.
+// Принимает контекст и логгер.
+// Возвращает контекст с логгером.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext - получение логгера из контекста.
+// Принимает контекст.
+// Возвращает логгер, сохранённый в контексте, или slog.Default(), если его нет.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// Discard - логгер, не выводящий ничего.
+var Discard = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
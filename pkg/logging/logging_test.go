@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// Test_New - тестирование создания логгера.
+func Test_New(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(&buf, "json", "warn")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		logger.Info("skipped")
+		logger.Warn("written", "key", 1)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("got %d lines, expected 1: %s", len(lines), buf.String())
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["msg"] != "written" || record["level"] != "WARN" || record["key"] != float64(1) {
+			t.Errorf("got record: %v", record)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(&buf, "text", "DEBUG")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		logger.Debug("written")
+		if !strings.Contains(buf.String(), "level=DEBUG msg=written") {
+			t.Errorf("got: %s", buf.String())
+		}
+	})
+
+	t.Run("wrong format or level", func(t *testing.T) {
+		if _, err := New(&bytes.Buffer{}, "xml", "info"); err == nil {
+			t.Error("expected error for unknown format")
+		}
+		if _, err := New(&bytes.Buffer{}, "text", "verbose"); err == nil {
+			t.Error("expected error for unknown level")
+		}
+	})
+}
+
+// Test_FromContext - тестирование получения логгера из контекста.
+func Test_FromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != slog.Default() {
+		t.Errorf("got %v, expected default logger", got)
+	}
+
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	if got := FromContext(WithLogger(context.Background(), logger)); got != logger {
+		t.Errorf("got %v, expected %v", got, logger)
+	}
+}